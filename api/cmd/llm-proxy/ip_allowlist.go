@@ -6,6 +6,8 @@ import (
 	"net/http"
 	"net/netip"
 	"strings"
+
+	"llm-proxy/api/internal/util"
 )
 
 type clientIPFilter struct {
@@ -14,45 +16,20 @@ type clientIPFilter struct {
 }
 
 func newClientIPFilter(allowedClientsRaw, trustedProxiesRaw string) (*clientIPFilter, error) {
-	allowedClients, err := parsePrefixes(allowedClientsRaw)
+	allowedClients, err := util.ParsePrefixes(allowedClientsRaw)
 	if err != nil {
 		return nil, fmt.Errorf("parse allowed client CIDRs: %w", err)
 	}
 	if len(allowedClients) == 0 {
 		return nil, fmt.Errorf("allowed client CIDRs are empty")
 	}
-	trustedProxies, err := parsePrefixes(trustedProxiesRaw)
+	trustedProxies, err := util.ParsePrefixes(trustedProxiesRaw)
 	if err != nil {
 		return nil, fmt.Errorf("parse trusted proxy CIDRs: %w", err)
 	}
 	return &clientIPFilter{allowedClients: allowedClients, trustedProxies: trustedProxies}, nil
 }
 
-func parsePrefixes(raw string) ([]netip.Prefix, error) {
-	parts := strings.Split(raw, ",")
-	prefixes := make([]netip.Prefix, 0, len(parts))
-	for _, part := range parts {
-		value := strings.TrimSpace(part)
-		if value == "" {
-			continue
-		}
-		prefix, err := netip.ParsePrefix(value)
-		if err != nil {
-			address, addressErr := netip.ParseAddr(value)
-			if addressErr != nil {
-				return nil, fmt.Errorf("invalid CIDR or IP %q: %w", value, err)
-			}
-			bits := 128
-			if address.Is4() {
-				bits = 32
-			}
-			prefix = netip.PrefixFrom(address, bits)
-		}
-		prefixes = append(prefixes, prefix.Masked())
-	}
-	return prefixes, nil
-}
-
 func (f *clientIPFilter) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		clientIP, ok := f.clientIP(r)
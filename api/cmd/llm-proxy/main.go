@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/subtle"
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
@@ -13,16 +14,33 @@ import (
 	"time"
 
 	"llm-proxy/api/internal/config"
+	"llm-proxy/api/internal/metrics"
+	"llm-proxy/api/internal/util"
 	handle1 "llm-proxy/api/internal/v1/handle"
 	ocr1 "llm-proxy/api/internal/v1/ocr"
 	gemini1 "llm-proxy/api/internal/v1/ocr/gemini"
 	gpt1 "llm-proxy/api/internal/v1/ocr/gpt"
+	"llm-proxy/api/internal/v2/batch"
+	"llm-proxy/api/internal/v2/coalesce"
+	"llm-proxy/api/internal/v2/experiment"
 	handle2 "llm-proxy/api/internal/v2/handle"
+	"llm-proxy/api/internal/v2/imagefetch"
+	"llm-proxy/api/internal/v2/imagestore"
 	ocr2 "llm-proxy/api/internal/v2/ocr"
+	"llm-proxy/api/internal/v2/ocr/cassette"
+	"llm-proxy/api/internal/v2/ocr/ensemble"
+	fake2 "llm-proxy/api/internal/v2/ocr/fake"
 	gemini2 "llm-proxy/api/internal/v2/ocr/gemini"
 	gpt2 "llm-proxy/api/internal/v2/ocr/gpt"
+	"llm-proxy/api/internal/v2/ocr/leakguard"
 	mixed2 "llm-proxy/api/internal/v2/ocr/mixed"
 	or2 "llm-proxy/api/internal/v2/ocr/openrouter"
+	"llm-proxy/api/internal/v2/ocr/prescreen"
+	"llm-proxy/api/internal/v2/ocr/readability"
+	"llm-proxy/api/internal/v2/ocr/respcache"
+	"llm-proxy/api/internal/v2/ocr/safety"
+	"llm-proxy/api/internal/v2/ocr/shadow"
+	"llm-proxy/api/internal/v2/ocr/verify"
 	"llm-proxy/api/internal/v2/tmplrouter"
 )
 
@@ -47,21 +65,16 @@ func main() {
 	}
 	h1 := handle1.New(engines1)
 
-	gptV2 := gpt2.New(cfg.OpenAIAPIKey, cfg.OpenAIModel)
-	geminiV2 := gemini2.New(cfg.GeminiAPIKey, cfg.GeminiDetectModel, cfg.GeminiParseModel)
+	images := setupImages(cfg)
+	cassettes := newCassettes(cfg)
+	gptV2 := newGPT(cfg, cfg.OpenAIModel, images, cassettes("gpt"))
+	geminiV2 := newGemini(cfg, cfg.GeminiDetectModel, cfg.GeminiParseModel, images, cassettes("gemini"))
 	mixedV2 := mixed2.New(geminiV2, gptV2)
 
 	// OpenRouter инициализируется только если задан ключ.
-	// Модели для каждого шага берутся из env-переменных — без хардкода в коде.
 	var openRouterV2 ocr2.Engine
 	if cfg.OpenRouterAPIKey != "" {
-		openRouterV2 = or2.New(cfg.OpenRouterAPIKey, or2.StepModels{
-			Detect:   cfg.OpenRouterDetectModel,
-			Parse:    cfg.OpenRouterParseModel,
-			Hint:     cfg.OpenRouterHintModel,
-			Check:    cfg.OpenRouterCheckModel,
-			Analogue: cfg.OpenRouterAnalogueModel,
-		})
+		openRouterV2 = newOpenRouter(cfg, openRouterModels(cfg), images, cassettes("openrouter"))
 		log.Printf("OpenRouter engine initialized (detect=%s parse=%s hint=%s check=%s)",
 			cfg.OpenRouterDetectModel, cfg.OpenRouterParseModel,
 			cfg.OpenRouterHintModel, cfg.OpenRouterCheckModel)
@@ -78,14 +91,74 @@ func main() {
 		orEngine.SetTemplateRouter(tmplRouter)
 	}
 
+	// Фейковый движок включается только явно через конфиг.
+	var fakeV2 ocr2.Engine
+	if cfg.FakeEngineEnabled {
+		fakeV2 = fake2.New(fake2.Options{
+			Latency:   time.Duration(cfg.FakeLatencyMs) * time.Millisecond,
+			ErrorRate: cfg.FakeErrorRate,
+		})
+		log.Printf("Fake engine enabled (latency=%dms error_rate=%.2f)", cfg.FakeLatencyMs, cfg.FakeErrorRate)
+	}
+
 	engines2 := &ocr2.Engines{
 		OpenAI:         gptV2,
 		Gemini:         geminiV2,
 		Mixed:          mixedV2,
 		OpenRouter:     openRouterV2,
+		Fake:           fakeV2,
 		TemplateRouter: tmplRouter,
 	}
-	h2 := handle2.New(engines2)
+	if cfg.ResponseCacheSize > 0 {
+		setupResponseCache(cfg, engines2)
+	}
+	if cfg.CheckEnsembleSamples > 1 {
+		setupEnsemble(cfg, engines2, tmplRouter, images, cassettes)
+	}
+	if cfg.CheckVerifyModel != "" {
+		setupVerify(cfg, engines2, tmplRouter, images, cassettes)
+	}
+	if cfg.ShadowEngine != "" && cfg.ShadowSampleRate > 0 {
+		setupShadow(cfg, engines2, tmplRouter, images, cassettes)
+	}
+	child := newChildFacing(cfg)
+	setupChildFacing(child, engines2)
+	exps, err := experiment.Load(cfg.ExperimentsFile)
+	if err != nil {
+		log.Fatalf("EXPERIMENTS_FILE: %v", err)
+	}
+	expRouter, err := experiment.NewRouter(exps, variantEngineBuilder(cfg, engines2, tmplRouter, images, child, cassettes))
+	if err != nil {
+		log.Fatalf("experiments: %v", err)
+	}
+	if expRouter.Len() > 0 {
+		log.Printf("Experiments loaded: %d from %s", expRouter.Len(), cfg.ExperimentsFile)
+	}
+	h2 := handle2.New(engines2).WithExperiments(expRouter)
+	if cfg.ImageFetchEnabled {
+		h2.WithImageFetcher(setupImageFetch(cfg))
+	}
+	if cfg.ImageStoreDir != "" {
+		store, err := imagestore.New(imagestore.Options{
+			Dir:           cfg.ImageStoreDir,
+			TTL:           time.Duration(cfg.ImageStoreTTLSec) * time.Second,
+			MaxImageBytes: int64(cfg.ImageStoreMaxMB) << 20,
+			QuotaBytes:    int64(cfg.ImageStoreQuotaMB) << 20,
+		})
+		if err != nil {
+			log.Fatalf("IMAGE_STORE_DIR: %v", err)
+		}
+		h2.WithImageStore(store)
+		mux.HandleFunc("POST /v2/images", h2.UploadImage)
+		log.Printf("Image store enabled: dir=%s ttl=%ds max=%dMB quota=%dMB",
+			cfg.ImageStoreDir, cfg.ImageStoreTTLSec, cfg.ImageStoreMaxMB, cfg.ImageStoreQuotaMB)
+	}
+	if cfg.BatchDir != "" {
+		h2.WithBatch(setupBatch(cfg, tmplRouter, images, child))
+		mux.HandleFunc("POST /v2/batches", h2.SubmitBatch)
+		mux.HandleFunc("GET /v2/batches/{id}", h2.BatchStatus)
+		mux.HandleFunc("GET /v2/batches/{id}/results", h2.BatchResults)
+	}
 
 	mux.HandleFunc("/v1/detect", h1.Detect)
 	mux.HandleFunc("/v1/parse", h1.Parse)
@@ -106,15 +179,29 @@ func main() {
 	mux.HandleFunc("/v2/check_ru", h2.CheckRU)
 
 	mux.HandleFunc("/v2/embed", h2.Embed)
+	mux.HandleFunc("/v2/normalize_answer", h2.NormalizeAnswer)
+
+	mux.Handle("/metrics", metrics.Handler())
 	clientIPFilter, err := newClientIPFilter(cfg.AllowedClientCIDRs, cfg.TrustedProxyCIDRs)
 	if err != nil {
 		log.Fatalf("invalid client IP allowlist: %v", err)
 	}
 
+	var handler http.Handler = mux
+	if cfg.FakeEngineEnabled {
+		handler = fake2.Middleware(handler)
+	}
+	if cfg.ResponseCacheSize > 0 {
+		handler = respcache.Middleware(handler)
+	}
+	if cfg.CoalesceRequests {
+		handler = coalesce.New(handle2.MaxBodySize).Middleware(handler)
+	}
+
 	addr := ":" + cfg.Port
 	srv := &http.Server{
 		Addr:              addr,
-		Handler:           clientIPFilter.Middleware(serviceAuth(cfg.APIKey, mux)),
+		Handler:           clientIPFilter.Middleware(serviceAuth(cfg.APIKey, handler)),
 		ReadHeaderTimeout: 15 * time.Second,
 		ReadTimeout:       30 * time.Second,
 		WriteTimeout:      5*time.Minute + 15*time.Second,
@@ -143,6 +230,454 @@ func main() {
 	}
 }
 
+// setupImages регистрирует внешний декодер и собирает пайплайн предобработки
+// изображений; nil — предобработка выключена (перекодирование форматов,
+// которые провайдер не принимает, работает и без неё).
+func setupImages(cfg *config.Config) *util.ImagePipeline {
+	if args := strings.Fields(cfg.ImageDecoderCmd); len(args) > 0 {
+		for _, mime := range strings.Split(cfg.ImageDecoderFormats, ",") {
+			if mime = strings.TrimSpace(mime); mime != "" {
+				util.RegisterImageDecoder(mime, util.CommandDecoder{Args: args})
+			}
+		}
+		log.Printf("Image decoder enabled: %q for %s", cfg.ImageDecoderCmd, cfg.ImageDecoderFormats)
+	}
+	if !cfg.ImagePreprocess {
+		return nil
+	}
+	byModel, err := util.ParseImageMaxDims(cfg.ImageMaxDimByModel)
+	if err != nil {
+		log.Fatalf("IMAGE_MAX_DIM_BY_MODEL: %v", err)
+	}
+	p := &util.ImagePipeline{
+		Options: util.ImageOptions{
+			MaxDim:    cfg.ImageMaxDim,
+			Quality:   cfg.ImageJPEGQuality,
+			MaxBytes:  cfg.ImageMaxKB << 10,
+			Grayscale: cfg.ImageGrayscale,
+		},
+		MaxDimByModel: byModel,
+	}
+	log.Printf("Image preprocessing enabled: %s", p)
+	return p
+}
+
+// setupImageFetch настраивает загрузку изображений по URL.
+func setupImageFetch(cfg *config.Config) *imagefetch.Fetcher {
+	allow, err := util.ParsePrefixes(cfg.ImageFetchAllowCIDRs)
+	if err != nil {
+		log.Fatalf("IMAGE_FETCH_ALLOW_CIDRS: %v", err)
+	}
+	opts := imagefetch.Options{
+		MaxBytes:     int64(cfg.ImageFetchMaxKB) << 10,
+		Timeout:      time.Duration(cfg.ImageFetchTimeoutSec) * time.Second,
+		MaxRedirects: cfg.ImageFetchMaxRedirects,
+		Allow:        allow,
+		CacheBytes:   int64(cfg.ImageFetchCacheMB) << 20,
+	}
+	log.Printf("Image URL fetch enabled: max=%dKB timeout=%ds redirects=%d allow=%v cache=%dMB",
+		cfg.ImageFetchMaxKB, cfg.ImageFetchTimeoutSec, cfg.ImageFetchMaxRedirects, allow, cfg.ImageFetchCacheMB)
+	return imagefetch.New(opts)
+}
+
+// httpClients выдаёт HTTP-клиент провайдера по имени кассеты; nil — кассеты
+// выключены, и движок ходит в сеть своим клиентом.
+type httpClients func(name string) *http.Client
+
+// newCassettes включает запись или воспроизведение трафика к провайдерам
+// для воспроизводимых тестов и отладки без сети. Каждый экземпляр движка
+// получает свою кассету.
+func newCassettes(cfg *config.Config) httpClients {
+	mode, err := cassette.ParseMode(cfg.CassetteMode)
+	if err != nil {
+		log.Fatalf("LLM_CASSETTE_MODE: %v", err)
+	}
+	if mode == cassette.ModeOff {
+		return func(string) *http.Client { return nil }
+	}
+	log.Printf("cassette mode=%s dir=%s", mode, cfg.CassetteDir)
+	return func(name string) *http.Client {
+		c, err := cassette.NewClient(mode, cfg.CassetteDir, name)
+		if err != nil {
+			log.Fatalf("cassette %s: %v", name, err)
+		}
+		return c
+	}
+}
+
+// cassetteName собирает имя кассеты из частей; пустые части пропускаются.
+// Модели вида "openai/gpt-4o" не должны превращаться в подкаталоги.
+func cassetteName(parts ...string) string {
+	var nonEmpty []string
+	for _, p := range parts {
+		if p != "" {
+			nonEmpty = append(nonEmpty, p)
+		}
+	}
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' {
+			return '_'
+		}
+		return r
+	}, strings.Join(nonEmpty, "-"))
+}
+
+// setupResponseCache оборачивает провайдерские движки кэшем ответов detect/parse.
+// Кэш стоит ближе всех к провайдеру: ансамбль, верификатор и тень его не обходят.
+func setupResponseCache(cfg *config.Config, engines *ocr2.Engines) {
+	cache, err := respcache.New(respcache.Options{
+		Size:      cfg.ResponseCacheSize,
+		TTL:       time.Duration(cfg.ResponseCacheTTLSec) * time.Second,
+		Dir:       cfg.ResponseCacheDir,
+		DiskQuota: int64(cfg.ResponseCacheQuotaMB) << 20,
+	})
+	if err != nil {
+		log.Fatalf("RESPONSE_CACHE_DIR: %v", err)
+	}
+	wrap := func(e ocr2.Engine) ocr2.Engine {
+		if e == nil {
+			return nil
+		}
+		return respcache.Wrap(e, cache)
+	}
+	engines.OpenAI = wrap(engines.OpenAI)
+	engines.Gemini = wrap(engines.Gemini)
+	engines.Mixed = wrap(engines.Mixed)
+	engines.OpenRouter = wrap(engines.OpenRouter)
+	log.Printf("Response cache enabled: size=%d ttl=%ds dir=%q quota=%dMB",
+		cfg.ResponseCacheSize, cfg.ResponseCacheTTLSec, cfg.ResponseCacheDir, cfg.ResponseCacheQuotaMB)
+}
+
+// setupEnsemble включает голосование для CheckSolution. Без
+// CHECK_ENSEMBLE_MODELS каждый движок голосует сам с собой; со списком
+// моделей ансамбль подключается только к OpenRouter, и выборки
+// распределяются по моделям по кругу.
+func setupEnsemble(cfg *config.Config, engines *ocr2.Engines, router *tmplrouter.Router, images *util.ImagePipeline, cassettes httpClients) {
+	opts := ensemble.Options{Samples: cfg.CheckEnsembleSamples, MinAgreement: cfg.CheckEnsembleMinAgreement}
+	var members []ocr2.Engine
+	for _, m := range strings.Split(cfg.CheckEnsembleModels, ",") {
+		if m = strings.TrimSpace(m); m == "" {
+			continue
+		}
+		if cfg.OpenRouterAPIKey == "" {
+			log.Fatal("CHECK_ENSEMBLE_MODELS requires OPENROUTER_API_KEY")
+		}
+		member := newOpenRouter(cfg, or2.StepModels{Check: m}, images, cassettes(cassetteName("ensemble", m)))
+		member.SetTemplateRouter(router)
+		members = append(members, member)
+	}
+	if len(members) > 0 {
+		engines.OpenRouter = ensemble.New(engines.OpenRouter, members, opts)
+		log.Printf("Check ensemble enabled for openrouter: samples=%d models=%s", opts.Samples, cfg.CheckEnsembleModels)
+		return
+	}
+	wrap := func(e ocr2.Engine) ocr2.Engine {
+		if e == nil {
+			return nil
+		}
+		return ensemble.New(e, nil, opts)
+	}
+	engines.OpenAI = wrap(engines.OpenAI)
+	engines.Gemini = wrap(engines.Gemini)
+	engines.Mixed = wrap(engines.Mixed)
+	engines.OpenRouter = wrap(engines.OpenRouter)
+	log.Printf("Check ensemble enabled: samples=%d min_agreement=%.2f", opts.Samples, opts.MinAgreement)
+}
+
+// setupVerify подключает второе мнение по CHECK на модели CHECK_VERIFY_MODEL.
+func setupVerify(cfg *config.Config, engines *ocr2.Engines, router *tmplrouter.Router, images *util.ImagePipeline, cassettes httpClients) {
+	if cfg.OpenRouterAPIKey == "" {
+		log.Fatal("CHECK_VERIFY_MODEL requires OPENROUTER_API_KEY")
+	}
+	resolution, err := verify.ParseResolution(cfg.CheckVerifyOnDispute)
+	if err != nil {
+		log.Fatalf("CHECK_VERIFY_ON_DISPUTE: %v", err)
+	}
+	verifier := newOpenRouter(cfg, or2.StepModels{Check: cfg.CheckVerifyModel}, images, cassettes("verify"))
+	verifier.SetTemplateRouter(router)
+	opts := verify.Options{
+		ConfidenceThreshold: cfg.CheckVerifyConfidence,
+		HighRisk:            cfg.CheckVerifyHighRisk,
+		OnDispute:           resolution,
+	}
+	wrap := func(e ocr2.Engine) ocr2.Engine {
+		if e == nil {
+			return nil
+		}
+		return verify.New(e, verifier, opts)
+	}
+	engines.OpenAI = wrap(engines.OpenAI)
+	engines.Gemini = wrap(engines.Gemini)
+	engines.Mixed = wrap(engines.Mixed)
+	engines.OpenRouter = wrap(engines.OpenRouter)
+	log.Printf("Check verifier enabled: model=%s threshold=%.2f high_risk=%v on_dispute=%s",
+		cfg.CheckVerifyModel, opts.ConfidenceThreshold, opts.HighRisk, opts.OnDispute)
+}
+
+// childFacing — декораторы ответа, который видит ученик: проверка утечки
+// ответа, читаемость, безопасность и тон, локальная оценка фото. Ими
+// оборачивается каждый движок, до которого доходит запрос: основные,
+// варианты экспериментов и batch.
+type childFacing struct {
+	leakGuard   bool
+	readability readability.Mode
+	safety      safety.Mode
+	filter      *safety.Filter
+	prescreen   prescreen.Mode
+	thresholds  prescreen.Thresholds
+}
+
+// newChildFacing разбирает режимы декораторов и правила фильтра безопасности.
+func newChildFacing(cfg *config.Config) *childFacing {
+	c := &childFacing{
+		leakGuard: cfg.LeakGuardEnabled,
+		thresholds: prescreen.Thresholds{
+			MinBlur:       cfg.PrescreenMinBlur,
+			MinBrightness: cfg.PrescreenMinBrightness,
+			MinContrast:   cfg.PrescreenMinContrast,
+			MinSide:       cfg.PrescreenMinSide,
+			MaxAspect:     cfg.PrescreenMaxAspect,
+		},
+	}
+	var err error
+	if c.readability, err = readability.ParseMode(cfg.ReadabilityMode); err != nil {
+		log.Fatalf("READABILITY_MODE: %v", err)
+	}
+	if c.safety, err = safety.ParseMode(cfg.SafetyFilterMode); err != nil {
+		log.Fatalf("SAFETY_FILTER_MODE: %v", err)
+	}
+	if c.safety != safety.ModeOff {
+		rules, err := safety.LoadRules(cfg.SafetyRulesFile)
+		if err != nil {
+			log.Fatalf("SAFETY_RULES_FILE: %v", err)
+		}
+		if c.filter, err = safety.NewFilter(rules); err != nil {
+			log.Fatalf("SAFETY_RULES_FILE: %v", err)
+		}
+	}
+	if c.prescreen, err = prescreen.ParseMode(cfg.PrescreenMode); err != nil {
+		log.Fatalf("PRESCREEN_MODE: %v", err)
+	}
+	if c.leakGuard {
+		log.Printf("Answer leak guard enabled for hint and check")
+	}
+	if c.readability != readability.ModeOff {
+		log.Printf("Readability check enabled: mode=%s", c.readability)
+	}
+	if c.safety != safety.ModeOff {
+		log.Printf("Child safety filter enabled: mode=%s rules=%q", c.safety, cfg.SafetyRulesFile)
+	}
+	if c.prescreen != prescreen.ModeOff {
+		log.Printf("Photo prescreen enabled: mode=%s thresholds=%+v", c.prescreen, c.thresholds)
+	}
+	return c
+}
+
+// wrap оборачивает движок цепочкой декораторов, изнутри наружу:
+//   - проверка утечки ответа — снаружи ансамбля и верификатора: проверяется
+//     текст, который действительно увидит ученик;
+//   - читаемость — снаружи проверки утечки, чтобы переписанный текст тоже
+//     проверялся на утечку;
+//   - фильтр безопасности — повторная генерация проходит обе проверки;
+//   - оценка фото — внешняя: ответ без модели не попадает в кэш и не уходит
+//     в тень.
+func (c *childFacing) wrap(e ocr2.Engine) ocr2.Engine {
+	if e == nil {
+		return nil
+	}
+	if c.leakGuard {
+		e = leakguard.New(e)
+	}
+	if c.readability != readability.ModeOff {
+		e = readability.New(e, c.readability)
+	}
+	if c.safety != safety.ModeOff {
+		e = safety.New(e, c.filter, c.safety)
+	}
+	if c.prescreen != prescreen.ModeOff {
+		e = prescreen.New(e, c.prescreen, c.thresholds)
+	}
+	return e
+}
+
+// setupChildFacing оборачивает основные движки декораторами для ученика.
+func setupChildFacing(child *childFacing, engines *ocr2.Engines) {
+	engines.OpenAI = child.wrap(engines.OpenAI)
+	engines.Gemini = child.wrap(engines.Gemini)
+	engines.Mixed = child.wrap(engines.Mixed)
+	engines.OpenRouter = child.wrap(engines.OpenRouter)
+}
+
+// setupShadow оборачивает основные движки теневым декоратором.
+// Кандидат — движок по SHADOW_ENGINE или, если задан SHADOW_MODEL,
+// отдельный экземпляр OpenRouter с этой моделью на всех шагах.
+func setupShadow(cfg *config.Config, engines *ocr2.Engines, router *tmplrouter.Router, images *util.ImagePipeline, cassettes httpClients) {
+	steps, err := shadow.ParseSteps(cfg.ShadowSteps)
+	if err != nil {
+		log.Fatalf("SHADOW_STEPS: %v", err)
+	}
+	var candidate ocr2.Engine
+	if cfg.ShadowModel != "" {
+		if cfg.OpenRouterAPIKey == "" {
+			log.Fatal("SHADOW_MODEL requires OPENROUTER_API_KEY")
+		}
+		m := cfg.ShadowModel
+		orCandidate := newOpenRouter(cfg, or2.StepModels{Detect: m, Parse: m, Hint: m, Check: m, Analogue: m},
+			images, cassettes(cassetteName("shadow", m)))
+		orCandidate.SetTemplateRouter(router)
+		candidate = orCandidate
+	} else {
+		candidate, err = engines.GetEngine(cfg.ShadowEngine)
+		if err != nil {
+			log.Fatalf("SHADOW_ENGINE: %v", err)
+		}
+	}
+	report, err := shadow.NewReporter(cfg.ShadowReportPath)
+	if err != nil {
+		log.Fatalf("shadow: %v", err)
+	}
+	opts := shadow.Options{
+		SampleRate:  cfg.ShadowSampleRate,
+		Steps:       steps,
+		MaxInFlight: cfg.ShadowMaxInFlight,
+	}
+	wrap := func(primary ocr2.Engine) ocr2.Engine {
+		if primary == nil || primary == candidate {
+			return primary
+		}
+		return shadow.New(primary, candidate, report, opts)
+	}
+	engines.OpenAI = wrap(engines.OpenAI)
+	engines.Gemini = wrap(engines.Gemini)
+	engines.Mixed = wrap(engines.Mixed)
+	engines.OpenRouter = wrap(engines.OpenRouter)
+	log.Printf("Shadow mode enabled: candidate=%s model=%q steps=%s rate=%.3f report=%s",
+		candidate.Name(), cfg.ShadowModel, cfg.ShadowSteps, cfg.ShadowSampleRate, report.Path())
+}
+
+// setupBatch создаёт менеджер batch-заданий для gpt и gemini. Движки собираются
+// теми же конструкторами, что и онлайн, но без кэша промпта Gemini: задание
+// может ждать дольше, чем живёт cachedContent. Semantic validation — одна
+// попытка: ответ batch-провайдера воспроизводится один раз, повторить нечем.
+// Декораторы для ученика те же, что онлайн; их повторная генерация в batch
+// не удаётся, и они отдают свой запасной результат.
+func setupBatch(cfg *config.Config, router *tmplrouter.Router, images *util.ImagePipeline, child *childFacing) *batch.Manager {
+	backends := map[string]batch.Backend{}
+	if cfg.OpenAIAPIKey != "" {
+		backends["gpt"] = batch.Backend{
+			Provider: batch.NewOpenAI(cfg.OpenAIAPIKey),
+			NewEngine: func(c *http.Client) ocr2.Engine {
+				eng := gpt2.New(cfg.OpenAIAPIKey, cfg.OpenAIModel).WithHTTPClient(c).WithImagePipeline(images).
+					WithValidationAttempts(1)
+				eng.SetTemplateRouter(router)
+				return child.wrap(eng)
+			},
+		}
+	}
+	if cfg.GeminiAPIKey != "" {
+		backends["gemini"] = batch.Backend{
+			Provider: batch.NewGemini(cfg.GeminiAPIKey),
+			NewEngine: func(c *http.Client) ocr2.Engine {
+				return child.wrap(gemini2.New(cfg.GeminiAPIKey, cfg.GeminiDetectModel, cfg.GeminiParseModel).
+					WithHTTPClient(c).WithImagePipeline(images).WithValidationAttempts(1))
+			},
+		}
+	}
+	m, err := batch.NewManager(batch.Options{
+		Dir:           cfg.BatchDir,
+		PollInterval:  time.Duration(cfg.BatchPollIntervalSec) * time.Second,
+		MaxInputBytes: int64(cfg.BatchMaxInputMB) << 20,
+	}, backends)
+	if err != nil {
+		log.Fatalf("BATCH_DIR: %v", err)
+	}
+	log.Printf("Batch mode enabled (dir=%s engines=%d)", cfg.BatchDir, len(backends))
+	return m
+}
+
+// variantEngineBuilder собирает движки вариантов экспериментов.
+// Вариант только с llm_name использует общий экземпляр движка; модель или
+// каталог промптов требуют отдельного экземпляра, который оборачивается
+// теми же декораторами для ученика, что и основные движки.
+func variantEngineBuilder(cfg *config.Config, engines *ocr2.Engines, router *tmplrouter.Router, images *util.ImagePipeline, child *childFacing, cassettes httpClients) experiment.EngineBuilder {
+	return func(v experiment.Variant, steps []string) (ocr2.Engine, error) {
+		if v.Model == "" && v.PromptDir == "" {
+			return engines.GetEngine(v.LLMName)
+		}
+		eng, err := newVariantEngine(cfg, router, images, v, steps, cassettes(cassetteName("variant", v.LLMName, v.Model)))
+		if err != nil {
+			return nil, err
+		}
+		return child.wrap(eng), nil
+	}
+}
+
+// newVariantEngine создаёт отдельный экземпляр движка с моделью или
+// каталогом промптов варианта. Экземпляр собирается теми же конструкторами,
+// что и основной движок, — вариант отличается от контрольной группы только
+// моделью или промптами.
+func newVariantEngine(cfg *config.Config, router *tmplrouter.Router, images *util.ImagePipeline, v experiment.Variant, steps []string, client *http.Client) (ocr2.Engine, error) {
+	switch v.LLMName {
+	case "openrouter":
+		if cfg.OpenRouterAPIKey == "" {
+			return nil, errors.New("OPENROUTER_API_KEY is not set")
+		}
+		models := openRouterModels(cfg)
+		if v.Model != "" {
+			models = models.Override(v.Model, steps...)
+		}
+		eng := newOpenRouter(cfg, models, images, client).WithPromptDir(v.PromptDir)
+		eng.SetTemplateRouter(router)
+		return eng, nil
+	case "gpt", "openai":
+		if v.PromptDir != "" {
+			return nil, errors.New("prompt_dir variants are supported only for openrouter")
+		}
+		eng := newGPT(cfg, v.Model, images, client)
+		eng.SetTemplateRouter(router)
+		return eng, nil
+	case "gemini":
+		if v.PromptDir != "" {
+			return nil, errors.New("prompt_dir variants are supported only for openrouter")
+		}
+		return newGemini(cfg, v.Model, v.Model, images, client), nil
+	default:
+		return nil, fmt.Errorf("model/prompt_dir variants need llm_name openrouter, gpt or gemini, got %q", v.LLMName)
+	}
+}
+
+// newGPT, newGemini и newOpenRouter собирают движки v2 с общими для всех
+// экземпляров настройками: основные движки, варианты экспериментов, ансамбль,
+// верификатор и тень. client — клиент кассеты; nil — обычный клиент движка.
+func newGPT(cfg *config.Config, model string, images *util.ImagePipeline, client *http.Client) *gpt2.Engine {
+	return gpt2.New(cfg.OpenAIAPIKey, model).WithHTTPClient(client).WithImagePipeline(images).
+		WithValidationAttempts(cfg.SemanticRetryAttempts)
+}
+
+func newGemini(cfg *config.Config, detectModel, parseModel string, images *util.ImagePipeline, client *http.Client) *gemini2.Engine {
+	return gemini2.New(cfg.GeminiAPIKey, detectModel, parseModel).WithHTTPClient(client).
+		WithPromptCache(time.Duration(cfg.GeminiPromptCacheTTLSec) * time.Second).
+		WithImagePipeline(images).
+		WithValidationAttempts(cfg.SemanticRetryAttempts)
+}
+
+func newOpenRouter(cfg *config.Config, models or2.StepModels, images *util.ImagePipeline, client *http.Client) *or2.Engine {
+	return or2.New(cfg.OpenRouterAPIKey, models).WithHTTPClient(client).WithImagePipeline(images).
+		WithValidationAttempts(cfg.SemanticRetryAttempts)
+}
+
+// openRouterModels — модели основного движка OpenRouter по шагам.
+// Модели для каждого шага берутся из env-переменных — без хардкода в коде.
+func openRouterModels(cfg *config.Config) or2.StepModels {
+	return or2.StepModels{
+		Detect:   cfg.OpenRouterDetectModel,
+		Parse:    cfg.OpenRouterParseModel,
+		Hint:     cfg.OpenRouterHintModel,
+		Check:    cfg.OpenRouterCheckModel,
+		Analogue: cfg.OpenRouterAnalogueModel,
+	}
+}
+
 func serviceAuth(apiKey string, next http.Handler) http.Handler {
 	apiKey = strings.TrimSpace(apiKey)
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"slices"
+	"testing"
+
+	"llm-proxy/api/internal/config"
+	"llm-proxy/api/internal/v2/experiment"
+	ocr2 "llm-proxy/api/internal/v2/ocr"
+	"llm-proxy/api/internal/v2/ocr/safety"
+	"llm-proxy/api/internal/v2/tmplrouter"
+)
+
+// hasDecorator ищет декоратор типа T в цепочке: каждый декоратор встраивает
+// обёрнутый движок полем Engine.
+func hasDecorator[T ocr2.Engine](e ocr2.Engine) bool {
+	for e != nil {
+		if _, ok := e.(T); ok {
+			return true
+		}
+		v := reflect.ValueOf(e)
+		if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+			return false
+		}
+		inner := v.Elem().FieldByName("Engine")
+		if !inner.IsValid() || inner.IsNil() {
+			return false
+		}
+		e, _ = inner.Interface().(ocr2.Engine)
+	}
+	return false
+}
+
+func TestVariantEngineBuilder_WrapsChildFacing(t *testing.T) {
+	cfg := &config.Config{
+		OpenAIAPIKey:     "test",
+		GeminiAPIKey:     "test",
+		OpenRouterAPIKey: "test",
+		SafetyFilterMode: "fallback",
+		ReadabilityMode:  "off",
+		PrescreenMode:    "off",
+	}
+	child := newChildFacing(cfg)
+	build := variantEngineBuilder(cfg, &ocr2.Engines{}, tmplrouter.New(), nil, child, newCassettes(cfg))
+
+	for _, v := range []experiment.Variant{
+		{LLMName: "openrouter", Model: "test/model"},
+		{LLMName: "gpt", Model: "gpt-test"},
+		{LLMName: "gemini", Model: "gemini-test"},
+	} {
+		t.Run(v.LLMName, func(t *testing.T) {
+			eng, err := build(v, []string{"hint"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !hasDecorator[*safety.Engine](eng) {
+				t.Errorf("variant engine %T bypasses the safety filter", eng)
+			}
+		})
+	}
+}
+
+func TestVariantEngineBuilder_UsesCassettes(t *testing.T) {
+	cfg := &config.Config{OpenAIAPIKey: "test", GeminiAPIKey: "test", OpenRouterAPIKey: "test"}
+	var names []string
+	cassettes := func(name string) *http.Client {
+		names = append(names, name)
+		return nil
+	}
+	build := variantEngineBuilder(cfg, &ocr2.Engines{}, tmplrouter.New(), nil, newChildFacing(cfg), cassettes)
+	for _, v := range []experiment.Variant{
+		{LLMName: "openrouter", Model: "test/model"},
+		{LLMName: "gpt", Model: "gpt-test"},
+		{LLMName: "gemini", Model: "gemini-test"},
+	} {
+		if _, err := build(v, []string{"hint"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{"variant-openrouter-test_model", "variant-gpt-gpt-test", "variant-gemini-gemini-test"}
+	if !slices.Equal(names, want) {
+		t.Errorf("cassettes = %q, want %q", names, want)
+	}
+}
+
+func TestCassetteName(t *testing.T) {
+	tests := []struct {
+		parts []string
+		want  string
+	}{
+		{[]string{"gpt"}, "gpt"},
+		{[]string{"shadow", "openai/gpt-4o"}, "shadow-openai_gpt-4o"},
+		{[]string{"variant", "gemini", ""}, "variant-gemini"},
+		{[]string{"ensemble", `a:b\c`}, "ensemble-a_b_c"},
+	}
+	for _, tt := range tests {
+		if got := cassetteName(tt.parts...); got != tt.want {
+			t.Errorf("cassetteName(%q) = %q, want %q", tt.parts, got, tt.want)
+		}
+	}
+}
@@ -1,7 +1,9 @@
 package config
 
 import (
+	"log"
 	"os"
+	"strconv"
 )
 
 type Config struct {
@@ -14,8 +16,10 @@ type Config struct {
 	GeminiModel       string // используется v1
 	GeminiDetectModel string // v2: detect (gemini-2.0-flash-lite)
 	GeminiParseModel  string // v2: parse  (gemini-2.5-flash)
-	OpenAIAPIKey      string
-	OpenAIModel       string
+	// GeminiPromptCacheTTLSec — TTL cachedContents для system instruction; 0 — без кэша.
+	GeminiPromptCacheTTLSec int // GEMINI_PROMPT_CACHE_TTL_SEC
+	OpenAIAPIKey            string
+	OpenAIModel             string
 
 	// OpenRouter — единый API для 300+ моделей.
 	// Модели задаются отдельно для каждого шага; ни одна не захардкожена.
@@ -26,6 +30,108 @@ type Config struct {
 	OpenRouterHintModel     string // OPENROUTER_HINT_MODEL
 	OpenRouterCheckModel    string // OPENROUTER_CHECK_MODEL
 	OpenRouterAnalogueModel string // OPENROUTER_ANALOGUE_MODEL
+
+	// Предобработка изображений v2: поворот по EXIF, уменьшение, перекодирование в JPEG.
+	ImagePreprocess    bool   // IMAGE_PREPROCESS
+	ImageMaxDim        int    // IMAGE_MAX_DIM: максимальная сторона в пикселях
+	ImageMaxDimByModel string // IMAGE_MAX_DIM_BY_MODEL: "модель=пиксели" через запятую
+	ImageJPEGQuality   int    // IMAGE_JPEG_QUALITY
+	ImageMaxKB         int    // IMAGE_MAX_KB: целевой размер; 0 — без цели
+	ImageGrayscale     bool   // IMAGE_GRAYSCALE
+	// Внешний декодер для форматов без декодера на Go (HEIC, AVIF): байты на stdin,
+	// PNG/JPEG на stdout. Пусто — такие изображения уходят только провайдерам,
+	// которые принимают их сами (Gemini — HEIC).
+	ImageDecoderCmd     string // IMAGE_DECODER_CMD, например "magick - png:-"
+	ImageDecoderFormats string // IMAGE_DECODER_FORMATS: MIME через запятую
+
+	// Изображения по http(s) URL: загрузка с лимитами и запретом приватных сетей.
+	ImageFetchEnabled      bool   // IMAGE_FETCH_ENABLED
+	ImageFetchMaxKB        int    // IMAGE_FETCH_MAX_KB
+	ImageFetchTimeoutSec   int    // IMAGE_FETCH_TIMEOUT_SEC
+	ImageFetchMaxRedirects int    // IMAGE_FETCH_MAX_REDIRECTS
+	ImageFetchAllowCIDRs   string // IMAGE_FETCH_ALLOW_CIDRS: приватные сети, разрешённые явно
+	ImageFetchCacheMB      int    // IMAGE_FETCH_CACHE_MB: кэш по URL+ETag; 0 — выключен
+
+	// Хранилище загруженных изображений: POST /v2/images → image_id.
+	ImageStoreDir     string // IMAGE_STORE_DIR: пусто — выключено
+	ImageStoreTTLSec  int    // IMAGE_STORE_TTL_SEC: с последнего обращения
+	ImageStoreMaxMB   int    // IMAGE_STORE_MAX_MB: лимит одного изображения
+	ImageStoreQuotaMB int    // IMAGE_STORE_QUOTA_MB: суммарный объём; 0 — без квоты
+
+	// Локальный пре-скрининг фото перед DETECT: off | observe | enforce.
+	// observe возвращает оценки в quality.local, enforce ещё и отвечает
+	// recommend_retake без модели при превышении порогов. 0 — порог выключен.
+	PrescreenMode          string  // PRESCREEN_MODE
+	PrescreenMinBlur       float64 // PRESCREEN_MIN_BLUR: дисперсия лапласиана
+	PrescreenMinBrightness float64 // PRESCREEN_MIN_BRIGHTNESS: средняя яркость 0..255
+	PrescreenMinContrast   float64 // PRESCREEN_MIN_CONTRAST: СКО яркости
+	PrescreenMinSide       int     // PRESCREEN_MIN_SIDE: короткая сторона в пикселях
+	PrescreenMaxAspect     float64 // PRESCREEN_MAX_ASPECT: длинная сторона / короткая
+
+	// Анти-ГДЗ: подсказки и feedback CHECK сверяются с ответом и промежуточными
+	// результатами решения; при утечке — одна повторная генерация.
+	LeakGuardEnabled bool // LEAK_GUARD_ENABLED
+
+	// Фильтр безопасности и тона текстов для ребёнка: off | fallback | regenerate.
+	SafetyFilterMode string // SAFETY_FILTER_MODE
+	SafetyRulesFile  string // SAFETY_RULES_FILE: JSON с дополнительными словами и шаблонами
+
+	// Читаемость подсказок и feedback по классу: off | warn | retry.
+	ReadabilityMode string // READABILITY_MODE
+
+	// Semantic validation ответов v2: вызовов модели на шаг, пока ответ не
+	// пройдёт проверку; 1 — без повторов.
+	SemanticRetryAttempts int // SEMANTIC_RETRY_ATTEMPTS
+
+	// Кассеты record/replay HTTP-трафика v2-движков к провайдерам.
+	// Пустой режим — обычная работа с сетью.
+	CassetteMode string // LLM_CASSETTE_MODE: record | replay
+	CassetteDir  string // LLM_CASSETTE_DIR
+
+	// Фейковый движок llm_name="fake" для тестов child_bot. По умолчанию выключен,
+	// чтобы production-трафик не мог случайно получить сценарные ответы.
+	FakeEngineEnabled bool    // LLM_FAKE_ENGINE
+	FakeLatencyMs     int     // LLM_FAKE_LATENCY_MS
+	FakeErrorRate     float64 // LLM_FAKE_ERROR_RATE: 0..1
+
+	// Теневой режим: выборка запросов асинхронно дублируется в движок-кандидат,
+	// расхождения пишутся в JSONL-отчёт. Ответ кандидата клиенту не отдаётся.
+	ShadowEngine      string  // SHADOW_ENGINE: llm_name кандидата
+	ShadowModel       string  // SHADOW_MODEL: модель OpenRouter для всех шагов кандидата
+	ShadowSteps       string  // SHADOW_STEPS: шаги через запятую
+	ShadowSampleRate  float64 // SHADOW_SAMPLE_RATE: 0..1, 0 — выключено
+	ShadowReportPath  string  // SHADOW_REPORT_PATH
+	ShadowMaxInFlight int     // SHADOW_MAX_INFLIGHT
+
+	// Объединение одновременных одинаковых запросов v2 в один вызов движка.
+	CoalesceRequests bool // COALESCE_REQUESTS
+
+	// Batch-режим: офлайн-прогон JSONL через batch API OpenAI и Gemini.
+	BatchDir             string // BATCH_DIR: каталог заданий; пусто — выключено
+	BatchPollIntervalSec int    // BATCH_POLL_INTERVAL_SEC
+	BatchMaxInputMB      int    // BATCH_MAX_INPUT_MB
+
+	// Кэш ответов detect/parse по хешу изображения: память (LRU) и опционально диск.
+	ResponseCacheSize    int    // RESPONSE_CACHE_SIZE: записей в памяти; 0 — выключено
+	ResponseCacheTTLSec  int    // RESPONSE_CACHE_TTL_SEC
+	ResponseCacheDir     string // RESPONSE_CACHE_DIR: пусто — без дискового уровня
+	ResponseCacheQuotaMB int    // RESPONSE_CACHE_QUOTA_MB: объём дискового уровня; 0 — без квоты
+
+	// Ансамбль проверки: CheckSolution вызывается N раз параллельно,
+	// решение выбирается большинством голосов.
+	CheckEnsembleSamples      int     // CHECK_ENSEMBLE_SAMPLES: 0/1 — выключено
+	CheckEnsembleModels       string  // CHECK_ENSEMBLE_MODELS: модели OpenRouter через запятую
+	CheckEnsembleMinAgreement float64 // CHECK_ENSEMBLE_MIN_AGREEMENT: 0..1
+
+	// Второе мнение по CHECK: другая модель подтверждает или оспаривает вердикт
+	// при низкой уверенности или для задач повышенного риска.
+	CheckVerifyModel      string  // CHECK_VERIFY_MODEL: модель OpenRouter; пусто — выключено
+	CheckVerifyConfidence float64 // CHECK_VERIFY_CONFIDENCE: порог уверенности
+	CheckVerifyHighRisk   bool    // CHECK_VERIFY_HIGH_RISK
+	CheckVerifyOnDispute  string  // CHECK_VERIFY_ON_DISPUTE: primary | verifier | cannot_evaluate
+
+	// Эксперименты: JSON-файл с вариантами (движок, модель, каталог промптов) и весами.
+	ExperimentsFile string // EXPERIMENTS_FILE
 }
 
 func getEnv(k, def string) string {
@@ -35,6 +141,45 @@ func getEnv(k, def string) string {
 	return def
 }
 
+func getEnvBool(k string, def bool) bool {
+	v := os.Getenv(k)
+	if v == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		log.Printf("config: bad %s=%q, using %v", k, v, def)
+		return def
+	}
+	return b
+}
+
+func getEnvInt(k string, def int) int {
+	v := os.Getenv(k)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Printf("config: bad %s=%q, using %d", k, v, def)
+		return def
+	}
+	return n
+}
+
+func getEnvFloat(k string, def float64) float64 {
+	v := os.Getenv(k)
+	if v == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		log.Printf("config: bad %s=%q, using %v", k, v, def)
+		return def
+	}
+	return f
+}
+
 func Load() *Config {
 	return &Config{
 		Port:               getEnv("PORT", "8000"),
@@ -42,12 +187,13 @@ func Load() *Config {
 		AllowedClientCIDRs: getEnv("LLM_PROXY_ALLOWED_CLIENT_CIDRS", ""),
 		TrustedProxyCIDRs:  getEnv("LLM_PROXY_TRUSTED_PROXY_CIDRS", ""),
 
-		GeminiAPIKey:      getEnv("GEMINI_API_KEY", ""),
-		GeminiModel:       getEnv("GEMINI_MODEL", "gemini-2.5-flash"),
-		GeminiDetectModel: getEnv("GEMINI_DETECT_MODEL", "gemini-2.0-flash-lite"),
-		GeminiParseModel:  getEnv("GEMINI_PARSE_MODEL", "gemini-2.5-flash"),
-		OpenAIAPIKey:      getEnv("OPENAI_API_KEY", ""),
-		OpenAIModel:       getEnv("OPENAI_MODEL", "gpt-4o-mini"),
+		GeminiAPIKey:            getEnv("GEMINI_API_KEY", ""),
+		GeminiModel:             getEnv("GEMINI_MODEL", "gemini-2.5-flash"),
+		GeminiDetectModel:       getEnv("GEMINI_DETECT_MODEL", "gemini-2.0-flash-lite"),
+		GeminiParseModel:        getEnv("GEMINI_PARSE_MODEL", "gemini-2.5-flash"),
+		GeminiPromptCacheTTLSec: getEnvInt("GEMINI_PROMPT_CACHE_TTL_SEC", 3600),
+		OpenAIAPIKey:            getEnv("OPENAI_API_KEY", ""),
+		OpenAIModel:             getEnv("OPENAI_MODEL", "gpt-4o-mini"),
 
 		// OpenRouter необязателен: если ключ не задан, движок просто недоступен.
 		OpenRouterAPIKey:        getEnv("OPENROUTER_API_KEY", ""),
@@ -56,5 +202,79 @@ func Load() *Config {
 		OpenRouterHintModel:     getEnv("OPENROUTER_HINT_MODEL", "google/gemini-2.5-flash"),
 		OpenRouterCheckModel:    getEnv("OPENROUTER_CHECK_MODEL", "openai/gpt-4.1-mini"),
 		OpenRouterAnalogueModel: getEnv("OPENROUTER_ANALOGUE_MODEL", ""),
+
+		ImagePreprocess:    getEnvBool("IMAGE_PREPROCESS", true),
+		ImageMaxDim:        getEnvInt("IMAGE_MAX_DIM", 2048),
+		ImageMaxDimByModel: getEnv("IMAGE_MAX_DIM_BY_MODEL", ""),
+		ImageJPEGQuality:   getEnvInt("IMAGE_JPEG_QUALITY", 85),
+		ImageMaxKB:         getEnvInt("IMAGE_MAX_KB", 1024),
+		ImageGrayscale:     getEnvBool("IMAGE_GRAYSCALE", false),
+
+		ImageDecoderCmd:     getEnv("IMAGE_DECODER_CMD", ""),
+		ImageDecoderFormats: getEnv("IMAGE_DECODER_FORMATS", "image/heic,image/heif,image/avif"),
+
+		ImageFetchEnabled:      getEnvBool("IMAGE_FETCH_ENABLED", false),
+		ImageFetchMaxKB:        getEnvInt("IMAGE_FETCH_MAX_KB", 8192),
+		ImageFetchTimeoutSec:   getEnvInt("IMAGE_FETCH_TIMEOUT_SEC", 10),
+		ImageFetchMaxRedirects: getEnvInt("IMAGE_FETCH_MAX_REDIRECTS", 3),
+		ImageFetchAllowCIDRs:   getEnv("IMAGE_FETCH_ALLOW_CIDRS", ""),
+		ImageFetchCacheMB:      getEnvInt("IMAGE_FETCH_CACHE_MB", 64),
+
+		ImageStoreDir:     getEnv("IMAGE_STORE_DIR", ""),
+		ImageStoreTTLSec:  getEnvInt("IMAGE_STORE_TTL_SEC", 3600),
+		ImageStoreMaxMB:   getEnvInt("IMAGE_STORE_MAX_MB", 20),
+		ImageStoreQuotaMB: getEnvInt("IMAGE_STORE_QUOTA_MB", 2048),
+
+		PrescreenMode:          getEnv("PRESCREEN_MODE", "off"),
+		PrescreenMinBlur:       getEnvFloat("PRESCREEN_MIN_BLUR", 30),
+		PrescreenMinBrightness: getEnvFloat("PRESCREEN_MIN_BRIGHTNESS", 35),
+		PrescreenMinContrast:   getEnvFloat("PRESCREEN_MIN_CONTRAST", 12),
+		PrescreenMinSide:       getEnvInt("PRESCREEN_MIN_SIDE", 480),
+		PrescreenMaxAspect:     getEnvFloat("PRESCREEN_MAX_ASPECT", 4),
+
+		LeakGuardEnabled: getEnvBool("LEAK_GUARD_ENABLED", true),
+
+		SafetyFilterMode: getEnv("SAFETY_FILTER_MODE", "regenerate"),
+		SafetyRulesFile:  getEnv("SAFETY_RULES_FILE", ""),
+
+		ReadabilityMode: getEnv("READABILITY_MODE", "warn"),
+
+		SemanticRetryAttempts: getEnvInt("SEMANTIC_RETRY_ATTEMPTS", 2),
+
+		CassetteMode: getEnv("LLM_CASSETTE_MODE", ""),
+		CassetteDir:  getEnv("LLM_CASSETTE_DIR", "./cassettes"),
+
+		FakeEngineEnabled: getEnvBool("LLM_FAKE_ENGINE", false),
+		FakeLatencyMs:     getEnvInt("LLM_FAKE_LATENCY_MS", 0),
+		FakeErrorRate:     getEnvFloat("LLM_FAKE_ERROR_RATE", 0),
+
+		ShadowEngine:      getEnv("SHADOW_ENGINE", ""),
+		ShadowModel:       getEnv("SHADOW_MODEL", ""),
+		ShadowSteps:       getEnv("SHADOW_STEPS", "hint,check"),
+		ShadowSampleRate:  getEnvFloat("SHADOW_SAMPLE_RATE", 0),
+		ShadowReportPath:  getEnv("SHADOW_REPORT_PATH", "./shadow/report.jsonl"),
+		ShadowMaxInFlight: getEnvInt("SHADOW_MAX_INFLIGHT", 4),
+
+		CoalesceRequests: getEnvBool("COALESCE_REQUESTS", true),
+
+		BatchDir:             getEnv("BATCH_DIR", ""),
+		BatchPollIntervalSec: getEnvInt("BATCH_POLL_INTERVAL_SEC", 60),
+		BatchMaxInputMB:      getEnvInt("BATCH_MAX_INPUT_MB", 200),
+
+		ResponseCacheSize:    getEnvInt("RESPONSE_CACHE_SIZE", 0),
+		ResponseCacheTTLSec:  getEnvInt("RESPONSE_CACHE_TTL_SEC", 86400),
+		ResponseCacheDir:     getEnv("RESPONSE_CACHE_DIR", ""),
+		ResponseCacheQuotaMB: getEnvInt("RESPONSE_CACHE_QUOTA_MB", 1024),
+
+		CheckEnsembleSamples:      getEnvInt("CHECK_ENSEMBLE_SAMPLES", 0),
+		CheckEnsembleModels:       getEnv("CHECK_ENSEMBLE_MODELS", ""),
+		CheckEnsembleMinAgreement: getEnvFloat("CHECK_ENSEMBLE_MIN_AGREEMENT", 0.6),
+
+		CheckVerifyModel:      getEnv("CHECK_VERIFY_MODEL", ""),
+		CheckVerifyConfidence: getEnvFloat("CHECK_VERIFY_CONFIDENCE", 0.7),
+		CheckVerifyHighRisk:   getEnvBool("CHECK_VERIFY_HIGH_RISK", true),
+		CheckVerifyOnDispute:  getEnv("CHECK_VERIFY_ON_DISPUTE", "cannot_evaluate"),
+
+		ExperimentsFile: getEnv("EXPERIMENTS_FILE", ""),
 	}
 }
@@ -0,0 +1,136 @@
+// Package metrics — минимальный реестр счётчиков с выдачей в текстовом
+// формате Prometheus. Внешних зависимостей нет: сервису нужны только
+// счётчики с метками и гистограммы, а vendored-клиента Prometheus в проекте нет.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type metric interface {
+	name() string
+	write(w io.Writer)
+}
+
+var (
+	registryMu sync.Mutex
+	registry   = map[string]metric{}
+)
+
+func register(m metric) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, dup := registry[m.name()]; dup {
+		panic("metrics: duplicate metric " + m.name())
+	}
+	registry[m.name()] = m
+}
+
+// Handler отдаёт все зарегистрированные метрики (GET /metrics).
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		registryMu.Lock()
+		names := make([]string, 0, len(registry))
+		for n := range registry {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		ms := make([]metric, 0, len(names))
+		for _, n := range names {
+			ms = append(ms, registry[n])
+		}
+		registryMu.Unlock()
+		for _, m := range ms {
+			m.write(w)
+		}
+	})
+}
+
+// labelKey склеивает значения меток в ключ карты.
+func labelKey(values []string) string { return strings.Join(values, "\x00") }
+
+func formatLabels(names, values []string, extra ...string) string {
+	if len(names) == 0 && len(extra) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, len(names)+len(extra)/2)
+	for i, n := range names {
+		parts = append(parts, n+`="`+escape(values[i])+`"`)
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		parts = append(parts, extra[i]+`="`+escape(extra[i+1])+`"`)
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+func formatFloat(v float64) string { return strconv.FormatFloat(v, 'g', -1, 64) }
+
+// ─── Counter ──────────────────────────────────────────────────────────────────
+
+// Counter — монотонный счётчик с метками.
+type Counter struct {
+	n, help string
+	labels  []string
+
+	mu     sync.Mutex
+	values map[string]float64
+	lvals  map[string][]string
+}
+
+// NewCounter создаёт и регистрирует счётчик.
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{n: name, help: help, labels: labels, values: map[string]float64{}, lvals: map[string][]string{}}
+	register(c)
+	return c
+}
+
+func (c *Counter) name() string { return c.n }
+
+// Inc увеличивает счётчик на 1. Число значений должно совпадать с числом меток.
+func (c *Counter) Inc(labelValues ...string) { c.Add(1, labelValues...) }
+
+// Add увеличивает счётчик на v (v >= 0).
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if len(labelValues) != len(c.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d labels, got %d", c.n, len(c.labels), len(labelValues)))
+	}
+	k := labelKey(labelValues)
+	c.mu.Lock()
+	if _, ok := c.lvals[k]; !ok {
+		c.lvals[k] = append([]string(nil), labelValues...)
+	}
+	c.values[k] += v
+	c.mu.Unlock()
+}
+
+// Value возвращает текущее значение (для тестов и диагностики).
+func (c *Counter) Value(labelValues ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[labelKey(labelValues)]
+}
+
+func (c *Counter) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.n, c.help, c.n)
+	keys := make([]string, 0, len(c.values))
+	for k := range c.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s%s %s\n", c.n, formatLabels(c.labels, c.lvals[k]), formatFloat(c.values[k]))
+	}
+}
@@ -0,0 +1,31 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCounter_Exposition(t *testing.T) {
+	c := NewCounter("test_requests_total", "Test requests.", "step", "result")
+	c.Inc("hint", "ok")
+	c.Add(2, "hint", "ok")
+	c.Inc("check", `bad"quote`)
+
+	if got := c.Value("hint", "ok"); got != 3 {
+		t.Fatalf("Value = %v, want 3", got)
+	}
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+	for _, want := range []string{
+		"# TYPE test_requests_total counter",
+		`test_requests_total{step="hint",result="ok"} 3`,
+		`test_requests_total{step="check",result="bad\"quote"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("exposition missing %q:\n%s", want, body)
+		}
+	}
+}
@@ -37,14 +37,14 @@ func (c *promptCache) InvalidateAll() {
 }
 
 // cachedLoadPrompt загружает промпт с кэшированием (без поддиректорий)
-func cachedLoadPrompt(name, tp, provider, version string) (string, error) {
-	key := version + ":" + provider + ":" + name + ":" + tp
+func cachedLoadPrompt(root, name, tp, provider, version string) (string, error) {
+	key := root + ":" + version + ":" + provider + ":" + name + ":" + tp
 
 	if cached, ok := globalCache.Get(key); ok {
 		return cached, nil
 	}
 
-	result, err := loadPrompt(name, tp, provider, version)
+	result, err := loadPrompt(root, name, tp, provider, version)
 	if err != nil {
 		return "", err
 	}
@@ -54,14 +54,14 @@ func cachedLoadPrompt(name, tp, provider, version string) (string, error) {
 }
 
 // cachedLoadPromptSubdirs загружает промпт с кэшированием и поддиректориями
-func cachedLoadPromptSubdirs(name, tp, provider, version string, subdirs ...string) (string, error) {
-	key := version + ":" + provider + ":" + name + ":" + tp + ":" + strings.Join(subdirs, "/")
+func cachedLoadPromptSubdirs(root, name, tp, provider, version string, subdirs ...string) (string, error) {
+	key := root + ":" + version + ":" + provider + ":" + name + ":" + tp + ":" + strings.Join(subdirs, "/")
 
 	if cached, ok := globalCache.Get(key); ok {
 		return cached, nil
 	}
 
-	result, err := loadPrompt(name, tp, provider, version, subdirs...)
+	result, err := loadPrompt(root, name, tp, provider, version, subdirs...)
 	if err != nil {
 		return "", err
 	}
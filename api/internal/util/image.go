@@ -0,0 +1,380 @@
+package util
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif" // регистрирует декодер GIF для image.Decode
+	"image/jpeg"
+	_ "image/png" // регистрирует декодер PNG для image.Decode
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultJPEGQuality = 85
+	minJPEGQuality     = 40
+	jpegQualityStep    = 10
+	// maxDecodePixels защищает от «пиксельных бомб»: больше — изображение
+	// уходит провайдеру как есть, без декодирования.
+	maxDecodePixels = 50_000_000
+)
+
+var errTooManyPixels = fmt.Errorf("image is larger than %d pixels", maxDecodePixels)
+
+func tooManyPixels(w, h int) bool {
+	return w > 0 && h > 0 && uint64(w)*uint64(h) > maxDecodePixels
+}
+
+// ImageOptions — параметры предобработки изображения перед отправкой провайдеру.
+type ImageOptions struct {
+	MaxDim    int  // максимальная сторона в пикселях; 0 — без уменьшения
+	Quality   int  // качество JPEG при перекодировании; 0 — 85
+	MaxBytes  int  // целевой размер: качество снижается ступенями до 40; 0 — без цели
+	Grayscale bool // перевод в оттенки серого
+}
+
+// ImageStats описывает результат предобработки.
+type ImageStats struct {
+	BytesIn   int // размер исходного изображения
+	BytesOut  int // размер изображения, отправленного провайдеру
+	Width     int // размеры после обработки; 0 — формат не декодировался
+	Height    int
+	Processed bool // изображение перекодировано
+}
+
+// ImagePipeline — предобработка изображений v2-движков: поворот по EXIF,
+// уменьшение до максимальной стороны модели, перекодирование в JPEG.
+// Nil-пайплайн только перекодирует форматы, которые провайдер не принимает.
+type ImagePipeline struct {
+	Options       ImageOptions
+	MaxDimByModel map[string]int // префикс имени модели → максимальная сторона
+}
+
+// For возвращает параметры для модели: MaxDim из самого длинного
+// совпавшего префикса MaxDimByModel, иначе Options.MaxDim.
+func (p *ImagePipeline) For(model string) ImageOptions {
+	opt := p.Options
+	m := strings.ToLower(strings.TrimSpace(model))
+	if i := strings.LastIndex(m, "/"); i >= 0 {
+		m = m[i+1:]
+	}
+	best := -1
+	for prefix, dim := range p.MaxDimByModel {
+		if strings.HasPrefix(m, prefix) && len(prefix) > best {
+			best = len(prefix)
+			opt.MaxDim = dim
+		}
+	}
+	return opt
+}
+
+// Prepare применяет пайплайн к изображению для модели model. Формат, которого
+// нет в accept, перекодируется в JPEG даже при выключенном (nil) пайплайне.
+func (p *ImagePipeline) Prepare(model string, data []byte, mime string, accept ImageFormats) ([]byte, string, ImageStats, error) {
+	var opt ImageOptions
+	if p != nil {
+		opt = p.For(model)
+	}
+	return PrepareImage(data, mime, opt, accept)
+}
+
+// ParseImageMaxDims разбирает список "модель=сторона" через запятую
+// (IMAGE_MAX_DIM_BY_MODEL), например "gpt-4.1-mini=1536,gemini-2.5-flash=3072".
+func ParseImageMaxDims(s string) (map[string]int, error) {
+	out := map[string]int{}
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		model, dim, ok := strings.Cut(pair, "=")
+		n, err := strconv.Atoi(strings.TrimSpace(dim))
+		model = strings.ToLower(strings.TrimSpace(model))
+		if !ok || model == "" || err != nil || n < 0 {
+			return nil, fmt.Errorf("bad image max dim %q, want model=pixels", pair)
+		}
+		out[model] = n
+	}
+	return out, nil
+}
+
+// PrepareImage поворачивает изображение по EXIF, уменьшает до opt.MaxDim,
+// переводит в оттенки серого и перекодирует в JPEG. Формат, которого нет
+// в accept (HEIC, AVIF для OpenAI), перекодируется обязательно: без
+// декодера это ошибка. В остальных случаях, если менять нечего или формат
+// не декодируется, возвращаются исходные байты.
+func PrepareImage(data []byte, mime string, opt ImageOptions, accept ImageFormats) ([]byte, string, ImageStats, error) {
+	st := ImageStats{BytesIn: len(data), BytesOut: len(data)}
+	// Не-изображения (битый base64, text/plain) уходят как есть — их отклонит провайдер.
+	convert := strings.HasPrefix(normalizeImageMIME(mime), "image/") && !accept.Accepts(mime)
+	passthrough := func(reason error) ([]byte, string, ImageStats, error) {
+		if convert {
+			return nil, "", st, fmt.Errorf("image format %s is not accepted by the provider: %w", mime, reason)
+		}
+		return data, mime, st, nil
+	}
+	builtin := builtinImageMIME(mime) && lookupImageDecoder(mime) == nil
+	if !builtin && (!convert || lookupImageDecoder(mime) == nil) {
+		// Внешний декодер запускается только для форматов, которые провайдер не принимает.
+		return passthrough(errors.New("no decoder registered"))
+	}
+
+	orientation := 1
+	if normalizeImageMIME(mime) == "image/jpeg" {
+		orientation = ExifOrientation(data)
+	}
+	if builtin {
+		cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil || cfg.Width <= 0 || cfg.Height <= 0 {
+			return passthrough(fmt.Errorf("decode config: %v", err))
+		}
+		st.Width, st.Height = cfg.Width, cfg.Height
+		w, h := fitWithin(cfg.Width, cfg.Height, opt.MaxDim)
+		resize := w != cfg.Width || h != cfg.Height
+		oversize := opt.MaxBytes > 0 && len(data) > opt.MaxBytes
+		if !convert && !resize && orientation == 1 && !opt.Grayscale && !oversize {
+			return data, mime, st, nil
+		}
+		if tooManyPixels(cfg.Width, cfg.Height) {
+			return passthrough(errTooManyPixels)
+		}
+	}
+	src, err := decodeAnyImage(data, mime)
+	if err != nil {
+		return passthrough(err)
+	}
+
+	img := toRGBA(src)
+	w, h := fitWithin(img.Bounds().Dx(), img.Bounds().Dy(), opt.MaxDim)
+	resize := w != img.Bounds().Dx() || h != img.Bounds().Dy()
+	if resize {
+		img = downscale(img, w, h)
+	}
+	img = orient(img, orientation)
+	var final image.Image = img
+	if opt.Grayscale {
+		final = toGray(img)
+	}
+
+	quality := opt.Quality
+	if quality <= 0 || quality > 100 {
+		quality = defaultJPEGQuality
+	}
+	out, err := encodeJPEG(final, quality)
+	for err == nil && opt.MaxBytes > 0 && len(out) > opt.MaxBytes && quality-jpegQualityStep >= minJPEGQuality {
+		quality -= jpegQualityStep
+		out, err = encodeJPEG(final, quality)
+	}
+	if err != nil {
+		return passthrough(err)
+	}
+	// Только перекодирование без изменения формата, геометрии и цвета не должно увеличивать размер.
+	if !convert && !resize && orientation == 1 && !opt.Grayscale && len(out) >= len(data) {
+		return data, mime, st, nil
+	}
+	b := final.Bounds()
+	st.Width, st.Height = b.Dx(), b.Dy()
+	st.BytesOut = len(out)
+	st.Processed = true
+	return out, "image/jpeg", st, nil
+}
+
+// fitWithin возвращает размеры, вписанные в квадрат maxDim с сохранением пропорций.
+func fitWithin(w, h, maxDim int) (int, int) {
+	if maxDim <= 0 || (w <= maxDim && h <= maxDim) {
+		return w, h
+	}
+	if w >= h {
+		return maxDim, max(1, h*maxDim/w)
+	}
+	return max(1, w*maxDim/h), maxDim
+}
+
+func encodeJPEG(img image.Image, quality int) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// toRGBA копирует изображение в RGBA с началом координат в (0,0).
+// Прозрачные области (PNG) заливаются белым: JPEG не хранит альфа-канал.
+func toRGBA(src image.Image) *image.RGBA {
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), src, b.Min, draw.Over)
+	return dst
+}
+
+// downscale уменьшает изображение усреднением по площади (box filter):
+// каждый пиксель результата — среднее покрываемого им прямоугольника исходника.
+func downscale(src *image.RGBA, w, h int) *image.RGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for dy := 0; dy < h; dy++ {
+		y0 := dy * sh / h
+		y1 := max((dy+1)*sh/h, y0+1)
+		for dx := 0; dx < w; dx++ {
+			x0 := dx * sw / w
+			x1 := max((dx+1)*sw/w, x0+1)
+			var r, g, b, a, n uint32
+			for y := y0; y < y1; y++ {
+				row := src.Pix[y*src.Stride:]
+				for x := x0; x < x1; x++ {
+					p := row[x*4 : x*4+4]
+					r += uint32(p[0])
+					g += uint32(p[1])
+					b += uint32(p[2])
+					a += uint32(p[3])
+					n++
+				}
+			}
+			d := dst.Pix[dy*dst.Stride+dx*4:]
+			d[0], d[1], d[2], d[3] = uint8(r/n), uint8(g/n), uint8(b/n), uint8(a/n)
+		}
+	}
+	return dst
+}
+
+// orient приводит изображение к нормальной ориентации по тегу EXIF Orientation (1..8).
+func orient(src *image.RGBA, orientation int) *image.RGBA {
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	// from возвращает координаты исходного пикселя для пикселя результата.
+	var from func(x, y int) (int, int)
+	dw, dh := w, h
+	switch orientation {
+	case 2: // зеркально по горизонтали
+		from = func(x, y int) (int, int) { return w - 1 - x, y }
+	case 3: // поворот на 180°
+		from = func(x, y int) (int, int) { return w - 1 - x, h - 1 - y }
+	case 4: // зеркально по вертикали
+		from = func(x, y int) (int, int) { return x, h - 1 - y }
+	case 5: // транспонирование
+		dw, dh = h, w
+		from = func(x, y int) (int, int) { return y, x }
+	case 6: // поворот на 90° по часовой
+		dw, dh = h, w
+		from = func(x, y int) (int, int) { return y, h - 1 - x }
+	case 7: // поперечное транспонирование
+		dw, dh = h, w
+		from = func(x, y int) (int, int) { return w - 1 - y, h - 1 - x }
+	case 8: // поворот на 90° против часовой
+		dw, dh = h, w
+		from = func(x, y int) (int, int) { return w - 1 - y, x }
+	default:
+		return src
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			sx, sy := from(x, y)
+			copy(dst.Pix[y*dst.Stride+x*4:y*dst.Stride+x*4+4], src.Pix[sy*src.Stride+sx*4:])
+		}
+	}
+	return dst
+}
+
+// toGray переводит изображение в оттенки серого (яркость по ITU-R BT.601,
+// как color.GrayModel).
+func toGray(src *image.RGBA) *image.Gray {
+	b := src.Bounds()
+	dst := image.NewGray(b)
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			p := src.Pix[y*src.Stride+x*4:]
+			lum := (19595*uint32(p[0]) + 38470*uint32(p[1]) + 7471*uint32(p[2]) + 1<<15) >> 16
+			dst.Pix[y*dst.Stride+x] = uint8(lum)
+		}
+	}
+	return dst
+}
+
+// ExifOrientation возвращает тег Orientation (1..8) из APP1-сегмента JPEG;
+// 1 — тега нет или данные не JPEG.
+func ExifOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		switch {
+		case marker == 0xFF: // заполняющий байт
+			i++
+			continue
+		case marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7): // маркеры без длины
+			i += 2
+			continue
+		case marker == 0xDA || marker == 0xD9: // начались данные скана — EXIF уже не будет
+			return 1
+		}
+		size := int(binary.BigEndian.Uint16(data[i+2:]))
+		if size < 2 || i+2+size > len(data) {
+			return 1
+		}
+		seg := data[i+4 : i+2+size]
+		if marker == 0xE1 && bytes.HasPrefix(seg, []byte("Exif\x00\x00")) {
+			return tiffOrientation(seg[6:])
+		}
+		i += 2 + size
+	}
+	return 1
+}
+
+// tiffOrientation ищет тег 0x0112 в IFD0 TIFF-заголовка EXIF.
+func tiffOrientation(t []byte) int {
+	if len(t) < 8 {
+		return 1
+	}
+	var bo binary.ByteOrder
+	switch string(t[:2]) {
+	case "II":
+		bo = binary.LittleEndian
+	case "MM":
+		bo = binary.BigEndian
+	default:
+		return 1
+	}
+	off := int(bo.Uint32(t[4:8]))
+	if off < 8 || off+2 > len(t) {
+		return 1
+	}
+	n := int(bo.Uint16(t[off:]))
+	for k := 0; k < n; k++ {
+		e := off + 2 + 12*k
+		if e+12 > len(t) {
+			return 1
+		}
+		if bo.Uint16(t[e:]) == 0x0112 {
+			if v := int(bo.Uint16(t[e+8:])); v >= 1 && v <= 8 {
+				return v
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+// String описывает настройки пайплайна для лога запуска.
+func (p *ImagePipeline) String() string {
+	if p == nil {
+		return "off"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "max_dim=%d quality=%d max_bytes=%d grayscale=%v",
+		p.Options.MaxDim, p.Options.Quality, p.Options.MaxBytes, p.Options.Grayscale)
+	for _, k := range slices.Sorted(maps.Keys(p.MaxDimByModel)) {
+		fmt.Fprintf(&b, " %s=%d", k, p.MaxDimByModel[k])
+	}
+	return b.String()
+}
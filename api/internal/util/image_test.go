@@ -0,0 +1,221 @@
+package util
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math/rand"
+	"testing"
+)
+
+// halves рисует изображение w×h: левая половина красная, правая синяя.
+func halves(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.RGBA{R: 220, A: 255}
+			if x >= w/2 {
+				c = color.RGBA{B: 220, A: 255}
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+func encodeTestJPEG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// withOrientation вставляет после SOI сегмент APP1 с EXIF Orientation.
+func withOrientation(jpg []byte, orientation uint16) []byte {
+	var tiff bytes.Buffer
+	tiff.WriteString("II*\x00")
+	_ = binary.Write(&tiff, binary.LittleEndian, uint32(8))
+	_ = binary.Write(&tiff, binary.LittleEndian, uint16(1))
+	_ = binary.Write(&tiff, binary.LittleEndian, [4]uint16{0x0112, 3, 1, 0})
+	_ = binary.Write(&tiff, binary.LittleEndian, [2]uint16{orientation, 0})
+	_ = binary.Write(&tiff, binary.LittleEndian, uint32(0))
+	payload := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+
+	var out bytes.Buffer
+	out.Write(jpg[:2])
+	out.Write([]byte{0xFF, 0xE1})
+	_ = binary.Write(&out, binary.BigEndian, uint16(len(payload)+2))
+	out.Write(payload)
+	out.Write(jpg[2:])
+	return out.Bytes()
+}
+
+func decodeTest(t *testing.T, data []byte) image.Image {
+	t.Helper()
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+func isRed(c color.Color) bool {
+	r, _, b, _ := c.RGBA()
+	return r > 2*b
+}
+
+func TestExifOrientation(t *testing.T) {
+	jpg := encodeTestJPEG(t, halves(8, 4))
+	tests := []struct {
+		name string
+		data []byte
+		want int
+	}{
+		{"no exif", jpg, 1},
+		{"rotate 90 cw", withOrientation(jpg, 6), 6},
+		{"mirror", withOrientation(jpg, 2), 2},
+		{"out of range", withOrientation(jpg, 9), 1},
+		{"not jpeg", []byte("\x89PNG\r\n\x1a\n"), 1},
+		{"truncated", withOrientation(jpg, 6)[:10], 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExifOrientation(tt.data); got != tt.want {
+				t.Errorf("ExifOrientation() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrepareImage(t *testing.T) {
+	small := encodeTestJPEG(t, halves(40, 20))
+
+	t.Run("nothing to do keeps original bytes", func(t *testing.T) {
+		out, mime, st, err := PrepareImage(small, "image/jpeg", ImageOptions{MaxDim: 100}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(out, small) || mime != "image/jpeg" || st.Processed {
+			t.Fatalf("image changed: mime=%s stats=%+v", mime, st)
+		}
+		if st.BytesIn != len(small) || st.BytesOut != len(small) || st.Width != 40 || st.Height != 20 {
+			t.Errorf("stats = %+v", st)
+		}
+	})
+
+	t.Run("exif orientation is applied", func(t *testing.T) {
+		out, _, st, err := PrepareImage(withOrientation(small, 6), "image/jpeg", ImageOptions{}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !st.Processed || st.Width != 20 || st.Height != 40 {
+			t.Fatalf("stats = %+v", st)
+		}
+		img := decodeTest(t, out)
+		// Поворот на 90° по часовой: левая (красная) половина оказывается сверху.
+		if !isRed(img.At(10, 5)) || isRed(img.At(10, 35)) {
+			t.Error("image was not rotated clockwise")
+		}
+		if ExifOrientation(out) != 1 {
+			t.Error("re-encoded image must not carry orientation")
+		}
+	})
+
+	t.Run("png is downscaled to max dim and becomes jpeg", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, halves(400, 100)); err != nil {
+			t.Fatal(err)
+		}
+		out, mime, st, err := PrepareImage(buf.Bytes(), "image/png", ImageOptions{MaxDim: 100}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mime != "image/jpeg" || st.Width != 100 || st.Height != 25 || st.BytesOut != len(out) {
+			t.Fatalf("mime=%s stats=%+v", mime, st)
+		}
+		img := decodeTest(t, out)
+		if b := img.Bounds(); b.Dx() != 100 || b.Dy() != 25 {
+			t.Errorf("decoded size = %v", b)
+		}
+		if !isRed(img.At(10, 10)) || isRed(img.At(90, 10)) {
+			t.Error("downscaled content is wrong")
+		}
+	})
+
+	t.Run("grayscale", func(t *testing.T) {
+		out, _, st, err := PrepareImage(small, "image/jpeg", ImageOptions{Grayscale: true}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !st.Processed {
+			t.Fatalf("stats = %+v", st)
+		}
+		if _, ok := decodeTest(t, out).(*image.Gray); !ok {
+			t.Error("want single-channel JPEG")
+		}
+	})
+
+	t.Run("quality is lowered to reach max bytes", func(t *testing.T) {
+		noise := image.NewRGBA(image.Rect(0, 0, 200, 200))
+		rng := rand.New(rand.NewSource(1))
+		rng.Read(noise.Pix)
+		for i := 3; i < len(noise.Pix); i += 4 {
+			noise.Pix[i] = 255
+		}
+		src := encodeTestJPEG(t, noise)
+		target := len(src) / 2
+		out, _, st, err := PrepareImage(src, "image/jpeg", ImageOptions{MaxBytes: target}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !st.Processed || len(out) >= len(src) || st.BytesIn != len(src) || st.BytesOut != len(out) {
+			t.Fatalf("stats = %+v (target %d)", st, target)
+		}
+	})
+
+	t.Run("broken image passes through when provider accepts it", func(t *testing.T) {
+		webp := []byte("RIFF\x00\x00\x00\x00WEBPVP8 ")
+		out, mime, st, err := PrepareImage(webp, "image/webp", ImageOptions{MaxDim: 10, Grayscale: true}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(out, webp) || mime != "image/webp" || st.Processed {
+			t.Errorf("mime=%s stats=%+v", mime, st)
+		}
+	})
+}
+
+func TestImagePipeline_For(t *testing.T) {
+	dims, err := ParseImageMaxDims("gpt-4.1=2048, gpt-4.1-mini=1536")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &ImagePipeline{Options: ImageOptions{MaxDim: 1024}, MaxDimByModel: dims}
+	tests := []struct {
+		model string
+		want  int
+	}{
+		{"gpt-4.1-mini-2025-04-14", 1536},
+		{"openai/gpt-4.1", 2048},
+		{"gemini-2.5-flash", 1024},
+	}
+	for _, tt := range tests {
+		if got := p.For(tt.model).MaxDim; got != tt.want {
+			t.Errorf("For(%q).MaxDim = %d, want %d", tt.model, got, tt.want)
+		}
+	}
+	if _, err := ParseImageMaxDims("gpt-4.1"); err == nil {
+		t.Error("want error for entry without '='")
+	}
+
+	var off *ImagePipeline
+	data := []byte{0xFF, 0xD8, 0xFF}
+	if out, mime, st, err := off.Prepare("any", data, "image/jpeg", nil); err != nil || !bytes.Equal(out, data) || mime != "image/jpeg" || st.BytesOut != 3 {
+		t.Errorf("nil pipeline must pass through: %+v", st)
+	}
+}
@@ -0,0 +1,250 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	_ "golang.org/x/image/webp" // регистрирует декодер WebP для image.Decode
+)
+
+// ImageFormats — MIME-типы изображений, которые принимает провайдер.
+// Nil — принимается любой формат.
+type ImageFormats []string
+
+// Accepts сообщает, можно ли отправить провайдеру изображение в формате mime.
+func (f ImageFormats) Accepts(mime string) bool {
+	if f == nil {
+		return true
+	}
+	return slices.Contains(f, normalizeImageMIME(mime))
+}
+
+func normalizeImageMIME(mime string) string {
+	m := strings.ToLower(strings.TrimSpace(mime))
+	if m == "image/jpg" {
+		return "image/jpeg"
+	}
+	return m
+}
+
+// ImageDecoder декодирует формат, которого нет в стандартной библиотеке
+// и golang.org/x/image (HEIC, AVIF).
+type ImageDecoder interface {
+	Decode(data []byte) (image.Image, error)
+}
+
+var (
+	decodersMu sync.RWMutex
+	decoders   = map[string]ImageDecoder{}
+)
+
+// RegisterImageDecoder подключает декодер для MIME-типа. Изображения этого
+// формата перекодируются в JPEG, только если провайдер их не принимает.
+func RegisterImageDecoder(mime string, d ImageDecoder) {
+	decodersMu.Lock()
+	defer decodersMu.Unlock()
+	if d == nil {
+		delete(decoders, normalizeImageMIME(mime))
+		return
+	}
+	decoders[normalizeImageMIME(mime)] = d
+}
+
+func lookupImageDecoder(mime string) ImageDecoder {
+	decodersMu.RLock()
+	defer decodersMu.RUnlock()
+	return decoders[normalizeImageMIME(mime)]
+}
+
+// builtinImageMIME — форматы, которые image.Decode читает без внешних декодеров.
+func builtinImageMIME(mime string) bool {
+	switch normalizeImageMIME(mime) {
+	case "image/jpeg", "image/png", "image/gif", "image/webp":
+		return true
+	}
+	return false
+}
+
+const defaultDecoderTimeout = 30 * time.Second
+
+// Предел stdout внешнего декодера по умолчанию: вывод без потерь (PNG) во
+// много раз больше сжатого HEIC/AVIF на входе, но не меньше
+// minDecoderOutput и не больше 16-битного RGBA на maxDecodePixels пикселей.
+const (
+	decoderOutputFactor = 32
+	minDecoderOutput    = 64 << 20
+	maxDecoderOutput    = maxDecodePixels * 8
+)
+
+// CommandDecoder декодирует изображение внешней программой: байты подаются
+// на stdin, на stdout ожидается изображение в формате, который читает
+// image.Decode (PNG, JPEG). Например: ["magick", "-", "png:-"].
+type CommandDecoder struct {
+	Args      []string      // программа и аргументы
+	Timeout   time.Duration // 0 — 30 секунд
+	MaxOutput int64         // предел stdout в байтах; 0 — по размеру входа
+}
+
+// outputLimit — предел stdout для входа размером n байт.
+func (d CommandDecoder) outputLimit(n int) int64 {
+	if d.MaxOutput > 0 {
+		return d.MaxOutput
+	}
+	return min(max(int64(n)*decoderOutputFactor, minDecoderOutput), maxDecoderOutput)
+}
+
+// cappedBuffer — буфер вывода программы с пределом. Для stdout запись сверх
+// limit отклоняется: exec закрывает pipe, и программа завершается, не заняв
+// лишней памяти. Для stderr (truncate) лишнее молча отбрасывается — это
+// только текст ошибки. bytes.Buffer не встраивается: его ReadFrom
+// позволил бы io.Copy обойти предел.
+type cappedBuffer struct {
+	buf      bytes.Buffer
+	limit    int64
+	truncate bool
+	exceeded bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - int64(b.buf.Len()); int64(len(p)) > room {
+		b.exceeded = true
+		if !b.truncate {
+			return 0, errors.New("output limit exceeded")
+		}
+		b.buf.Write(p[:max(room, 0)])
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (d CommandDecoder) Decode(data []byte) (image.Image, error) {
+	if len(d.Args) == 0 {
+		return nil, errors.New("image decoder: empty command")
+	}
+	timeout := d.Timeout
+	if timeout <= 0 {
+		timeout = defaultDecoderTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, d.Args[0], d.Args[1:]...)
+	cmd.Stdin = bytes.NewReader(data)
+	stdout := &cappedBuffer{limit: d.outputLimit(len(data))}
+	stderr := &cappedBuffer{limit: 4 << 10, truncate: true}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	err := cmd.Run()
+	if stdout.exceeded {
+		return nil, fmt.Errorf("image decoder %s: output is larger than %d bytes", d.Args[0], stdout.limit)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("image decoder %s: %w: %s", d.Args[0], err, strings.TrimSpace(stderr.buf.String()))
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(stdout.buf.Bytes()))
+	if err != nil {
+		return nil, fmt.Errorf("image decoder %s: output: %w", d.Args[0], err)
+	}
+	if tooManyPixels(cfg.Width, cfg.Height) {
+		return nil, fmt.Errorf("image decoder %s: output: %w", d.Args[0], errTooManyPixels)
+	}
+	img, _, err := image.Decode(&stdout.buf)
+	if err != nil {
+		return nil, fmt.Errorf("image decoder %s: output: %w", d.Args[0], err)
+	}
+	return img, nil
+}
+
+// decodeAnyImage декодирует изображение встроенным или зарегистрированным
+// декодером. Размер внешнего формата проверяется по заголовку HEIC/AVIF до
+// запуска декодера и по результату — после: встроенные форматы вызывающий
+// проверяет сам через image.DecodeConfig.
+func decodeAnyImage(data []byte, mime string) (image.Image, error) {
+	if d := lookupImageDecoder(mime); d != nil {
+		if w, h, ok := heifSize(data); ok && tooManyPixels(w, h) {
+			return nil, errTooManyPixels
+		}
+		img, err := d.Decode(data)
+		if err != nil {
+			return nil, err
+		}
+		if b := img.Bounds(); tooManyPixels(b.Dx(), b.Dy()) {
+			return nil, errTooManyPixels
+		}
+		return img, nil
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	return img, err
+}
+
+// heifSize читает размеры HEIC/AVIF из свойства ispe (meta → iprp → ipco)
+// без декодирования. У сетки плиток ispe есть и у плиток, и у всего
+// изображения — берётся наибольший. ok=false — заголовок не разобран.
+func heifSize(data []byte) (w, h int, ok bool) {
+	meta, found := isoBox(data, "meta")
+	if !found || len(meta) < 4 {
+		return 0, 0, false
+	}
+	iprp, found := isoBox(meta[4:], "iprp") // meta — full box: version и flags
+	if !found {
+		return 0, 0, false
+	}
+	ipco, found := isoBox(iprp, "ipco")
+	if !found {
+		return 0, 0, false
+	}
+	eachISOBox(ipco, func(typ string, payload []byte) bool {
+		if typ == "ispe" && len(payload) >= 12 {
+			pw, ph := int(binary.BigEndian.Uint32(payload[4:])), int(binary.BigEndian.Uint32(payload[8:]))
+			if !ok || uint64(pw)*uint64(ph) > uint64(w)*uint64(h) {
+				w, h, ok = pw, ph, true
+			}
+		}
+		return true
+	})
+	return w, h, ok
+}
+
+// isoBox возвращает содержимое первого бокса ISO BMFF типа typ верхнего уровня data.
+func isoBox(data []byte, typ string) (payload []byte, ok bool) {
+	eachISOBox(data, func(t string, p []byte) bool {
+		if t == typ {
+			payload, ok = p, true
+			return false
+		}
+		return true
+	})
+	return payload, ok
+}
+
+// eachISOBox перебирает боксы ISO BMFF верхнего уровня data, пока fn
+// возвращает true. Обрезанный бокс завершает перебор.
+func eachISOBox(data []byte, fn func(typ string, payload []byte) bool) {
+	for len(data) >= 8 {
+		size, header := uint64(binary.BigEndian.Uint32(data)), uint64(8)
+		switch size {
+		case 0: // до конца данных
+			size = uint64(len(data))
+		case 1: // 64-битный размер после типа
+			if len(data) < 16 {
+				return
+			}
+			size, header = binary.BigEndian.Uint64(data[8:]), 16
+		}
+		if size < header || size > uint64(len(data)) {
+			return
+		}
+		if !fn(string(data[4:8]), data[header:size]) {
+			return
+		}
+		data = data[size:]
+	}
+}
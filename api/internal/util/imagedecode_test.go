@@ -0,0 +1,208 @@
+package util
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stubDecoder возвращает фиксированное изображение вместо внешней программы:
+// декодер HEIC/AVIF есть не везде, где запускаются тесты.
+type stubDecoder struct{ img image.Image }
+
+func (d stubDecoder) Decode([]byte) (image.Image, error) { return d.img, nil }
+
+// hugeImage — изображение больше maxDecodePixels без выделения памяти под пиксели.
+type hugeImage struct{}
+
+func (hugeImage) ColorModel() color.Model { return color.GrayModel }
+func (hugeImage) Bounds() image.Rectangle { return image.Rect(0, 0, 10_000, 10_000) }
+func (hugeImage) At(int, int) color.Color { return color.Gray{} }
+
+func readTestdata(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestPrepareImage_Transcoding(t *testing.T) {
+	openai := ImageFormats{"image/jpeg", "image/png", "image/webp"}
+	gemini := ImageFormats{"image/jpeg", "image/png", "image/webp", "image/heic", "image/heif"}
+	jpegPNG := ImageFormats{"image/jpeg", "image/png"}
+
+	var gifBuf bytes.Buffer
+	if err := gif.Encode(&gifBuf, halves(16, 8), nil); err != nil {
+		t.Fatal(err)
+	}
+	webp := readTestdata(t, "sample.webp")
+	heic := readTestdata(t, "sample.heic")
+	avif := readTestdata(t, "sample.avif")
+
+	tests := []struct {
+		name     string
+		data     []byte
+		accept   ImageFormats
+		decoders map[string]ImageDecoder
+		wantMIME string
+		wantW    int
+		wantErr  string
+	}{
+		{name: "webp accepted as is", data: webp, accept: openai, wantMIME: "image/webp"},
+		{name: "webp decoded in pure go", data: webp, accept: jpegPNG, wantMIME: "image/jpeg", wantW: 150},
+		{name: "gif converted for openai", data: gifBuf.Bytes(), accept: openai, wantMIME: "image/jpeg", wantW: 16},
+		{name: "heic native on gemini", data: heic, accept: gemini, wantMIME: "image/heic"},
+		{name: "heic without decoder", data: heic, accept: openai, wantErr: "not accepted by the provider"},
+		{
+			name: "heic through registered decoder", data: heic, accept: openai,
+			decoders: map[string]ImageDecoder{"image/heic": stubDecoder{halves(30, 10)}},
+			wantMIME: "image/jpeg", wantW: 30,
+		},
+		{
+			name: "avif through registered decoder on gemini", data: avif, accept: gemini,
+			decoders: map[string]ImageDecoder{"image/avif": stubDecoder{halves(12, 6)}},
+			wantMIME: "image/jpeg", wantW: 12,
+		},
+		{
+			name: "decoded heic over pixel limit", data: heic, accept: openai,
+			decoders: map[string]ImageDecoder{"image/heic": stubDecoder{hugeImage{}}},
+			wantErr:  "larger than",
+		},
+		{
+			name: "avif header over pixel limit", data: withISPE(t, avif, 10_000, 10_000), accept: openai,
+			decoders: map[string]ImageDecoder{"image/avif": stubDecoder{halves(12, 6)}},
+			wantErr:  "larger than",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for mime, d := range tt.decoders {
+				RegisterImageDecoder(mime, d)
+				defer RegisterImageDecoder(mime, nil)
+			}
+			mime := PickMIME("", "", tt.data)
+			out, gotMIME, st, err := PrepareImage(tt.data, mime, ImageOptions{}, tt.accept)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if gotMIME != tt.wantMIME {
+				t.Fatalf("mime = %s, want %s", gotMIME, tt.wantMIME)
+			}
+			if tt.wantW == 0 {
+				if !bytes.Equal(out, tt.data) || st.Processed {
+					t.Errorf("accepted format must pass through, stats = %+v", st)
+				}
+				return
+			}
+			if img := decodeTest(t, out); img.Bounds().Dx() != tt.wantW || st.Width != tt.wantW || !st.Processed {
+				t.Errorf("decoded width = %d, stats = %+v, want %d", img.Bounds().Dx(), st, tt.wantW)
+			}
+		})
+	}
+}
+
+func TestCommandDecoder(t *testing.T) {
+	if _, err := exec.LookPath("cat"); err != nil {
+		t.Skip("cat not available")
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, halves(10, 4)); err != nil {
+		t.Fatal(err)
+	}
+	img, err := CommandDecoder{Args: []string{"cat"}}.Decode(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dx() != 10 || img.Bounds().Dy() != 4 {
+		t.Errorf("bounds = %v", img.Bounds())
+	}
+
+	if _, err := (CommandDecoder{Args: []string{"false"}}).Decode(buf.Bytes()); err == nil {
+		t.Error("want error for failing command")
+	}
+	if _, err := (CommandDecoder{}).Decode(buf.Bytes()); err == nil {
+		t.Error("want error for empty command")
+	}
+	if _, err := (CommandDecoder{Args: []string{"cat"}, MaxOutput: 16}).Decode(buf.Bytes()); err == nil || !strings.Contains(err.Error(), "larger than 16 bytes") {
+		t.Errorf("over the output cap: err = %v", err)
+	}
+}
+
+// TestCommandDecoder_EndlessOutput: программа, которая пишет без конца,
+// останавливается на пределе stdout, а не съедает память.
+func TestCommandDecoder_EndlessOutput(t *testing.T) {
+	if _, err := exec.LookPath("yes"); err != nil {
+		t.Skip("yes not available")
+	}
+	_, err := CommandDecoder{Args: []string{"yes"}, MaxOutput: 1 << 20, Timeout: 10 * time.Second}.Decode([]byte("x"))
+	if err == nil || !strings.Contains(err.Error(), "output is larger than") {
+		t.Errorf("err = %v, want output limit error", err)
+	}
+}
+
+// withISPE — копия HEIC/AVIF с другими размерами в свойстве ispe.
+func withISPE(t *testing.T, data []byte, w, h uint32) []byte {
+	t.Helper()
+	out := bytes.Clone(data)
+	i := bytes.Index(out, []byte("ispe"))
+	if i < 0 || i+16 > len(out) {
+		t.Fatal("no ispe box")
+	}
+	binary.BigEndian.PutUint32(out[i+8:], w)
+	binary.BigEndian.PutUint32(out[i+12:], h)
+	return out
+}
+
+func TestHeifSize(t *testing.T) {
+	tests := []struct {
+		name string
+		w, h int
+	}{
+		// В sample.heic два свойства ispe, 64×64 и 64×48: для лимита
+		// берётся большее.
+		{"sample.heic", 64, 64},
+		{"sample.avif", 64, 48},
+	}
+	for _, tt := range tests {
+		w, h, ok := heifSize(readTestdata(t, tt.name))
+		if !ok || w != tt.w || h != tt.h {
+			t.Errorf("heifSize(%s) = %d×%d, %v; want %d×%d", tt.name, w, h, ok, tt.w, tt.h)
+		}
+	}
+	if _, _, ok := heifSize([]byte("\x00\x00\x00\x18ftypheic")); ok {
+		t.Error("heifSize() of a truncated header must fail")
+	}
+}
+
+// TestCommandDecoder_RealSamples декодирует тестовые HEIC и AVIF внешней
+// программой, если она установлена.
+func TestCommandDecoder_RealSamples(t *testing.T) {
+	if _, err := exec.LookPath("magick"); err != nil {
+		t.Skip("magick not available")
+	}
+	for _, name := range []string{"sample.heic", "sample.avif"} {
+		img, err := CommandDecoder{Args: []string{"magick", "-", "png:-"}}.Decode(readTestdata(t, name))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if b := img.Bounds(); b.Dx() != 64 || b.Dy() != 48 || !isRed(img.At(0, 0)) || isRed(img.At(63, 0)) {
+			t.Errorf("%s: bounds %v, want 64×48 red|blue halves", name, b)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package util
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"math"
+)
+
+// analysisDim — сторона, к которой приводится изображение перед оценкой
+// резкости: дисперсия лапласиана зависит от масштаба, и без приведения
+// пороги пришлось бы подбирать под каждое разрешение камеры.
+const analysisDim = 1024
+
+// ImageQuality — локальные оценки качества фото.
+type ImageQuality struct {
+	Width      int // исходные размеры с учётом EXIF-поворота
+	Height     int
+	Aspect     float64 // отношение длинной стороны к короткой, ≥ 1
+	Blur       float64 // дисперсия лапласиана яркости; меньше — размытее
+	Brightness float64 // средняя яркость, 0..255
+	Contrast   float64 // СКО яркости, 0..127
+}
+
+// AnalyzeImage оценивает резкость, яркость, контраст и геометрию фото
+// без обращения к модели. Форматы без декодера возвращают ошибку. Размер
+// встроенных форматов проверяется до декодирования, внешних — в decodeAnyImage.
+func AnalyzeImage(data []byte, mime string) (ImageQuality, error) {
+	var q ImageQuality
+	if builtinImageMIME(mime) && lookupImageDecoder(mime) == nil {
+		cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			return q, fmt.Errorf("decode config: %w", err)
+		}
+		if tooManyPixels(cfg.Width, cfg.Height) {
+			return q, errTooManyPixels
+		}
+	}
+	src, err := decodeAnyImage(data, mime)
+	if err != nil {
+		return q, err
+	}
+	b := src.Bounds()
+	if b.Dx() <= 0 || b.Dy() <= 0 {
+		return q, errors.New("empty image")
+	}
+	q.Width, q.Height = b.Dx(), b.Dy()
+	if o := ExifOrientation(data); o >= 5 {
+		q.Width, q.Height = q.Height, q.Width
+	}
+	q.Aspect = float64(max(q.Width, q.Height)) / float64(min(q.Width, q.Height))
+
+	img := toRGBA(src)
+	if w, h := fitWithin(b.Dx(), b.Dy(), analysisDim); w != b.Dx() || h != b.Dy() {
+		img = downscale(img, w, h)
+	}
+	gray := toGray(img)
+	q.Brightness, q.Contrast = lumaStats(gray)
+	q.Blur = laplacianVariance(gray)
+	return q, nil
+}
+
+// lumaStats возвращает среднюю яркость и её СКО.
+func lumaStats(g *image.Gray) (mean, stddev float64) {
+	w, h := g.Bounds().Dx(), g.Bounds().Dy()
+	var sum, sq float64
+	for y := 0; y < h; y++ {
+		for _, v := range g.Pix[y*g.Stride : y*g.Stride+w] {
+			f := float64(v)
+			sum += f
+			sq += f * f
+		}
+	}
+	n := float64(w * h)
+	mean = sum / n
+	return mean, math.Sqrt(max(0, sq/n-mean*mean))
+}
+
+// laplacianVariance — дисперсия отклика 4-связного лапласиана по внутренним
+// пикселям: у резкого текста много перепадов яркости, у размытого — мало.
+func laplacianVariance(g *image.Gray) float64 {
+	w, h := g.Bounds().Dx(), g.Bounds().Dy()
+	if w < 3 || h < 3 {
+		return 0
+	}
+	at := func(x, y int) float64 { return float64(g.Pix[y*g.Stride+x]) }
+	var sum, sq float64
+	for y := 1; y < h-1; y++ {
+		for x := 1; x < w-1; x++ {
+			l := at(x-1, y) + at(x+1, y) + at(x, y-1) + at(x, y+1) - 4*at(x, y)
+			sum += l
+			sq += l * l
+		}
+	}
+	n := float64((w - 2) * (h - 2))
+	mean := sum / n
+	return sq/n - mean*mean
+}
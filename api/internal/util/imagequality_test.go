@@ -0,0 +1,85 @@
+package util
+
+import (
+	"image"
+	"strings"
+	"testing"
+
+	"llm-proxy/api/internal/util/imagetest"
+)
+
+func TestAnalyzeImage(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  []byte
+		check func(t *testing.T, q ImageQuality)
+	}{
+		{"sharp text", imagetest.Stripes(800, 600, 20, 235), func(t *testing.T, q ImageQuality) {
+			if q.Blur < 1000 || q.Contrast < 100 || q.Brightness < 100 || q.Brightness > 155 {
+				t.Errorf("quality = %+v", q)
+			}
+		}},
+		{"flat page", imagetest.Stripes(800, 600, 128, 128), func(t *testing.T, q ImageQuality) {
+			if q.Blur != 0 || q.Contrast != 0 || q.Brightness != 128 {
+				t.Errorf("quality = %+v", q)
+			}
+		}},
+		{"dark", imagetest.Stripes(800, 600, 5, 25), func(t *testing.T, q ImageQuality) {
+			if q.Brightness > 20 || q.Contrast > 15 {
+				t.Errorf("quality = %+v", q)
+			}
+		}},
+		{"geometry", imagetest.Stripes(1000, 250, 0, 255), func(t *testing.T, q ImageQuality) {
+			if q.Width != 1000 || q.Height != 250 || q.Aspect != 4 {
+				t.Errorf("quality = %+v", q)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := AnalyzeImage(tt.data, "image/png")
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.check(t, q)
+		})
+	}
+
+	if _, err := AnalyzeImage([]byte("not an image"), "image/png"); err == nil {
+		t.Error("want error for undecodable data")
+	}
+}
+
+// TestAnalyzeImage_ExternalFormats проверяет, что ограничение на число
+// пикселей действует и для форматов с внешним декодером.
+func TestAnalyzeImage_ExternalFormats(t *testing.T) {
+	heic := readTestdata(t, "sample.heic")
+	tests := []struct {
+		name    string
+		img     image.Image
+		wantW   int
+		wantErr string
+	}{
+		{name: "decoded", img: halves(64, 48), wantW: 64},
+		{name: "too many pixels", img: hugeImage{}, wantErr: "larger than"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			RegisterImageDecoder("image/heic", stubDecoder{tt.img})
+			defer RegisterImageDecoder("image/heic", nil)
+			q, err := AnalyzeImage(heic, "image/heic")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("AnalyzeImage() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if q.Width != tt.wantW {
+				t.Errorf("width = %d, want %d", q.Width, tt.wantW)
+			}
+		})
+	}
+}
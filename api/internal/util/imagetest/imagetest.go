@@ -0,0 +1,29 @@
+// Package imagetest — синтетические изображения для тестов, которым нужны
+// настоящие фото с управляемыми резкостью и яркостью.
+package imagetest
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+)
+
+// Stripes кодирует в PNG изображение w×h в клетку 4×4 пикселя из яркостей
+// lo и hi — грубая модель строк текста на бумаге. При lo == hi получается
+// ровный лист без деталей.
+func Stripes(w, h int, lo, hi uint8) []byte {
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := hi
+			if (x/4+y/4)%2 == 0 {
+				v = lo
+			}
+			img.SetGray(x, y, color.Gray{Y: v})
+		}
+	}
+	var buf bytes.Buffer
+	_ = png.Encode(&buf, img)
+	return buf.Bytes()
+}
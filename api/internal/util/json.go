@@ -4,58 +4,88 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	prompt1 "llm-proxy/api/internal/v1/prompt"
 	prompt2 "llm-proxy/api/internal/v2/prompt"
 )
 
+// PromptRoot возвращает корень каталога промптов: override, если задан
+// (эксперименты с альтернативными промптами), иначе PROMPT_DIR или путь по умолчанию.
+func PromptRoot(override string) string {
+	if override != "" {
+		return override
+	}
+	if root := os.Getenv("PROMPT_DIR"); root != "" {
+		return root
+	}
+	return filepath.Join("api", "internal")
+}
+
+// GradeSubdir — подкаталог промптов класса: "1_class"…"4_class"; пусто для
+// неизвестного класса.
+func GradeSubdir(grade int) string {
+	if grade < 1 || grade > 4 {
+		return ""
+	}
+	return fmt.Sprintf("%d_class", grade)
+}
+
 func LoadSystemPrompt(name, provider, version string, subdirs ...string) (string, error) {
+	return LoadSystemPromptIn("", name, provider, version, subdirs...)
+}
+
+// LoadSystemPromptIn — LoadSystemPrompt с явным корнем промптов (пустой — PromptRoot по умолчанию).
+func LoadSystemPromptIn(root, name, provider, version string, subdirs ...string) (string, error) {
 	// Try to load from subdirectories first
 	if len(subdirs) > 0 {
-		if p, err := cachedLoadPromptSubdirs(name, "system", provider, version, subdirs...); err == nil {
+		if p, err := cachedLoadPromptSubdirs(root, name, "system", provider, version, subdirs...); err == nil {
 			return p, nil
 		}
 		for _, subdir := range subdirs {
-			if p, err := cachedLoadPromptSubdirs(name, "system", provider, version, subdir); err == nil {
+			if p, err := cachedLoadPromptSubdirs(root, name, "system", provider, version, subdir); err == nil {
 				return p, nil
 			}
 		}
 	}
 
 	// Fallback to universal prompt
-	system, err := cachedLoadPromptSubdirs("universal", "system", provider, version, "universal")
+	system, err := cachedLoadPromptSubdirs(root, "universal", "system", provider, version, "universal")
 	if err != nil {
-		system, err = cachedLoadPrompt("universal", "system", provider, version)
+		system, err = cachedLoadPrompt(root, "universal", "system", provider, version)
 	}
 	return system, err
 }
 
 func LoadUserPrompt(name, provider, version string, subdirs ...string) (string, error) {
+	return LoadUserPromptIn("", name, provider, version, subdirs...)
+}
+
+// LoadUserPromptIn — LoadUserPrompt с явным корнем промптов.
+func LoadUserPromptIn(root, name, provider, version string, subdirs ...string) (string, error) {
 	// Try to load from subdirectories first
 	if len(subdirs) > 0 {
-		if p, err := cachedLoadPromptSubdirs(name, "user", provider, version, subdirs...); err == nil {
+		if p, err := cachedLoadPromptSubdirs(root, name, "user", provider, version, subdirs...); err == nil {
 			return p, nil
 		}
 		for _, subdir := range subdirs {
-			if p, err := cachedLoadPromptSubdirs(name, "user", provider, version, subdir); err == nil {
+			if p, err := cachedLoadPromptSubdirs(root, name, "user", provider, version, subdir); err == nil {
 				return p, nil
 			}
 		}
 	}
-	return cachedLoadPrompt(name, "user", provider, version)
+	return cachedLoadPrompt(root, name, "user", provider, version)
 }
 
-func loadPrompt(name, tp, provider, version string, subdirs ...string) (string, error) {
+func loadPrompt(root, name, tp, provider, version string, subdirs ...string) (string, error) {
 	if provider == "" {
 		return "", fmt.Errorf("provider is empty")
 	}
-	baseRoot := os.Getenv("PROMPT_DIR")
-	if baseRoot == "" {
-		baseRoot = filepath.Join("api", "internal")
-	}
+	baseRoot := PromptRoot(root)
 
 	// Промпты общие для всех провайдеров — лежат в v2/prompt/
 	pathParts := []string{baseRoot, version, "prompt"}
@@ -88,10 +118,12 @@ func loadPrompt(name, tp, provider, version string, subdirs ...string) (string,
 
 // Загружаем <name>.schema.json из PROMPT_SCHEMA_DIR, иначе берём из встроенных prompt.*.
 func LoadPromptSchema(name, version string) (map[string]any, error) {
-	baseRoot := os.Getenv("PROMPT_DIR")
-	if baseRoot == "" {
-		baseRoot = filepath.Join("api", "internal")
-	}
+	return LoadPromptSchemaIn("", name, version)
+}
+
+// LoadPromptSchemaIn — LoadPromptSchema с явным корнем промптов.
+func LoadPromptSchemaIn(root, name, version string) (map[string]any, error) {
+	baseRoot := PromptRoot(root)
 	p := filepath.Join(baseRoot, version, "prompt", name+".schema.json")
 	log.Printf("schema path: %s", p)
 	if b, err := os.ReadFile(p); err == nil && len(b) > 0 {
@@ -171,8 +203,10 @@ func FixJSONSchemaStrict(node any) {
 			if _, hasType := n["type"]; !hasType {
 				n["type"] = "object"
 			}
+			// Порядок ключей фиксирован: тело запроса к провайдеру должно быть
+			// детерминированным (кассеты, кэш промптов).
 			req := make([]any, 0, len(props))
-			for k := range props {
+			for _, k := range slices.Sorted(maps.Keys(props)) {
 				req = append(req, k)
 			}
 			n["required"] = req
@@ -0,0 +1,33 @@
+package util
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// ParsePrefixes разбирает список CIDR или отдельных IP через запятую.
+func ParsePrefixes(raw string) ([]netip.Prefix, error) {
+	parts := strings.Split(raw, ",")
+	prefixes := make([]netip.Prefix, 0, len(parts))
+	for _, part := range parts {
+		value := strings.TrimSpace(part)
+		if value == "" {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			address, addressErr := netip.ParseAddr(value)
+			if addressErr != nil {
+				return nil, fmt.Errorf("invalid CIDR or IP %q: %w", value, err)
+			}
+			bits := 128
+			if address.Is4() {
+				bits = 32
+			}
+			prefix = netip.PrefixFrom(address, bits)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
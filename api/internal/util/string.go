@@ -21,6 +21,10 @@ type ResponsesEnvelope struct {
 	Usage struct {
 		InputTokens  int `json:"input_tokens"`
 		OutputTokens int `json:"output_tokens"`
+		// InputTokensDetails.CachedTokens — часть input_tokens, прочитанная из кэша промпта.
+		InputTokensDetails struct {
+			CachedTokens int `json:"cached_tokens"`
+		} `json:"input_tokens_details"`
 	} `json:"usage"`
 }
 
@@ -34,6 +38,16 @@ func ExtractResponsesUsage(raw []byte) (inputTokens, outputTokens int) {
 	return env.Usage.InputTokens, env.Usage.OutputTokens
 }
 
+// ExtractResponsesCachedTokens возвращает usage.input_tokens_details.cached_tokens —
+// сколько входных токенов OpenAI взял из кэша промпта (тарифицируются со скидкой).
+func ExtractResponsesCachedTokens(raw []byte) int {
+	var env ResponsesEnvelope
+	if err := json.Unmarshal(raw, &env); err != nil {
+		return 0
+	}
+	return env.Usage.InputTokensDetails.CachedTokens
+}
+
 // ExtractResponsesText reads the OpenAI Responses API JSON and returns the first output_text text.
 func ExtractResponsesText(r io.Reader) (string, error) {
 	var env ResponsesEnvelope
@@ -0,0 +1,154 @@
+package arith
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		expr    string
+		want    string
+		wantErr bool
+	}{
+		{expr: "12 + 5", want: "17"},
+		{expr: "36 : 4 + 5", want: "14"},
+		{expr: "2 · (3 + 4)", want: "14"},
+		{expr: "100 − 4 × 5", want: "80"},
+		{expr: "3,5 + 1.5", want: "5"},
+		{expr: "1/2 + 1/4", want: "0.75"},
+		{expr: "10 ÷ 3", want: "10/3"},
+		{expr: "60 090 - 90", want: "60000"},
+		{expr: "-3 + 5", want: "2"},
+		{expr: "5 : 0", wantErr: true},
+		{expr: "(2 + 3", wantErr: true},
+		{expr: "x + 5", wantErr: true},
+		{expr: "5 6", wantErr: true},
+		{expr: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := Eval(tt.expr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Eval(%q) error = %v, wantErr %v", tt.expr, err, tt.wantErr)
+			}
+			if err == nil && Format(got) != tt.want {
+				t.Errorf("Eval(%q) = %s, want %s", tt.expr, Format(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckStep(t *testing.T) {
+	tests := []struct {
+		name string
+		step string
+		want []string // Mismatch.String()
+	}{
+		{name: "correct", step: "1) 27444 + 32646 = 60090 (руб.)"},
+		{name: "wrong sum", step: "27444 + 32646 = 59844 руб.", want: []string{"27444 + 32646 = 60090, not 59844"}},
+		{name: "chain", step: "P = 2 · (3 + 4) = 2 · 7 = 15 см", want: []string{"2 · 7 = 14, not 15"}},
+		{name: "colon after word", step: "Всего: 12 + 5 = 17."},
+		{name: "several equalities", step: "12 - 5 = 7, 7 + 3 = 11", want: []string{"7 + 3 = 10, not 11"}},
+		{name: "remainder", step: "17 : 5 = 3 (ост. 2)"},
+		{name: "wrong remainder", step: "17 : 5 = 3 (ост. 1)", want: []string{"17 : 5 = 3 (ост. 2), not 3 (ост. 1)"}},
+		{name: "rounded", step: "10 : 3 = 3,33"},
+		{name: "fraction", step: "3/6 = 1/2"},
+		{name: "equation is skipped", step: "x + 5 = 12, x = 12 - 5 = 7"},
+		{name: "words in the middle", step: "1/2 от 10 = 5"},
+		{name: "units", step: "3 кг 200 г = 3200 г"},
+		{name: "numbered step", step: "Шаг 1: 12 + 5 = 17"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, m := range CheckStep(tt.step) {
+				got = append(got, m.String())
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("CheckStep(%q) = %q, want %q", tt.step, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTaskValue(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+		ok   bool
+	}{
+		{text: "36 : 4 + 5 =", want: "14", ok: true},
+		{text: "Вычисли: (12 + 8) · 3 = ?", want: "60", ok: true},
+		{text: "48 − 19 = …", want: "29", ok: true},
+		{text: "У Маши 5 яблок, у Пети на 3 больше.", ok: false},
+		{text: "17", ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got, ok := TaskValue(tt.text)
+			if ok != tt.ok || (ok && Format(got) != tt.want) {
+				t.Errorf("TaskValue(%q) = %v, %v; want %s, %v", tt.text, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestAnswerValue(t *testing.T) {
+	tests := []struct {
+		answer string
+		want   string
+		ok     bool
+	}{
+		{answer: "17", want: "17", ok: true},
+		{answer: "60 090 руб.", want: "60090", ok: true},
+		{answer: "1/2 торта", want: "0.5", ok: true},
+		{answer: "3,5", want: "3.5", ok: true},
+		{answer: "3 (ост. 2)", ok: false},
+		{answer: "5 + 3 яблока", ok: false},
+		{answer: "квадрат", ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.answer, func(t *testing.T) {
+			got, ok := AnswerValue(tt.answer)
+			if ok != tt.ok || (ok && Format(got) != tt.want) {
+				t.Errorf("AnswerValue(%q) = %v, %v; want %s, %v", tt.answer, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestStepResults(t *testing.T) {
+	tests := []struct {
+		step string
+		want []string
+	}{
+		{step: "1) 12 + 5 = 17 (яблок)", want: []string{"17"}},
+		{step: "P = 2 · (3 + 4) = 2 · 7 = 14 см", want: []string{"14"}},
+		{step: "12 - 5 = 7, 7 + 3 = 10", want: []string{"7", "10"}},
+		{step: "Половина: 1 : 2 = 1/2", want: []string{"0.5"}},
+		{step: "Сложим числа", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.step, func(t *testing.T) {
+			var got []string
+			for _, v := range StepResults(tt.step) {
+				got = append(got, Format(v))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("StepResults(%q) = %q, want %q", tt.step, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNumbers(t *testing.T) {
+	var got []string
+	for _, n := range Numbers("Возьми 12 яблок и ещё двадцать пять, потом 0,5 и 3/4. Получится сто.") {
+		got = append(got, Format(n.Value))
+	}
+	want := []string{"12", "0.5", "0.75", "25", "100"}
+	if !slices.Equal(got, want) {
+		t.Errorf("Numbers() = %q, want %q", got, want)
+	}
+}
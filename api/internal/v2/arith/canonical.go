@@ -0,0 +1,332 @@
+package arith
+
+import (
+	"math/big"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Kind — вид ответа после канонизации.
+type Kind string
+
+const (
+	KindNumber    Kind = "number"    // число или дробь: "3/4", "0,75", "XIV", "двенадцать"
+	KindRemainder Kind = "remainder" // деление с остатком: "7 ост. 2"
+	KindQuantity  Kind = "quantity"  // величина с единицами: "1 м 20 см"
+	KindList      Kind = "list"      // перечисление: "2, 4, 6"
+	KindText      Kind = "text"      // всё остальное: нормализованная строка
+)
+
+// Answer — канонический вид ответа ученика или эталона. Равные по смыслу
+// записи ("3/4" и "0,75", "XIV" и "14", "1 м 20 см" и "120 см") получают
+// одинаковый Canonical.
+type Answer struct {
+	Kind      Kind      `json:"kind"`
+	Canonical string    `json:"canonical"`           // ключ сравнения
+	Decimal   string    `json:"decimal,omitempty"`   // конечная десятичная запись дробного числа
+	Dimension Dimension `json:"dimension,omitempty"` // для величин
+	Items     []Answer  `json:"items,omitempty"`     // элементы списка по порядку
+}
+
+func (a Answer) key() string { return string(a.Kind) + ":" + a.Canonical }
+
+// Equal сравнивает канонические ответы. ordered — порядок элементов списка
+// важен ("запиши в порядке возрастания"); иначе списки сравниваются как
+// мультимножества.
+func (a Answer) Equal(b Answer, ordered bool) bool {
+	if a.Kind != b.Kind {
+		return false
+	}
+	if a.Kind != KindList {
+		return a.Canonical == b.Canonical
+	}
+	if len(a.Items) != len(b.Items) {
+		return false
+	}
+	ka, kb := make([]string, len(a.Items)), make([]string, len(b.Items))
+	for i := range a.Items {
+		ka[i], kb[i] = a.Items[i].key(), b.Items[i].key()
+	}
+	if !ordered {
+		slices.Sort(ka)
+		slices.Sort(kb)
+	}
+	return slices.Equal(ka, kb)
+}
+
+// Equivalent сообщает, что два ответа равны по смыслу.
+func Equivalent(a, b string, ordered bool) bool {
+	return Canonicalize(a).Equal(Canonicalize(b), ordered)
+}
+
+var (
+	reCanonRemainder = regexp.MustCompile(`^(\d+)\s*,?\s*\(?\s*ост(?:аток|\.)?\s*:?\s*(\d+)\s*\)?$`)
+	reCanonNumber    = regexp.MustCompile(`^[-+]?(?:\d{1,3}(?:\s\d{3})+|\d+)(?:[.,]\d+)?$`)
+	reCanonFraction  = regexp.MustCompile(`^(?:(\d+)\s+)?(\d+)\s*/\s*(\d+)$`)
+	reCanonRoman     = regexp.MustCompile(`^M{0,3}(?:CM|CD|D?C{0,3})(?:XC|XL|L?X{0,3})(?:IX|IV|V?I{0,3})$`)
+	reCanonListSep   = regexp.MustCompile(`\s*;\s*|,\s+|\s+и\s+`)
+	reCanonTrim      = regexp.MustCompile(`^[\s"«»'.!]+|[\s"«»'.!]+$`)
+	reCanonSpaces    = regexp.MustCompile(`\s+`)
+)
+
+// Canonicalize приводит ответ к каноническому виду. Порядок распознавания:
+// деление с остатком, число (десятичное, дробь, смешанное, римское,
+// словами), величина, список; нераспознанное остаётся текстом.
+func Canonicalize(s string) Answer {
+	s = strings.ToLower(romanToArabic(s))
+	s = strings.NewReplacer("ё", "е", "\u00a0", " ", "\u202f", " ").Replace(s)
+	s = reAnswerPrefix.ReplaceAllString(s, "")
+	s = reCanonSpaces.ReplaceAllString(reCanonTrim.ReplaceAllString(s, ""), " ")
+	if a, ok := canonicalScalar(s); ok {
+		return a
+	}
+	if parts := reCanonListSep.Split(s, -1); len(parts) > 1 {
+		list := Answer{Kind: KindList}
+		keys := make([]string, 0, len(parts))
+		for _, part := range parts {
+			part = reCanonTrim.ReplaceAllString(part, "")
+			if part == "" {
+				continue
+			}
+			item, ok := canonicalScalar(part)
+			if !ok {
+				item = Answer{Kind: KindText, Canonical: part}
+			}
+			list.Items = append(list.Items, item)
+			keys = append(keys, item.Canonical)
+		}
+		if len(list.Items) > 1 {
+			list.Canonical = strings.Join(keys, "; ")
+			return list
+		}
+	}
+	return Answer{Kind: KindText, Canonical: s}
+}
+
+func canonicalScalar(s string) (Answer, bool) {
+	if m := reCanonRemainder.FindStringSubmatch(s); m != nil {
+		q, r := strings.TrimLeft(m[1], "0"), strings.TrimLeft(m[2], "0")
+		return Answer{Kind: KindRemainder, Canonical: zeroIfEmpty(q) + " ост. " + zeroIfEmpty(r)}, true
+	}
+	if v, ok := numberValue(s); ok {
+		return numberAnswer(v), true
+	}
+	if q, ok := ParseQuantity(s); ok {
+		return Answer{Kind: KindQuantity, Canonical: q.String(), Dimension: q.Dim}, true
+	}
+	return Answer{}, false
+}
+
+func zeroIfEmpty(s string) string {
+	if s == "" {
+		return "0"
+	}
+	return s
+}
+
+func numberAnswer(v *big.Rat) Answer {
+	a := Answer{Kind: KindNumber, Canonical: v.RatString()}
+	if !v.IsInt() {
+		if n, ok := decimalPlaces(v.Denom()); ok {
+			a.Decimal = v.FloatString(n)
+		}
+	}
+	return a
+}
+
+// numberValue распознаёт число в любой школьной записи: "0,75", "3/4",
+// "1 1/2", "двенадцать". Римские числа к этому моменту уже заменены
+// арабскими (romanToArabic).
+func numberValue(s string) (*big.Rat, bool) {
+	if reCanonNumber.MatchString(s) {
+		v, err := Eval(s)
+		return v, err == nil
+	}
+	if m := reCanonFraction.FindStringSubmatch(s); m != nil {
+		num, _ := new(big.Int).SetString(m[2], 10)
+		den, _ := new(big.Int).SetString(m[3], 10)
+		if den.Sign() == 0 {
+			return nil, false
+		}
+		v := new(big.Rat).SetFrac(num, den)
+		if m[1] != "" {
+			whole, _ := new(big.Rat).SetString(m[1])
+			v.Add(v, whole)
+		}
+		return v, true
+	}
+	if n, ok := wordsValue(s); ok {
+		return new(big.Rat).SetInt64(n), true
+	}
+	return nil, false
+}
+
+// romanLookalikes — кириллические буквы, которыми часто набирают римские цифры.
+var romanLookalikes = strings.NewReplacer("Х", "X", "С", "C", "М", "M", "І", "I")
+
+var romanDigits = map[byte]int64{'I': 1, 'V': 5, 'X': 10, 'L': 50, 'C': 100, 'D': 500, 'M': 1000}
+
+// romanToArabic заменяет римские числа в ответе арабскими. Римским считается
+// только слово из заглавных римских цифр: строчные «с», «м» — единицы
+// измерения, «mix» — слово. Кириллические двойники цифр принимаются в слове
+// от двух букв, одиночная буква — только I, V или X.
+func romanToArabic(s string) string {
+	var b strings.Builder
+	rs := []rune(s)
+	for i := 0; i < len(rs); {
+		if !unicode.IsLetter(rs[i]) {
+			b.WriteRune(rs[i])
+			i++
+			continue
+		}
+		j := i
+		for j < len(rs) && unicode.IsLetter(rs[j]) {
+			j++
+		}
+		word := string(rs[i:j])
+		if n, ok := romanValue(word); ok {
+			b.WriteString(strconv.FormatInt(n, 10))
+		} else {
+			b.WriteString(word)
+		}
+		i = j
+	}
+	return b.String()
+}
+
+func romanValue(word string) (int64, bool) {
+	switch {
+	case strings.ContainsAny(word, "ХСМІ"):
+		if utf8.RuneCountInString(word) < 2 {
+			return 0, false
+		}
+		word = romanLookalikes.Replace(word)
+	case len(word) == 1 && !strings.Contains("IVX", word):
+		return 0, false
+	}
+	if strings.Trim(word, "IVXLCDM") != "" || !reCanonRoman.MatchString(word) {
+		return 0, false
+	}
+	var n int64
+	for i := 0; i < len(word); i++ {
+		v := romanDigits[word[i]]
+		if i+1 < len(word) && v < romanDigits[word[i+1]] {
+			n -= v
+		} else {
+			n += v
+		}
+	}
+	return n, true
+}
+
+// numberWords — значение и разряд слова: 1 — единицы, 2 — десятки
+// (и 10–19), 3 — сотни.
+var numberWords = map[string]struct {
+	value int64
+	rank  int
+}{
+	"ноль": {0, 1}, "нуль": {0, 1},
+	"один": {1, 1}, "одна": {1, 1}, "одно": {1, 1}, "два": {2, 1}, "две": {2, 1},
+	"три": {3, 1}, "четыре": {4, 1}, "пять": {5, 1}, "шесть": {6, 1},
+	"семь": {7, 1}, "восемь": {8, 1}, "девять": {9, 1},
+	"десять": {10, 2}, "одиннадцать": {11, 2}, "двенадцать": {12, 2},
+	"тринадцать": {13, 2}, "четырнадцать": {14, 2}, "пятнадцать": {15, 2},
+	"шестнадцать": {16, 2}, "семнадцать": {17, 2}, "восемнадцать": {18, 2},
+	"девятнадцать": {19, 2}, "двадцать": {20, 2}, "тридцать": {30, 2},
+	"сорок": {40, 2}, "пятьдесят": {50, 2}, "шестьдесят": {60, 2},
+	"семьдесят": {70, 2}, "восемьдесят": {80, 2}, "девяносто": {90, 2},
+	"сто": {100, 3}, "двести": {200, 3}, "триста": {300, 3}, "четыреста": {400, 3},
+	"пятьсот": {500, 3}, "шестьсот": {600, 3}, "семьсот": {700, 3},
+	"восемьсот": {800, 3}, "девятьсот": {900, 3},
+}
+
+// wordsValue разбирает целое число словами до 999 999: "сто двадцать пять",
+// "две тысячи сорок". Разряды должны идти по убыванию.
+func wordsValue(s string) (int64, bool) {
+	words := strings.Fields(s)
+	if len(words) == 0 {
+		return 0, false
+	}
+	var total, group int64
+	rank, thousands := 4, false
+	for _, w := range words {
+		switch w {
+		case "тысяча", "тысячи", "тысяч":
+			if thousands {
+				return 0, false
+			}
+			total, group, rank, thousands = max(group, 1)*1000, 0, 4, true
+			continue
+		}
+		nw, ok := numberWords[w]
+		if !ok || nw.rank >= rank || (nw.value == 0 && len(words) > 1) {
+			return 0, false
+		}
+		group += nw.value
+		rank = nw.rank
+		if nw.value >= 10 && nw.value < 20 {
+			rank = 1 // после "двенадцать" единиц уже не бывает
+		}
+	}
+	return total + group, true
+}
+
+var (
+	reNumberToken = regexp.MustCompile(`\d{1,3}(?:[ \x{00A0}\x{202F}]\d{3})+(?:[.,]\d+)?|\d+(?:[.,]\d+)?(?:\s*/\s*\d+)?`)
+	reWordTrim    = regexp.MustCompile(`^[^\p{L}]+|[^\p{L}]+$`)
+)
+
+// Number — число, найденное в тексте, и его запись.
+type Number struct {
+	Value *big.Rat
+	Text  string // как в тексте: "12", "0,75", "двадцать пять"
+	Words bool   // записано словами
+}
+
+// Numbers извлекает из текста все числа: цифрами ("12", "0,75", "3/4") и
+// словами ("двенадцать", "сто двадцать пять").
+func Numbers(text string) []Number {
+	var out []Number
+	for _, tok := range reNumberToken.FindAllString(text, -1) {
+		if v, err := Eval(tok); err == nil {
+			out = append(out, Number{Value: v, Text: tok})
+		}
+	}
+	words := strings.Fields(strings.ReplaceAll(strings.ToLower(text), "ё", "е"))
+	for i := range words {
+		words[i] = reWordTrim.ReplaceAllString(words[i], "")
+	}
+	for i := 0; i < len(words); {
+		j := i
+		for j < len(words) && isNumberWord(words[j]) {
+			j++
+		}
+		if j == i {
+			i++
+			continue
+		}
+		// Подряд идущие слова — одно число ("сто двадцать пять"), если
+		// складываются; иначе каждое слово отдельно ("два три").
+		run := strings.Join(words[i:j], " ")
+		if n, ok := wordsValue(run); ok {
+			out = append(out, Number{Value: new(big.Rat).SetInt64(n), Text: run, Words: true})
+		} else {
+			for _, w := range words[i:j] {
+				if n, ok := wordsValue(w); ok {
+					out = append(out, Number{Value: new(big.Rat).SetInt64(n), Text: w, Words: true})
+				}
+			}
+		}
+		i = j
+	}
+	return out
+}
+
+func isNumberWord(w string) bool {
+	_, ok := numberWords[w]
+	return ok || w == "тысяча" || w == "тысячи" || w == "тысяч"
+}
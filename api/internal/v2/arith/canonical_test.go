@@ -0,0 +1,75 @@
+package arith
+
+import "testing"
+
+func TestCanonicalize(t *testing.T) {
+	tests := []struct {
+		in        string
+		kind      Kind
+		canonical string
+	}{
+		{in: "3/4", kind: KindNumber, canonical: "3/4"},
+		{in: "0,75", kind: KindNumber, canonical: "3/4"},
+		{in: "6/8", kind: KindNumber, canonical: "3/4"},
+		{in: "1 1/2", kind: KindNumber, canonical: "3/2"},
+		{in: "1 500", kind: KindNumber, canonical: "1500"},
+		{in: "Ответ: 14.", kind: KindNumber, canonical: "14"},
+		{in: "XIV", kind: KindNumber, canonical: "14"},
+		{in: "ХIV", kind: KindNumber, canonical: "14"}, // кириллическая Х
+		{in: "MCMXC", kind: KindNumber, canonical: "1990"},
+		{in: "двенадцать", kind: KindNumber, canonical: "12"},
+		{in: "сто двадцать пять", kind: KindNumber, canonical: "125"},
+		{in: "две тысячи сорок", kind: KindNumber, canonical: "2040"},
+		{in: "7 ост. 2", kind: KindRemainder, canonical: "7 ост. 2"},
+		{in: "7 (остаток 2)", kind: KindRemainder, canonical: "7 ост. 2"},
+		{in: "1 м 20 см", kind: KindQuantity, canonical: "1200 мм"},
+		{in: "2, 4, 6", kind: KindList, canonical: "2; 4; 6"},
+		{in: "квадрат и круг", kind: KindList, canonical: "квадрат; круг"},
+		{in: "  Квадрат ", kind: KindText, canonical: "квадрат"},
+		{in: "IIII", kind: KindText, canonical: "iiii"},
+		{in: "V", kind: KindNumber, canonical: "5"},
+		{in: "ХІІ", kind: KindNumber, canonical: "12"}, // кириллические Х и І
+		{in: "с", kind: KindText, canonical: "с"},
+		{in: "м", kind: KindText, canonical: "м"},
+		{in: "С", kind: KindText, canonical: "с"},
+		{in: "mix", kind: KindText, canonical: "mix"},
+		{in: "C", kind: KindText, canonical: "c"},
+		{in: "XIV см", kind: KindQuantity, canonical: "140 мм"},
+		{in: "двенадцать пять", kind: KindText, canonical: "двенадцать пять"},
+		{in: "пять сто", kind: KindText, canonical: "пять сто"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got := Canonicalize(tt.in)
+			if got.Kind != tt.kind || got.Canonical != tt.canonical {
+				t.Errorf("Canonicalize(%q) = %s %q, want %s %q", tt.in, got.Kind, got.Canonical, tt.kind, tt.canonical)
+			}
+		})
+	}
+}
+
+func TestEquivalent(t *testing.T) {
+	tests := []struct {
+		a, b    string
+		ordered bool
+		want    bool
+	}{
+		{a: "3/4", b: "0,75", want: true},
+		{a: "XIV", b: "14", want: true},
+		{a: "двенадцать", b: "12", want: true},
+		{a: "7 ост. 2", b: "7 (ост. 2)", want: true},
+		{a: "7 ост. 2", b: "7", want: false},
+		{a: "2, 4, 6", b: "6; 4; 2", want: true},
+		{a: "2, 4, 6", b: "6; 4; 2", ordered: true, want: false},
+		{a: "1/2, 3", b: "3 и 0,5", want: true},
+		{a: "2, 2, 4", b: "2, 4, 4", want: false},
+		{a: "12", b: "12 см", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+" vs "+tt.b, func(t *testing.T) {
+			if got := Equivalent(tt.a, tt.b, tt.ordered); got != tt.want {
+				t.Errorf("Equivalent(%q, %q, %v) = %v, want %v", tt.a, tt.b, tt.ordered, got, tt.want)
+			}
+		})
+	}
+}
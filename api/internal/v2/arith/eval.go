@@ -0,0 +1,310 @@
+// Package arith — точный вычислитель арифметики начальной школы: целые и
+// десятичные числа, четыре действия, скобки, простые дроби и деление с
+// остатком. Нужен, чтобы не доверять модели то, что считается
+// детерминированно: шаги решения PARSE и эталонный ответ CHECK
+// пересчитываются здесь. Вычисления идут в рациональных числах без
+// округления; всё, что не разбирается как чистая арифметика (переменные,
+// единицы посреди выражения), пропускается, а не считается ошибкой.
+package arith
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+const (
+	maxExprLen = 256 // длиннее в шагах решения 1–4 класса не бывает
+	maxDigits  = 30  // на одно число
+	maxDepth   = 32  // вложенность скобок
+)
+
+var (
+	ErrSyntax     = errors.New("not an arithmetic expression")
+	ErrDivByZero  = errors.New("division by zero")
+	errTooComplex = errors.New("expression is too complex")
+)
+
+// opRune приводит школьные знаки действий к + - * /. Двоеточие и ÷ —
+// деление, дробная черта — тоже деление: 3/4 = 3 : 4.
+func opRune(r rune) (rune, bool) {
+	switch r {
+	case '+':
+		return '+', true
+	case '-', '−', '–':
+		return '-', true
+	case '*', '×', '·', '⋅', '∙':
+		return '*', true
+	case '/', ':', '÷':
+		return '/', true
+	}
+	return 0, false
+}
+
+func isSpace(r rune) bool { return r == ' ' || r == '\t' || r == '\u00a0' || r == '\u202f' }
+
+type token struct {
+	op  rune     // '+', '-', '*', '/', '(', ')'; 0 — число
+	num *big.Rat // для чисел
+}
+
+// tokenize разбивает выражение на числа, знаки и скобки. Разряды можно
+// отделять пробелом: "60 090" — одно число, два числа подряд всё равно
+// не были бы выражением.
+func tokenize(expr string) ([]token, error) {
+	rs := []rune(expr)
+	var out []token
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case isSpace(r):
+			i++
+		case r == '(' || r == ')':
+			out = append(out, token{op: r})
+			i++
+		case r >= '0' && r <= '9':
+			num, n, err := scanNumber(rs[i:])
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, token{num: num})
+			i += n
+		default:
+			op, ok := opRune(r)
+			if !ok {
+				return nil, fmt.Errorf("%w: unexpected %q", ErrSyntax, r)
+			}
+			out = append(out, token{op: op})
+			i++
+		}
+	}
+	return out, nil
+}
+
+func scanNumber(rs []rune) (*big.Rat, int, error) {
+	var b strings.Builder
+	i := 0
+	digits := func() {
+		for i < len(rs) && rs[i] >= '0' && rs[i] <= '9' {
+			b.WriteRune(rs[i])
+			i++
+		}
+	}
+	digits()
+	// Группы разрядов: "1 000 000".
+	for i+3 < len(rs) && b.Len() <= maxDigits {
+		if !isSpace(rs[i]) || !isDigits(rs[i+1:i+4]) || (i+4 < len(rs) && rs[i+4] >= '0' && rs[i+4] <= '9') {
+			break
+		}
+		b.WriteString(string(rs[i+1 : i+4]))
+		i += 4
+	}
+	if i+1 < len(rs) && (rs[i] == '.' || rs[i] == ',') && rs[i+1] >= '0' && rs[i+1] <= '9' {
+		b.WriteByte('.')
+		i++
+		digits()
+	}
+	if b.Len() > maxDigits {
+		return nil, 0, errTooComplex
+	}
+	num, ok := new(big.Rat).SetString(b.String())
+	if !ok {
+		return nil, 0, ErrSyntax
+	}
+	return num, i, nil
+}
+
+func isDigits(rs []rune) bool {
+	for _, r := range rs {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Eval вычисляет выражение точно. Приоритет обычный: скобки, умножение и
+// деление, сложение и вычитание; унарный минус допускается.
+func Eval(expr string) (*big.Rat, error) {
+	if len(expr) > maxExprLen {
+		return nil, errTooComplex
+	}
+	toks, err := tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+	if len(toks) == 0 {
+		return nil, ErrSyntax
+	}
+	p := &parser{toks: toks}
+	v, err := p.expr(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.toks) {
+		return nil, fmt.Errorf("%w: unexpected %q", ErrSyntax, p.toks[p.pos].op)
+	}
+	return v, nil
+}
+
+type parser struct {
+	toks []token
+	pos  int
+}
+
+func (p *parser) peek() rune {
+	if p.pos >= len(p.toks) {
+		return -1
+	}
+	if p.toks[p.pos].num != nil {
+		return 0
+	}
+	return p.toks[p.pos].op
+}
+
+// expr := term {('+' | '-') term}
+func (p *parser) expr(depth int) (*big.Rat, error) {
+	v, err := p.term(depth)
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op == '+' || op == '-'; op = p.peek() {
+		p.pos++
+		rhs, err := p.term(depth)
+		if err != nil {
+			return nil, err
+		}
+		if op == '+' {
+			v.Add(v, rhs)
+		} else {
+			v.Sub(v, rhs)
+		}
+	}
+	return v, nil
+}
+
+// term := unary {('*' | '/') unary}
+func (p *parser) term(depth int) (*big.Rat, error) {
+	v, err := p.unary(depth)
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op == '*' || op == '/'; op = p.peek() {
+		p.pos++
+		rhs, err := p.unary(depth)
+		if err != nil {
+			return nil, err
+		}
+		if op == '*' {
+			v.Mul(v, rhs)
+			continue
+		}
+		if rhs.Sign() == 0 {
+			return nil, ErrDivByZero
+		}
+		v.Quo(v, rhs)
+	}
+	return v, nil
+}
+
+// unary := ['-' | '+'] primary
+func (p *parser) unary(depth int) (*big.Rat, error) {
+	switch p.peek() {
+	case '-':
+		p.pos++
+		v, err := p.primary(depth)
+		if err != nil {
+			return nil, err
+		}
+		return v.Neg(v), nil
+	case '+':
+		p.pos++
+	}
+	return p.primary(depth)
+}
+
+// primary := number | '(' expr ')'
+func (p *parser) primary(depth int) (*big.Rat, error) {
+	switch p.peek() {
+	case 0:
+		v := new(big.Rat).Set(p.toks[p.pos].num)
+		p.pos++
+		return v, nil
+	case '(':
+		if depth >= maxDepth {
+			return nil, errTooComplex
+		}
+		p.pos++
+		v, err := p.expr(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, fmt.Errorf("%w: unbalanced parentheses", ErrSyntax)
+		}
+		p.pos++
+		return v, nil
+	default:
+		return nil, ErrSyntax
+	}
+}
+
+// HasOperator сообщает, что в выражении есть хотя бы одно действие, а не
+// просто число (ведущий минус не считается).
+func HasOperator(expr string) bool {
+	expr = strings.TrimLeft(strings.TrimSpace(expr), "-−–")
+	for _, r := range expr {
+		if _, ok := opRune(r); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Format печатает значение так, как его записал бы ученик: целое — "17",
+// конечная десятичная дробь — "3.5", остальное — обыкновенной дробью "7/3".
+func Format(v *big.Rat) string {
+	if v.IsInt() {
+		return v.Num().String()
+	}
+	if n, ok := decimalPlaces(v.Denom()); ok {
+		return v.FloatString(n)
+	}
+	return v.RatString()
+}
+
+// decimalPlaces — число знаков конечной десятичной записи для знаменателя
+// вида 2^a·5^b; ok=false — дробь периодическая.
+func decimalPlaces(denom *big.Int) (int, bool) {
+	d := new(big.Int).Set(denom)
+	two, five := big.NewInt(2), big.NewInt(5)
+	var a, b int
+	mod := new(big.Int)
+	for {
+		if q, m := new(big.Int).QuoRem(d, two, mod); m.Sign() == 0 {
+			d, a = q, a+1
+			continue
+		}
+		if q, m := new(big.Int).QuoRem(d, five, mod); m.Sign() == 0 {
+			d, b = q, b+1
+			continue
+		}
+		break
+	}
+	return max(a, b), d.Cmp(big.NewInt(1)) == 0
+}
+
+// Equal сообщает, что обе строки — арифметические выражения (или числа)
+// с одинаковым значением: "0,5" и "1/2", "3/6" и "1/2".
+func Equal(a, b string) bool {
+	va, err := Eval(a)
+	if err != nil {
+		return false
+	}
+	vb, err := Eval(b)
+	if err != nil {
+		return false
+	}
+	return va.Cmp(vb) == 0
+}
@@ -0,0 +1,229 @@
+package arith
+
+import (
+	"math/big"
+	"regexp"
+	"strings"
+)
+
+// Dimension — величина, в которой записан ответ.
+type Dimension string
+
+const (
+	Length Dimension = "length" // в миллиметрах
+	Mass   Dimension = "mass"   // в граммах
+	Time   Dimension = "time"   // в секундах
+	Money  Dimension = "money"  // в копейках
+	Area   Dimension = "area"   // в квадратных миллиметрах
+	Volume Dimension = "volume" // в кубических миллиметрах
+)
+
+// baseUnit — единица, в которой хранится Quantity.Value.
+var baseUnit = map[Dimension]string{
+	Length: "мм", Mass: "г", Time: "с", Money: "коп", Area: "мм²", Volume: "мм³",
+}
+
+// Quantity — именованная величина, приведённая к базовой единице измерения:
+// "1 м 20 см", "120 см" и "1,2 м" дают одно и то же значение.
+type Quantity struct {
+	Dim   Dimension
+	Value *big.Rat
+}
+
+func (q Quantity) String() string {
+	if q.Value == nil {
+		return ""
+	}
+	return Format(q.Value) + " " + baseUnit[q.Dim]
+}
+
+type unit struct {
+	dim    Dimension
+	factor int64 // базовых единиц в одной
+}
+
+// units — единицы и их сокращения во всех формах, которые встречаются в
+// ответах: "метр", "метра", "метров", "м". Линейные единицы возводятся в
+// квадрат и куб ("кв. м", "см²", "куб. дм").
+var units = map[string]unit{}
+
+func addUnit(dim Dimension, factor int64, forms ...string) {
+	for _, f := range forms {
+		units[f] = unit{dim: dim, factor: factor}
+	}
+}
+
+func init() {
+	addUnit(Length, 1, "мм", "миллиметр", "миллиметра", "миллиметров", "миллиметры")
+	addUnit(Length, 10, "см", "сантиметр", "сантиметра", "сантиметров", "сантиметры")
+	addUnit(Length, 100, "дм", "дециметр", "дециметра", "дециметров", "дециметры")
+	addUnit(Length, 1000, "м", "метр", "метра", "метров", "метры")
+	addUnit(Length, 1000_000, "км", "километр", "километра", "километров", "километры")
+
+	addUnit(Mass, 1, "г", "гр", "грамм", "грамма", "граммов", "граммы")
+	addUnit(Mass, 1000, "кг", "килограмм", "килограмма", "килограммов", "килограммы")
+	addUnit(Mass, 100_000, "ц", "центнер", "центнера", "центнеров", "центнеры")
+	addUnit(Mass, 1000_000, "т", "тонна", "тонны", "тонн", "тонну")
+
+	addUnit(Time, 1, "с", "сек", "секунда", "секунды", "секунд", "секунду")
+	addUnit(Time, 60, "мин", "минута", "минуты", "минут", "минуту")
+	addUnit(Time, 3600, "ч", "час", "часа", "часов")
+	addUnit(Time, 86400, "сут", "сутки", "суток", "дн", "день", "дня", "дней")
+	addUnit(Time, 7*86400, "нед", "неделя", "недели", "недель", "неделю")
+
+	addUnit(Money, 1, "к", "коп", "копейка", "копейки", "копеек", "копейку")
+	addUnit(Money, 100, "р", "руб", "рубль", "рубля", "рублей")
+
+	addUnit(Area, 100*1000_000, "ар", "сотка", "сотки", "соток")
+	addUnit(Area, 10_000*1000_000, "га", "гектар", "гектара", "гектаров")
+
+	addUnit(Volume, 1000, "мл", "миллилитр", "миллилитра", "миллилитров")
+	addUnit(Volume, 1000_000, "л", "литр", "литра", "литров", "литры")
+}
+
+var (
+	// reQuantityPart — число и единица: "1,2 м", "20см", "3 кв. м", "5 см²",
+	// "60 090 руб.".
+	reQuantityPart = regexp.MustCompile(`(\d{1,3}(?:\s\d{3})+(?:[.,]\d+)?|\d+(?:[.,]\d+)?(?:\s*/\s*\d+)?)\s*(?:(квадратн\p{L}*|кубическ\p{L}*|кв|куб)\.?\s*)?(\p{L}+)\.?(²|³|\^?[23]\b)?`)
+	// reQuantityGap — что допустимо между частями: "1 м 20 см", "2 ч, 5 мин", "1 м и 5 см".
+	reQuantityGap = regexp.MustCompile(`^(?:[\s,.;]|\sи\s)*$`)
+	// reAnswerPrefix — "Ответ:" перед величиной.
+	reAnswerPrefix = regexp.MustCompile(`^\s*ответ\s*:?\s*`)
+)
+
+// ParseQuantity разбирает ответ с единицами измерения: длина, масса, время,
+// деньги, площадь, объём, в том числе составные ("1 м 20 см", "2 ч 15 мин",
+// "5 р. 50 к."). ok=false — в строке не только величина, единицы разных
+// величин или число без единиц.
+func ParseQuantity(s string) (Quantity, bool) {
+	s = reAnswerPrefix.ReplaceAllString(normalizeQuantity(s), "")
+	matches := reQuantityPart.FindAllStringSubmatchIndex(s, -1)
+	if len(matches) == 0 {
+		return Quantity{}, false
+	}
+	var q Quantity
+	prev := 0
+	for _, m := range matches {
+		if !reQuantityGap.MatchString(" " + s[prev:m[0]] + " ") {
+			return Quantity{}, false
+		}
+		prev = m[1]
+		part, ok := quantityPart(s, m)
+		if !ok || (q.Dim != "" && q.Dim != part.Dim) {
+			return Quantity{}, false
+		}
+		if q.Value == nil {
+			q = part
+		} else {
+			q.Value.Add(q.Value, part.Value)
+		}
+	}
+	if !reQuantityGap.MatchString(" " + s[prev:] + " ") {
+		return Quantity{}, false
+	}
+	return q, true
+}
+
+// QuantitySpan — величина, найденная в тексте, и её запись.
+type QuantitySpan struct {
+	Quantity
+	Text string // как в тексте, в нижнем регистре: "1,2 м", "1 м 20 см"
+}
+
+// Quantities извлекает из текста все величины с единицами измерения.
+// Соседние части одной величины ("1 м 20 см") собираются в одну; число без
+// единиц ("5 учеников") величиной не считается.
+func Quantities(text string) []QuantitySpan {
+	s := normalizeQuantity(text)
+	var (
+		out        []QuantitySpan
+		cur        *QuantitySpan
+		start, end int
+	)
+	flush := func() {
+		if cur != nil {
+			cur.Text = strings.TrimSuffix(s[start:end], ".")
+			out = append(out, *cur)
+			cur = nil
+		}
+	}
+	for _, m := range reQuantityPart.FindAllStringSubmatchIndex(s, -1) {
+		part, ok := quantityPart(s, m)
+		switch {
+		case !ok:
+			flush()
+		case cur != nil && cur.Dim == part.Dim && reQuantityGap.MatchString(" "+s[end:m[0]]+" "):
+			cur.Value.Add(cur.Value, part.Value)
+			end = m[1]
+		default:
+			flush()
+			cur = &QuantitySpan{Quantity: part}
+			start, end = m[0], m[1]
+		}
+	}
+	flush()
+	return out
+}
+
+func normalizeQuantity(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	return strings.NewReplacer("ё", "е", "\u00a0", " ", "\u202f", " ").Replace(s)
+}
+
+// quantityPart переводит совпадение reQuantityPart в базовые единицы.
+func quantityPart(s string, m []int) (Quantity, bool) {
+	v, err := Eval(s[m[2]:m[3]])
+	if err != nil {
+		return Quantity{}, false
+	}
+	power := 1
+	if m[4] >= 0 {
+		power = 2
+		if strings.HasPrefix(s[m[4]:m[5]], "куб") {
+			power = 3
+		}
+	}
+	if m[8] >= 0 {
+		if p := s[m[8]:m[9]]; strings.HasSuffix(p, "3") || p == "³" {
+			power = 3
+		} else {
+			power = 2
+		}
+	}
+	u, ok := lookupUnit(s[m[6]:m[7]], power)
+	if !ok {
+		return Quantity{}, false
+	}
+	return Quantity{Dim: u.dim, Value: v.Mul(v, new(big.Rat).SetInt64(u.factor))}, true
+}
+
+// lookupUnit находит единицу; power > 1 — квадрат или куб линейной единицы.
+func lookupUnit(word string, power int) (unit, bool) {
+	u, ok := units[word]
+	if !ok || power == 1 {
+		return u, ok
+	}
+	if u.dim != Length {
+		return unit{}, false
+	}
+	factor := u.factor
+	for range power - 1 {
+		factor *= u.factor
+	}
+	if power == 2 {
+		return unit{dim: Area, factor: factor}, true
+	}
+	return unit{dim: Volume, factor: factor}, true
+}
+
+// SameQuantity сравнивает два ответа как величины. ok=false — хотя бы один
+// не разбирается как величина или они разной природы (метры и килограммы):
+// тогда решение остаётся за обычным сравнением.
+func SameQuantity(a, b string) (equal, ok bool) {
+	qa, okA := ParseQuantity(a)
+	qb, okB := ParseQuantity(b)
+	if !okA || !okB || qa.Dim != qb.Dim {
+		return false, false
+	}
+	return qa.Value.Cmp(qb.Value) == 0, true
+}
@@ -0,0 +1,90 @@
+package arith
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseQuantity(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string // Quantity.String()
+		ok   bool
+	}{
+		{in: "1 м 20 см", want: "1200 мм", ok: true},
+		{in: "120 см", want: "1200 мм", ok: true},
+		{in: "1,2 м", want: "1200 мм", ok: true},
+		{in: "12 дм", want: "1200 мм", ok: true},
+		{in: "3 кг 200 г", want: "3200 г", ok: true},
+		{in: "2 ц", want: "200000 г", ok: true},
+		{in: "1 ч 30 мин", want: "5400 с", ok: true},
+		{in: "1,5 часа", want: "5400 с", ok: true},
+		{in: "2 суток", want: "172800 с", ok: true},
+		{in: "5 р. 50 к.", want: "550 коп", ok: true},
+		{in: "60 090 рублей", want: "6009000 коп", ok: true},
+		{in: "Ответ: 12 кв. см", want: "1200 мм²", ok: true},
+		{in: "12 см²", want: "1200 мм²", ok: true},
+		{in: "12 квадратных сантиметров", want: "1200 мм²", ok: true},
+		{in: "1 га", want: "10000000000 мм²", ok: true},
+		{in: "2 л", want: "2000000 мм³", ok: true},
+		{in: "2 куб. дм", want: "2000000 мм³", ok: true},
+		{in: "1 м и 5 см", want: "1050 мм", ok: true},
+		{in: "120", ok: false},
+		{in: "5 яблок", ok: false},
+		{in: "1 м 20 кг", ok: false},
+		{in: "5 + 3 см", ok: false},
+		{in: "2 кг², 3 г", ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, ok := ParseQuantity(tt.in)
+			if ok != tt.ok || (ok && got.String() != tt.want) {
+				t.Errorf("ParseQuantity(%q) = %v, %v; want %s, %v", tt.in, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestSameQuantity(t *testing.T) {
+	tests := []struct {
+		a, b       string
+		wantEq, ok bool
+	}{
+		{a: "1 м 20 см", b: "120 см", wantEq: true, ok: true},
+		{a: "1 ч 5 мин", b: "65 минут", wantEq: true, ok: true},
+		{a: "120 см", b: "120 мм", wantEq: false, ok: true},
+		{a: "120 см", b: "120 г", ok: false},
+		{a: "120 см", b: "120", ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+" vs "+tt.b, func(t *testing.T) {
+			eq, ok := SameQuantity(tt.a, tt.b)
+			if eq != tt.wantEq || ok != tt.ok {
+				t.Errorf("SameQuantity(%q, %q) = %v, %v; want %v, %v", tt.a, tt.b, eq, ok, tt.wantEq, tt.ok)
+			}
+		})
+	}
+}
+
+func TestQuantities(t *testing.T) {
+	tests := []struct {
+		text string
+		want string // "запись=значение" через "; "
+	}{
+		{text: "Вспомни: 1 м = 100 см.", want: "1 м=1000 мм; 100 см=1000 мм"},
+		{text: "Получится 1,2 м.", want: "1,2 м=1200 мм"},
+		{text: "Длина 1 м 20 см, масса 3 кг.", want: "1 м 20 см=1200 мм; 3 кг=3000 г"},
+		{text: "Было 5 учеников и 12 яблок.", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			var parts []string
+			for _, q := range Quantities(tt.text) {
+				parts = append(parts, q.Text+"="+q.String())
+			}
+			if got := strings.Join(parts, "; "); got != tt.want {
+				t.Errorf("Quantities(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
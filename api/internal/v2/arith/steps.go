@@ -0,0 +1,203 @@
+package arith
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Mismatch — равенство в тексте, которое не сходится.
+type Mismatch struct {
+	Expr string // левая часть как в тексте
+	Want string // верное значение
+	Got  string // записанное значение
+}
+
+func (m Mismatch) String() string {
+	return fmt.Sprintf("%s = %s, not %s", m.Expr, m.Want, m.Got)
+}
+
+var (
+	// reChain — участок текста из чисел, знаков действий, скобок и "=".
+	reChain = regexp.MustCompile(`[0-9\s\x{00A0}\x{202F}.,+\-−–*×·⋅∙/:÷()=]+`)
+	// reChainSep — конец предложения или перечисление внутри участка:
+	// у десятичной запятой пробела после неё не бывает.
+	reChainSep = regexp.MustCompile(`[.,;]\s+|[.,;]$`)
+	// reListMarker — нумерация действий "1)", "2." в начале строки.
+	reListMarker = regexp.MustCompile(`(?m)^\s*\d+[).]\s+`)
+	// reRemainder — деление с остатком: "17 : 5 = 3 (ост. 2)".
+	reRemainder = regexp.MustCompile(`(\d+)\s*[:÷/]\s*(\d+)\s*=\s*(\d+)\s*\(?\s*ост(?:аток|\.)?\s*:?\s*(\d+)\s*\)?`)
+	// reTaskTail — место для ответа в конце примера: "=", "= ?", "= …".
+	reTaskTail = regexp.MustCompile(`\s*=\s*(?:\?|…|\.{3}|_+|□|\[\s*\])?\s*$`)
+	// reTaskPrefix — формулировка перед примером: "Вычисли:".
+	reTaskPrefix = regexp.MustCompile(`^\s*\p{L}[\p{L}\s]*:\s*`)
+	// reRemainderAnswer — ответ с остатком, его нельзя сравнивать с частным.
+	reRemainderAnswer = regexp.MustCompile(`ост`)
+)
+
+// CheckStep пересчитывает все равенства в шаге решения: "12 + 5 = 17",
+// цепочки "2 · (3 + 4) = 2 · 7 = 14", деление с остатком. Возвращает
+// неверные равенства; то, что не разбирается как арифметика, пропускается.
+func CheckStep(step string) []Mismatch {
+	step = reListMarker.ReplaceAllString(step, "")
+	var out []Mismatch
+	step = reRemainder.ReplaceAllStringFunc(step, func(m string) string {
+		if mm, ok := checkRemainder(reRemainder.FindStringSubmatch(m)); !ok {
+			out = append(out, mm)
+		}
+		return " ; "
+	})
+	for _, loc := range reChain.FindAllStringIndex(step, -1) {
+		run := step[loc[0]:loc[1]]
+		if !strings.Contains(run, "=") {
+			continue
+		}
+		// Участок сразу после слова начинается с середины записи: "x + 5 = 12",
+		// "1/2 от 10 = 5" — его первую часть не проверяем. Двоеточие вплотную
+		// к слову — пунктуация ("Всего: 12 + 5 = 17").
+		prev, _ := utf8.DecodeLastRuneInString(step[:loc[0]])
+		afterWord := unicode.IsLetter(prev)
+		if afterWord && strings.HasPrefix(run, ":") {
+			run, afterWord = run[1:], false
+		}
+		for i, sub := range reChainSep.Split(run, -1) {
+			out = append(out, checkChain(sub, afterWord && i == 0)...)
+		}
+	}
+	return out
+}
+
+func checkChain(chain string, skipFirst bool) []Mismatch {
+	parts := strings.Split(chain, "=")
+	if len(parts) < 2 {
+		return nil
+	}
+	type side struct {
+		text string
+		v    *big.Rat
+	}
+	sides := make([]side, len(parts))
+	for i, part := range parts {
+		part = strings.TrimSpace(part)
+		part = strings.TrimSpace(strings.TrimRight(part, "("))
+		part = strings.TrimSpace(strings.TrimLeft(part, ")"))
+		if part == "" || (i == 0 && skipFirst) {
+			continue
+		}
+		if _, isOp := opRune([]rune(part)[0]); isOp && i == 0 {
+			continue // продолжение записи с буквами: "x + 5 = 12"
+		}
+		if v, err := Eval(part); err == nil {
+			sides[i] = side{text: part, v: v}
+		}
+	}
+	var out []Mismatch
+	for i := 1; i < len(sides); i++ {
+		lhs, rhs := sides[i-1], sides[i]
+		if lhs.v == nil || rhs.v == nil || lhs.v.Cmp(rhs.v) == 0 || roundsTo(lhs.v, rhs.text, rhs.v) {
+			continue
+		}
+		out = append(out, Mismatch{Expr: lhs.text, Want: Format(lhs.v), Got: rhs.text})
+	}
+	return out
+}
+
+// roundsTo допускает округление: "10 : 3 = 3,33" записано с двумя знаками.
+func roundsTo(exact *big.Rat, written string, v *big.Rat) bool {
+	if exact.IsInt() {
+		return false
+	}
+	i := strings.LastIndexAny(written, ".,")
+	if i < 0 || HasOperator(written) {
+		return false
+	}
+	places := len(written) - i - 1
+	rounded, _ := new(big.Rat).SetString(exact.FloatString(places))
+	return rounded.Cmp(v) == 0
+}
+
+func checkRemainder(m []string) (Mismatch, bool) {
+	a, _ := new(big.Int).SetString(m[1], 10)
+	b, _ := new(big.Int).SetString(m[2], 10)
+	q, _ := new(big.Int).SetString(m[3], 10)
+	r, _ := new(big.Int).SetString(m[4], 10)
+	expr := m[1] + " : " + m[2]
+	if b.Sign() == 0 {
+		return Mismatch{Expr: expr, Want: "undefined", Got: m[3]}, false
+	}
+	wantQ, wantR := new(big.Int).QuoRem(a, b, new(big.Int))
+	if wantQ.Cmp(q) == 0 && wantR.Cmp(r) == 0 {
+		return Mismatch{}, true
+	}
+	return Mismatch{
+		Expr: expr,
+		Want: wantQ.String() + " (ост. " + wantR.String() + ")",
+		Got:  m[3] + " (ост. " + m[4] + ")",
+	}, false
+}
+
+// TaskValue вычисляет условие-пример: "36 : 4 + 5 =", "Вычисли: (12 + 8) · 3 = ?".
+// ok=false — в условии не только арифметика или в нём нет действий.
+func TaskValue(text string) (*big.Rat, bool) {
+	s := reTaskPrefix.ReplaceAllString(text, "")
+	s = reTaskTail.ReplaceAllString(s, "")
+	if !HasOperator(s) {
+		return nil, false
+	}
+	v, err := Eval(s)
+	return v, err == nil
+}
+
+// AnswerValue — числовое значение ответа вида "17", "3,5", "1/2",
+// "60 090 руб.": число в начале строки, единицы после него не мешают.
+// Ответ с остатком ("3 (ост. 2)") значения не имеет.
+func AnswerValue(answer string) (*big.Rat, bool) {
+	answer = strings.TrimSpace(answer)
+	if answer == "" || reRemainderAnswer.MatchString(answer) {
+		return nil, false
+	}
+	if v, err := Eval(answer); err == nil {
+		return v, true
+	}
+	loc := reChain.FindStringIndex(answer)
+	if loc == nil || loc[0] != 0 {
+		return nil, false
+	}
+	lead := strings.TrimSpace(strings.TrimRight(answer[:loc[1]], " .,;(:="))
+	if HasOperator(lead) && !isFraction(lead) {
+		return nil, false
+	}
+	v, err := Eval(lead)
+	return v, err == nil
+}
+
+// isFraction — запись вида "3/4": единственное действие — дробная черта.
+func isFraction(s string) bool {
+	num, den, ok := strings.Cut(s, "/")
+	return ok && !HasOperator(num) && !HasOperator(den)
+}
+
+// StepResults — значения, записанные в шаге после "=": "12 + 5 = 17" → 17,
+// "2 · (3 + 4) = 2 · 7 = 14" → 14. Выражения справа от "=" не считаются
+// результатами.
+func StepResults(step string) []*big.Rat {
+	var out []*big.Rat
+	for _, run := range reChain.FindAllString(step, -1) {
+		for _, sub := range reChainSep.Split(run, -1) {
+			parts := strings.Split(sub, "=")
+			for _, part := range parts[1:] {
+				part = strings.TrimSpace(strings.TrimRight(strings.TrimSpace(part), "("))
+				if part == "" || (HasOperator(part) && !isFraction(part)) {
+					continue
+				}
+				if v, err := Eval(part); err == nil {
+					out = append(out, v)
+				}
+			}
+		}
+	}
+	return out
+}
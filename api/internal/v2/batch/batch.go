@@ -0,0 +1,593 @@
+// Package batch прогоняет офлайн-нагрузку (перепроверка истории ДЗ для
+// аналитики, генерация аналогов) через batch API OpenAI и Gemini — вдвое
+// дешевле онлайн-вызовов, но с задержкой до 24 часов.
+//
+// Вход — JSONL запросов шагов v2: {"id": "...", "step": "check", "request": {...}}.
+// Запрос к провайдеру собирает тот же код движка, что и онлайн: движок
+// вызывается с HTTP-транспортом, который перехватывает запрос вместо отправки.
+// Перехваченные запросы группируются по модели и уходят в batch API. Когда
+// задание завершено, каждый ответ провайдера подаётся обратно в движок через
+// подменённый транспорт — разбор, нормализация и валидация те же, что онлайн.
+// Выход — JSONL в порядке входа: {"id", "step", "response" | "error", "stats"}.
+// Изображения передаются только base64: ответ разбирается повторным вызовом
+// движка по input.jsonl, поэтому image_id и URL пришлось бы подставлять
+// дважды, а содержимое по ним может измениться за время задания.
+//
+// Состояние задания лежит в Dir/<id>/ (job.json, input.jsonl, results.jsonl),
+// поэтому после перезапуска опрос продолжается с того же места.
+package batch
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"llm-proxy/api/internal/metrics"
+	"llm-proxy/api/internal/v2/imagefetch"
+	"llm-proxy/api/internal/v2/ocr"
+	"llm-proxy/api/internal/v2/ocr/types"
+)
+
+// priceFactor — batch API OpenAI и Gemini стоят половину онлайн-цены.
+const priceFactor = 0.5
+
+// replayTimeout — лимит на разбор одного ответа движком.
+const replayTimeout = 30 * time.Second
+
+var itemsTotal = metrics.NewCounter(
+	"llm_proxy_batch_items_total",
+	"Batch items processed, by engine and result.",
+	"engine", "result",
+)
+
+// Item — строка входного JSONL.
+type Item struct {
+	ID      string          `json:"id"`
+	Step    string          `json:"step"`
+	Request json.RawMessage `json:"request"`
+}
+
+// Result — строка выходного JSONL.
+type Result struct {
+	ID       string `json:"id"`
+	Step     string `json:"step"`
+	Response any    `json:"response,omitempty"`
+	Error    string `json:"error,omitempty"`
+	Stats    *Stats `json:"stats,omitempty"`
+}
+
+// Stats — метрики ответа; стоимость уже с batch-скидкой.
+type Stats struct {
+	Model        string  `json:"model,omitempty"`
+	InputTokens  int     `json:"input_tokens"`
+	OutputTokens int     `json:"output_tokens"`
+	CachedTokens int     `json:"cached_tokens,omitempty"`
+	CostUSD      float64 `json:"cost_usd,omitempty"`
+}
+
+type State string
+
+const (
+	StateRunning   State = "running"   // задания у провайдера ещё выполняются
+	StateCompleted State = "completed" // results.jsonl готов
+	StateFailed    State = "failed"    // не удалось собрать результаты
+)
+
+// Job — batch-задание прокси: одна загрузка JSONL.
+type Job struct {
+	ID        string    `json:"id"`
+	Engine    string    `json:"engine"`
+	State     State     `json:"state"`
+	Total     int       `json:"total"`
+	Succeeded int       `json:"succeeded"`
+	Failed    int       `json:"failed"`
+	Parts     []Part    `json:"parts"`
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Rejected — строки, для которых не удалось собрать запрос: номер строки → ошибка.
+	Rejected map[string]string `json:"rejected,omitempty"`
+}
+
+// Part — задание у провайдера; batch API принимает запросы одной модели.
+type Part struct {
+	Model    string `json:"model"`
+	RemoteID string `json:"remote_id,omitempty"`
+	Requests int    `json:"requests"`
+	State    string `json:"state,omitempty"`
+	Done     bool   `json:"done"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Backend — движок, у провайдера которого есть batch API.
+type Backend struct {
+	Provider Provider
+	// NewEngine создаёт движок с заданным HTTP-клиентом тем же конструктором,
+	// что и онлайн-движок (модели, шаблоны). Кэш промпта провайдера не включать:
+	// handle протухнет раньше, чем задание дойдёт до выполнения.
+	NewEngine func(*http.Client) ocr.Engine
+}
+
+type Options struct {
+	Dir           string
+	PollInterval  time.Duration
+	MaxInputBytes int64
+}
+
+// Manager принимает JSONL, ведёт задания и собирает результаты.
+type Manager struct {
+	opts     Options
+	backends map[string]Backend
+
+	mu   sync.Mutex
+	jobs map[string]*Job
+}
+
+// NewManager создаёт менеджер и возобновляет опрос незавершённых заданий из Dir.
+func NewManager(opts Options, backends map[string]Backend) (*Manager, error) {
+	if opts.Dir == "" {
+		return nil, errors.New("batch: dir is required")
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = time.Minute
+	}
+	if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("batch: %w", err)
+	}
+	m := &Manager{opts: opts, backends: backends, jobs: make(map[string]*Job)}
+	entries, err := os.ReadDir(opts.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("batch: %w", err)
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		raw, err := os.ReadFile(filepath.Join(opts.Dir, e.Name(), "job.json"))
+		if err != nil {
+			continue
+		}
+		var job Job
+		if err := json.Unmarshal(raw, &job); err != nil || job.ID != e.Name() {
+			log.Printf("[batch] skip %s: bad job.json", e.Name())
+			continue
+		}
+		m.jobs[job.ID] = &job
+		if job.State == StateRunning {
+			go m.watch(job.ID)
+		}
+	}
+	return m, nil
+}
+
+// MaxInputBytes — лимит размера входного JSONL.
+func (m *Manager) MaxInputBytes() int64 { return m.opts.MaxInputBytes }
+
+func (m *Manager) backend(engine string) (string, Backend, error) {
+	if engine == "openai" {
+		engine = "gpt"
+	}
+	b, ok := m.backends[engine]
+	if !ok {
+		names := make([]string, 0, len(m.backends))
+		for n := range m.backends {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return "", Backend{}, fmt.Errorf("batch not supported for engine %q; use one of: %s", engine, strings.Join(names, ", "))
+	}
+	return engine, b, nil
+}
+
+// Submit сохраняет входной JSONL, собирает запросы к провайдеру и создаёт
+// задания. Строки, для которых запрос собрать не удалось, попадут в результаты
+// с ошибкой; остальные ждут провайдера. Строка с image_id или URL изображения
+// отклоняет весь вход.
+func (m *Manager) Submit(ctx context.Context, engine string, input io.Reader) (Job, error) {
+	engine, b, err := m.backend(engine)
+	if err != nil {
+		return Job{}, err
+	}
+	id, err := newID()
+	if err != nil {
+		return Job{}, err
+	}
+	dir := filepath.Join(m.opts.Dir, id)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return Job{}, fmt.Errorf("batch: %w", err)
+	}
+	if err := m.saveInput(dir, input); err != nil {
+		_ = os.RemoveAll(dir)
+		return Job{}, err
+	}
+
+	now := time.Now().UTC()
+	job := &Job{ID: id, Engine: engine, State: StateRunning, CreatedAt: now, UpdatedAt: now, Rejected: map[string]string{}}
+	byModel := map[string][]Request{}
+	var refErr error
+	err = readItems(filepath.Join(dir, "input.jsonl"), func(n int, item Item, err error) {
+		job.Total++
+		key := strconv.Itoa(n)
+		if err == nil && refErr == nil {
+			if refErr = checkImageRefs(item.Request); refErr != nil {
+				refErr = fmt.Errorf("batch: line %d: %w", n, refErr)
+			}
+		}
+		if refErr != nil {
+			return
+		}
+		if err == nil {
+			var req Request
+			if req, err = capture(b.NewEngine, item); err == nil {
+				var model string
+				if model, err = b.Provider.Model(req); err == nil {
+					req.CustomID = key
+					byModel[model] = append(byModel[model], req)
+					return
+				}
+			}
+		}
+		job.Rejected[key] = err.Error()
+	})
+	if err == nil {
+		err = refErr
+	}
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return Job{}, err
+	}
+	if job.Total == 0 {
+		_ = os.RemoveAll(dir)
+		return Job{}, errors.New("batch: input is empty")
+	}
+
+	models := make([]string, 0, len(byModel))
+	for model := range byModel {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+	for _, model := range models {
+		reqs := byModel[model]
+		part := Part{Model: model, Requests: len(reqs)}
+		remoteID, err := b.Provider.Submit(ctx, model, reqs)
+		if err != nil {
+			log.Printf("[batch] %s submit %s: %v", id, model, err)
+			part.Done, part.Error = true, err.Error()
+		} else {
+			part.RemoteID = remoteID
+		}
+		job.Parts = append(job.Parts, part)
+	}
+	log.Printf("[batch] %s submitted engine=%s items=%d rejected=%d parts=%d", id, engine, job.Total, len(job.Rejected), len(job.Parts))
+
+	m.mu.Lock()
+	m.jobs[id] = job
+	m.mu.Unlock()
+	if err := m.save(job); err != nil {
+		return Job{}, err
+	}
+	go m.watch(id)
+	return m.snapshot(job), nil
+}
+
+func (m *Manager) saveInput(dir string, input io.Reader) error {
+	f, err := os.Create(filepath.Join(dir, "input.jsonl"))
+	if err != nil {
+		return fmt.Errorf("batch: %w", err)
+	}
+	defer f.Close()
+	src := input
+	if m.opts.MaxInputBytes > 0 {
+		src = io.LimitReader(input, m.opts.MaxInputBytes+1)
+	}
+	n, err := io.Copy(f, src)
+	if err != nil {
+		return fmt.Errorf("batch: read input: %w", err)
+	}
+	if m.opts.MaxInputBytes > 0 && n > m.opts.MaxInputBytes {
+		return fmt.Errorf("batch: input exceeds %d bytes", m.opts.MaxInputBytes)
+	}
+	return f.Close()
+}
+
+// Job возвращает копию состояния задания.
+func (m *Manager) Job(id string) (Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return m.snapshotLocked(job), true
+}
+
+// ResultsPath возвращает путь к results.jsonl завершённого задания.
+func (m *Manager) ResultsPath(id string) (string, bool) {
+	job, ok := m.Job(id)
+	if !ok || job.State != StateCompleted {
+		return "", false
+	}
+	return filepath.Join(m.opts.Dir, id, "results.jsonl"), true
+}
+
+func (m *Manager) snapshot(job *Job) Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.snapshotLocked(job)
+}
+
+func (m *Manager) snapshotLocked(job *Job) Job {
+	out := *job
+	out.Parts = append([]Part(nil), job.Parts...)
+	out.Rejected = make(map[string]string, len(job.Rejected))
+	for k, v := range job.Rejected {
+		out.Rejected[k] = v
+	}
+	return out
+}
+
+// save атомарно пишет job.json.
+func (m *Manager) save(job *Job) error {
+	snap := m.snapshot(job)
+	raw, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return err
+	}
+	dir := filepath.Join(m.opts.Dir, job.ID)
+	tmp := filepath.Join(dir, "job.json.tmp")
+	if err := os.WriteFile(tmp, raw, 0o644); err != nil {
+		return fmt.Errorf("batch: save job: %w", err)
+	}
+	return os.Rename(tmp, filepath.Join(dir, "job.json"))
+}
+
+// watch опрашивает задания провайдера, пока все не завершатся, и собирает результаты.
+func (m *Manager) watch(id string) {
+	for {
+		if m.poll(id) {
+			return
+		}
+		time.Sleep(m.opts.PollInterval)
+	}
+}
+
+// poll обновляет состояние частей; true — задание завершено и больше не опрашивается.
+func (m *Manager) poll(id string) bool {
+	m.mu.Lock()
+	job, ok := m.jobs[id]
+	m.mu.Unlock()
+	if !ok {
+		return true
+	}
+	_, b, err := m.backend(job.Engine)
+	if err != nil {
+		m.fail(job, err)
+		return true
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	done := true
+	for i := range job.Parts {
+		m.mu.Lock()
+		part := job.Parts[i]
+		m.mu.Unlock()
+		if part.Done {
+			continue
+		}
+		st, err := b.Provider.Poll(ctx, part.RemoteID)
+		if err != nil {
+			// Сетевые сбои при опросе не фатальны: повторим на следующем тике.
+			log.Printf("[batch] %s poll %s: %v", id, part.RemoteID, err)
+			done = false
+			continue
+		}
+		m.mu.Lock()
+		job.Parts[i].State, job.Parts[i].Done, job.Parts[i].Error = st.State, st.Done, st.Err
+		job.UpdatedAt = time.Now().UTC()
+		m.mu.Unlock()
+		if !st.Done {
+			done = false
+		}
+	}
+	if err := m.save(job); err != nil {
+		log.Printf("[batch] %s: %v", id, err)
+	}
+	if !done {
+		return false
+	}
+	if err := m.finalize(ctx, job, b); err != nil {
+		log.Printf("[batch] %s finalize: %v", id, err)
+		m.fail(job, err)
+	}
+	return true
+}
+
+func (m *Manager) fail(job *Job, err error) {
+	m.mu.Lock()
+	job.State, job.Error, job.UpdatedAt = StateFailed, err.Error(), time.Now().UTC()
+	m.mu.Unlock()
+	if err := m.save(job); err != nil {
+		log.Printf("[batch] %s: %v", job.ID, err)
+	}
+}
+
+// finalize скачивает ответы, прогоняет их через движок и пишет results.jsonl.
+func (m *Manager) finalize(ctx context.Context, job *Job, b Backend) error {
+	outputs := map[string]Output{}
+	partErrs := []string{}
+	for _, part := range job.Parts {
+		if part.Error != "" {
+			partErrs = append(partErrs, part.Model+": "+part.Error)
+		}
+		if part.RemoteID == "" {
+			continue
+		}
+		res, err := b.Provider.Results(ctx, part.RemoteID)
+		if err != nil {
+			return err
+		}
+		for k, v := range res {
+			outputs[k] = v
+		}
+	}
+	missing := "no response from provider"
+	if len(partErrs) > 0 {
+		missing += ": " + strings.Join(partErrs, "; ")
+	}
+
+	dir := filepath.Join(m.opts.Dir, job.ID)
+	tmp := filepath.Join(dir, "results.jsonl.tmp")
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	var succeeded, failed int
+	err = readItems(filepath.Join(dir, "input.jsonl"), func(n int, item Item, decodeErr error) {
+		key := strconv.Itoa(n)
+		res := Result{ID: item.ID, Step: item.Step}
+		if res.ID == "" {
+			res.ID = key
+		}
+		switch out, ok := outputs[key]; {
+		case job.Rejected[key] != "":
+			res.Error = job.Rejected[key]
+		case decodeErr != nil:
+			res.Error = decodeErr.Error()
+		case !ok:
+			res.Error = missing
+		case out.Err != "":
+			res.Error = "provider: " + out.Err
+		default:
+			rctx, cancel := context.WithTimeout(context.Background(), replayTimeout)
+			resp, stats, err := replay(rctx, b.NewEngine, item, out.Body)
+			cancel()
+			if stats != nil {
+				res.Stats = &Stats{
+					Model:        stats.Model,
+					InputTokens:  stats.InputTokens,
+					OutputTokens: stats.OutputTokens,
+					CachedTokens: stats.CachedTokens,
+					CostUSD:      stats.CostUSD * priceFactor,
+				}
+			}
+			if err != nil {
+				res.Error = err.Error()
+			} else {
+				res.Response = resp
+			}
+		}
+		if res.Error != "" {
+			failed++
+			itemsTotal.Inc(job.Engine, "error")
+		} else {
+			succeeded++
+			itemsTotal.Inc(job.Engine, "ok")
+		}
+		if err := enc.Encode(res); err != nil {
+			log.Printf("[batch] %s encode result %s: %v", job.ID, key, err)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, "results.jsonl")); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	job.State, job.Succeeded, job.Failed, job.UpdatedAt = StateCompleted, succeeded, failed, time.Now().UTC()
+	m.mu.Unlock()
+	log.Printf("[batch] %s completed ok=%d failed=%d", job.ID, succeeded, failed)
+	return m.save(job)
+}
+
+// checkImageRefs проверяет, что изображения запроса переданы base64: batch
+// не разрешает image_id и не скачивает URL.
+func checkImageRefs(raw json.RawMessage) error {
+	var in struct {
+		Image   string           `json:"image"`
+		ImageID string           `json:"image_id"`
+		Images  []types.ImageRef `json:"images"`
+	}
+	if json.Unmarshal(raw, &in) != nil {
+		return nil // ошибку разбора покажет сам шаг
+	}
+	refs := append([]types.ImageRef{{Image: in.Image, ImageID: in.ImageID}}, in.Images...)
+	for _, ref := range refs {
+		switch {
+		case ref.ImageID != "":
+			return errors.New("image_id is not supported in batch; send the image as base64")
+		case imagefetch.IsURL(ref.Image):
+			return errors.New("image URLs are not supported in batch; send the image as base64")
+		}
+	}
+	return nil
+}
+
+// readItems читает JSONL построчно; строки нумеруются с 1, пустые пропускаются.
+// Ошибка разбора строки передаётся в fn, а не прерывает чтение.
+func readItems(path string, fn func(n int, item Item, err error)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	n := 0
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(strings.TrimSpace(string(line))) > 0 {
+			n++
+			var item Item
+			perr := json.Unmarshal(line, &item)
+			switch {
+			case perr != nil:
+				perr = fmt.Errorf("bad json line: %w", perr)
+			case !steps[item.Step]:
+				perr = fmt.Errorf("unknown step %q", item.Step)
+			case len(item.Request) == 0:
+				perr = errors.New("request is required")
+			}
+			fn(n, item, perr)
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func newID() (string, error) {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return time.Now().UTC().Format("20060102-150405") + "-" + hex.EncodeToString(b), nil
+}
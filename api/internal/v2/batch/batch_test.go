@@ -0,0 +1,364 @@
+package batch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"llm-proxy/api/internal/v2/ocr"
+	"llm-proxy/api/internal/v2/ocr/gemini"
+	"llm-proxy/api/internal/v2/ocr/gpt"
+)
+
+// fakeProvider хранит задания в памяти и отвечает телом respond(req).
+type fakeProvider struct {
+	model   func(Request) (string, error)
+	respond func(Request) Output
+
+	mu   sync.Mutex
+	jobs map[string][]Request
+}
+
+func (p *fakeProvider) Model(req Request) (string, error) { return p.model(req) }
+
+func (p *fakeProvider) Submit(_ context.Context, model string, reqs []Request) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.jobs == nil {
+		p.jobs = map[string][]Request{}
+	}
+	id := "remote-" + model
+	p.jobs[id] = reqs
+	return id, nil
+}
+
+func (p *fakeProvider) Poll(context.Context, string) (Status, error) {
+	return Status{State: "completed", Done: true}, nil
+}
+
+func (p *fakeProvider) Results(_ context.Context, id string) (map[string]Output, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	out := map[string]Output{}
+	for _, r := range p.jobs[id] {
+		out[r.CustomID] = p.respond(r)
+	}
+	return out, nil
+}
+
+func waitCompleted(t *testing.T, m *Manager, id string) Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if job, _ := m.Job(id); job.State != StateRunning {
+			return job
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("batch did not complete")
+	return Job{}
+}
+
+func readResults(t *testing.T, m *Manager, id string) []Result {
+	t.Helper()
+	path, ok := m.ResultsPath(id)
+	if !ok {
+		t.Fatal("results not available")
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out []Result
+	for _, line := range strings.Split(strings.TrimSpace(string(raw)), "\n") {
+		var r Result
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+const analogueJSON = `{"example_task":"Реши: 3 + 4","solution_steps":["3 + 4 = 7"]}`
+
+func TestManager_OpenAIRoundTrip(t *testing.T) {
+	t.Setenv("PROMPT_DIR", "../..")
+	provider := &fakeProvider{
+		model: NewOpenAI("").Model,
+		respond: func(r Request) Output {
+			if r.CustomID == "3" {
+				return Output{Err: "rate limited"}
+			}
+			body, _ := json.Marshal(map[string]any{
+				"output": []any{map[string]any{"content": []any{map[string]any{"type": "output_text", "text": analogueJSON}}}},
+				"usage":  map[string]any{"input_tokens": 10000, "output_tokens": 1000, "input_tokens_details": map[string]any{"cached_tokens": 6000}},
+			})
+			return Output{Body: body}
+		},
+	}
+	m, err := NewManager(Options{Dir: t.TempDir(), PollInterval: 5 * time.Millisecond}, map[string]Backend{
+		"gpt": {Provider: provider, NewEngine: func(c *http.Client) ocr.Engine {
+			return gpt.New("key", "gpt-4.1-mini").WithHTTPClient(c)
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := `{"task_struct":{"subject":"math","combined_subpoints":true},"reason":"after_3_hints","raw_task_text":"2 + 5","grade":2}`
+	input := strings.Join([]string{
+		`{"id":"ok","step":"analogue","request":` + req + `}`,
+		`{"id":"unknown-step","step":"nope","request":{}}`,
+		`{"id":"provider-error","step":"analogue","request":` + req + `}`,
+		`not json`,
+		``,
+		`{"id":"bad-request","step":"analogue","request":{"unknown":1}}`,
+	}, "\n")
+	job, err := m.Submit(context.Background(), "openai", strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Engine != "gpt" || job.Total != 5 || len(job.Rejected) != 3 || len(job.Parts) != 1 || job.Parts[0].Model != "gpt-4.1-mini" {
+		t.Fatalf("job = %+v", job)
+	}
+
+	// Запрос к провайдеру собран онлайн-кодом движка: system-промпт, схема, модель.
+	sent := provider.jobs["remote-gpt-4.1-mini"]
+	if len(sent) != 2 || !strings.HasSuffix(sent[0].URL, "/v1/responses") || !bytes.Contains(sent[0].Body, []byte(`"name":"analogue"`)) {
+		t.Fatalf("captured requests = %+v", sent)
+	}
+
+	job = waitCompleted(t, m, job.ID)
+	if job.State != StateCompleted || job.Succeeded != 1 || job.Failed != 4 {
+		t.Fatalf("job = %+v", job)
+	}
+	results := readResults(t, m, job.ID)
+	wantIDs := []string{"ok", "unknown-step", "provider-error", "4", "bad-request"}
+	if len(results) != len(wantIDs) {
+		t.Fatalf("results = %+v", results)
+	}
+	for i, id := range wantIDs {
+		if results[i].ID != id {
+			t.Errorf("result %d id = %q, want %q", i, results[i].ID, id)
+		}
+	}
+	ok := results[0]
+	resp, _ := json.Marshal(ok.Response)
+	if ok.Error != "" || !strings.Contains(string(resp), "3 + 4") {
+		t.Errorf("ok result = %+v", ok)
+	}
+	wantCost := (4000*0.40 + 6000*0.10 + 1000*1.60) / 1e6 * priceFactor
+	if ok.Stats == nil || ok.Stats.CachedTokens != 6000 || math.Abs(ok.Stats.CostUSD-wantCost) > 1e-12 {
+		t.Errorf("ok stats = %+v, want cost %v", ok.Stats, wantCost)
+	}
+	for _, r := range results[1:] {
+		if r.Error == "" || r.Response != nil {
+			t.Errorf("result %q should be an error: %+v", r.ID, r)
+		}
+	}
+	if !strings.Contains(results[2].Error, "rate limited") || !strings.Contains(results[1].Error, "unknown step") {
+		t.Errorf("errors = %q / %q", results[1].Error, results[2].Error)
+	}
+}
+
+func TestManager_GeminiRoundTripAndResume(t *testing.T) {
+	t.Setenv("PROMPT_DIR", "../..")
+	dir := t.TempDir()
+	var polls sync.Map
+	provider := &fakeProvider{
+		model: NewGemini("").Model,
+		respond: func(Request) Output {
+			body := `{"candidates":[{"content":{"role":"model","parts":[{"text":` + jsonString(analogueJSON) + `}]},"finishReason":"STOP"}],` +
+				`"usageMetadata":{"promptTokenCount":100,"candidatesTokenCount":10}}`
+			return Output{Body: json.RawMessage(body)}
+		},
+	}
+	backends := map[string]Backend{
+		"gemini": {Provider: &slowPoll{fakeProvider: provider, polls: &polls}, NewEngine: func(c *http.Client) ocr.Engine {
+			return gemini.New("key", "gemini-2.0-flash-lite", "gemini-2.5-flash").WithHTTPClient(c)
+		}},
+	}
+	m, err := NewManager(Options{Dir: dir, PollInterval: time.Hour}, backends)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := `{"task_struct":{"subject":"math","combined_subpoints":true},"reason":"after_incorrect","raw_task_text":"2 + 5","grade":2}`
+	job, err := m.Submit(context.Background(), "gemini", strings.NewReader(`{"id":"g1","step":"analogue","request":`+req+`}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(job.Parts) != 1 || job.Parts[0].Model != "gemini-2.5-flash" {
+		t.Fatalf("parts = %+v", job.Parts)
+	}
+	if sent := provider.jobs["remote-gemini-2.5-flash"]; len(sent) != 1 || !bytes.Contains(sent[0].Body, []byte("systemInstruction")) {
+		t.Fatalf("captured = %+v", sent)
+	}
+
+	// Первый менеджер увидел «выполняется» и уснул до следующего тика.
+	for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(time.Millisecond) {
+		if _, polled := polls.Load(job.Parts[0].RemoteID); polled {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("first poll did not happen")
+		}
+	}
+
+	// Перезапуск: новый менеджер подхватывает незавершённое задание из каталога.
+	resumed, err := NewManager(Options{Dir: dir, PollInterval: 5 * time.Millisecond}, backends)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job = waitCompleted(t, resumed, job.ID)
+	if job.State != StateCompleted || job.Succeeded != 1 {
+		t.Fatalf("job = %+v", job)
+	}
+	results := readResults(t, resumed, job.ID)
+	if len(results) != 1 || results[0].Error != "" || results[0].Stats == nil || results[0].Stats.Model != "gemini-2.5-flash" {
+		t.Fatalf("results = %+v", results)
+	}
+}
+
+// slowPoll отвечает «ещё выполняется» на первый опрос каждого задания.
+type slowPoll struct {
+	*fakeProvider
+	polls *sync.Map
+}
+
+func (p *slowPoll) Poll(ctx context.Context, id string) (Status, error) {
+	if _, seen := p.polls.LoadOrStore(id, true); !seen {
+		return Status{State: "BATCH_STATE_RUNNING"}, nil
+	}
+	return p.fakeProvider.Poll(ctx, id)
+}
+
+func jsonString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+func TestOpenAI_SubmitAndResults(t *testing.T) {
+	var uploaded, created []byte
+	client := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		reply := func(body string) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(body))}, nil
+		}
+		if r.Header.Get("Authorization") != "Bearer key" {
+			t.Errorf("%s %s: missing auth", r.Method, r.URL.Path)
+		}
+		switch r.Method + " " + r.URL.Path {
+		case "POST /v1/files":
+			if err := r.ParseMultipartForm(1 << 20); err != nil {
+				t.Fatal(err)
+			}
+			if r.FormValue("purpose") != "batch" {
+				t.Errorf("purpose = %q", r.FormValue("purpose"))
+			}
+			f, _, _ := r.FormFile("file")
+			uploaded, _ = io.ReadAll(f)
+			return reply(`{"id":"file-in"}`)
+		case "POST /v1/batches":
+			created, _ = io.ReadAll(r.Body)
+			return reply(`{"id":"batch_1","status":"validating"}`)
+		case "GET /v1/batches/batch_1":
+			return reply(`{"id":"batch_1","status":"completed","output_file_id":"file-out","error_file_id":"file-err"}`)
+		case "GET /v1/files/file-out/content":
+			return reply(`{"custom_id":"1","response":{"status_code":200,"body":{"output_text":"x"}}}` + "\n")
+		case "GET /v1/files/file-err/content":
+			return reply(`{"custom_id":"2","response":{"status_code":400,"body":{"error":"bad"}}}` + "\n" +
+				`{"custom_id":"3","error":{"message":"expired"}}` + "\n")
+		}
+		t.Fatalf("unexpected %s %s", r.Method, r.URL)
+		return nil, nil
+	})}
+	p := NewOpenAI("key").WithHTTPClient(client)
+
+	reqs := []Request{
+		{CustomID: "1", URL: "https://api.openai.com/v1/responses", Body: json.RawMessage(`{"model":"gpt-4.1-mini"}`)},
+		{CustomID: "2", URL: "https://api.openai.com/v1/responses", Body: json.RawMessage(`{"model":"gpt-4.1-mini"}`)},
+	}
+	if model, err := p.Model(reqs[0]); err != nil || model != "gpt-4.1-mini" {
+		t.Fatalf("Model = %q, %v", model, err)
+	}
+	id, err := p.Submit(context.Background(), "gpt-4.1-mini", reqs)
+	if err != nil || id != "batch_1" {
+		t.Fatalf("Submit = %q, %v", id, err)
+	}
+	if want := `{"custom_id":"1","method":"POST","url":"/v1/responses","body":{"model":"gpt-4.1-mini"}}`; !strings.HasPrefix(string(uploaded), want) {
+		t.Errorf("uploaded file = %s", uploaded)
+	}
+	if !strings.Contains(string(created), `"endpoint":"/v1/responses"`) || !strings.Contains(string(created), `"input_file_id":"file-in"`) {
+		t.Errorf("create body = %s", created)
+	}
+	st, err := p.Poll(context.Background(), id)
+	if err != nil || !st.Done || st.Err != "" {
+		t.Fatalf("Poll = %+v, %v", st, err)
+	}
+	out, err := p.Results(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out["1"].Body) != `{"output_text":"x"}` || !strings.Contains(out["2"].Err, "status 400") || out["3"].Err != "expired" {
+		t.Errorf("results = %+v", out)
+	}
+}
+
+func TestGemini_Model(t *testing.T) {
+	tests := []struct {
+		url     string
+		want    string
+		wantErr bool
+	}{
+		{"https://generativelanguage.googleapis.com/v1beta/models/gemini-2.5-flash:generateContent?%24alt=json", "gemini-2.5-flash", false},
+		{"https://generativelanguage.googleapis.com/v1beta/models/gemini-2.5-flash:streamGenerateContent", "", true},
+		{"https://generativelanguage.googleapis.com/v1beta/cachedContents", "", true},
+	}
+	for _, tt := range tests {
+		got, err := NewGemini("").Model(Request{URL: tt.url})
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("Model(%q) = %q, %v; want %q, err=%v", tt.url, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestManager_RejectsImageRefs(t *testing.T) {
+	dir := t.TempDir()
+	m, err := NewManager(Options{Dir: dir}, map[string]Backend{
+		"gpt": {Provider: &fakeProvider{model: NewOpenAI("").Model}, NewEngine: func(c *http.Client) ocr.Engine {
+			return gpt.New("key", "gpt-4.1-mini").WithHTTPClient(c)
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		request string
+		want    string
+	}{
+		{"image_id", `{"image_id":"abc"}`, "image_id is not supported"},
+		{"url", `{"image":"aGVsbG8=","images":[{"image":"https://example.com/p2.png"}]}`, "image URLs are not supported"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := `{"id":"a","step":"detect","request":{"image":"aGVsbG8="}}` + "\n" +
+				`{"id":"b","step":"parse","request":` + tt.request + `}`
+			_, err := m.Submit(context.Background(), "gpt", strings.NewReader(input))
+			if err == nil || !strings.Contains(err.Error(), "line 2") || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Submit() error = %v, want %q on line 2", err, tt.want)
+			}
+			if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+				t.Errorf("rejected batch left %d job dirs", len(entries))
+			}
+		})
+	}
+}
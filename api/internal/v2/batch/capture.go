@@ -0,0 +1,127 @@
+package batch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"llm-proxy/api/internal/v2/ocr"
+	"llm-proxy/api/internal/v2/ocr/types"
+)
+
+// errCaptured прерывает вызов движка после перехвата запроса к провайдеру.
+var errCaptured = errors.New("batch: request captured")
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+// capture вызывает шаг на движке с транспортом, который не отправляет запрос,
+// а запоминает его. Так запрос к провайдеру собирается тем же кодом, что онлайн:
+// промпты, блоки, схема, изображение. Ошибка — шаг не дошёл до провайдера
+// (невалидный запрос, нет изображения и т.п.).
+func capture(newEngine func(*http.Client) ocr.Engine, item Item) (Request, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var got *Request
+	client := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		if got != nil {
+			return nil, errCaptured
+		}
+		var body []byte
+		if r.Body != nil {
+			b, err := io.ReadAll(r.Body)
+			if err != nil {
+				return nil, err
+			}
+			body = b
+		}
+		if !json.Valid(body) {
+			return nil, fmt.Errorf("batch: provider request body is not JSON")
+		}
+		got = &Request{URL: r.URL.String(), Body: body}
+		// Отмена контекста останавливает ретраи движка без пауз.
+		cancel()
+		return nil, errCaptured
+	})}
+	_, _, err := runStep(ctx, newEngine(client), item.Step, item.Request)
+	if got == nil {
+		if err == nil {
+			err = errors.New("engine made no provider call")
+		}
+		return Request{}, err
+	}
+	return *got, nil
+}
+
+// replay вызывает шаг на движке с транспортом, который вместо провайдера отдаёт
+// ответ из batch-задания. Движок разбирает и валидирует его как онлайн-ответ.
+// Шаги с повторным вызовом (семантический ретрай) завершаются ошибкой:
+// в batch-ответе есть только первый.
+func replay(ctx context.Context, newEngine func(*http.Client) ocr.Engine, item Item, body []byte) (any, *types.LLMStats, error) {
+	served := false
+	client := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		if served {
+			return nil, errors.New("batch: engine made a second provider call")
+		}
+		served = true
+		if r.Body != nil {
+			_, _ = io.Copy(io.Discard, r.Body)
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {"application/json"}},
+			Body:       io.NopCloser(bytes.NewReader(body)),
+			Request:    r,
+		}, nil
+	})}
+	return runStep(ctx, newEngine(client), item.Step, item.Request)
+}
+
+// steps — шаги v2, доступные в batch (имена как в экспериментах и кэше ответов).
+var steps = map[string]bool{
+	"detect": true, "parse": true, "hint": true, "check": true, "analogue": true,
+	"parse_ru": true, "hint_ru": true, "check_ru": true,
+}
+
+// runStep декодирует запрос шага и вызывает соответствующий метод движка.
+func runStep(ctx context.Context, e ocr.Engine, step string, raw json.RawMessage) (any, *types.LLMStats, error) {
+	switch step {
+	case "detect":
+		return call(ctx, raw, e.Detect)
+	case "parse":
+		return call(ctx, raw, e.Parse)
+	case "hint":
+		return call(ctx, raw, e.Hint)
+	case "check":
+		return call(ctx, raw, e.CheckSolution)
+	case "analogue":
+		return call(ctx, raw, e.AnalogueSolution)
+	case "parse_ru":
+		return call(ctx, raw, e.ParseRU)
+	case "hint_ru":
+		return call(ctx, raw, e.HintRU)
+	case "check_ru":
+		return call(ctx, raw, e.CheckRU)
+	default:
+		return nil, nil, fmt.Errorf("unknown step %q", step)
+	}
+}
+
+func call[Req, Resp any](ctx context.Context, raw json.RawMessage, fn func(context.Context, Req) (Resp, *types.LLMStats, error)) (any, *types.LLMStats, error) {
+	var in Req
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&in); err != nil {
+		return nil, nil, fmt.Errorf("decode request: %w", err)
+	}
+	out, stats, err := fn(ctx, in)
+	if err != nil {
+		return nil, stats, err
+	}
+	return out, stats, nil
+}
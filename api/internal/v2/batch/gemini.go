@@ -0,0 +1,237 @@
+package batch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const geminiBaseURL = "https://generativelanguage.googleapis.com"
+
+// Gemini — Batch Mode Gemini API: файл JSONL загружается через Files API,
+// задание создаётся методом models/{model}:batchGenerateContent, ответы
+// приходят файлом с теми же ключами.
+type Gemini struct {
+	apiKey string
+	httpc  *http.Client
+}
+
+func NewGemini(apiKey string) *Gemini {
+	return &Gemini{apiKey: apiKey, httpc: &http.Client{Timeout: 5 * time.Minute}}
+}
+
+// WithHTTPClient подменяет HTTP-клиент (тесты, кассеты).
+func (p *Gemini) WithHTTPClient(c *http.Client) *Gemini {
+	if c != nil {
+		p.httpc = c
+	}
+	return p
+}
+
+func (p *Gemini) header() http.Header {
+	return http.Header{"X-Goog-Api-Key": {p.apiKey}}
+}
+
+// Model извлекает модель из пути /v1beta/models/{model}:generateContent.
+func (p *Gemini) Model(req Request) (string, error) {
+	u, err := url.Parse(req.URL)
+	if err != nil {
+		return "", fmt.Errorf("gemini batch: request url: %w", err)
+	}
+	_, rest, ok := strings.Cut(u.Path, "/models/")
+	if !ok {
+		return "", fmt.Errorf("gemini batch: model not found in %s", u.Path)
+	}
+	model, method, ok := strings.Cut(rest, ":")
+	if !ok || model == "" || method != "generateContent" {
+		return "", fmt.Errorf("gemini batch: unsupported request %s", u.Path)
+	}
+	return model, nil
+}
+
+// geminiLine — строка входного и выходного файла: key связывает ответ с запросом.
+type geminiLine struct {
+	Key      string          `json:"key"`
+	Request  json.RawMessage `json:"request,omitempty"`
+	Response json.RawMessage `json:"response,omitempty"`
+	Error    *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+func (p *Gemini) Submit(ctx context.Context, model string, reqs []Request) (string, error) {
+	if len(reqs) == 0 {
+		return "", fmt.Errorf("gemini batch: no requests")
+	}
+	var file bytes.Buffer
+	enc := json.NewEncoder(&file)
+	for _, r := range reqs {
+		if err := enc.Encode(geminiLine{Key: r.CustomID, Request: r.Body}); err != nil {
+			return "", fmt.Errorf("gemini batch: encode line: %w", err)
+		}
+	}
+	name := "batch-" + model
+	fileName, err := p.upload(ctx, name, file.Bytes())
+	if err != nil {
+		return "", fmt.Errorf("gemini batch: upload: %w", err)
+	}
+	in := map[string]any{
+		"batch": map[string]any{
+			"display_name": name,
+			"input_config": map[string]any{"file_name": fileName},
+		},
+	}
+	var op struct {
+		Name string `json:"name"`
+	}
+	u := geminiBaseURL + "/v1beta/models/" + url.PathEscape(model) + ":batchGenerateContent"
+	if err := doJSON(ctx, p.httpc, http.MethodPost, u, p.header(), in, &op); err != nil {
+		return "", fmt.Errorf("gemini batch: create: %w", err)
+	}
+	if op.Name == "" {
+		return "", fmt.Errorf("gemini batch: create: empty batch name")
+	}
+	return op.Name, nil
+}
+
+// upload загружает файл resumable-протоколом Files API: start → upload, finalize.
+func (p *Gemini) upload(ctx context.Context, name string, data []byte) (string, error) {
+	meta, _ := json.Marshal(map[string]any{"file": map[string]any{"display_name": name}})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, geminiBaseURL+"/upload/v1beta/files", bytes.NewReader(meta))
+	if err != nil {
+		return "", err
+	}
+	req.Header = p.header()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Goog-Upload-Protocol", "resumable")
+	req.Header.Set("X-Goog-Upload-Command", "start")
+	req.Header.Set("X-Goog-Upload-Header-Content-Length", strconv.Itoa(len(data)))
+	req.Header.Set("X-Goog-Upload-Header-Content-Type", "application/jsonl")
+	_, h, err := do(p.httpc, req)
+	if err != nil {
+		return "", err
+	}
+	uploadURL := h.Get("X-Goog-Upload-Url")
+	if uploadURL == "" {
+		return "", fmt.Errorf("upload url not returned")
+	}
+
+	req, err = http.NewRequestWithContext(ctx, http.MethodPost, uploadURL, bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	req.Header = p.header()
+	req.Header.Set("X-Goog-Upload-Offset", "0")
+	req.Header.Set("X-Goog-Upload-Command", "upload, finalize")
+	raw, _, err := do(p.httpc, req)
+	if err != nil {
+		return "", err
+	}
+	var out struct {
+		File struct {
+			Name string `json:"name"`
+		} `json:"file"`
+	}
+	if err := json.Unmarshal(raw, &out); err != nil || out.File.Name == "" {
+		return "", fmt.Errorf("file name not found in response")
+	}
+	return out.File.Name, nil
+}
+
+// geminiOperation — long-running operation из GET /v1beta/batches/{id}.
+type geminiOperation struct {
+	Done     bool `json:"done"`
+	Metadata struct {
+		State  string `json:"state"`
+		Output struct {
+			ResponsesFile string `json:"responsesFile"`
+		} `json:"output"`
+	} `json:"metadata"`
+	Response struct {
+		ResponsesFile string `json:"responsesFile"`
+	} `json:"response"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (op geminiOperation) responsesFile() string {
+	if op.Response.ResponsesFile != "" {
+		return op.Response.ResponsesFile
+	}
+	return op.Metadata.Output.ResponsesFile
+}
+
+func (p *Gemini) get(ctx context.Context, remoteID string) (geminiOperation, error) {
+	var op geminiOperation
+	err := doJSON(ctx, p.httpc, http.MethodGet, geminiBaseURL+"/v1beta/"+remoteID, p.header(), nil, &op)
+	return op, err
+}
+
+func (p *Gemini) Poll(ctx context.Context, remoteID string) (Status, error) {
+	op, err := p.get(ctx, remoteID)
+	if err != nil {
+		return Status{}, fmt.Errorf("gemini batch: poll: %w", err)
+	}
+	st := Status{State: op.Metadata.State}
+	switch op.Metadata.State {
+	case "BATCH_STATE_SUCCEEDED":
+		st.Done = true
+	case "BATCH_STATE_FAILED", "BATCH_STATE_CANCELLED", "BATCH_STATE_EXPIRED":
+		st.Done = true
+		st.Err = strings.ToLower(strings.TrimPrefix(op.Metadata.State, "BATCH_STATE_"))
+	}
+	if op.Done {
+		st.Done = true
+	}
+	if op.Error != nil {
+		st.Err = op.Error.Message
+	}
+	return st, nil
+}
+
+func (p *Gemini) Results(ctx context.Context, remoteID string) (map[string]Output, error) {
+	op, err := p.get(ctx, remoteID)
+	if err != nil {
+		return nil, fmt.Errorf("gemini batch: results: %w", err)
+	}
+	file := op.responsesFile()
+	if file == "" {
+		return map[string]Output{}, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, geminiBaseURL+"/download/v1beta/"+file+":download?alt=media", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = p.header()
+	raw, _, err := do(p.httpc, req)
+	if err != nil {
+		return nil, fmt.Errorf("gemini batch: download %s: %w", file, err)
+	}
+	out := make(map[string]Output)
+	err = eachLine(raw, func(line []byte) error {
+		var l geminiLine
+		if err := json.Unmarshal(line, &l); err != nil {
+			return fmt.Errorf("gemini batch: parse output line: %w", err)
+		}
+		switch {
+		case l.Error != nil:
+			out[l.Key] = Output{Err: l.Error.Message}
+		case len(l.Response) == 0:
+			out[l.Key] = Output{Err: "empty response"}
+		default:
+			out[l.Key] = Output{Body: l.Response}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,226 @@
+package batch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const openAIBaseURL = "https://api.openai.com/v1"
+
+// OpenAI — Batch API OpenAI: файл запросов загружается с purpose=batch,
+// задание выполняется в окне 24h, ответы приходят файлом JSONL.
+type OpenAI struct {
+	apiKey string
+	httpc  *http.Client
+}
+
+func NewOpenAI(apiKey string) *OpenAI {
+	return &OpenAI{apiKey: apiKey, httpc: &http.Client{Timeout: 5 * time.Minute}}
+}
+
+// WithHTTPClient подменяет HTTP-клиент (тесты, кассеты).
+func (p *OpenAI) WithHTTPClient(c *http.Client) *OpenAI {
+	if c != nil {
+		p.httpc = c
+	}
+	return p
+}
+
+func (p *OpenAI) header() http.Header {
+	return http.Header{"Authorization": {"Bearer " + p.apiKey}}
+}
+
+func (p *OpenAI) Model(req Request) (string, error) {
+	var body struct {
+		Model string `json:"model"`
+	}
+	if err := json.Unmarshal(req.Body, &body); err != nil || body.Model == "" {
+		return "", fmt.Errorf("openai batch: model not found in request body")
+	}
+	return body.Model, nil
+}
+
+// openAILine — строка входного файла Batch API.
+type openAILine struct {
+	CustomID string          `json:"custom_id"`
+	Method   string          `json:"method"`
+	URL      string          `json:"url"`
+	Body     json.RawMessage `json:"body"`
+}
+
+func (p *OpenAI) Submit(ctx context.Context, model string, reqs []Request) (string, error) {
+	if len(reqs) == 0 {
+		return "", fmt.Errorf("openai batch: no requests")
+	}
+	u, err := url.Parse(reqs[0].URL)
+	if err != nil {
+		return "", fmt.Errorf("openai batch: request url: %w", err)
+	}
+	endpoint := u.Path // /v1/responses
+	var file bytes.Buffer
+	enc := json.NewEncoder(&file)
+	for _, r := range reqs {
+		if err := enc.Encode(openAILine{CustomID: r.CustomID, Method: http.MethodPost, URL: endpoint, Body: r.Body}); err != nil {
+			return "", fmt.Errorf("openai batch: encode line: %w", err)
+		}
+	}
+
+	fileID, err := p.upload(ctx, "batch-"+model+".jsonl", file.Bytes())
+	if err != nil {
+		return "", fmt.Errorf("openai batch: upload: %w", err)
+	}
+	var created struct {
+		ID string `json:"id"`
+	}
+	in := map[string]any{
+		"input_file_id":     fileID,
+		"endpoint":          endpoint,
+		"completion_window": "24h",
+	}
+	if err := doJSON(ctx, p.httpc, http.MethodPost, openAIBaseURL+"/batches", p.header(), in, &created); err != nil {
+		return "", fmt.Errorf("openai batch: create: %w", err)
+	}
+	return created.ID, nil
+}
+
+func (p *OpenAI) upload(ctx context.Context, name string, data []byte) (string, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	if err := mw.WriteField("purpose", "batch"); err != nil {
+		return "", err
+	}
+	fw, err := mw.CreateFormFile("file", name)
+	if err != nil {
+		return "", err
+	}
+	if _, err := fw.Write(data); err != nil {
+		return "", err
+	}
+	if err := mw.Close(); err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, openAIBaseURL+"/files", &body)
+	if err != nil {
+		return "", err
+	}
+	req.Header = p.header()
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	raw, _, err := do(p.httpc, req)
+	if err != nil {
+		return "", err
+	}
+	var file struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(raw, &file); err != nil || file.ID == "" {
+		return "", fmt.Errorf("file id not found in response")
+	}
+	return file.ID, nil
+}
+
+// openAIBatch — объект batch из GET /v1/batches/{id}.
+type openAIBatch struct {
+	Status       string `json:"status"`
+	OutputFileID string `json:"output_file_id"`
+	ErrorFileID  string `json:"error_file_id"`
+	Errors       *struct {
+		Data []struct {
+			Message string `json:"message"`
+		} `json:"data"`
+	} `json:"errors"`
+}
+
+func (p *OpenAI) get(ctx context.Context, remoteID string) (openAIBatch, error) {
+	var b openAIBatch
+	err := doJSON(ctx, p.httpc, http.MethodGet, openAIBaseURL+"/batches/"+url.PathEscape(remoteID), p.header(), nil, &b)
+	return b, err
+}
+
+func (p *OpenAI) Poll(ctx context.Context, remoteID string) (Status, error) {
+	b, err := p.get(ctx, remoteID)
+	if err != nil {
+		return Status{}, fmt.Errorf("openai batch: poll: %w", err)
+	}
+	st := Status{State: b.Status}
+	switch b.Status {
+	case "completed":
+		st.Done = true
+	case "failed", "expired", "cancelled":
+		st.Done = true
+		st.Err = "batch " + b.Status
+		if b.Errors != nil && len(b.Errors.Data) > 0 {
+			st.Err += ": " + b.Errors.Data[0].Message
+		}
+	}
+	return st, nil
+}
+
+// openAIOutputLine — строка файла результатов или ошибок.
+type openAIOutputLine struct {
+	CustomID string `json:"custom_id"`
+	Response *struct {
+		StatusCode int             `json:"status_code"`
+		Body       json.RawMessage `json:"body"`
+	} `json:"response"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (p *OpenAI) Results(ctx context.Context, remoteID string) (map[string]Output, error) {
+	b, err := p.get(ctx, remoteID)
+	if err != nil {
+		return nil, fmt.Errorf("openai batch: results: %w", err)
+	}
+	out := make(map[string]Output)
+	// Ответы с ошибкой (4xx/5xx) лежат в error_file_id; у истёкшего задания
+	// output_file_id содержит то, что успело выполниться.
+	for _, fileID := range []string{b.OutputFileID, b.ErrorFileID} {
+		if fileID == "" {
+			continue
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, openAIBaseURL+"/files/"+url.PathEscape(fileID)+"/content", nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header = p.header()
+		raw, _, err := do(p.httpc, req)
+		if err != nil {
+			return nil, fmt.Errorf("openai batch: download %s: %w", fileID, err)
+		}
+		err = eachLine(raw, func(line []byte) error {
+			var l openAIOutputLine
+			if err := json.Unmarshal(line, &l); err != nil {
+				return fmt.Errorf("openai batch: parse output line: %w", err)
+			}
+			switch {
+			case l.Error != nil:
+				out[l.CustomID] = Output{Err: l.Error.Message}
+			case l.Response == nil:
+				out[l.CustomID] = Output{Err: "empty response"}
+			case l.Response.StatusCode != http.StatusOK:
+				out[l.CustomID] = Output{Err: fmt.Sprintf("status %d: %s", l.Response.StatusCode, truncate(l.Response.Body, 512))}
+			default:
+				out[l.CustomID] = Output{Body: l.Response.Body}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func truncate(b []byte, n int) string {
+	if len(b) > n {
+		return string(b[:n]) + "..."
+	}
+	return string(b)
+}
@@ -0,0 +1,112 @@
+package batch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Provider — batch API провайдера.
+type Provider interface {
+	// Model возвращает модель перехваченного запроса: задание у провайдера
+	// создаётся на одну модель, поэтому запросы группируются по ней.
+	Model(req Request) (string, error)
+	// Submit загружает файл запросов и создаёт задание; возвращает его id у провайдера.
+	Submit(ctx context.Context, model string, reqs []Request) (string, error)
+	// Poll возвращает состояние задания.
+	Poll(ctx context.Context, remoteID string) (Status, error)
+	// Results скачивает ответы завершённого задания по CustomID.
+	Results(ctx context.Context, remoteID string) (map[string]Output, error)
+}
+
+// Request — перехваченный запрос движка к провайдеру.
+type Request struct {
+	CustomID string
+	URL      string
+	Body     json.RawMessage
+}
+
+// Status — состояние задания у провайдера.
+type Status struct {
+	State string // как его называет провайдер: in_progress, BATCH_STATE_RUNNING...
+	Done  bool   // провайдер закончил обработку (успешно или нет)
+	Err   string // причина, если задание завершилось без результатов
+}
+
+// Output — ответ провайдера на один запрос: тело в том же формате, что и онлайн.
+type Output struct {
+	Body json.RawMessage
+	Err  string
+}
+
+// doJSON отправляет JSON-запрос и декодирует JSON-ответ; статус не 2xx — ошибка с телом ответа.
+func doJSON(ctx context.Context, c *http.Client, method, url string, header http.Header, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("marshal request: %w", err)
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	raw, _, err := do(c, req)
+	if err != nil {
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(raw, out); err != nil {
+		return fmt.Errorf("%s %s: parse response: %w", method, req.URL.Path, err)
+	}
+	return nil
+}
+
+// do выполняет запрос и читает тело; статус не 2xx — ошибка с началом тела ответа.
+func do(c *http.Client, req *http.Request) ([]byte, http.Header, error) {
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s %s: read response: %w", req.Method, req.URL.Path, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg := strings.TrimSpace(string(raw))
+		if len(msg) > 512 {
+			msg = msg[:512] + "..."
+		}
+		return nil, nil, fmt.Errorf("%s %s %d: %s", req.Method, req.URL.Path, resp.StatusCode, msg)
+	}
+	return raw, resp.Header, nil
+}
+
+// eachLine вызывает fn для каждой непустой строки JSONL.
+func eachLine(data []byte, fn func(line []byte) error) error {
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		if err := fn(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+// Package coalesce объединяет одновременные одинаковые запросы v2: пока
+// первый запрос выполняется, повторы с тем же телом ждут его результат, а не
+// запускают ещё один дорогой вызов LLM. Типичный случай — бот повторил запрос
+// после клиентского таймаута, а первый ещё обрабатывается.
+//
+// Запросы считаются одинаковыми, если совпадают путь, канонический JSON тела
+// (порядок ключей и пробелы не важны; llm_name входит в тело) и заголовки,
+// влияющие на маршрутизацию. Общий вызов отменяется, только когда ушли все
+// ожидающие клиенты; пока остался хоть один, вызов продолжается.
+//
+// Присоединившийся запрос получает тот же ответ с заголовком X-Coalesced: 1,
+// а токены и стоимость в нём обнулены: провайдеру заплатили один раз, и
+// клиент, суммирующий X-LLM-Cost-USD, не должен учесть вызов дважды.
+package coalesce
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"llm-proxy/api/internal/metrics"
+	"llm-proxy/api/internal/util"
+)
+
+// HeaderCoalesced помечает ответ, полученный из чужого вызова.
+const HeaderCoalesced = "X-Coalesced"
+
+// costHeaders — заголовки расхода вызова (handle.writeStatsHeaders); в ответе
+// присоединившемуся запросу они обнуляются.
+var costHeaders = []string{"X-LLM-Input-Tokens", "X-LLM-Output-Tokens", "X-LLM-Cached-Tokens", "X-LLM-Cost-USD"}
+
+// keyHeaders — заголовки, меняющие результат запроса (эксперименты, фейковый
+// движок, обход кэша); запросы с разными значениями не объединяются.
+var keyHeaders = []string{"X-User-Id", "X-Task-Id", "X-Fake-Scenario", "X-Fake-Latency-Ms", "X-Cache-Bypass", "Cache-Control"}
+
+var coalesced = metrics.NewCounter(
+	"llm_proxy_coalesced_requests_total",
+	"Requests served by joining an identical in-flight request.",
+	"path",
+)
+
+// Group хранит выполняющиеся вызовы по ключу.
+type Group struct {
+	maxBody int64
+
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+type call struct {
+	done   chan struct{}
+	resp   *recorder
+	refs   int
+	cancel context.CancelFunc
+}
+
+// New создаёт группу; тела больше maxBody не объединяются и уходят в хендлер как есть.
+func New(maxBody int64) *Group {
+	return &Group{maxBody: maxBody, calls: map[string]*call{}}
+}
+
+// Middleware объединяет POST-запросы к /v2/.
+func (g *Group) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || !strings.HasPrefix(r.URL.Path, "/v2/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		orig := r.Body
+		body, err := io.ReadAll(io.LimitReader(orig, g.maxBody+1))
+		if err != nil || int64(len(body)) > g.maxBody {
+			// Ошибку чтения и превышение лимита сообщит сам хендлер.
+			r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), orig))
+			next.ServeHTTP(w, r)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		key, ok := requestKey(r, body)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		g.serve(w, r, key, body, next)
+	})
+}
+
+func (g *Group) serve(w http.ResponseWriter, r *http.Request, key string, body []byte, next http.Handler) {
+	g.mu.Lock()
+	c, joined := g.calls[key]
+	if joined {
+		c.refs++
+	} else {
+		// Общий вызов не привязан к контексту первого клиента: его уход
+		// не должен отменять вызов, пока ждут остальные.
+		ctx, cancel := context.WithCancel(context.WithoutCancel(r.Context()))
+		c = &call{done: make(chan struct{}), refs: 1, cancel: cancel}
+		g.calls[key] = c
+		shared := r.Clone(ctx)
+		shared.Body = io.NopCloser(bytes.NewReader(body))
+		go g.run(key, c, shared, next)
+	}
+	g.mu.Unlock()
+
+	if joined {
+		coalesced.Inc(r.URL.Path)
+		log.Printf("[coalesce] %s joined in-flight request", r.URL.Path)
+	}
+
+	select {
+	case <-c.done:
+		g.leave(key, c, false)
+		c.resp.replay(w, joined)
+	case <-r.Context().Done():
+		g.leave(key, c, true)
+	}
+}
+
+// leave снимает ожидающего. Ушёл последний до завершения — вызов отменяется
+// и убирается из группы, чтобы новые запросы не присоединились к отменённому.
+func (g *Group) leave(key string, c *call, abandoned bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	c.refs--
+	if abandoned && c.refs == 0 {
+		c.cancel()
+		if g.calls[key] == c {
+			delete(g.calls, key)
+		}
+	}
+}
+
+func (g *Group) run(key string, c *call, r *http.Request, next http.Handler) {
+	rec := newRecorder()
+	defer func() {
+		if p := recover(); p != nil {
+			log.Printf("[coalesce] handler panic: %v", p)
+			rec = newRecorder()
+			rec.WriteHeader(http.StatusInternalServerError)
+		}
+		g.mu.Lock()
+		if g.calls[key] == c {
+			delete(g.calls, key)
+		}
+		c.resp = rec
+		g.mu.Unlock()
+		c.cancel()
+		close(c.done)
+	}()
+	next.ServeHTTP(rec, r)
+}
+
+// requestKey — хеш пути с query, заголовков маршрутизации и канонического JSON тела.
+// Тело из нескольких JSON-значений (JSONL batch-загрузки) не объединяется.
+func requestKey(r *http.Request, body []byte) (string, bool) {
+	var v any
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return "", false
+	}
+	if dec.More() {
+		return "", false
+	}
+	// encoding/json сортирует ключи объектов — это и есть каноническая форма.
+	canonical, err := json.Marshal(v)
+	if err != nil {
+		return "", false
+	}
+	var b strings.Builder
+	b.WriteString(r.URL.Path)
+	b.WriteString("?" + r.URL.RawQuery)
+	for _, h := range keyHeaders {
+		b.WriteString("\x00" + r.Header.Get(h))
+	}
+	b.WriteString("\x00")
+	b.Write(canonical)
+	return util.SHA256Hex([]byte(b.String())), true
+}
+
+// recorder буферизует ответ хендлера для раздачи всем ожидающим.
+type recorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newRecorder() *recorder { return &recorder{header: http.Header{}} }
+
+func (r *recorder) Header() http.Header { return r.header }
+
+func (r *recorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
+
+func (r *recorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.body.Write(p)
+}
+
+// replay отдаёт записанный ответ; joined — ответ присоединившемуся запросу.
+func (r *recorder) replay(w http.ResponseWriter, joined bool) {
+	for k, vs := range r.header {
+		w.Header()[k] = append([]string(nil), vs...)
+	}
+	if joined {
+		w.Header().Set(HeaderCoalesced, "1")
+		for _, h := range costHeaders {
+			if w.Header().Get(h) != "" {
+				w.Header().Set(h, "0")
+			}
+		}
+	}
+	status := r.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+	if _, err := w.Write(r.body.Bytes()); err != nil {
+		log.Printf("[coalesce] write response: %v", err)
+	}
+}
@@ -0,0 +1,171 @@
+package coalesce
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blockingHandler отвечает телом запроса после release; ctxErr фиксирует отмену.
+type blockingHandler struct {
+	calls   atomic.Int32
+	started chan struct{}
+	release chan struct{}
+	ctxErr  chan error
+}
+
+func newBlocking() *blockingHandler {
+	return &blockingHandler{started: make(chan struct{}, 4), release: make(chan struct{}), ctxErr: make(chan error, 4)}
+}
+
+func (h *blockingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.calls.Add(1)
+	body, _ := io.ReadAll(r.Body)
+	h.started <- struct{}{}
+	select {
+	case <-h.release:
+		w.Header().Set("X-LLM-Model", "m")
+		w.Header().Set("X-LLM-Input-Tokens", "120")
+		w.Header().Set("X-LLM-Cost-USD", "0.0042")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write(body)
+	case <-r.Context().Done():
+		h.ctxErr <- r.Context().Err()
+	}
+}
+
+func post(ctx context.Context, h http.Handler, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/v2/hint", strings.NewReader(body)).WithContext(ctx)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+// waitJoined ждёт, пока к вызову присоединится n ожидающих.
+func waitJoined(t *testing.T, g *Group, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		g.mu.Lock()
+		refs := 0
+		for _, c := range g.calls {
+			refs += c.refs
+		}
+		g.mu.Unlock()
+		if refs == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("waiters did not join")
+}
+
+func TestCoalesce_IdenticalRequestsShareOneCall(t *testing.T) {
+	h := newBlocking()
+	g := New(1 << 20)
+	srv := g.Middleware(h)
+
+	var wg sync.WaitGroup
+	recs := make([]*httptest.ResponseRecorder, 2)
+	bodies := []string{`{"llm_name":"gpt","task":{"a":1,"b":2}}`, `{ "task": {"b":2, "a":1}, "llm_name":"gpt" }`}
+	for i, body := range bodies {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			recs[i] = post(context.Background(), srv, body)
+		}()
+		if i == 0 {
+			<-h.started
+		}
+	}
+	waitJoined(t, g, 2)
+	close(h.release)
+	wg.Wait()
+
+	if n := h.calls.Load(); n != 1 {
+		t.Fatalf("handler calls = %d, want 1", n)
+	}
+	for i, rec := range recs {
+		if rec.Code != http.StatusCreated || rec.Body.String() != bodies[0] || rec.Header().Get("X-LLM-Model") != "m" {
+			t.Errorf("response %d: %d %q %v", i, rec.Code, rec.Body.String(), rec.Header())
+		}
+	}
+	if recs[0].Header().Get(HeaderCoalesced) != "" || recs[1].Header().Get(HeaderCoalesced) != "1" {
+		t.Errorf("coalesced markers: %q / %q", recs[0].Header().Get(HeaderCoalesced), recs[1].Header().Get(HeaderCoalesced))
+	}
+	if recs[0].Header().Get("X-LLM-Cost-USD") != "0.0042" || recs[0].Header().Get("X-LLM-Input-Tokens") != "120" {
+		t.Errorf("leader stats headers: %v", recs[0].Header())
+	}
+	if recs[1].Header().Get("X-LLM-Cost-USD") != "0" || recs[1].Header().Get("X-LLM-Input-Tokens") != "0" || recs[1].Header().Get("X-LLM-Output-Tokens") != "" {
+		t.Errorf("joined stats headers: %v", recs[1].Header())
+	}
+}
+
+func TestCoalesce_DifferentLLMNameNotShared(t *testing.T) {
+	h := newBlocking()
+	close(h.release)
+	srv := New(1 << 20).Middleware(h)
+	post(context.Background(), srv, `{"llm_name":"gpt"}`)
+	post(context.Background(), srv, `{"llm_name":"gemini"}`)
+	if n := h.calls.Load(); n != 2 {
+		t.Fatalf("handler calls = %d, want 2", n)
+	}
+}
+
+func TestCoalesce_CancelOnlyWhenAllWaitersGone(t *testing.T) {
+	h := newBlocking()
+	g := New(1 << 20)
+	srv := g.Middleware(h)
+	body := `{"llm_name":"gpt"}`
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	done := make(chan struct{}, 2)
+	go func() { post(ctx1, srv, body); done <- struct{}{} }()
+	<-h.started
+	go func() { post(ctx2, srv, body); done <- struct{}{} }()
+	waitJoined(t, g, 2)
+
+	// Первый клиент ушёл — общий вызов продолжается ради второго.
+	cancel1()
+	<-done
+	select {
+	case err := <-h.ctxErr:
+		t.Fatalf("shared call cancelled while a waiter remains: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// Ушёл и второй — вызов отменяется.
+	cancel2()
+	<-done
+	select {
+	case err := <-h.ctxErr:
+		if err != context.Canceled {
+			t.Errorf("ctx err = %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("shared call not cancelled after all waiters left")
+	}
+}
+
+func TestRequestKey(t *testing.T) {
+	key := func(target, body string) (string, bool) {
+		return requestKey(httptest.NewRequest(http.MethodPost, target, strings.NewReader(body)), []byte(body))
+	}
+	base, ok := key("/v2/batches?llm_name=gpt", `{"id":"1"}`)
+	if !ok {
+		t.Fatal("single JSON value must be coalescable")
+	}
+	if other, _ := key("/v2/batches?llm_name=gemini", `{"id":"1"}`); other == base {
+		t.Error("query must be part of the key")
+	}
+	if _, ok := key("/v2/batches?llm_name=gpt", "{\"id\":\"1\"}\n{\"id\":\"2\"}\n"); ok {
+		t.Error("JSONL body with several values must not be coalesced")
+	}
+}
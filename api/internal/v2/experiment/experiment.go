@@ -0,0 +1,185 @@
+// Package experiment распределяет запросы v2 по вариантам экспериментов.
+//
+// Эксперимент описывается в JSON-конфиге (EXPERIMENTS_FILE): имя, шаги и
+// варианты с весами. Вариант может подменить движок (llm_name), модель или
+// каталог промптов. Назначение детерминировано: вариант выбирается по
+// sha256(имя эксперимента + ключ), где ключ — user id клиента или task_id,
+// поэтому один и тот же ребёнок или задача всегда попадает в один вариант.
+package experiment
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"llm-proxy/api/internal/v2/ocr"
+)
+
+// Variant — вариант эксперимента. Пустые LLMName/Model/PromptDir означают
+// «как в запросе» — такой вариант служит контрольной группой.
+type Variant struct {
+	Name      string `json:"name"`
+	Weight    int    `json:"weight"`
+	LLMName   string `json:"llm_name,omitempty"`
+	Model     string `json:"model,omitempty"`
+	PromptDir string `json:"prompt_dir,omitempty"`
+}
+
+// IsControl сообщает, что вариант ничего не подменяет.
+func (v Variant) IsControl() bool {
+	return v.LLMName == "" && v.Model == "" && v.PromptDir == ""
+}
+
+// Experiment — описание эксперимента из конфига.
+type Experiment struct {
+	Name     string    `json:"name"`
+	Steps    []string  `json:"steps"`
+	Variants []Variant `json:"variants"`
+}
+
+// Load читает список экспериментов из JSON-файла; пустой путь — экспериментов нет.
+func Load(path string) ([]Experiment, error) {
+	if strings.TrimSpace(path) == "" {
+		return nil, nil
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("experiments: read %s: %w", path, err)
+	}
+	var exps []Experiment
+	if err := json.Unmarshal(raw, &exps); err != nil {
+		return nil, fmt.Errorf("experiments: parse %s: %w", path, err)
+	}
+	for _, exp := range exps {
+		if err := exp.validate(); err != nil {
+			return nil, err
+		}
+	}
+	return exps, nil
+}
+
+func (e Experiment) validate() error {
+	if e.Name == "" {
+		return errors.New("experiments: experiment without name")
+	}
+	if len(e.Steps) == 0 {
+		return fmt.Errorf("experiments: %s: no steps", e.Name)
+	}
+	total := 0
+	seen := map[string]bool{}
+	for _, v := range e.Variants {
+		if v.Name == "" || seen[v.Name] {
+			return fmt.Errorf("experiments: %s: empty or duplicate variant name %q", e.Name, v.Name)
+		}
+		seen[v.Name] = true
+		if v.Weight < 0 {
+			return fmt.Errorf("experiments: %s/%s: negative weight", e.Name, v.Name)
+		}
+		total += v.Weight
+	}
+	if total == 0 {
+		return fmt.Errorf("experiments: %s: total weight is zero", e.Name)
+	}
+	return nil
+}
+
+// Pick детерминированно выбирает индекс варианта для ключа.
+func Pick(experiment, key string, variants []Variant) int {
+	total := 0
+	for _, v := range variants {
+		total += v.Weight
+	}
+	if total <= 0 {
+		return -1
+	}
+	sum := sha256.Sum256([]byte(experiment + "\x00" + key))
+	bucket := int(binary.BigEndian.Uint64(sum[:8]) % uint64(total))
+	for i, v := range variants {
+		if bucket < v.Weight {
+			return i
+		}
+		bucket -= v.Weight
+	}
+	return len(variants) - 1
+}
+
+// Assignment — результат назначения запроса.
+type Assignment struct {
+	Experiment string
+	Variant    string
+	Engine     ocr.Engine // nil — использовать движок из запроса
+}
+
+// Header возвращает значение заголовка X-Experiment: "exp=variant".
+func (a Assignment) Header() string { return a.Experiment + "=" + a.Variant }
+
+// EngineBuilder создаёт движок варианта. Вызывается один раз при старте.
+type EngineBuilder func(v Variant, steps []string) (ocr.Engine, error)
+
+type compiled struct {
+	Experiment
+	steps   map[string]bool
+	engines []ocr.Engine
+}
+
+// Router хранит эксперименты с заранее собранными движками вариантов.
+type Router struct {
+	exps []compiled
+}
+
+// NewRouter собирает движки для всех не-контрольных вариантов.
+func NewRouter(exps []Experiment, build EngineBuilder) (*Router, error) {
+	r := &Router{}
+	for _, exp := range exps {
+		if err := exp.validate(); err != nil {
+			return nil, err
+		}
+		c := compiled{Experiment: exp, steps: map[string]bool{}, engines: make([]ocr.Engine, len(exp.Variants))}
+		for _, s := range exp.Steps {
+			c.steps[s] = true
+		}
+		for i, v := range exp.Variants {
+			if v.IsControl() {
+				continue
+			}
+			eng, err := build(v, exp.Steps)
+			if err != nil {
+				return nil, fmt.Errorf("experiments: %s/%s: %w", exp.Name, v.Name, err)
+			}
+			c.engines[i] = eng
+		}
+		r.exps = append(r.exps, c)
+	}
+	return r, nil
+}
+
+// Len возвращает число активных экспериментов.
+func (r *Router) Len() int {
+	if r == nil {
+		return 0
+	}
+	return len(r.exps)
+}
+
+// Assign назначает вариант первого эксперимента, покрывающего шаг.
+// Пустой ключ не назначается: без стабильного ключа результаты нельзя склеить.
+func (r *Router) Assign(step, key string) (Assignment, bool) {
+	if r == nil || key == "" {
+		return Assignment{}, false
+	}
+	for _, exp := range r.exps {
+		if !exp.steps[step] {
+			continue
+		}
+		i := Pick(exp.Name, key, exp.Variants)
+		if i < 0 {
+			continue
+		}
+		return Assignment{Experiment: exp.Name, Variant: exp.Variants[i].Name, Engine: exp.engines[i]}, true
+	}
+	return Assignment{}, false
+}
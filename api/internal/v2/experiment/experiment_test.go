@@ -0,0 +1,96 @@
+package experiment
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"llm-proxy/api/internal/v2/ocr"
+	"llm-proxy/api/internal/v2/ocr/fake"
+)
+
+func TestPick_DeterministicAndWeighted(t *testing.T) {
+	variants := []Variant{{Name: "control", Weight: 80}, {Name: "b", Weight: 20}, {Name: "off", Weight: 0}}
+	counts := make([]int, len(variants))
+	for i := 0; i < 5000; i++ {
+		key := fmt.Sprintf("user:%d", i)
+		got := Pick("exp", key, variants)
+		if again := Pick("exp", key, variants); again != got {
+			t.Fatalf("Pick(%s) not deterministic: %d vs %d", key, got, again)
+		}
+		counts[got]++
+	}
+	if counts[2] != 0 {
+		t.Errorf("zero-weight variant picked %d times", counts[2])
+	}
+	if share := float64(counts[1]) / 5000; share < 0.17 || share > 0.23 {
+		t.Errorf("variant b share = %.3f, want ≈0.20", share)
+	}
+}
+
+func TestLoad_Validation(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		wantErr bool
+	}{
+		{"valid", `[{"name":"e","steps":["hint"],"variants":[{"name":"a","weight":1}]}]`, false},
+		{"no steps", `[{"name":"e","variants":[{"name":"a","weight":1}]}]`, true},
+		{"duplicate variant", `[{"name":"e","steps":["hint"],"variants":[{"name":"a","weight":1},{"name":"a","weight":1}]}]`, true},
+		{"zero total weight", `[{"name":"e","steps":["hint"],"variants":[{"name":"a","weight":0}]}]`, true},
+		{"bad json", `{`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "exp.json")
+			if err := os.WriteFile(path, []byte(tt.body), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := Load(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+	if exps, err := Load(""); err != nil || exps != nil {
+		t.Fatalf("Load(\"\") = %v, %v", exps, err)
+	}
+}
+
+func TestRouter_Assign(t *testing.T) {
+	exps := []Experiment{{
+		Name:  "hint_engine",
+		Steps: []string{"hint"},
+		Variants: []Variant{
+			{Name: "control", Weight: 0},
+			{Name: "fake", Weight: 1, LLMName: "fake"},
+		},
+	}}
+	var built []string
+	r, err := NewRouter(exps, func(v Variant, steps []string) (ocr.Engine, error) {
+		built = append(built, v.Name)
+		return fake.New(fake.Options{}), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(built) != 1 || built[0] != "fake" {
+		t.Fatalf("built engines for %v, want only non-control variant", built)
+	}
+
+	a, ok := r.Assign("hint", "user:42")
+	if !ok || a.Variant != "fake" || a.Engine == nil || a.Header() != "hint_engine=fake" {
+		t.Fatalf("Assign(hint) = %+v, %v", a, ok)
+	}
+	if _, ok := r.Assign("check", "user:42"); ok {
+		t.Error("step outside experiment must not be assigned")
+	}
+	if _, ok := r.Assign("hint", ""); ok {
+		t.Error("empty key must not be assigned")
+	}
+	var nilRouter *Router
+	if _, ok := nilRouter.Assign("hint", "user:42"); ok || nilRouter.Len() != 0 {
+		t.Error("nil router must be a no-op")
+	}
+}
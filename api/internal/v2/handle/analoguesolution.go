@@ -37,7 +37,7 @@ func (h *Handle) AnalogueSolution(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), deadline)
 	defer cancel()
 
-	engine, err := h.engs.GetEngine(req.LLMName)
+	engine, err := h.engineFor(w, r, "analogue", req.LLMName, "")
 	if err != nil {
 		log.Printf("[analogue] engine error: %v", err)
 		http.Error(w, "engine not available", http.StatusBadGateway)
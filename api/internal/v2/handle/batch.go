@@ -0,0 +1,85 @@
+package handle
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"llm-proxy/api/internal/v2/batch"
+)
+
+// batchSubmitTimeout — сборка запросов и загрузка файлов провайдеру.
+const batchSubmitTimeout = 5 * time.Minute
+
+// WithBatch подключает batch-режим: /v2/batches.
+func (h *Handle) WithBatch(m *batch.Manager) *Handle {
+	h.batches = m
+	return h
+}
+
+// SubmitBatch — POST /v2/batches?llm_name=gpt|gemini. Тело — JSONL строк
+// {"id", "step", "request"}. Ответ 202 с состоянием задания; результаты
+// забираются из /v2/batches/{id}/results после state=completed.
+func (h *Handle) SubmitBatch(w http.ResponseWriter, r *http.Request) {
+	if h.batches == nil {
+		http.Error(w, "batch mode disabled", http.StatusNotFound)
+		return
+	}
+	if limit := h.batches.MaxInputBytes(); limit > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+	}
+	llmName := r.URL.Query().Get("llm_name")
+	if llmName == "" {
+		llmName = "gpt"
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), batchSubmitTimeout)
+	defer cancel()
+	job, err := h.batches.Submit(ctx, llmName, r.Body)
+	if err != nil {
+		log.Printf("[batch] submit: %v", err)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "batch input too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+// BatchStatus — GET /v2/batches/{id}.
+func (h *Handle) BatchStatus(w http.ResponseWriter, r *http.Request) {
+	if h.batches == nil {
+		http.Error(w, "batch mode disabled", http.StatusNotFound)
+		return
+	}
+	job, ok := h.batches.Job(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "batch not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+// BatchResults — GET /v2/batches/{id}/results: JSONL в порядке входного файла.
+func (h *Handle) BatchResults(w http.ResponseWriter, r *http.Request) {
+	if h.batches == nil {
+		http.Error(w, "batch mode disabled", http.StatusNotFound)
+		return
+	}
+	id := r.PathValue("id")
+	path, ok := h.batches.ResultsPath(id)
+	if !ok {
+		if _, exists := h.batches.Job(id); exists {
+			http.Error(w, "batch not completed", http.StatusConflict)
+			return
+		}
+		http.Error(w, "batch not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	http.ServeFile(w, r, path)
+}
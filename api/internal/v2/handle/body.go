@@ -0,0 +1,125 @@
+package handle
+
+import (
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+
+	"llm-proxy/api/internal/util"
+	"llm-proxy/api/internal/v2/ocr/types"
+)
+
+// zstdMaxWindow ограничивает окно zstd: иначе заголовок кадра может
+// потребовать гигабайты памяти ещё до чтения данных.
+const zstdMaxWindow = 8 << 20
+
+// decodedBody возвращает тело запроса, распакованное по Content-Encoding.
+func decodedBody(r *http.Request) (io.ReadCloser, error) {
+	switch enc := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))); enc {
+	case "", "identity":
+		return r.Body, nil
+	case "gzip":
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return nil, fmt.Errorf("read request body: gzip: %w", err)
+		}
+		return zr, nil
+	case "zstd":
+		zr, err := zstd.NewReader(r.Body,
+			zstd.WithDecoderConcurrency(1),
+			zstd.WithDecoderMaxWindow(zstdMaxWindow),
+			zstd.WithDecoderMaxMemory(maxBodySize+1))
+		if err != nil {
+			return nil, fmt.Errorf("read request body: zstd: %w", err)
+		}
+		return zr.IOReadCloser(), nil
+	default:
+		return nil, fmt.Errorf("unsupported Content-Encoding %q", enc)
+	}
+}
+
+// readMultipart собирает JSON-тело из multipart/form-data: часть "json" —
+// поля запроса, файлы — изображения без base64:
+//   - "image" — основное изображение (поле image);
+//   - "images" или "images.<role>" — дополнительные, в порядке частей.
+//
+// Файлы подставляются в JSON как data URL, дальше запрос обрабатывается как обычный.
+func readMultipart(src io.Reader, boundary string) ([]byte, error) {
+	if boundary == "" {
+		return nil, errors.New("multipart boundary is missing")
+	}
+	var (
+		payload []byte
+		image   string
+		images  []types.ImageRef
+	)
+	mr := multipart.NewReader(src, boundary)
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(part)
+		if err != nil {
+			return nil, err
+		}
+		switch name := part.FormName(); {
+		case name == "json":
+			payload = data
+		case name == "image":
+			if image != "" {
+				return nil, errors.New(`multipart: duplicate "image" part`)
+			}
+			image = fileDataURL(data)
+		case name == "images" || strings.HasPrefix(name, "images."):
+			images = append(images, types.ImageRef{Image: fileDataURL(data), Role: strings.TrimPrefix(strings.TrimPrefix(name, "images"), ".")})
+		default:
+			return nil, fmt.Errorf("multipart: unexpected part %q", name)
+		}
+	}
+
+	fields := map[string]json.RawMessage{}
+	if len(payload) > 0 {
+		if err := json.Unmarshal(payload, &fields); err != nil {
+			return nil, fmt.Errorf("multipart: json part: %w", err)
+		}
+	}
+	if image != "" {
+		if _, ok := fields["image"]; ok {
+			return nil, errors.New(`multipart: image is set both in json and as a file`)
+		}
+		if _, ok := fields["image_id"]; ok {
+			return nil, errors.New(`multipart: image_id and an image file are mutually exclusive`)
+		}
+		fields["image"], _ = json.Marshal(image)
+	}
+	if len(images) > 0 {
+		var refs []json.RawMessage
+		if raw, ok := fields["images"]; ok {
+			if err := json.Unmarshal(raw, &refs); err != nil {
+				return nil, fmt.Errorf("multipart: images: %w", err)
+			}
+		}
+		for _, ref := range images {
+			b, _ := json.Marshal(ref)
+			refs = append(refs, b)
+		}
+		fields["images"], _ = json.Marshal(refs)
+	}
+	return json.Marshal(fields)
+}
+
+func fileDataURL(data []byte) string {
+	return "data:" + util.PickMIME("", "", data) + ";base64," + base64.StdEncoding.EncodeToString(data)
+}
@@ -0,0 +1,199 @@
+package handle
+
+import (
+	"bytes"
+	"compress/gzip"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+
+	"llm-proxy/api/internal/v2/ocr/types"
+)
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func zstdBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	zw, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zw.Close()
+	return zw.EncodeAll(data, nil)
+}
+
+func TestReadAndLimitBody_ContentEncoding(t *testing.T) {
+	t.Parallel()
+	valid := []byte(`{"name":"task"}`)
+	// Сжимается в килобайты, распаковывается больше лимита.
+	bomb := append(append([]byte(`{"name":"`), bytes.Repeat([]byte("a"), maxBodySize+1)...), `"}`...)
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+		wantErr  bool
+	}{
+		{name: "identity", encoding: "identity", body: valid},
+		{name: "gzip", encoding: "gzip", body: gzipBytes(t, valid)},
+		{name: "zstd", encoding: "zstd", body: zstdBytes(t, valid)},
+		{name: "gzip bomb", encoding: "gzip", body: gzipBytes(t, bomb), wantErr: true},
+		{name: "zstd bomb", encoding: "zstd", body: zstdBytes(t, bomb), wantErr: true},
+		{name: "corrupt gzip", encoding: "gzip", body: valid, wantErr: true},
+		{name: "unsupported", encoding: "br", body: valid, wantErr: true},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(test.body))
+			req.Header.Set("Content-Encoding", test.encoding)
+			var dst struct {
+				Name string `json:"name"`
+			}
+			err := readAndLimitBody(httptest.NewRecorder(), req, &dst)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("readAndLimitBody() error=%v, wantErr=%v", err, test.wantErr)
+			}
+			if !test.wantErr && dst.Name != "task" {
+				t.Fatalf("name = %q, want task", dst.Name)
+			}
+		})
+	}
+}
+
+type multipartField struct {
+	name, content string
+	file          bool
+}
+
+func multipartRequest(t *testing.T, fields []multipartField) *http.Request {
+	t.Helper()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for _, f := range fields {
+		var err error
+		if f.file {
+			h := textproto.MIMEHeader{}
+			h.Set("Content-Disposition", `form-data; name="`+f.name+`"; filename="photo"`)
+			h.Set("Content-Type", "application/octet-stream")
+			w, err2 := mw.CreatePart(h)
+			if err2 != nil {
+				t.Fatal(err2)
+			}
+			_, err = w.Write([]byte(f.content))
+		} else {
+			err = mw.WriteField(f.name, f.content)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/", &buf)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+func TestReadAndLimitBody_Multipart(t *testing.T) {
+	t.Parallel()
+	const png = "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"
+	tests := []struct {
+		name       string
+		fields     []multipartField
+		wantErr    bool
+		wantImage  bool
+		wantRoles  []string
+		wantLLMTag string
+	}{
+		{
+			name: "json and image file",
+			fields: []multipartField{
+				{name: "json", content: `{"llm_name":"gpt"}`},
+				{name: "image", content: png, file: true},
+			},
+			wantImage:  true,
+			wantLLMTag: "gpt",
+		},
+		{
+			name: "images with roles keep order",
+			fields: []multipartField{
+				{name: "json", content: `{"images":[{"image":"aGk=","role":"task"}]}`},
+				{name: "images.answer", content: png, file: true},
+				{name: "images", content: png, file: true},
+			},
+			wantRoles: []string{"task", "answer", ""},
+		},
+		{
+			name: "image in json and as file",
+			fields: []multipartField{
+				{name: "json", content: `{"image":"aGk="}`},
+				{name: "image", content: png, file: true},
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown part",
+			fields: []multipartField{
+				{name: "photo", content: png, file: true},
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown json field",
+			fields: []multipartField{
+				{name: "json", content: `{"unexpected":true}`},
+			},
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			var dst struct {
+				LLMName string           `json:"llm_name"`
+				Image   string           `json:"image"`
+				Images  []types.ImageRef `json:"images"`
+			}
+			err := readAndLimitBody(httptest.NewRecorder(), multipartRequest(t, test.fields), &dst)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("readAndLimitBody() error=%v, wantErr=%v", err, test.wantErr)
+			}
+			if test.wantErr {
+				return
+			}
+			if got := strings.HasPrefix(dst.Image, "data:image/png;base64,"); got != test.wantImage {
+				t.Fatalf("image = %.40q, want png data URL: %v", dst.Image, test.wantImage)
+			}
+			if dst.LLMName != test.wantLLMTag {
+				t.Fatalf("llm_name = %q, want %q", dst.LLMName, test.wantLLMTag)
+			}
+			if len(dst.Images) != len(test.wantRoles) {
+				t.Fatalf("images = %d, want %d", len(dst.Images), len(test.wantRoles))
+			}
+			for i, role := range test.wantRoles {
+				if dst.Images[i].Role != role {
+					t.Errorf("images[%d].role = %q, want %q", i, dst.Images[i].Role, role)
+				}
+			}
+		})
+	}
+}
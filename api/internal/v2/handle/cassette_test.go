@@ -0,0 +1,73 @@
+package handle
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"llm-proxy/api/internal/v2/ocr"
+	"llm-proxy/api/internal/v2/ocr/cassette"
+	"llm-proxy/api/internal/v2/ocr/openrouter"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+// TestDetect_CassetteReplay прогоняет /v2/detect через движок openrouter дважды:
+// сначала с записью ответа фейкового провайдера, затем офлайн из кассеты.
+func TestDetect_CassetteReplay(t *testing.T) {
+	t.Setenv("PROMPT_DIR", "../..")
+	dir := t.TempDir()
+
+	const content = `{"schema_version":"2.2.2","quality":{"recommend_retake":false,"issues":[]},` +
+		`"classification":{"subject_candidate":"math","confidence":0.93}}`
+	completion, _ := json.Marshal(map[string]any{
+		"choices": []any{map[string]any{"message": map[string]any{"content": content}}},
+		"usage":   map[string]any{"prompt_tokens": 120, "completion_tokens": 30, "cost": 0.0001},
+	})
+	upstream := roundTripFunc(func(*http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       io.NopCloser(bytes.NewReader(completion)),
+		}, nil
+	})
+	offline := roundTripFunc(func(*http.Request) (*http.Response, error) {
+		t.Fatal("replay must not touch the network")
+		return nil, nil
+	})
+
+	img := append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{7}, 600)...)
+	body := `{"llm_name":"openrouter","image":"` + base64.StdEncoding.EncodeToString(img) + `"}`
+
+	detect := func(mode cassette.Mode, base http.RoundTripper) (int, string) {
+		tr, err := cassette.New(mode, dir, "openrouter", base)
+		if err != nil {
+			t.Fatal(err)
+		}
+		eng := openrouter.New("sk-test", openrouter.StepModels{Detect: "openai/gpt-4.1-mini"}).
+			WithHTTPClient(&http.Client{Transport: tr})
+		h := New(&ocr.Engines{OpenRouter: eng})
+		rr := httptest.NewRecorder()
+		h.Detect(rr, httptest.NewRequest(http.MethodPost, "/v2/detect", strings.NewReader(body)))
+		return rr.Code, rr.Body.String()
+	}
+
+	recCode, recBody := detect(cassette.ModeRecord, upstream)
+	if recCode != http.StatusOK {
+		t.Fatalf("record: status %d body %s", recCode, recBody)
+	}
+	playCode, playBody := detect(cassette.ModeReplay, offline)
+	if playCode != http.StatusOK || playBody != recBody {
+		t.Fatalf("replay: status %d body %s, want %s", playCode, playBody, recBody)
+	}
+	if !strings.Contains(playBody, `"subject_candidate":"math"`) {
+		t.Errorf("unexpected detect output: %s", playBody)
+	}
+}
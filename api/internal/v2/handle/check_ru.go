@@ -31,7 +31,7 @@ func (h *Handle) CheckRU(w http.ResponseWriter, r *http.Request) {
 	var out types.CheckRUResponse
 	var stats *types.LLMStats
 
-	engine, err := h.engs.GetEngine(req.LLMName)
+	engine, err := h.engineFor(w, r, "check_ru", req.LLMName, "")
 	if err != nil {
 		log.Printf("[check_ru] engine error: %v", err)
 		http.Error(w, "engine not available", http.StatusBadGateway)
@@ -28,12 +28,21 @@ func (h *Handle) CheckSolution(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "bad json", http.StatusBadRequest)
 		return
 	}
+	if _, err := req.AllImages(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	deadline := parseDeadline(r)
 	ctx, cancel := context.WithTimeout(r.Context(), deadline)
 	defer cancel()
 
-	engine, err := h.engs.GetEngine(req.LLMName)
+	if err := h.resolveImages(ctx, &req.Image, &req.ImageID, req.Images); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	engine, err := h.engineFor(w, r, "check", req.LLMName, "")
 	if err != nil {
 		log.Printf("[check] engine error: %v", err)
 		http.Error(w, "engine not available", http.StatusBadGateway)
@@ -26,10 +26,8 @@ func (h *Handle) Detect(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	req.Image = stripDataURL(req.Image)
-	img, err := base64.StdEncoding.DecodeString(req.Image)
-	if err != nil || len(img) == 0 {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "bad image_b64"})
+	if _, err := req.AllImages(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
 		return
 	}
 
@@ -37,11 +35,25 @@ func (h *Handle) Detect(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), deadline)
 	defer cancel()
 
+	if err := h.resolveImages(ctx, &req.Image, &req.ImageID, req.Images); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	refs, _ := req.AllImages()
+	for _, ref := range refs {
+		img, err := base64.StdEncoding.DecodeString(stripDataURL(ref.Image))
+		if err != nil || len(img) == 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "bad image_b64"})
+			return
+		}
+	}
+	req.Image = stripDataURL(req.Image)
+
 	var out types.DetectResponse
 	var stats *types.LLMStats
 
 	log.Printf("[detect] llm_name=%q", req.LLMName)
-	engine, err := h.engs.GetEngine(req.LLMName)
+	engine, err := h.engineFor(w, r, "detect", req.LLMName, "")
 	if err != nil {
 		log.Printf("[detect] engine error: %v", err)
 		writeJSON(w, http.StatusBadGateway, map[string]string{"error": "engine not available"})
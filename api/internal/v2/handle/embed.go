@@ -36,7 +36,7 @@ func (h *Handle) Embed(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("[embed] llm_name=%q, input_count=%d", req.LLMName, len(req.Input))
 
-	engine, err := h.engs.GetEngine(req.LLMName)
+	engine, err := h.engineFor(w, r, "embed", req.LLMName, "")
 	if err != nil {
 		log.Printf("[embed] engine error: %v", err)
 		writeJSON(w, http.StatusBadGateway, map[string]string{"error": "engine not available"})
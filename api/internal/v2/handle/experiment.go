@@ -0,0 +1,59 @@
+package handle
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"llm-proxy/api/internal/metrics"
+	"llm-proxy/api/internal/v2/experiment"
+	"llm-proxy/api/internal/v2/ocr"
+)
+
+// Заголовки экспериментов: ключ назначения от клиента и назначенный вариант в ответе.
+const (
+	headerUserID     = "X-User-Id"
+	headerTaskID     = "X-Task-Id"
+	headerExperiment = "X-Experiment"
+)
+
+var experimentAssignments = metrics.NewCounter(
+	"llm_proxy_experiment_assignments_total",
+	"Requests assigned to an experiment variant.",
+	"experiment", "variant", "step",
+)
+
+// WithExperiments подключает распределение запросов по вариантам экспериментов.
+func (h *Handle) WithExperiments(r *experiment.Router) *Handle {
+	h.experiments = r
+	return h
+}
+
+// engineFor возвращает движок для шага: вариант эксперимента, если запрос
+// в него попал, иначе движок по llm_name. Назначенный вариант пишется
+// в заголовок X-Experiment, лог и метрики.
+func (h *Handle) engineFor(w http.ResponseWriter, r *http.Request, step, llmName, taskID string) (ocr.Engine, error) {
+	if a, ok := h.experiments.Assign(step, experimentKey(r, taskID)); ok {
+		w.Header().Set(headerExperiment, a.Header())
+		experimentAssignments.Inc(a.Experiment, a.Variant, step)
+		log.Printf("[%s] experiment=%s variant=%s", step, a.Experiment, a.Variant)
+		if a.Engine != nil {
+			return a.Engine, nil
+		}
+	}
+	return h.engs.GetEngine(llmName)
+}
+
+// experimentKey — стабильный ключ назначения: user id клиента, затем task_id.
+func experimentKey(r *http.Request, taskID string) string {
+	if v := strings.TrimSpace(r.Header.Get(headerUserID)); v != "" {
+		return "user:" + v
+	}
+	if v := strings.TrimSpace(taskID); v != "" {
+		return "task:" + v
+	}
+	if v := strings.TrimSpace(r.Header.Get(headerTaskID)); v != "" {
+		return "task:" + v
+	}
+	return ""
+}
@@ -0,0 +1,52 @@
+package handle
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"llm-proxy/api/internal/v2/experiment"
+	"llm-proxy/api/internal/v2/ocr"
+	"llm-proxy/api/internal/v2/ocr/fake"
+)
+
+func TestDetect_ExperimentVariant(t *testing.T) {
+	exps := []experiment.Experiment{{
+		Name:     "detect_engine",
+		Steps:    []string{"detect"},
+		Variants: []experiment.Variant{{Name: "fake", Weight: 1, LLMName: "fake"}},
+	}}
+	router, err := experiment.NewRouter(exps, func(experiment.Variant, []string) (ocr.Engine, error) {
+		return fake.New(fake.Options{}), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// В запросе движок, которого нет: ответ возможен только из варианта.
+	h := New(&ocr.Engines{}).WithExperiments(router)
+
+	body := `{"llm_name":"openrouter","image":"aGVsbG8="}`
+	req := httptest.NewRequest(http.MethodPost, "/v2/detect", strings.NewReader(body))
+	req.Header.Set(headerUserID, "child-1")
+	rec := httptest.NewRecorder()
+	h.Detect(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get(headerExperiment); got != "detect_engine=fake" {
+		t.Errorf("%s = %q", headerExperiment, got)
+	}
+	if got := experimentAssignments.Value("detect_engine", "fake", "detect"); got < 1 {
+		t.Errorf("assignment counter = %v", got)
+	}
+
+	// Без ключа назначения запрос идёт в движок из llm_name.
+	req = httptest.NewRequest(http.MethodPost, "/v2/detect", strings.NewReader(body))
+	rec = httptest.NewRecorder()
+	h.Detect(rec, req)
+	if rec.Header().Get(headerExperiment) != "" || rec.Code == http.StatusOK {
+		t.Errorf("unassigned request: status %d, header %q", rec.Code, rec.Header().Get(headerExperiment))
+	}
+}
@@ -7,10 +7,15 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"mime"
 	"net/http"
 	"strconv"
 	"time"
 
+	"llm-proxy/api/internal/v2/batch"
+	"llm-proxy/api/internal/v2/experiment"
+	"llm-proxy/api/internal/v2/imagefetch"
+	"llm-proxy/api/internal/v2/imagestore"
 	"llm-proxy/api/internal/v2/ocr"
 	"llm-proxy/api/internal/v2/ocr/types"
 	"llm-proxy/api/internal/v2/tmplrouter"
@@ -29,8 +34,15 @@ const (
 	defaultTimeout = 180 * time.Second
 )
 
+// MaxBodySize — лимит тела запроса v2 для middleware, читающих тело до хендлера.
+const MaxBodySize = maxBodySize
+
 type Handle struct {
-	engs *ocr.Engines
+	engs        *ocr.Engines
+	experiments *experiment.Router  // nil — эксперименты выключены
+	batches     *batch.Manager      // nil — batch-режим выключен
+	fetcher     *imagefetch.Fetcher // nil — изображения по URL не принимаются
+	store       *imagestore.Store   // nil — image_id не принимается
 }
 
 func New(engs *ocr.Engines) *Handle {
@@ -54,6 +66,9 @@ func writeStatsHeaders(w http.ResponseWriter, stats *types.LLMStats) {
 	w.Header().Set("X-LLM-Input-Tokens", strconv.Itoa(stats.InputTokens))
 	w.Header().Set("X-LLM-Output-Tokens", strconv.Itoa(stats.OutputTokens))
 	w.Header().Set("X-LLM-Latency-Ms", strconv.FormatInt(stats.LatencyMs, 10))
+	if stats.CachedTokens > 0 {
+		w.Header().Set("X-LLM-Cached-Tokens", strconv.Itoa(stats.CachedTokens))
+	}
 	if stats.Model != "" {
 		w.Header().Set("X-LLM-Model", stats.Model)
 	}
@@ -66,6 +81,28 @@ func writeStatsHeaders(w http.ResponseWriter, stats *types.LLMStats) {
 	if stats.CostUSD > 0 {
 		w.Header().Set("X-LLM-Cost-USD", strconv.FormatFloat(stats.CostUSD, 'f', 9, 64))
 	}
+	if stats.Cache != "" {
+		w.Header().Set("X-LLM-Cache", stats.Cache)
+	}
+	if stats.LeakCheck != "" {
+		w.Header().Set("X-LLM-Leak-Check", stats.LeakCheck)
+	}
+	if stats.Safety != "" {
+		w.Header().Set("X-LLM-Safety", stats.Safety)
+	}
+	if stats.Readability != "" {
+		w.Header().Set("X-LLM-Readability", stats.Readability)
+	}
+	if stats.Validation != "" {
+		w.Header().Set("X-LLM-Validation", stats.Validation)
+	}
+	if stats.JSONRepair != "" {
+		w.Header().Set("X-LLM-JSON-Repair", stats.JSONRepair)
+	}
+	if stats.ImageBytesIn > 0 {
+		w.Header().Set("X-LLM-Image-Bytes-In", strconv.Itoa(stats.ImageBytesIn))
+		w.Header().Set("X-LLM-Image-Bytes-Out", strconv.Itoa(stats.ImageBytesOut))
+	}
 }
 
 func writeJSON(w http.ResponseWriter, code int, v any) {
@@ -101,16 +138,32 @@ func limitBodyReader(w http.ResponseWriter, r *http.Request) {
 }
 
 // readAndLimitBody читает тело запроса с лимитом и декодирует JSON.
+// Тело может быть сжато (Content-Encoding: gzip | zstd) или прийти как
+// multipart/form-data (см. readMultipart). Лимит maxBodySize действует и на
+// сжатые байты, и на распакованные — защита от zip-бомб.
 // Возвращает ошибку, если тело превышает maxBodySize или невалидный JSON.
 func readAndLimitBody(w http.ResponseWriter, r *http.Request, dst any) error {
 	limitBodyReader(w, r)
-	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize+1))
+	src, err := decodedBody(r)
 	if err != nil {
-		return fmt.Errorf("read request body: %w", err)
+		return err
+	}
+	defer src.Close()
+	limited := &io.LimitedReader{R: src, N: maxBodySize + 1}
+
+	var body []byte
+	mediaType, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		body, err = readMultipart(limited, params["boundary"])
+	} else {
+		body, err = io.ReadAll(limited)
 	}
-	if len(body) > maxBodySize {
+	if limited.N <= 0 {
 		return fmt.Errorf("request body exceeds %d bytes", maxBodySize)
 	}
+	if err != nil {
+		return fmt.Errorf("read request body: %w", err)
+	}
 	decoder := json.NewDecoder(bytes.NewReader(body))
 	decoder.DisallowUnknownFields()
 	if err := decoder.Decode(dst); err != nil {
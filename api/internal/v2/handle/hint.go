@@ -31,7 +31,7 @@ func (h *Handle) Hint(w http.ResponseWriter, r *http.Request) {
 	var out types.HintResponse
 	var stats *types.LLMStats
 
-	engine, err := h.engs.GetEngine(req.LLMName)
+	engine, err := h.engineFor(w, r, "hint", req.LLMName, req.Task.TaskId)
 	if err != nil {
 		log.Printf("[hint] engine error: %v", err)
 		http.Error(w, "engine not available", http.StatusBadGateway)
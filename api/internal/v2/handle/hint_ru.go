@@ -31,7 +31,7 @@ func (h *Handle) HintRU(w http.ResponseWriter, r *http.Request) {
 	var out types.HintRUResponse
 	var stats *types.LLMStats
 
-	engine, err := h.engs.GetEngine(req.LLMName)
+	engine, err := h.engineFor(w, r, "hint_ru", req.LLMName, "")
 	if err != nil {
 		log.Printf("[hint_ru] engine error: %v", err)
 		http.Error(w, "engine not available", http.StatusBadGateway)
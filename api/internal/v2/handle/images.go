@@ -0,0 +1,141 @@
+package handle
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+
+	"llm-proxy/api/internal/v2/imagefetch"
+	"llm-proxy/api/internal/v2/imagestore"
+	"llm-proxy/api/internal/v2/ocr/types"
+)
+
+// multipartOverhead — запас на заголовки частей multipart сверх лимита изображения.
+const multipartOverhead = 64 << 10
+
+// WithImageFetcher разрешает передавать изображения как http(s) URL.
+func (h *Handle) WithImageFetcher(f *imagefetch.Fetcher) *Handle {
+	h.fetcher = f
+	return h
+}
+
+// WithImageStore включает POST /v2/images и поля image_id.
+func (h *Handle) WithImageStore(s *imagestore.Store) *Handle {
+	h.store = s
+	return h
+}
+
+// UploadImage — POST /v2/images: тело — изображение целиком или
+// multipart/form-data с файлом в поле "image". Ответ 201 с image_id,
+// который шаги v2 принимают вместо base64.
+func (h *Handle) UploadImage(w http.ResponseWriter, r *http.Request) {
+	if h.store == nil {
+		http.Error(w, "image store disabled", http.StatusNotFound)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, h.store.MaxImageBytes()+multipartOverhead)
+	data, err := readUpload(r)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, imagestore.ErrTooLarge.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	info, err := h.store.Put(data)
+	switch {
+	case errors.Is(err, imagestore.ErrTooLarge):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+	case errors.Is(err, imagestore.ErrNotImage):
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+	case errors.Is(err, imagestore.ErrQuota):
+		http.Error(w, err.Error(), http.StatusInsufficientStorage)
+	case err != nil:
+		log.Printf("[images] store: %v", err)
+		http.Error(w, "image store failed", http.StatusInternalServerError)
+	default:
+		writeJSON(w, http.StatusCreated, info)
+	}
+}
+
+// readUpload читает изображение из тела или из части "image" multipart-формы.
+func readUpload(r *http.Request) ([]byte, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return io.ReadAll(r.Body)
+	}
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil, errors.New(`multipart form has no "image" part`)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == "image" {
+			return io.ReadAll(part)
+		}
+	}
+}
+
+// resolveImages заменяет image_id и URL в полях изображений на содержимое
+// (data URL): движки, кэш ответов и coalescing видят только байты. Лимит
+// types.MaxImagesBytes проверяется заново по мере подстановки: до неё
+// ссылки занимают байты, а не мегабайты.
+func (h *Handle) resolveImages(ctx context.Context, image, imageID *string, images []types.ImageRef) error {
+	if err := h.resolveImage(ctx, image, imageID); err != nil {
+		return err
+	}
+	total := len(*image)
+	for i := range images {
+		if total > types.MaxImagesBytes {
+			break
+		}
+		if err := h.resolveImage(ctx, &images[i].Image, &images[i].ImageID); err != nil {
+			return fmt.Errorf("images[%d]: %w", i, err)
+		}
+		total += len(images[i].Image)
+	}
+	if total > types.MaxImagesBytes {
+		return fmt.Errorf("images too large: more than %d bytes after resolving URLs and image_id", types.MaxImagesBytes)
+	}
+	return nil
+}
+
+func (h *Handle) resolveImage(ctx context.Context, image, imageID *string) error {
+	if *imageID != "" {
+		if h.store == nil {
+			return errors.New("image store disabled")
+		}
+		data, mime, err := h.store.Get(*imageID)
+		if err != nil {
+			return fmt.Errorf("image_id %s: %w", *imageID, err)
+		}
+		*image = "data:" + mime + ";base64," + base64.StdEncoding.EncodeToString(data)
+		*imageID = ""
+		return nil
+	}
+	if !imagefetch.IsURL(*image) {
+		return nil
+	}
+	if h.fetcher == nil {
+		return errors.New("image URLs are disabled")
+	}
+	dataURL, err := h.fetcher.DataURL(ctx, *image)
+	if err != nil {
+		return fmt.Errorf("fetch image: %w", err)
+	}
+	*image = dataURL
+	return nil
+}
@@ -0,0 +1,156 @@
+package handle
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"llm-proxy/api/internal/v2/imagefetch"
+	"llm-proxy/api/internal/v2/imagestore"
+	"llm-proxy/api/internal/v2/ocr"
+	"llm-proxy/api/internal/v2/ocr/fake"
+	"llm-proxy/api/internal/v2/ocr/types"
+)
+
+// recordingEngine запоминает запрос PARSE, дошедший до движка.
+type recordingEngine struct {
+	*fake.Engine
+	got types.ParseRequest
+}
+
+func (e *recordingEngine) Parse(ctx context.Context, in types.ParseRequest) (types.ParseResponse, *types.LLMStats, error) {
+	e.got = in
+	return e.Engine.Parse(ctx, in)
+}
+
+func TestParse_ImageURL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"))
+	}))
+	defer srv.Close()
+
+	body := `{"llm_name":"fake","image":"aGVsbG8=","images":[{"image":"` + srv.URL + `/answer.png","role":"answer"}]}`
+	post := func(h *Handle) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.Parse(rec, httptest.NewRequest(http.MethodPost, "/v2/parse", strings.NewReader(body)))
+		return rec
+	}
+
+	engine := &recordingEngine{Engine: fake.New(fake.Options{})}
+	if rec := post(New(&ocr.Engines{Fake: engine})); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "image URLs are disabled") {
+		t.Fatalf("without fetcher: status %d, body %q", rec.Code, rec.Body.String())
+	}
+
+	fetcher := imagefetch.New(imagefetch.Options{Allow: []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")}})
+	if rec := post(New(&ocr.Engines{Fake: engine}).WithImageFetcher(fetcher)); rec.Code != http.StatusOK {
+		t.Fatalf("status %d, body %q", rec.Code, rec.Body.String())
+	}
+	if engine.got.Image != "aGVsbG8=" || len(engine.got.Images) != 1 {
+		t.Fatalf("engine got %+v", engine.got)
+	}
+	if ref := engine.got.Images[0]; ref.Role != "answer" || !strings.HasPrefix(ref.Image, "data:image/png;base64,") {
+		t.Errorf("images[0] = %+v", ref)
+	}
+}
+
+func TestUploadImage_ThenParseByID(t *testing.T) {
+	store, err := imagestore.New(imagestore.Options{Dir: t.TempDir(), MaxImageBytes: 1 << 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := &recordingEngine{Engine: fake.New(fake.Options{})}
+	h := New(&ocr.Engines{Fake: engine}).WithImageStore(store)
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+	var form bytes.Buffer
+	mw := multipart.NewWriter(&form)
+	_ = mw.WriteField("note", "ignored")
+	part, _ := mw.CreateFormFile("image", "task.png")
+	_, _ = part.Write(png)
+	_ = mw.Close()
+
+	uploads := []struct {
+		name        string
+		body        []byte
+		contentType string
+		wantCode    int
+	}{
+		{"raw", png, "image/png", http.StatusCreated},
+		{"multipart", form.Bytes(), mw.FormDataContentType(), http.StatusCreated},
+		{"not an image", []byte("hello"), "text/plain", http.StatusUnsupportedMediaType},
+		{"too large", append(png, make([]byte, 2<<10)...), "image/png", http.StatusRequestEntityTooLarge},
+	}
+	var id string
+	for _, u := range uploads {
+		req := httptest.NewRequest(http.MethodPost, "/v2/images", bytes.NewReader(u.body))
+		req.Header.Set("Content-Type", u.contentType)
+		rec := httptest.NewRecorder()
+		h.UploadImage(rec, req)
+		if rec.Code != u.wantCode {
+			t.Fatalf("%s: status %d, body %q", u.name, rec.Code, rec.Body.String())
+		}
+		if rec.Code != http.StatusCreated {
+			continue
+		}
+		var info imagestore.Info
+		if err := json.Unmarshal(rec.Body.Bytes(), &info); err != nil {
+			t.Fatal(err)
+		}
+		if id != "" && info.ID != id {
+			t.Errorf("%s: id %s, want %s", u.name, info.ID, id)
+		}
+		id = info.ID
+	}
+
+	parse := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.Parse(rec, httptest.NewRequest(http.MethodPost, "/v2/parse", strings.NewReader(body)))
+		return rec
+	}
+	if rec := parse(`{"llm_name":"fake","image_id":"` + id + `"}`); rec.Code != http.StatusOK {
+		t.Fatalf("status %d, body %q", rec.Code, rec.Body.String())
+	}
+	if engine.got.ImageID != "" || !strings.HasPrefix(engine.got.Image, "data:image/png;base64,") {
+		t.Errorf("engine got image=%.40q image_id=%q", engine.got.Image, engine.got.ImageID)
+	}
+	if rec := parse(`{"llm_name":"fake","image_id":"img_unknown"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown id: status %d", rec.Code)
+	}
+}
+
+func TestParse_ResolvedImagesOverLimit(t *testing.T) {
+	var fetched atomic.Int32
+	page := append([]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), make([]byte, 4<<20)...)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetched.Add(1)
+		_, _ = w.Write(page)
+	}))
+	defer srv.Close()
+
+	// Ссылки короткие и проходят лимит до подстановки; четыре страницы по
+	// 4 MB в base64 — больше types.MaxImagesBytes.
+	refs := make([]string, 4)
+	for i := range refs {
+		refs[i] = fmt.Sprintf(`{"image":"%s/p%d.png"}`, srv.URL, i)
+	}
+	body := `{"llm_name":"fake","images":[` + strings.Join(refs, ",") + `]}`
+	fetcher := imagefetch.New(imagefetch.Options{Allow: []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")}})
+	engine := &recordingEngine{Engine: fake.New(fake.Options{})}
+	rec := httptest.NewRecorder()
+	New(&ocr.Engines{Fake: engine}).WithImageFetcher(fetcher).
+		Parse(rec, httptest.NewRequest(http.MethodPost, "/v2/parse", strings.NewReader(body)))
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "images too large") {
+		t.Fatalf("status %d, body %q", rec.Code, rec.Body.String())
+	}
+	if n := fetched.Load(); n != 3 {
+		t.Errorf("fetched %d images, want to stop after the limit is exceeded (3)", n)
+	}
+}
@@ -0,0 +1,41 @@
+package handle
+
+import (
+	"net/http"
+	"unicode/utf8"
+
+	"llm-proxy/api/internal/v2/arith"
+	"llm-proxy/api/internal/v2/ocr/types"
+)
+
+// maxAnswerRunes — ответ ученика длиннее этого не бывает; ограничивает работу
+// разбора на запрос.
+const maxAnswerRunes = 1000
+
+// NormalizeAnswer приводит ответ к каноническому виду без вызова модели:
+// "0,75" → 3/4, "XIV" → 14, "1 м 20 см" → 1200 мм. С compare_to сообщает,
+// равны ли ответы по смыслу.
+func (h *Handle) NormalizeAnswer(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "POST only"})
+		return
+	}
+	var req types.NormalizeAnswerRequest
+	if err := readAndLimitBody(w, r, &req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "bad json: " + err.Error()})
+		return
+	}
+	if utf8.RuneCountInString(req.Answer) > maxAnswerRunes ||
+		(req.CompareTo != nil && utf8.RuneCountInString(*req.CompareTo) > maxAnswerRunes) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "answer is too long"})
+		return
+	}
+
+	out := types.NormalizeAnswerResponse{Answer: arith.Canonicalize(req.Answer)}
+	if req.CompareTo != nil {
+		expected := arith.Canonicalize(*req.CompareTo)
+		equivalent := out.Answer.Equal(expected, req.Ordered)
+		out.CompareTo, out.Equivalent = &expected, &equivalent
+	}
+	writeJSON(w, http.StatusOK, out)
+}
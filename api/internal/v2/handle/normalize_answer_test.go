@@ -0,0 +1,57 @@
+package handle
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"llm-proxy/api/internal/v2/arith"
+	"llm-proxy/api/internal/v2/ocr"
+	"llm-proxy/api/internal/v2/ocr/types"
+)
+
+func TestNormalizeAnswer(t *testing.T) {
+	t.Parallel()
+	h := New(&ocr.Engines{})
+	yes, no := true, false
+	tests := []struct {
+		name       string
+		body       string
+		wantCode   int
+		wantKind   arith.Kind
+		wantCanon  string
+		equivalent *bool
+	}{
+		{name: "fraction", body: `{"answer":"0,75"}`, wantCode: http.StatusOK, wantKind: arith.KindNumber, wantCanon: "3/4"},
+		{name: "roman equals words", body: `{"answer":"XIV","compare_to":"четырнадцать"}`, wantCode: http.StatusOK, wantKind: arith.KindNumber, wantCanon: "14", equivalent: &yes},
+		{name: "ordered list", body: `{"answer":"6, 4, 2","compare_to":"2; 4; 6","ordered":true}`, wantCode: http.StatusOK, wantKind: arith.KindList, wantCanon: "6; 4; 2", equivalent: &no},
+		{name: "unknown field", body: `{"answer":"1","llm_name":"gpt"}`, wantCode: http.StatusBadRequest},
+		{name: "too long", body: `{"answer":"` + strings.Repeat("1", maxAnswerRunes+1) + `"}`, wantCode: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			rec := httptest.NewRecorder()
+			h.NormalizeAnswer(rec, httptest.NewRequest(http.MethodPost, "/v2/normalize_answer", strings.NewReader(tt.body)))
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			var out types.NormalizeAnswerResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+				t.Fatal(err)
+			}
+			if out.Answer.Kind != tt.wantKind || out.Answer.Canonical != tt.wantCanon {
+				t.Errorf("answer = %s %q, want %s %q", out.Answer.Kind, out.Answer.Canonical, tt.wantKind, tt.wantCanon)
+			}
+			if (out.Equivalent == nil) != (tt.equivalent == nil) || (out.Equivalent != nil && *out.Equivalent != *tt.equivalent) {
+				t.Errorf("equivalent = %v, want %v", out.Equivalent, tt.equivalent)
+			}
+		})
+	}
+}
@@ -23,15 +23,24 @@ func (h *Handle) ParseRU(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "bad json", http.StatusBadRequest)
 		return
 	}
+	if _, err := req.AllImages(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	deadline := parseDeadline(r)
 	ctx, cancel := context.WithTimeout(r.Context(), deadline)
 	defer cancel()
 
+	if err := h.resolveImages(ctx, &req.Image, &req.ImageID, req.Images); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	var out types.ParseRUResponse
 	var stats *types.LLMStats
 
-	engine, err := h.engs.GetEngine(req.LLMName)
+	engine, err := h.engineFor(w, r, "parse_ru", req.LLMName, req.TaskId)
 	if err != nil {
 		log.Printf("[parse_ru] engine error: %v", err)
 		http.Error(w, "engine not available", http.StatusBadGateway)
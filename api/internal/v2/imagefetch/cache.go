@@ -0,0 +1,61 @@
+package imagefetch
+
+import (
+	"container/list"
+	"sync"
+)
+
+// cacheEntry — скачанное изображение и ETag, по которому его можно
+// перепроверить условным запросом.
+type cacheEntry struct {
+	url  string
+	etag string
+	data []byte
+	mime string
+}
+
+// cache — LRU скачанных изображений, ограниченный суммарным размером.
+type cache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	bytes    int64
+	order    *list.List // front — самое свежее
+	items    map[string]*list.Element
+}
+
+func newCache(maxBytes int64) *cache {
+	return &cache{maxBytes: maxBytes, order: list.New(), items: map[string]*list.Element{}}
+}
+
+func (c *cache) get(url string) *cacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[url]
+	if !ok {
+		return nil
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*cacheEntry)
+}
+
+func (c *cache) put(e *cacheEntry) {
+	size := int64(len(e.data))
+	if size > c.maxBytes {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[e.url]; ok {
+		c.bytes -= int64(len(el.Value.(*cacheEntry).data))
+		c.order.Remove(el)
+	}
+	c.items[e.url] = c.order.PushFront(e)
+	c.bytes += size
+	for c.bytes > c.maxBytes {
+		last := c.order.Back()
+		old := last.Value.(*cacheEntry)
+		c.order.Remove(last)
+		delete(c.items, old.url)
+		c.bytes -= int64(len(old.data))
+	}
+}
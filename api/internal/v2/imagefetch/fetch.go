@@ -0,0 +1,236 @@
+// Package imagefetch скачивает изображения запросов v2, переданные как
+// http(s) URL. Загрузка ограничена по размеру, времени и числу редиректов;
+// адреса назначения проверяются после резолва DNS, поэтому приватные,
+// loopback и link-local сети недоступны, если явно не разрешены.
+// Скачанные изображения кэшируются по URL и ETag.
+package imagefetch
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"syscall"
+	"time"
+
+	"llm-proxy/api/internal/metrics"
+	"llm-proxy/api/internal/util"
+)
+
+// ErrBlocked — адрес назначения в запрещённой сети.
+var ErrBlocked = errors.New("destination address is not allowed")
+
+// Результаты для метрики.
+const (
+	ResultFetched = "fetched" // скачано целиком
+	ResultHit     = "hit"     // взято из кэша после 304 Not Modified
+	ResultBlocked = "blocked" // адрес в запрещённой сети
+	ResultError   = "error"   // сетевая ошибка, статус, размер, не изображение
+)
+
+var fetches = metrics.NewCounter(
+	"llm_proxy_image_fetch_total",
+	"Image URL fetches by result.",
+	"result",
+)
+
+// Options — ограничения загрузки.
+type Options struct {
+	MaxBytes     int64          // максимальный размер изображения; 0 — 8 MB
+	Timeout      time.Duration  // на всю загрузку; 0 — 10 секунд
+	MaxRedirects int            // 0 — редиректы запрещены
+	Allow        []netip.Prefix // сети, разрешённые несмотря на приватность
+	CacheBytes   int64          // объём кэша; 0 — без кэша
+}
+
+const (
+	defaultMaxBytes = 8 << 20
+	defaultTimeout  = 10 * time.Second
+)
+
+// blockedPrefixes — специальные сети, не покрытые методами netip.Addr:
+// CGNAT, служебные диапазоны IANA, NAT64 (через него виден приватный IPv4).
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// Fetcher скачивает изображения по URL. Безопасен для конкурентного использования.
+type Fetcher struct {
+	opts   Options
+	client *http.Client
+	cache  *cache // nil — кэш выключен
+}
+
+func New(opts Options) *Fetcher {
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = defaultMaxBytes
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+	f := &Fetcher{opts: opts}
+	if opts.CacheBytes > 0 {
+		f.cache = newCache(opts.CacheBytes)
+	}
+	dialer := &net.Dialer{Timeout: opts.Timeout, Control: f.control}
+	f.client = &http.Client{
+		Timeout: opts.Timeout,
+		Transport: &http.Transport{
+			Proxy:                 nil, // прокси скрыл бы реальный адрес назначения от проверки
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   opts.Timeout,
+			ResponseHeaderTimeout: opts.Timeout,
+			MaxIdleConnsPerHost:   2,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > opts.MaxRedirects {
+				return fmt.Errorf("stopped after %d redirects", opts.MaxRedirects)
+			}
+			if !IsURL(req.URL.String()) {
+				return fmt.Errorf("redirect to unsupported scheme %q", req.URL.Scheme)
+			}
+			return nil
+		},
+	}
+	return f
+}
+
+// IsURL сообщает, что поле изображения — http(s) URL, а не base64.
+func IsURL(s string) bool {
+	s = strings.ToLower(strings.TrimSpace(s))
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+// control проверяет адрес уже после резолва DNS: имя, указывающее на
+// внутреннюю сеть (в том числе через DNS rebinding), не пройдёт.
+func (f *Fetcher) control(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if !f.allowed(addr) {
+		return fmt.Errorf("%w: %s", ErrBlocked, addr)
+	}
+	return nil
+}
+
+func (f *Fetcher) allowed(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, p := range f.opts.Allow {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() || addr.IsUnspecified() {
+		return false
+	}
+	for _, p := range blockedPrefixes {
+		if p.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// Fetch скачивает изображение и возвращает его байты и MIME, определённый
+// по содержимому. Заявленный Content-Type учитывается, только если формат
+// по байтам не распознан.
+func (f *Fetcher) Fetch(ctx context.Context, url string) ([]byte, string, error) {
+	if !IsURL(url) {
+		return nil, "", fmt.Errorf("not an http(s) URL")
+	}
+	ctx, cancel := context.WithTimeout(ctx, f.opts.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSpace(url), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Accept", "image/*")
+
+	var cached *cacheEntry
+	if f.cache != nil {
+		if cached = f.cache.get(url); cached != nil {
+			req.Header.Set("If-None-Match", cached.etag)
+		}
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		if errors.Is(err, ErrBlocked) {
+			fetches.Inc(ResultBlocked)
+			return nil, "", ErrBlocked
+		}
+		fetches.Inc(ResultError)
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		fetches.Inc(ResultHit)
+		return cached.data, cached.mime, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		fetches.Inc(ResultError)
+		return nil, "", fmt.Errorf("status %d", resp.StatusCode)
+	}
+	if resp.ContentLength > f.opts.MaxBytes {
+		fetches.Inc(ResultError)
+		return nil, "", fmt.Errorf("image is larger than %d bytes", f.opts.MaxBytes)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, f.opts.MaxBytes+1))
+	if err != nil {
+		fetches.Inc(ResultError)
+		return nil, "", err
+	}
+	if int64(len(data)) > f.opts.MaxBytes {
+		fetches.Inc(ResultError)
+		return nil, "", fmt.Errorf("image is larger than %d bytes", f.opts.MaxBytes)
+	}
+	if len(data) == 0 {
+		fetches.Inc(ResultError)
+		return nil, "", errors.New("empty image")
+	}
+
+	declared, _, _ := strings.Cut(resp.Header.Get("Content-Type"), ";")
+	mime := util.PickMIME("", "", data)
+	if mime == "application/octet-stream" && strings.HasPrefix(strings.TrimSpace(declared), "image/") {
+		// Форматы, которые не распознаются по сигнатуре, — на слово сервера.
+		mime = strings.ToLower(strings.TrimSpace(declared))
+	}
+	if !strings.HasPrefix(mime, "image/") {
+		fetches.Inc(ResultError)
+		return nil, "", fmt.Errorf("not an image: %s", mime)
+	}
+
+	fetches.Inc(ResultFetched)
+	if etag := resp.Header.Get("ETag"); f.cache != nil && etag != "" {
+		f.cache.put(&cacheEntry{url: url, etag: etag, data: data, mime: mime})
+	}
+	return data, mime, nil
+}
+
+// DataURL скачивает изображение и возвращает его как data URL — в таком
+// виде изображение принимают все v2-движки.
+func (f *Fetcher) DataURL(ctx context.Context, url string) (string, error) {
+	data, mime, err := f.Fetch(ctx, url)
+	if err != nil {
+		return "", err
+	}
+	return "data:" + mime + ";base64," + base64.StdEncoding.EncodeToString(data), nil
+}
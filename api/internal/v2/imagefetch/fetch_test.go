@@ -0,0 +1,135 @@
+package imagefetch
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+var loopback = []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8"), netip.MustParsePrefix("::1/128")}
+
+func TestAllowed(t *testing.T) {
+	f := New(Options{Allow: []netip.Prefix{netip.MustParsePrefix("10.1.0.0/16")}})
+	tests := map[string]bool{
+		"8.8.8.8":          true,
+		"2a00:1450::1":     true,
+		"10.1.2.3":         true, // разрешено явно
+		"10.2.0.1":         false,
+		"127.0.0.1":        false,
+		"::1":              false,
+		"::ffff:127.0.0.1": false,
+		"169.254.169.254":  false,
+		"fe80::1":          false,
+		"100.64.0.1":       false,
+		"0.0.0.0":          false,
+		"fd00::1":          false,
+		"64:ff9b::a00:1":   false,
+	}
+	for addr, want := range tests {
+		if got := f.allowed(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("allowed(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
+
+func TestFetch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/photo":
+			w.Header().Set("Content-Type", "text/plain") // неверный заголовок: формат определяется по байтам
+			_, _ = w.Write(pngHeader)
+		case "/page":
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = w.Write([]byte("<html><body>not an image</body></html>"))
+		case "/big":
+			_, _ = w.Write(append(pngHeader, make([]byte, 100)...))
+		case "/empty":
+			w.WriteHeader(http.StatusOK)
+		case "/missing":
+			http.NotFound(w, r)
+		default: // /redirect/N — цепочка из N редиректов до /photo
+			n, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/redirect/"))
+			if n <= 0 {
+				http.Redirect(w, r, "/photo", http.StatusFound)
+				return
+			}
+			http.Redirect(w, r, "/redirect/"+strconv.Itoa(n-1), http.StatusFound)
+		}
+	}))
+	defer srv.Close()
+
+	f := New(Options{Allow: loopback, MaxBytes: 64, MaxRedirects: 2})
+	tests := []struct {
+		path    string
+		wantErr string
+	}{
+		{"/photo", ""},
+		{"/page", "not an image"},
+		{"/big", "larger than 64 bytes"},
+		{"/empty", "empty image"},
+		{"/missing", "status 404"},
+		{"/redirect/1", ""},
+		{"/redirect/2", "stopped after 2 redirects"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			data, mime, err := f.Fetch(context.Background(), srv.URL+tt.path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if mime != "image/png" || len(data) != len(pngHeader) {
+				t.Errorf("mime = %s, %d bytes", mime, len(data))
+			}
+		})
+	}
+
+	if _, _, err := New(Options{}).Fetch(context.Background(), srv.URL+"/photo"); !errors.Is(err, ErrBlocked) {
+		t.Errorf("loopback without allowlist: err = %v", err)
+	}
+	if _, _, err := f.Fetch(context.Background(), "file:///etc/passwd"); err == nil {
+		t.Error("want error for non-http scheme")
+	}
+}
+
+func TestFetch_ETagCache(t *testing.T) {
+	var full, conditional atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			conditional.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		full.Add(1)
+		_, _ = w.Write(pngHeader)
+	}))
+	defer srv.Close()
+
+	f := New(Options{Allow: loopback, CacheBytes: 1 << 20})
+	for i := 0; i < 3; i++ {
+		url, err := f.DataURL(context.Background(), srv.URL+"/img")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(url, "data:image/png;base64,") {
+			t.Fatalf("data URL = %q", url)
+		}
+	}
+	if full.Load() != 1 || conditional.Load() != 2 {
+		t.Errorf("full = %d, conditional = %d; want 1 and 2", full.Load(), conditional.Load())
+	}
+}
@@ -0,0 +1,262 @@
+// Package imagestore — локальное хранилище загруженных изображений
+// (POST /v2/images). Изображение загружается один раз и дальше передаётся
+// шагам v2 по image_id. Хранилище адресуется содержимым: ID — SHA-256
+// байтов, повторная загрузка того же фото не занимает места. Запись живёт
+// TTL с момента последнего обращения; суммарный объём ограничен квотой.
+package imagestore
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"llm-proxy/api/internal/metrics"
+	"llm-proxy/api/internal/util"
+)
+
+var (
+	ErrNotFound = errors.New("image not found or expired")
+	ErrTooLarge = errors.New("image is too large")
+	ErrNotImage = errors.New("not an image")
+	ErrQuota    = errors.New("image store quota exceeded")
+)
+
+// Результаты загрузки для метрики.
+const (
+	ResultStored    = "stored"    // новое изображение
+	ResultDuplicate = "duplicate" // такое уже есть, продлён TTL
+	ResultRejected  = "rejected"  // размер, формат, квота
+)
+
+var uploads = metrics.NewCounter(
+	"llm_proxy_image_store_uploads_total",
+	"Image store uploads by result.",
+	"result",
+)
+
+const idPrefix = "img_"
+
+var reID = regexp.MustCompile(`^img_[0-9a-f]{64}$`)
+
+// IsID сообщает, что строка похожа на image_id хранилища.
+func IsID(s string) bool { return reID.MatchString(s) }
+
+// Options — параметры хранилища.
+type Options struct {
+	Dir           string
+	TTL           time.Duration // 0 — 1 час
+	MaxImageBytes int64         // 0 — 20 MB
+	QuotaBytes    int64         // суммарный объём; 0 — без квоты
+}
+
+const (
+	defaultTTL           = time.Hour
+	defaultMaxImageBytes = 20 << 20
+	minCleanupInterval   = time.Minute
+)
+
+// Info — ответ POST /v2/images.
+type Info struct {
+	ID        string    `json:"image_id"`
+	Size      int64     `json:"size"`
+	MIME      string    `json:"mime"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Store хранит изображения в Dir: по файлу на ID в подкаталоге по первым
+// символам хеша. Время последнего обращения — mtime файла.
+type Store struct {
+	opts Options
+	now  func() time.Time
+
+	mu   sync.Mutex
+	used int64 // суммарный размер файлов
+}
+
+// New открывает хранилище, удаляет истёкшие записи и запускает их
+// периодическую очистку.
+func New(opts Options) (*Store, error) {
+	if opts.Dir == "" {
+		return nil, errors.New("imagestore: dir is required")
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = defaultTTL
+	}
+	if opts.MaxImageBytes <= 0 {
+		opts.MaxImageBytes = defaultMaxImageBytes
+	}
+	if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("imagestore: %w", err)
+	}
+	s := &Store{opts: opts, now: time.Now}
+	s.Cleanup()
+	go s.janitor(max(opts.TTL/4, minCleanupInterval))
+	return s, nil
+}
+
+// MaxImageBytes — лимит одного изображения; хендлер ограничивает им тело запроса.
+func (s *Store) MaxImageBytes() int64 { return s.opts.MaxImageBytes }
+
+func (s *Store) path(id string) string {
+	hash := strings.TrimPrefix(id, idPrefix)
+	return filepath.Join(s.opts.Dir, hash[:2], id)
+}
+
+// Put сохраняет изображение и возвращает его ID. Формат определяется по байтам.
+func (s *Store) Put(data []byte) (Info, error) {
+	info, err := s.put(data)
+	switch {
+	case err != nil:
+		uploads.Inc(ResultRejected)
+	case info.duplicate:
+		uploads.Inc(ResultDuplicate)
+	default:
+		uploads.Inc(ResultStored)
+	}
+	return info.Info, err
+}
+
+type putResult struct {
+	Info
+	duplicate bool
+}
+
+func (s *Store) put(data []byte) (putResult, error) {
+	size := int64(len(data))
+	if size == 0 {
+		return putResult{}, ErrNotImage
+	}
+	if size > s.opts.MaxImageBytes {
+		return putResult{}, fmt.Errorf("%w: %d > %d bytes", ErrTooLarge, size, s.opts.MaxImageBytes)
+	}
+	mime := util.PickMIME("", "", data)
+	if !strings.HasPrefix(mime, "image/") {
+		return putResult{}, fmt.Errorf("%w: %s", ErrNotImage, mime)
+	}
+	id := idPrefix + util.SHA256Hex(data)
+	p := s.path(id)
+	now := s.now()
+	res := putResult{Info: Info{ID: id, Size: size, MIME: mime, ExpiresAt: now.Add(s.opts.TTL)}}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := os.Stat(p); err == nil {
+		res.duplicate = true
+		return res, os.Chtimes(p, now, now)
+	}
+	if s.opts.QuotaBytes > 0 && s.used+size > s.opts.QuotaBytes {
+		s.cleanupLocked()
+		if s.used+size > s.opts.QuotaBytes {
+			return putResult{}, ErrQuota
+		}
+	}
+	if err := writeAtomic(p, data); err != nil {
+		return putResult{}, fmt.Errorf("imagestore: %w", err)
+	}
+	_ = os.Chtimes(p, now, now)
+	s.used += size
+	return res, nil
+}
+
+// Get возвращает изображение и его MIME и продлевает TTL.
+func (s *Store) Get(id string) ([]byte, string, error) {
+	if !IsID(id) {
+		return nil, "", ErrNotFound
+	}
+	p := s.path(id)
+	st, err := os.Stat(p)
+	if err != nil {
+		return nil, "", ErrNotFound
+	}
+	now := s.now()
+	if now.Sub(st.ModTime()) > s.opts.TTL {
+		s.remove(p, st.Size())
+		return nil, "", ErrNotFound
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, "", ErrNotFound
+	}
+	_ = os.Chtimes(p, now, now)
+	return data, util.PickMIME("", "", data), nil
+}
+
+func (s *Store) remove(p string, size int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if os.Remove(p) == nil {
+		s.used -= size
+	}
+}
+
+// Cleanup удаляет истёкшие изображения и пересчитывает занятый объём.
+// Возвращает число удалённых файлов.
+func (s *Store) Cleanup() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cleanupLocked()
+}
+
+func (s *Store) cleanupLocked() int {
+	now := s.now()
+	var used int64
+	removed := 0
+	_ = filepath.WalkDir(s.opts.Dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		// Недописанные временные файлы остаются от падения между записью и rename.
+		if strings.HasPrefix(d.Name(), ".tmp-") || now.Sub(info.ModTime()) > s.opts.TTL {
+			if os.Remove(p) == nil {
+				removed++
+			}
+			return nil
+		}
+		used += info.Size()
+		return nil
+	})
+	s.used = used
+	return removed
+}
+
+func (s *Store) janitor(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for range t.C {
+		if n := s.Cleanup(); n > 0 {
+			log.Printf("[imagestore] removed %d expired images", n)
+		}
+	}
+}
+
+// writeAtomic пишет файл через временный файл и rename.
+func writeAtomic(p string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
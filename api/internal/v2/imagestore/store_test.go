@@ -0,0 +1,106 @@
+package imagestore
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+var png = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func jpeg(n int) []byte { return append([]byte{0xFF, 0xD8, 0xFF, 0xE0}, make([]byte, n)...) }
+
+func newStore(t *testing.T, opts Options) *Store {
+	t.Helper()
+	opts.Dir = t.TempDir()
+	s, err := New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestPutGet(t *testing.T) {
+	s := newStore(t, Options{})
+	info, err := s.Put(png)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsID(info.ID) || info.MIME != "image/png" || info.Size != int64(len(png)) {
+		t.Fatalf("info = %+v", info)
+	}
+	again, err := s.Put(png)
+	if err != nil || again.ID != info.ID {
+		t.Fatalf("same bytes must give the same id: %+v, %v", again, err)
+	}
+	data, mime, err := s.Get(info.ID)
+	if err != nil || !bytes.Equal(data, png) || mime != "image/png" {
+		t.Fatalf("Get = %d bytes, %s, %v", len(data), mime, err)
+	}
+
+	for _, id := range []string{"img_../../etc/passwd", "img_" + string(make([]byte, 64)), "nope"} {
+		if _, _, err := s.Get(id); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get(%q) err = %v", id, err)
+		}
+	}
+}
+
+func TestPut_Rejects(t *testing.T) {
+	s := newStore(t, Options{MaxImageBytes: 32})
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"empty", nil, ErrNotImage},
+		{"text", []byte("hello, world"), ErrNotImage},
+		{"too large", jpeg(64), ErrTooLarge},
+	}
+	for _, tt := range tests {
+		if _, err := s.Put(tt.data); !errors.Is(err, tt.want) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestTTLAndQuota(t *testing.T) {
+	now := time.Now()
+	s := newStore(t, Options{TTL: time.Hour, QuotaBytes: 100})
+	s.now = func() time.Time { return now }
+
+	old, err := s.Put(jpeg(60))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Квота занята первым изображением, пока оно не истекло.
+	if _, err := s.Put(jpeg(61)); !errors.Is(err, ErrQuota) {
+		t.Fatalf("err = %v, want quota", err)
+	}
+
+	// Обращение продлевает TTL.
+	now = now.Add(50 * time.Minute)
+	if _, _, err := s.Get(old.ID); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(50 * time.Minute)
+	if _, _, err := s.Get(old.ID); err != nil {
+		t.Fatalf("TTL must slide on access: %v", err)
+	}
+
+	// После истечения место освобождается при следующей загрузке.
+	now = now.Add(2 * time.Hour)
+	if _, err := s.Put(jpeg(61)); err != nil {
+		t.Fatalf("quota after expiry: %v", err)
+	}
+	if _, _, err := s.Get(old.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expired image: err = %v", err)
+	}
+	if _, err := os.Stat(s.path(old.ID)); !os.IsNotExist(err) {
+		t.Errorf("expired file not removed: %v", err)
+	}
+	if s.Cleanup() != 0 || s.used != int64(len(jpeg(61))) {
+		t.Errorf("used = %d", s.used)
+	}
+}
@@ -0,0 +1,338 @@
+// Package cassette записывает и воспроизводит HTTP-трафик v2-движков к провайдерам LLM.
+//
+// Работает на уровне http.RoundTripper, поэтому подходит для любого движка,
+// который позволяет подменить *http.Client (gpt, gemini, openrouter):
+//   - record: запрос уходит к провайдеру, пара запрос/ответ сохраняется в JSONL;
+//   - replay: ответ берётся из кассеты, сеть не используется.
+//
+// Перед сохранением запрос санитизируется: заголовки не пишутся вовсе (ключи
+// остаются только в памяти), параметр ?key= удаляется из URL, а base64-картинки
+// в теле заменяются на "sha256:<hex>". Ключ воспроизведения считается по уже
+// санитизированному запросу, поэтому один и тот же промпт с той же картинкой
+// всегда находит одну и ту же запись.
+package cassette
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"llm-proxy/api/internal/util"
+)
+
+// Mode — режим работы кассеты.
+type Mode string
+
+const (
+	ModeOff    Mode = ""
+	ModeRecord Mode = "record"
+	ModeReplay Mode = "replay"
+)
+
+// ParseMode разбирает значение LLM_CASSETTE_MODE.
+func ParseMode(s string) (Mode, error) {
+	switch Mode(strings.ToLower(strings.TrimSpace(s))) {
+	case ModeOff, "off":
+		return ModeOff, nil
+	case ModeRecord:
+		return ModeRecord, nil
+	case ModeReplay:
+		return ModeReplay, nil
+	default:
+		return ModeOff, fmt.Errorf("unknown cassette mode %q; use 'record' or 'replay'", s)
+	}
+}
+
+// minInlineImageLen — строки короче не проверяются на base64-картинку:
+// так промпты и короткие значения не превращаются в хэши случайно.
+const minInlineImageLen = 256
+
+// maxResponseBody — верхний лимит записываемого тела ответа.
+const maxResponseBody = 8 << 20
+
+// ErrNotRecorded возвращается в режиме replay, если для запроса нет записи.
+var ErrNotRecorded = errors.New("interaction not recorded")
+
+// Interaction — одна записанная пара запрос/ответ.
+type Interaction struct {
+	Key         string          `json:"key"`
+	Method      string          `json:"method"`
+	URL         string          `json:"url"`
+	RequestBody json.RawMessage `json:"request_body,omitempty"`
+	Status      int             `json:"status"`
+	ContentType string          `json:"content_type,omitempty"`
+	RetryAfter  string          `json:"retry_after,omitempty"`
+	Body        string          `json:"response_body"`
+}
+
+// Transport — http.RoundTripper, который пишет или воспроизводит кассету.
+type Transport struct {
+	mode Mode
+	path string
+	base http.RoundTripper
+
+	mu       sync.Mutex
+	recorded map[string][]Interaction // replay: key → записи в порядке записи
+	served   map[string]int           // replay: сколько раз выдан ключ
+}
+
+// New создаёт транспорт для кассеты dir/name.jsonl.
+// base используется только в режиме record; nil означает http.DefaultTransport.
+func New(mode Mode, dir, name string, base http.RoundTripper) (*Transport, error) {
+	if mode != ModeRecord && mode != ModeReplay {
+		return nil, fmt.Errorf("cassette %s: mode must be record or replay", name)
+	}
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	t := &Transport{
+		mode:     mode,
+		path:     filepath.Join(dir, name+".jsonl"),
+		base:     base,
+		recorded: map[string][]Interaction{},
+		served:   map[string]int{},
+	}
+	switch mode {
+	case ModeRecord:
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("cassette %s: create dir: %w", name, err)
+		}
+	case ModeReplay:
+		if err := t.load(); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// NewClient возвращает *http.Client без общего таймаута (как у движков),
+// использующий кассету dir/name.jsonl.
+func NewClient(mode Mode, dir, name string) (*http.Client, error) {
+	t, err := New(mode, dir, name, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Timeout: 0, Transport: t}, nil
+}
+
+// Path возвращает путь к файлу кассеты.
+func (t *Transport) Path() string { return t.path }
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		b, err := io.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("cassette: read request body: %w", err)
+		}
+		body = b
+	}
+	sanitizedURL := SanitizeURL(req.URL)
+	sanitizedBody := SanitizeBody(body)
+	key := Key(req.Method, sanitizedURL, sanitizedBody)
+
+	if t.mode == ModeReplay {
+		return t.replay(req, key)
+	}
+
+	out := req.Clone(req.Context())
+	out.Body = io.NopCloser(bytes.NewReader(body))
+	out.ContentLength = int64(len(body))
+	resp, err := t.base.RoundTrip(out)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("cassette: read response body: %w", err)
+	}
+	interaction := Interaction{
+		Key:         key,
+		Method:      req.Method,
+		URL:         sanitizedURL,
+		RequestBody: sanitizedBody,
+		Status:      resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+		RetryAfter:  resp.Header.Get("Retry-After"),
+		Body:        string(respBody),
+	}
+	if err := t.append(interaction); err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+	resp.ContentLength = int64(len(respBody))
+	return resp, nil
+}
+
+func (t *Transport) replay(req *http.Request, key string) (*http.Response, error) {
+	t.mu.Lock()
+	records := t.recorded[key]
+	if len(records) == 0 {
+		t.mu.Unlock()
+		return nil, fmt.Errorf("cassette %s: %w: %s %s (key=%s)",
+			filepath.Base(t.path), ErrNotRecorded, req.Method, SanitizeURL(req.URL), key)
+	}
+	// Повторы одного запроса (retry после 5xx) выдаются в порядке записи,
+	// после исчерпания повторяется последняя запись.
+	idx := min(t.served[key], len(records)-1)
+	t.served[key]++
+	rec := records[idx]
+	t.mu.Unlock()
+
+	header := http.Header{}
+	if rec.ContentType != "" {
+		header.Set("Content-Type", rec.ContentType)
+	}
+	if rec.RetryAfter != "" {
+		header.Set("Retry-After", rec.RetryAfter)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", rec.Status, http.StatusText(rec.Status)),
+		StatusCode:    rec.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(rec.Body)),
+		ContentLength: int64(len(rec.Body)),
+		Request:       req,
+	}, nil
+}
+
+func (t *Transport) append(rec Interaction) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("cassette: marshal interaction: %w", err)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	f, err := os.OpenFile(t.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("cassette: open %s: %w", t.path, err)
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("cassette: write %s: %w", t.path, err)
+	}
+	return f.Close()
+}
+
+func (t *Transport) load() error {
+	f, err := os.Open(t.path)
+	if err != nil {
+		return fmt.Errorf("cassette: open %s: %w", t.path, err)
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64<<10), maxResponseBody*2)
+	for line := 1; sc.Scan(); line++ {
+		raw := bytes.TrimSpace(sc.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+		var rec Interaction
+		if err := json.Unmarshal(raw, &rec); err != nil {
+			return fmt.Errorf("cassette: %s:%d: %w", t.path, line, err)
+		}
+		t.recorded[rec.Key] = append(t.recorded[rec.Key], rec)
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("cassette: read %s: %w", t.path, err)
+	}
+	return nil
+}
+
+// Key — стабильный ключ записи по санитизированному запросу.
+func Key(method, sanitizedURL string, sanitizedBody []byte) string {
+	return util.SHA256Hex([]byte(method + " " + sanitizedURL + "\n" + string(sanitizedBody)))[:16]
+}
+
+// SanitizeURL убирает из URL ключи доступа.
+func SanitizeURL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	c := *u
+	c.User = nil
+	q := c.Query()
+	for _, k := range []string{"key", "api_key", "access_token"} {
+		q.Del(k)
+	}
+	c.RawQuery = q.Encode()
+	return c.String()
+}
+
+// SanitizeBody канонизирует JSON-тело запроса и заменяет встроенные картинки
+// на sha256 от их байтов. Не-JSON тела сохраняются как JSON-строка с хэшем.
+func SanitizeBody(body []byte) json.RawMessage {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil
+	}
+	var doc any
+	if err := json.Unmarshal(body, &doc); err != nil {
+		b, _ := json.Marshal("sha256:" + util.SHA256Hex(body))
+		return b
+	}
+	doc = sanitizeValue(doc)
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+func sanitizeValue(v any) any {
+	switch n := v.(type) {
+	case map[string]any:
+		for k, val := range n {
+			n[k] = sanitizeValue(val)
+		}
+		return n
+	case []any:
+		for i, val := range n {
+			n[i] = sanitizeValue(val)
+		}
+		return n
+	case string:
+		if hashed, ok := hashInlineImage(n); ok {
+			return hashed
+		}
+		return n
+	default:
+		return v
+	}
+}
+
+// hashInlineImage распознаёт data:URL и «голый» base64 картинки.
+func hashInlineImage(s string) (string, bool) {
+	if len(s) < minInlineImageLen {
+		return "", false
+	}
+	if strings.HasPrefix(s, "data:") && strings.Contains(s[:min(len(s), 64)], ";base64,") {
+		data, _, err := util.DecodeBase64MaybeDataURL(s)
+		if err != nil {
+			return "", false
+		}
+		return "sha256:" + util.SHA256Hex(data), true
+	}
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return "", false
+	}
+	if mime := util.PickMIME("", "", data); !strings.HasPrefix(mime, "image/") {
+		return "", false
+	}
+	return "sha256:" + util.SHA256Hex(data), true
+}
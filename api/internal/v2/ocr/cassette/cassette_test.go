@@ -0,0 +1,175 @@
+package cassette
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"llm-proxy/api/internal/util"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+// fakePNG — PNG-сигнатура с хвостом, достаточным для порога minInlineImageLen.
+func fakePNG() []byte {
+	return append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0x42}, 512)...)
+}
+
+func requestBody(img []byte) string {
+	return `{"model":"m","messages":[{"role":"user","content":[{"type":"text","text":"detect"},` +
+		`{"type":"image_url","image_url":{"url":"data:image/png;base64,` + base64.StdEncoding.EncodeToString(img) + `"}}]}]}`
+}
+
+func newRequest(t *testing.T, url, body string) *http.Request {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer sk-secret")
+	return req
+}
+
+func TestParseMode(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Mode
+		wantErr bool
+	}{
+		{in: "", want: ModeOff},
+		{in: "off", want: ModeOff},
+		{in: " Record ", want: ModeRecord},
+		{in: "replay", want: ModeReplay},
+		{in: "rewind", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseMode(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("ParseMode(%q) err = %v, wantErr %v", tt.in, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("ParseMode(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRecordThenReplay(t *testing.T) {
+	dir := t.TempDir()
+	img := fakePNG()
+	const url = "https://provider.example/v1/chat?key=AIza-secret&alt=json"
+	const answer = `{"choices":[{"message":{"content":"{\"ok\":true}"}}]}`
+
+	upstreamCalls := 0
+	upstream := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		upstreamCalls++
+		if got := r.Header.Get("Authorization"); got != "Bearer sk-secret" {
+			t.Errorf("upstream Authorization = %q", got)
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       io.NopCloser(strings.NewReader(answer)),
+		}, nil
+	})
+
+	rec, err := New(ModeRecord, dir, "openrouter", upstream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := rec.RoundTrip(newRequest(t, url, requestBody(img)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := io.ReadAll(resp.Body)
+	if string(got) != answer {
+		t.Fatalf("record response = %s", got)
+	}
+
+	file, err := os.ReadFile(rec.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, leaked := range []string{"sk-secret", "AIza-secret", base64.StdEncoding.EncodeToString(img)[:64]} {
+		if strings.Contains(string(file), leaked) {
+			t.Errorf("cassette leaks %q", leaked)
+		}
+	}
+	if !strings.Contains(string(file), "sha256:"+util.SHA256Hex(img)) {
+		t.Errorf("cassette does not contain image hash: %s", file)
+	}
+
+	failing := roundTripFunc(func(*http.Request) (*http.Response, error) {
+		t.Fatal("replay must not touch the network")
+		return nil, nil
+	})
+	play, err := New(ModeReplay, dir, "openrouter", failing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = play.RoundTrip(newRequest(t, url, requestBody(img)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ = io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(got) != answer {
+		t.Fatalf("replay = %d %s", resp.StatusCode, got)
+	}
+	if upstreamCalls != 1 {
+		t.Errorf("upstream calls = %d, want 1", upstreamCalls)
+	}
+
+	other := append(fakePNG(), 0x01)
+	_, err = play.RoundTrip(newRequest(t, url, requestBody(other)))
+	if !errors.Is(err, ErrNotRecorded) {
+		t.Fatalf("replay of unknown request err = %v, want ErrNotRecorded", err)
+	}
+}
+
+func TestReplayServesRetriesInOrder(t *testing.T) {
+	dir := t.TempDir()
+	statuses := []int{http.StatusServiceUnavailable, http.StatusOK}
+	calls := 0
+	upstream := roundTripFunc(func(*http.Request) (*http.Response, error) {
+		st := statuses[calls]
+		calls++
+		return &http.Response{StatusCode: st, Header: http.Header{}, Body: io.NopCloser(strings.NewReader("{}"))}, nil
+	})
+	rec, err := New(ModeRecord, dir, "gpt", upstream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range statuses {
+		if _, err := rec.RoundTrip(newRequest(t, "https://api.example/v1/responses", `{"a":1}`)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	play, err := New(ModeReplay, dir, "gpt", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []int{http.StatusServiceUnavailable, http.StatusOK, http.StatusOK} {
+		resp, err := play.RoundTrip(newRequest(t, "https://api.example/v1/responses", `{"a":1}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != want {
+			t.Errorf("status = %d, want %d", resp.StatusCode, want)
+		}
+	}
+}
+
+func TestSanitizeBody_KeyIsStableAcrossKeyOrder(t *testing.T) {
+	a := SanitizeBody([]byte(`{"b":2,"a":"x"}`))
+	b := SanitizeBody([]byte(`{"a":"x","b":2}`))
+	if Key("POST", "u", a) != Key("POST", "u", b) {
+		t.Errorf("keys differ: %s vs %s", a, b)
+	}
+}
@@ -26,6 +26,7 @@ type Engines struct {
 	Gemini         Engine             // Gemini    — detect, parse
 	Mixed          Engine             // detect+parse→Gemini, hint+check→OpenAI
 	OpenRouter     Engine             // все шаги через OpenRouter; модели из env
+	Fake           Engine             // детерминированные ответы для тестов; nil если выключен
 	TemplateRouter *tmplrouter.Router // педагогические шаблоны T1–T52
 }
 
@@ -34,6 +35,7 @@ type Engines struct {
 //   - "gemini"           → Gemini (все шаги через Gemini)
 //   - "mixed"            → detect+parse→Gemini, hint+check→OpenAI
 //   - "openrouter"       → все шаги через OpenRouter; модели из OPENROUTER_*_MODEL
+//   - "fake"             → сценарные ответы без LLM; только при LLM_FAKE_ENGINE
 func (e *Engines) GetEngine(llmName string) (Engine, error) {
 	switch llmName {
 	case "gpt", "openai":
@@ -56,7 +58,12 @@ func (e *Engines) GetEngine(llmName string) (Engine, error) {
 			return nil, errors.New("OpenRouter engine not initialized (set OPENROUTER_API_KEY)")
 		}
 		return e.OpenRouter, nil
+	case "fake":
+		if e.Fake == nil {
+			return nil, errors.New("Fake engine not enabled (set LLM_FAKE_ENGINE)")
+		}
+		return e.Fake, nil
 	default:
-		return nil, errors.New("unknown llm_name; use 'gpt', 'gemini', 'mixed' or 'openrouter'")
+		return nil, errors.New("unknown llm_name; use 'gpt', 'gemini', 'mixed', 'openrouter' or 'fake'")
 	}
 }
@@ -0,0 +1,190 @@
+// Package ensemble реализует режим самосогласованности для CheckSolution:
+// один и тот же запрос проверки отправляется N раз (в одну или несколько
+// моделей) параллельно, а итоговое решение выбирается большинством голосов.
+//
+// Если голоса расходятся, уверенность итогового ответа снижается
+// пропорционально доле согласных голосов; при доле ниже порога ответ
+// заменяется на cannot_evaluate. Разбивка голосов пишется в debug.votes,
+// токены и стоимость всех вызовов суммируются в статистике.
+package ensemble
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"llm-proxy/api/internal/v2/ocr"
+	"llm-proxy/api/internal/v2/ocr/types"
+)
+
+// FailureReasonDisagreement — failure_reason ответа, когда голоса разошлись.
+const FailureReasonDisagreement = "ensemble_disagreement"
+
+// Options — настройки ансамбля.
+type Options struct {
+	Samples      int     // число параллельных вызовов на запрос (>= 2)
+	MinAgreement float64 // минимальная доля голосов за победителя; ниже — cannot_evaluate
+}
+
+// Engine — декоратор движка. Все шаги, кроме CheckSolution, делегируются
+// основному движку через встраивание.
+type Engine struct {
+	ocr.Engine
+	members []ocr.Engine
+	opts    Options
+}
+
+// New создаёт ансамбль поверх primary. Вызовы распределяются по members
+// по кругу; без members все выборки делает сам primary.
+func New(primary ocr.Engine, members []ocr.Engine, opts Options) *Engine {
+	if opts.Samples < 2 {
+		opts.Samples = 3
+	}
+	if opts.MinAgreement <= 0 || opts.MinAgreement > 1 {
+		opts.MinAgreement = 0.6
+	}
+	if len(members) == 0 {
+		members = []ocr.Engine{primary}
+	}
+	return &Engine{Engine: primary, members: members, opts: opts}
+}
+
+type sample struct {
+	out   types.CheckResponse
+	stats *types.LLMStats
+	err   error
+	model string
+}
+
+func (e *Engine) CheckSolution(ctx context.Context, in types.CheckRequest) (types.CheckResponse, *types.LLMStats, error) {
+	start := time.Now()
+	samples := make([]sample, e.opts.Samples)
+	var wg sync.WaitGroup
+	for i := range samples {
+		member := e.members[i%len(e.members)]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Движки нормализуют вход на месте — каждой выборке своя копия.
+			out, stats, err := member.CheckSolution(ctx, cloneRequest(in))
+			model := member.Name()
+			if stats != nil && stats.Model != "" {
+				model = stats.Model
+			}
+			samples[i] = sample{out: out, stats: stats, err: err, model: model}
+		}()
+	}
+	wg.Wait()
+
+	out, stats, err := aggregate(samples, e.opts.MinAgreement)
+	if stats != nil {
+		// Выборки идут параллельно: латентность — время ожидания всех, а не сумма.
+		stats.LatencyMs = time.Since(start).Milliseconds()
+	}
+	return out, stats, err
+}
+
+// aggregate выбирает решение большинством голосов среди успешных выборок.
+func aggregate(samples []sample, minAgreement float64) (types.CheckResponse, *types.LLMStats, error) {
+	stats := &types.LLMStats{}
+	var models []string
+	votes := make([]types.CheckVote, 0, len(samples))
+	counts := map[types.CheckDecision]int{}
+	var order []types.CheckDecision
+	var errs []error
+	ok := 0
+	for _, s := range samples {
+		stats.Add(s.stats)
+		models = appendUnique(models, s.model)
+		vote := types.CheckVote{Model: s.model}
+		if s.err != nil {
+			vote.Error = s.err.Error()
+			errs = append(errs, s.err)
+			votes = append(votes, vote)
+			continue
+		}
+		vote.Decision = s.out.Decision
+		vote.Confidence = s.out.Confidence
+		votes = append(votes, vote)
+		if counts[s.out.Decision] == 0 {
+			order = append(order, s.out.Decision)
+		}
+		counts[s.out.Decision]++
+		ok++
+	}
+	stats.Model = "ensemble:" + strings.Join(models, "+")
+	if ok == 0 {
+		return types.CheckResponse{}, stats, fmt.Errorf("ensemble: all %d samples failed: %w", len(samples), errors.Join(errs...))
+	}
+
+	winner, top, tie := order[0], 0, false
+	for _, d := range order {
+		switch n := counts[d]; {
+		case n > top:
+			winner, top, tie = d, n, false
+		case n == top:
+			tie = true
+		}
+	}
+	// Доля считается от успешных выборок: упавший вызов не голос «против».
+	agreement := float64(top) / float64(ok)
+
+	if tie || agreement < minAgreement {
+		log.Printf("[ensemble] check disagreement: %s", formatCounts(order, counts))
+		out := types.ConservativeCheckResponse()
+		reason := FailureReasonDisagreement
+		out.FailureReason = &reason
+		out.Feedback = "Не удалось уверенно проверить решение. Попробуй сфотографировать его ещё раз."
+		out.Debug = &types.CheckDebug{Votes: votes, VoteAgreement: &agreement}
+		return out, stats, nil
+	}
+
+	var out types.CheckResponse
+	for _, s := range samples {
+		if s.err == nil && s.out.Decision == winner {
+			out = s.out
+			break
+		}
+	}
+	if out.Confidence != nil {
+		c := *out.Confidence * agreement
+		out.Confidence = &c
+	}
+	if out.Debug == nil {
+		out.Debug = &types.CheckDebug{}
+	} else {
+		d := *out.Debug
+		out.Debug = &d
+	}
+	out.Debug.Votes = votes
+	out.Debug.VoteAgreement = &agreement
+	return out, stats, nil
+}
+
+func cloneRequest(in types.CheckRequest) types.CheckRequest {
+	out := in
+	out.TaskStruct.Items = append([]types.ParseItem(nil), in.TaskStruct.Items...)
+	out.TaskStruct.VisualFacts = append([]types.VisualFact(nil), in.TaskStruct.VisualFacts...)
+	return out
+}
+
+func appendUnique(list []string, s string) []string {
+	for _, v := range list {
+		if v == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
+
+func formatCounts(order []types.CheckDecision, counts map[types.CheckDecision]int) string {
+	parts := make([]string, 0, len(order))
+	for _, d := range order {
+		parts = append(parts, fmt.Sprintf("%s=%d", d, counts[d]))
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,100 @@
+package ensemble
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"llm-proxy/api/internal/v2/ocr"
+	"llm-proxy/api/internal/v2/ocr/fake"
+	"llm-proxy/api/internal/v2/ocr/types"
+)
+
+// voter — фейковый движок с фиксированным решением проверки.
+type voter struct {
+	*fake.Engine
+	name string
+	sc   fake.Scenario
+	cost float64
+}
+
+func (v voter) Name() string { return v.name }
+
+func (v voter) CheckSolution(ctx context.Context, in types.CheckRequest) (types.CheckResponse, *types.LLMStats, error) {
+	out, stats, err := v.Engine.CheckSolution(fake.WithScenario(ctx, v.sc), in)
+	if stats != nil {
+		stats.Model = v.name
+		stats.CostUSD = v.cost
+	}
+	return out, stats, err
+}
+
+func newVoter(name string, sc fake.Scenario) voter {
+	return voter{Engine: fake.New(fake.Options{}), name: name, sc: sc, cost: 0.01}
+}
+
+func TestEnsemble_Majority(t *testing.T) {
+	e := New(newVoter("primary", fake.ScenarioOK), []ocr.Engine{
+		newVoter("a", fake.ScenarioOK),
+		newVoter("b", fake.ScenarioOK),
+		newVoter("c", fake.ScenarioIncorrect),
+	}, Options{Samples: 3, MinAgreement: 0.6})
+
+	out, stats, err := e.CheckSolution(context.Background(), types.CheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Decision != types.CheckDecisionCorrect {
+		t.Fatalf("decision = %s, want correct", out.Decision)
+	}
+	if out.Debug == nil || len(out.Debug.Votes) != 3 || out.Debug.VoteAgreement == nil {
+		t.Fatalf("debug = %+v", out.Debug)
+	}
+	if got := *out.Debug.VoteAgreement; got < 0.66 || got > 0.67 {
+		t.Errorf("agreement = %v, want 2/3", got)
+	}
+	if out.Confidence == nil || *out.Confidence >= 1 {
+		t.Errorf("confidence must be lowered by disagreement: %v", out.Confidence)
+	}
+	if stats == nil || stats.CostUSD < 0.0299 || stats.Model != "ensemble:a+b+c" {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func TestEnsemble_DisagreementCannotEvaluate(t *testing.T) {
+	e := New(newVoter("primary", fake.ScenarioOK), []ocr.Engine{
+		newVoter("a", fake.ScenarioOK),
+		newVoter("b", fake.ScenarioIncorrect),
+	}, Options{Samples: 2})
+
+	out, _, err := e.CheckSolution(context.Background(), types.CheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Decision != types.CheckDecisionCannotEvaluate || out.CanEvaluate {
+		t.Fatalf("decision = %s, can_evaluate = %v", out.Decision, out.CanEvaluate)
+	}
+	if out.FailureReason == nil || *out.FailureReason != FailureReasonDisagreement {
+		t.Errorf("failure_reason = %v", out.FailureReason)
+	}
+	if err := out.ValidateSemantics(types.CheckRequest{}); err != nil {
+		t.Errorf("disagreement response must stay valid: %v", err)
+	}
+}
+
+func TestEnsemble_FailedSamples(t *testing.T) {
+	broken := voter{Engine: fake.New(fake.Options{ErrorRate: 1}), name: "broken"}
+	e := New(broken, []ocr.Engine{newVoter("a", fake.ScenarioOK), broken}, Options{Samples: 2})
+	out, _, err := e.CheckSolution(context.Background(), types.CheckRequest{})
+	if err != nil || out.Decision != types.CheckDecisionCorrect {
+		t.Fatalf("one failed sample must not veto: %s, %v", out.Decision, err)
+	}
+	if out.Debug.Votes[1].Error == "" {
+		t.Errorf("failed vote must carry error: %+v", out.Debug.Votes)
+	}
+
+	e = New(broken, nil, Options{Samples: 3})
+	if _, _, err := e.CheckSolution(context.Background(), types.CheckRequest{}); !errors.Is(err, fake.ErrInjected) {
+		t.Fatalf("all failed: err = %v", err)
+	}
+}
@@ -0,0 +1,610 @@
+// Package fake — детерминированный движок v2 для тестирования UX-веток child_bot
+// без обращения к провайдерам LLM.
+//
+// Движок доступен как llm_name="fake" только если включён в конфиге
+// (LLM_FAKE_ENGINE). Сценарий выбирается так (по убыванию приоритета):
+//   - заголовок X-Fake-Scenario (прокидывается в контекст через Middleware);
+//   - «магический» task_id вида "fake:<scenario>" (parse, parse_ru, hint);
+//   - ScenarioOK по умолчанию.
+//
+// Все ответы проходят JSON-схемы и семантические проверки типов v2.
+package fake
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"llm-proxy/api/internal/util"
+	"llm-proxy/api/internal/v2/ocr/types"
+)
+
+// Scenario — сценарий ответа фейкового движка.
+type Scenario string
+
+const (
+	ScenarioOK             Scenario = "ok"              // задача по математике, ответ верный
+	ScenarioRetake         Scenario = "retake"          // плохое фото: просим переснять
+	ScenarioNonMath        Scenario = "non_math"        // предмет не математика
+	ScenarioCannotEvaluate Scenario = "cannot_evaluate" // CHECK не может честно проверить
+	ScenarioIncorrect      Scenario = "incorrect"       // CHECK: неверный ответ с error_spans
+	ScenarioError          Scenario = "error"           // движок возвращает ошибку
+	ScenarioTimeout        Scenario = "timeout"         // движок ждёт истечения дедлайна
+)
+
+// Заголовки, которые Middleware переносит в контекст запроса.
+const (
+	HeaderScenario  = "X-Fake-Scenario"
+	HeaderLatencyMs = "X-Fake-Latency-Ms"
+)
+
+// MaxHeaderLatency — предел задержки из X-Fake-Latency-Ms: заголовок
+// передаёт любой клиент, и он не должен держать горутину сколь угодно долго.
+const MaxHeaderLatency = 30 * time.Second
+
+// TaskIDPrefix — префикс «магического» task_id.
+const TaskIDPrefix = "fake:"
+
+// embedDim совпадает с размерностью text-embedding-3-small,
+// чтобы векторы можно было складывать в те же колонки.
+const embedDim = 1536
+
+// ErrInjected возвращается в сценарии ScenarioError и при случайной инъекции ошибок.
+var ErrInjected = errors.New("fake engine: injected error")
+
+// ErrBadHeader — неизвестный сценарий или некорректная задержка в заголовках
+// X-Fake-*: опечатка в тесте не должна превращаться в "ok".
+var ErrBadHeader = errors.New("fake engine: bad " + HeaderScenario + " or " + HeaderLatencyMs)
+
+var scenarios = map[Scenario]bool{
+	ScenarioOK: true, ScenarioRetake: true, ScenarioNonMath: true, ScenarioCannotEvaluate: true,
+	ScenarioIncorrect: true, ScenarioError: true, ScenarioTimeout: true,
+}
+
+// ParseScenario разбирает имя сценария; пустое имя — ScenarioOK.
+func ParseScenario(s string) (Scenario, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return ScenarioOK, true
+	}
+	sc := Scenario(s)
+	return sc, scenarios[sc]
+}
+
+// Options — настройки движка из конфига.
+type Options struct {
+	Latency   time.Duration // искусственная задержка каждого вызова
+	ErrorRate float64       // доля вызовов, завершающихся ErrInjected (0..1)
+}
+
+type Engine struct {
+	opts Options
+}
+
+func New(opts Options) *Engine {
+	return &Engine{opts: opts}
+}
+
+func (e *Engine) Name() string { return "fake" }
+
+type ctxKey int
+
+const (
+	scenarioKey ctxKey = iota
+	latencyKey
+)
+
+// WithScenario кладёт сценарий в контекст.
+func WithScenario(ctx context.Context, s Scenario) context.Context {
+	return context.WithValue(ctx, scenarioKey, s)
+}
+
+// WithLatency переопределяет задержку для одного запроса.
+func WithLatency(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, latencyKey, d)
+}
+
+// Middleware переносит заголовки X-Fake-* в контекст запроса. Заголовки
+// читает только фейковый движок, поэтому здесь они не проверяются: запрос к
+// настоящему движку с лишним заголовком проходит как обычно, а неизвестный
+// сценарий или некорректная задержка в запросе с llm_name=fake дают
+// ErrBadHeader. Задержка ограничена MaxHeaderLatency.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if v := r.Header.Get(HeaderScenario); v != "" {
+			ctx = WithScenario(ctx, Scenario(strings.ToLower(strings.TrimSpace(v))))
+		}
+		if v := r.Header.Get(HeaderLatencyMs); v != "" {
+			latency := time.Duration(-1) // некорректное значение — ошибка в begin
+			if ms, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && ms >= 0 {
+				latency = min(time.Duration(ms), MaxHeaderLatency/time.Millisecond) * time.Millisecond
+			}
+			ctx = WithLatency(ctx, latency)
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// scenario выбирает сценарий: контекст → task_id → ok.
+func scenario(ctx context.Context, taskID string) Scenario {
+	if sc, ok := ctx.Value(scenarioKey).(Scenario); ok && sc != "" {
+		return sc
+	}
+	if rest, ok := strings.CutPrefix(taskID, TaskIDPrefix); ok {
+		if sc, ok := ParseScenario(rest); ok {
+			return sc
+		}
+	}
+	return ScenarioOK
+}
+
+// begin выполняет общую часть каждого вызова: задержку и инъекцию ошибок.
+func (e *Engine) begin(ctx context.Context, op string, sc Scenario) (*types.LLMStats, error) {
+	start := time.Now()
+	latency := e.opts.Latency
+	if d, ok := ctx.Value(latencyKey).(time.Duration); ok {
+		latency = d
+	}
+	if !scenarios[sc] || latency < 0 {
+		return nil, fmt.Errorf("fake %s: %w", op, ErrBadHeader)
+	}
+	if sc == ScenarioTimeout {
+		<-ctx.Done()
+		return nil, fmt.Errorf("fake %s: %w", op, ctx.Err())
+	}
+	if latency > 0 {
+		timer := time.NewTimer(latency)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("fake %s: %w", op, ctx.Err())
+		case <-timer.C:
+		}
+	}
+	if sc == ScenarioError || (e.opts.ErrorRate > 0 && rand.Float64() < e.opts.ErrorRate) {
+		return nil, fmt.Errorf("fake %s: %w", op, ErrInjected)
+	}
+	return &types.LLMStats{
+		LatencyMs: time.Since(start).Milliseconds(),
+		Model:     "fake/" + string(sc),
+	}, nil
+}
+
+// ─── DETECT ───────────────────────────────────────────────────────────────────
+
+func (e *Engine) Detect(ctx context.Context, in types.DetectRequest) (types.DetectResponse, *types.LLMStats, error) {
+	sc := scenario(ctx, "")
+	stats, err := e.begin(ctx, "detect", sc)
+	if err != nil {
+		return types.DetectResponse{}, nil, err
+	}
+	out := types.DetectResponse{
+		SchemaVersion:  "2.2.2",
+		Quality:        types.Quality{Issues: []types.QualityIssue{}},
+		Classification: types.Classification{SubjectCandidate: types.SubjectMath, Confidence: 0.95},
+	}
+	switch sc {
+	case ScenarioRetake:
+		out.Quality = types.Quality{RecommendRetake: true, Issues: []types.QualityIssue{types.IssueBlur}}
+		out.Classification.Confidence = 0.4
+	case ScenarioNonMath:
+		out.Classification = types.Classification{SubjectCandidate: types.SubjectRu, Confidence: 0.9}
+	}
+	return out, stats, nil
+}
+
+// ─── PARSE ────────────────────────────────────────────────────────────────────
+
+func (e *Engine) Parse(ctx context.Context, in types.ParseRequest) (types.ParseResponse, *types.LLMStats, error) {
+	sc := scenario(ctx, in.TaskId)
+	stats, err := e.begin(ctx, "parse", sc)
+	if err != nil {
+		return types.ParseResponse{}, nil, err
+	}
+	grade := int(in.Grade)
+	if grade == 0 {
+		grade = 2
+	}
+	out := types.ParseResponse{
+		SchemaVersion: "2.2.2",
+		Task: types.ParseTask{
+			TaskId:        in.TaskId,
+			Subject:       types.SubjectMath,
+			Grade:         grade,
+			TaskTextClean: "Сколько будет 7 + 5?",
+			VisualFacts:   []types.VisualFact{},
+			Quality:       types.ParseTaskQuality{Flags: []string{}},
+		},
+		Items: []types.ParseItem{mathItem()},
+	}
+	switch sc {
+	case ScenarioRetake:
+		out.Task.TaskTextClean = ""
+		out.Task.Quality.Flags = []string{"blur", "recommend_retake"}
+		out.Items = []types.ParseItem{}
+	case ScenarioNonMath:
+		out.Task.Subject = types.SubjectOther
+		out.Task.TaskTextClean = "Вставь пропущенные буквы: м..роз, к..рова."
+		out.Items = []types.ParseItem{}
+	}
+	return out, stats, nil
+}
+
+func mathItem() types.ParseItem {
+	return types.ParseItem{
+		ItemId:        "1",
+		ItemTextClean: "Сколько будет 7 + 5?",
+		PedKeys: types.PedKeys{
+			TemplateId:     "T1",
+			TaskType:       "arithmetic_fluency",
+			Format:         "number",
+			Constraints:    []string{},
+			TemplateParams: map[string]any{},
+		},
+		HintPolicy:  types.HintPolicy{MaxHints: 2, DefaultVisible: 1, H3Reason: types.H3ReasonNone},
+		ItemQuality: types.ItemQuality{},
+		SolutionInternal: types.SolutionInternal{
+			Plan:          []string{"Дополнить 7 до 10", "Прибавить оставшееся"},
+			SolutionSteps: []string{"7 + 3 = 10", "10 + 2 = 12"},
+			FinalAnswer:   "12",
+		},
+	}
+}
+
+// ─── HINT ─────────────────────────────────────────────────────────────────────
+
+func (e *Engine) Hint(ctx context.Context, in types.HintRequest) (types.HintResponse, *types.LLMStats, error) {
+	sc := scenario(ctx, in.Task.TaskId)
+	stats, err := e.begin(ctx, "hint", sc)
+	if err != nil {
+		return types.HintResponse{}, nil, err
+	}
+	subject := in.Task.Subject
+	if sc == ScenarioNonMath {
+		subject = types.SubjectOther
+	}
+	out := types.HintResponse{
+		SchemaVersion: "2.2.2",
+		TaskRef:       types.TaskRef{TaskId: in.Task.TaskId, ParseSchemaVersion: "2.2.2"},
+		Task: types.HintTask{
+			Subject: subject,
+			Grade:   in.Task.Grade,
+			Quality: types.HintTaskQuality{Flags: []string{}},
+		},
+		Items: []types.HintItem{},
+		UI:    types.HintUI{Buttons: []types.HintButton{}},
+	}
+	if subject != types.SubjectMath {
+		return out, stats, nil
+	}
+
+	levels := []types.HintLevel{types.HintL1, types.HintL2, types.HintL3}
+	texts := map[types.HintLevel]string{
+		types.HintL1: "Перечитай условие и подумай, какое действие здесь нужно.",
+		types.HintL2: "Попробуй сначала дополнить первое число до круглого.",
+		types.HintL3: "Посчитай, сколько осталось прибавить после круглого числа.",
+	}
+	maxHints := 2
+	for _, item := range in.Items {
+		n := min(max(item.HintPolicy.MaxHints, 2), 3)
+		maxHints = max(maxHints, n)
+		hints := make([]types.Hint, 0, n)
+		for _, lvl := range levels[:n] {
+			hints = append(hints, types.Hint{Level: lvl, HintText: texts[lvl]})
+		}
+		plan := len(item.SolutionInternal.Plan)
+		out.Items = append(out.Items, types.HintItem{
+			ItemId:        item.ItemId,
+			TemplateId:    item.PedKeys.TemplateId,
+			AppliedPolicy: types.AppliedPolicy{MaxHints: n, DefaultVisible: 1},
+			PlanCoverage:  types.PlanCoverage{PlanStepsTotal: plan, PlanStepsCovered: plan},
+			Hints:         hints,
+		})
+	}
+	if len(out.Items) > 0 {
+		for i, lvl := range levels[:maxHints] {
+			out.UI.Buttons = append(out.UI.Buttons, types.HintButton{Level: lvl, Label: fmt.Sprintf("Подсказка %d", i+1)})
+		}
+	}
+	return out, stats, nil
+}
+
+// ─── CHECK ────────────────────────────────────────────────────────────────────
+
+func (e *Engine) CheckSolution(ctx context.Context, in types.CheckRequest) (types.CheckResponse, *types.LLMStats, error) {
+	sc := scenario(ctx, "")
+	stats, err := e.begin(ctx, "check", sc)
+	if err != nil {
+		return types.CheckResponse{}, nil, err
+	}
+
+	switch sc {
+	case ScenarioRetake:
+		reason := "bad_photo"
+		out := types.CheckResponse{
+			Status:        types.CheckStatusNeedBetterPhoto,
+			Decision:      types.CheckDecisionCannotEvaluate,
+			Feedback:      "Фото получилось нечётким. Сфотографируй решение ещё раз при хорошем освещении.",
+			ErrorSpans:    []types.ErrorSpan{},
+			PhotoQuality:  &types.PhotoQuality{Score: 0.2, Label: types.PhotoQualityLow},
+			FailureReason: &reason,
+		}
+		return out, stats, nil
+	case ScenarioNonMath:
+		reason := "unsupported_subject"
+		out := types.CheckResponse{
+			Status:        types.CheckStatusInternalError,
+			Decision:      types.CheckDecisionCannotEvaluate,
+			Feedback:      "Пока я умею проверять только задачи по математике.",
+			ErrorSpans:    []types.ErrorSpan{},
+			FailureReason: &reason,
+		}
+		return out, stats, nil
+	case ScenarioCannotEvaluate:
+		reason := "no_visible_answer"
+		out := types.CheckResponse{
+			Status:        types.CheckStatusNoAnswer,
+			Decision:      types.CheckDecisionCannotEvaluate,
+			Feedback:      "Не вижу ответа на фото. Запиши ответ и пришли фото ещё раз.",
+			ErrorSpans:    []types.ErrorSpan{},
+			PhotoQuality:  &types.PhotoQuality{Score: 0.8, Label: types.PhotoQualityHigh},
+			FailureReason: &reason,
+		}
+		return out, stats, nil
+	}
+
+	expected := expectedAnswer(in)
+	student := expected
+	decision := types.CheckDecisionCorrect
+	feedback := "Всё верно, молодец!"
+	spans := []types.ErrorSpan{}
+	var details *types.CheckErrorDetails
+	if sc == ScenarioIncorrect {
+		student = wrongAnswer(expected)
+		decision = types.CheckDecisionIncorrect
+		feedback = "В ответе есть ошибка. Проверь вычисления ещё раз."
+		spans = []types.ErrorSpan{{From: 0, To: len([]rune(student)), Label: "arithmetic_error"}}
+		details = &types.CheckErrorDetails{
+			Topic:                  "addition",
+			ErrorType:              "arithmetic_error",
+			BriefForReport:         "Ошибка в сложении с переходом через десяток.",
+			PracticeRecommendation: "Потренировать сложение с переходом через десяток.",
+		}
+	}
+	confidence := 0.95
+	method := "recompute"
+	reason := "independent_verification"
+	complete := true
+	out := types.CheckResponse{
+		Status:       types.CheckStatusEvaluated,
+		CanEvaluate:  true,
+		Decision:     decision,
+		Feedback:     feedback,
+		ErrorSpans:   spans,
+		Confidence:   &confidence,
+		PhotoQuality: &types.PhotoQuality{Score: 0.9, Label: types.PhotoQualityHigh},
+		Debug: &types.CheckDebug{
+			RawAnswerText:        &student,
+			NormalizedAnswer:     &student,
+			ExpectedAnswer:       &expected,
+			DecisionReason:       &reason,
+			VerificationMethod:   &method,
+			ParseConsistent:      &complete,
+			VerificationComplete: &complete,
+			VisualEvidence: []types.CheckVisualEvidence{
+				{ObjectID: "answer", Observed: student, Expected: expected, Matches: student == expected},
+			},
+		},
+		ErrorDetails: details,
+	}
+	out.SetIsCorrectFromDecision()
+	return out, stats, nil
+}
+
+// expectedAnswer берёт эталон из PARSE, если он есть.
+func expectedAnswer(in types.CheckRequest) string {
+	for _, item := range in.TaskStruct.Items {
+		if item.SolutionInternal.FinalAnswer == nil {
+			continue
+		}
+		if s := strings.TrimSpace(fmt.Sprint(item.SolutionInternal.FinalAnswer)); s != "" {
+			return s
+		}
+	}
+	return "12"
+}
+
+func wrongAnswer(expected string) string {
+	if n, err := strconv.ParseFloat(strings.ReplaceAll(expected, ",", "."), 64); err == nil {
+		return strconv.FormatFloat(n+1, 'f', -1, 64)
+	}
+	return expected + "?"
+}
+
+// ─── ANALOGUE ─────────────────────────────────────────────────────────────────
+
+func (e *Engine) AnalogueSolution(ctx context.Context, in types.AnalogueRequest) (types.AnalogueResponse, *types.LLMStats, error) {
+	stats, err := e.begin(ctx, "analogue", scenario(ctx, ""))
+	if err != nil {
+		return types.AnalogueResponse{}, nil, err
+	}
+	return types.AnalogueResponse{
+		ExampleTask:   "Сколько будет 8 + 6?",
+		SolutionSteps: []string{"Дополним 8 до 10: 8 + 2 = 10", "Осталось прибавить 4: 10 + 4 = 14"},
+	}, stats, nil
+}
+
+// ─── RU ───────────────────────────────────────────────────────────────────────
+
+func (e *Engine) ParseRU(ctx context.Context, in types.ParseRURequest) (types.ParseRUResponse, *types.LLMStats, error) {
+	sc := scenario(ctx, in.TaskId)
+	stats, err := e.begin(ctx, "parse_ru", sc)
+	if err != nil {
+		return types.ParseRUResponse{}, nil, err
+	}
+	grade := in.Grade
+	if grade == 0 {
+		grade = 2
+	}
+	out := types.ParseRUResponse{
+		ParseMeta: types.RUParseMeta{
+			Readable:      true,
+			TaskTextClean: "Вставь пропущенные буквы: м..роз, к..рова.",
+		},
+		ActionPlan: types.RUActionPlan{
+			Schema:   "ru_action_plan_v1",
+			Subject:  "ru",
+			Grade:    grade,
+			TaskKind: "single",
+			Coverage: "full",
+			Actions: []types.RUAction{{
+				ActionID:           "a1",
+				TaskAction:         "insert_letter",
+				CheckMode:          "strict",
+				RuleFamily:         "vocabulary_word",
+				Reliability:        "high",
+				Items:              []string{"м..роз", "к..рова"},
+				TargetFormat:       "letter_gap",
+				ExpectedAnswerType: "letter",
+				VisualRequirement:  "none",
+				SourceTextRole:     "items",
+				VisualTargets:      []string{},
+			}},
+		},
+	}
+	switch sc {
+	case ScenarioRetake:
+		out.ParseMeta = types.RUParseMeta{RecommendRetake: true}
+		out.ActionPlan.TaskKind = "unknown"
+		out.ActionPlan.Coverage = "unsupported"
+		out.ActionPlan.Actions = []types.RUAction{}
+	case ScenarioNonMath:
+		// Для русского «не тот предмет» — это математика на фото.
+		out.ParseMeta.TaskTextClean = "Сколько будет 7 + 5?"
+		out.ActionPlan.TaskKind = "unknown"
+		out.ActionPlan.Coverage = "unsupported"
+		out.ActionPlan.Actions = []types.RUAction{}
+	}
+	return out, stats, nil
+}
+
+func (e *Engine) HintRU(ctx context.Context, in types.HintRUCompactInput) (types.HintRUResponse, *types.LLMStats, error) {
+	sc := scenario(ctx, "")
+	stats, err := e.begin(ctx, "hint_ru", sc)
+	if err != nil {
+		return types.HintRUResponse{}, nil, err
+	}
+	out := types.HintRUResponse{
+		Status:       "ready",
+		Confidence:   "high",
+		ChildMessage: "Давай вспомним правило и проверим каждое слово.",
+		RoadmapSteps: []string{"Найди пропуск", "Вспомни правило", "Проверь по словарю"},
+		HintCards:    []types.RUHintCard{},
+		RuleButtons:  []types.RURuleButton{},
+	}
+	for _, a := range in.ActionsPayload {
+		out.HintCards = append(out.HintCards, types.RUHintCard{
+			ActionID:       a.ActionID,
+			Title:          "Словарные слова",
+			Explanation:    "Написание словарных слов нужно запомнить или проверить по словарю.",
+			AlgorithmSteps: []string{"Найди слово с пропуском", "Открой словарь в конце учебника"},
+			ChildQuestion:  "Какое из слов ты уже встречал в словаре?",
+		})
+	}
+	switch sc {
+	case ScenarioRetake:
+		out = types.HintRUResponse{Status: "need_retake", Confidence: "none",
+			ChildMessage: "Фото получилось нечётким. Сфотографируй задание ещё раз.",
+			RoadmapSteps: []string{}, HintCards: []types.RUHintCard{}, RuleButtons: []types.RURuleButton{}}
+	case ScenarioNonMath, ScenarioCannotEvaluate:
+		out = types.HintRUResponse{Status: "cannot_help", Confidence: "none",
+			ChildMessage: "С этим заданием я пока не помогу.",
+			RoadmapSteps: []string{}, HintCards: []types.RUHintCard{}, RuleButtons: []types.RURuleButton{}}
+	}
+	return out, stats, nil
+}
+
+func (e *Engine) CheckRU(ctx context.Context, in types.CheckRUCompactInput) (types.CheckRUResponse, *types.LLMStats, error) {
+	sc := scenario(ctx, "")
+	stats, err := e.begin(ctx, "check_ru", sc)
+	if err != nil {
+		return types.CheckRUResponse{}, nil, err
+	}
+	out := types.CheckRUResponse{
+		Status:         "correct",
+		Confidence:     "high",
+		ChildMessage:   "Всё верно, молодец!",
+		CheckedActions: []types.RUCheckedAction{},
+		ErrorGroups:    []types.RUErrorGroup{},
+		RuleButtons:    []types.RURuleButton{},
+	}
+	result := "correct"
+	switch sc {
+	case ScenarioIncorrect:
+		out.Status = "needs_fix"
+		out.ChildMessage = "Почти получилось, но в одном слове есть ошибка."
+		result = "has_issue"
+	case ScenarioRetake, ScenarioNonMath, ScenarioCannotEvaluate:
+		out.Status = "cannot_check"
+		out.Confidence = "none"
+		out.ChildMessage = "Не получилось проверить ответ. Пришли фото ещё раз."
+		result = "unclear"
+	}
+	for _, a := range in.ActionsPayload {
+		out.CheckedActions = append(out.CheckedActions, types.RUCheckedAction{ActionID: a.ActionID, Result: result})
+		if result == "has_issue" {
+			out.ErrorGroups = append(out.ErrorGroups, types.RUErrorGroup{
+				ActionID:          a.ActionID,
+				RuleFamily:        a.RuleFamily,
+				LocationHint:      "первое слово",
+				Feedback:          "Проверь безударную гласную.",
+				SelfCheckQuestion: "Какое проверочное слово можно подобрать?",
+				RuleIDs:           []string{},
+			})
+		}
+	}
+	return out, stats, nil
+}
+
+// ─── EMBED ────────────────────────────────────────────────────────────────────
+
+// Embed возвращает детерминированные единичные векторы, зависящие только от текста.
+func (e *Engine) Embed(ctx context.Context, in types.EmbedRequest) (types.EmbedResponse, *types.LLMStats, error) {
+	stats, err := e.begin(ctx, "embed", scenario(ctx, ""))
+	if err != nil {
+		return types.EmbedResponse{}, nil, err
+	}
+	out := types.EmbedResponse{SchemaVersion: "embed_v1", Vectors: make([][]float32, 0, len(in.Input))}
+	for _, s := range in.Input {
+		out.Vectors = append(out.Vectors, embedVector(s))
+	}
+	return out, stats, nil
+}
+
+func embedVector(s string) []float32 {
+	seed := util.SHA256Hex([]byte(s))
+	a, _ := strconv.ParseUint(seed[:16], 16, 64)
+	b, _ := strconv.ParseUint(seed[16:32], 16, 64)
+	r := rand.New(rand.NewPCG(a, b))
+	v := make([]float32, embedDim)
+	var norm float64
+	for i := range v {
+		x := r.NormFloat64()
+		v[i] = float32(x)
+		norm += x * x
+	}
+	if norm > 0 {
+		inv := float32(1 / math.Sqrt(norm))
+		for i := range v {
+			v[i] *= inv
+		}
+	}
+	return v
+}
@@ -0,0 +1,200 @@
+package fake
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"llm-proxy/api/internal/v2/ocr/types"
+)
+
+func TestCheckSolution_ScenariosPassSemanticValidation(t *testing.T) {
+	e := New(Options{})
+	parse, _, err := e.Parse(context.Background(), types.ParseRequest{TaskId: "t1", Grade: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := types.CheckRequest{TaskStruct: types.TaskStructCheck{
+		TaskTextClean: parse.Task.TaskTextClean,
+		VisualFacts:   []types.VisualFact{},
+		Items:         parse.Items,
+	}}
+
+	tests := []struct {
+		scenario    Scenario
+		decision    types.CheckDecision
+		canEvaluate bool
+		wantSpans   bool
+	}{
+		{ScenarioOK, types.CheckDecisionCorrect, true, false},
+		{ScenarioIncorrect, types.CheckDecisionIncorrect, true, true},
+		{ScenarioCannotEvaluate, types.CheckDecisionCannotEvaluate, false, false},
+		{ScenarioRetake, types.CheckDecisionCannotEvaluate, false, false},
+		{ScenarioNonMath, types.CheckDecisionCannotEvaluate, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.scenario), func(t *testing.T) {
+			out, stats, err := e.CheckSolution(WithScenario(context.Background(), tt.scenario), in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stats == nil || stats.Model != "fake/"+string(tt.scenario) {
+				t.Errorf("stats = %+v", stats)
+			}
+			if out.Decision != tt.decision || out.CanEvaluate != tt.canEvaluate {
+				t.Errorf("decision=%s can_evaluate=%v", out.Decision, out.CanEvaluate)
+			}
+			if (len(out.ErrorSpans) > 0) != tt.wantSpans {
+				t.Errorf("error_spans = %+v", out.ErrorSpans)
+			}
+			if err := out.ValidateSemantics(in); err != nil {
+				t.Errorf("ValidateSemantics: %v", err)
+			}
+		})
+	}
+}
+
+func TestHint_PassesValidationAgainstParse(t *testing.T) {
+	e := New(Options{})
+	for _, sc := range []Scenario{ScenarioOK, ScenarioNonMath} {
+		ctx := WithScenario(context.Background(), sc)
+		parse, _, err := e.Parse(ctx, types.ParseRequest{TaskId: "t1", Grade: 3})
+		if err != nil {
+			t.Fatal(err)
+		}
+		in := types.HintRequest{Task: parse.Task, Items: parse.Items}
+		out, _, err := e.Hint(ctx, in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := out.ValidateAgainstRequest(in); err != nil {
+			t.Errorf("%s: ValidateAgainstRequest: %v", sc, err)
+		}
+		if inconsistent := parse.ValidateItems(); inconsistent != 0 {
+			t.Errorf("%s: parse has %d inconsistent items", sc, inconsistent)
+		}
+	}
+}
+
+func TestScenarioSelection(t *testing.T) {
+	e := New(Options{})
+
+	out, _, err := e.Parse(context.Background(), types.ParseRequest{TaskId: "fake:retake"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Items) != 0 || len(out.Task.Quality.Flags) == 0 {
+		t.Errorf("magic task_id ignored: %+v", out)
+	}
+
+	// Заголовок (контекст) важнее task_id.
+	out, _, err = e.Parse(WithScenario(context.Background(), ScenarioOK), types.ParseRequest{TaskId: "fake:retake"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Items) != 1 {
+		t.Errorf("context scenario must win over task_id: %+v", out)
+	}
+
+	det, _, err := e.Detect(WithScenario(context.Background(), ScenarioNonMath), types.DetectRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if det.Classification.SubjectCandidate == types.SubjectMath {
+		t.Errorf("non_math detect returned math")
+	}
+}
+
+func TestInjectedErrorsAndLatency(t *testing.T) {
+	e := New(Options{})
+	if _, _, err := e.Detect(WithScenario(context.Background(), ScenarioError), types.DetectRequest{}); !errors.Is(err, ErrInjected) {
+		t.Errorf("error scenario err = %v", err)
+	}
+	if _, _, err := New(Options{ErrorRate: 1}).Embed(context.Background(), types.EmbedRequest{}); !errors.Is(err, ErrInjected) {
+		t.Errorf("error rate 1 err = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, _, err := e.Hint(WithScenario(ctx, ScenarioTimeout), types.HintRequest{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("timeout scenario err = %v", err)
+	}
+
+	start := time.Now()
+	_, stats, err := e.Detect(WithLatency(context.Background(), 30*time.Millisecond), types.DetectRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) < 30*time.Millisecond || stats.LatencyMs < 30 {
+		t.Errorf("latency not applied: stats=%+v", stats)
+	}
+}
+
+func TestEmbed_Deterministic(t *testing.T) {
+	e := New(Options{})
+	a, _, err := e.Embed(context.Background(), types.EmbedRequest{Input: []string{"дроби", "углы"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _, _ := e.Embed(context.Background(), types.EmbedRequest{Input: []string{"дроби"}})
+	if len(a.Vectors) != 2 || len(a.Vectors[0]) != embedDim {
+		t.Fatalf("unexpected shape: %d", len(a.Vectors))
+	}
+	for i := range a.Vectors[0] {
+		if a.Vectors[0][i] != b.Vectors[0][i] {
+			t.Fatal("same input must produce the same vector")
+		}
+	}
+	if a.Vectors[0][0] == a.Vectors[1][0] && a.Vectors[0][1] == a.Vectors[1][1] {
+		t.Error("different inputs produced the same vector")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var got Scenario
+	var gotLatency time.Duration
+	h := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = scenario(r.Context(), "")
+		gotLatency, _ = r.Context().Value(latencyKey).(time.Duration)
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/v2/check_solution", nil)
+	req.Header.Set(HeaderScenario, "Incorrect")
+	req.Header.Set(HeaderLatencyMs, "150")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || got != ScenarioIncorrect || gotLatency != 150*time.Millisecond {
+		t.Errorf("code=%d scenario=%q latency=%v", rr.Code, got, gotLatency)
+	}
+
+	// Задержка из заголовка ограничена.
+	req = httptest.NewRequest(http.MethodPost, "/v2/check_solution", nil)
+	req.Header.Set(HeaderLatencyMs, "999999999999999")
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || gotLatency != MaxHeaderLatency {
+		t.Errorf("code=%d latency=%v, want %v", rr.Code, gotLatency, MaxHeaderLatency)
+	}
+}
+
+// TestMiddleware_BadHeaders: запрос к настоящему движку с неверным заголовком
+// проходит, фейковый движок отвечает ошибкой.
+func TestMiddleware_BadHeaders(t *testing.T) {
+	for _, h := range [][2]string{{HeaderScenario, "incorect"}, {HeaderLatencyMs, "soon"}} {
+		var ctx context.Context
+		mw := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { ctx = r.Context() }))
+		req := httptest.NewRequest(http.MethodPost, "/v2/detect", nil)
+		req.Header.Set(h[0], h[1])
+		rr := httptest.NewRecorder()
+		mw.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: code = %d, want the request to reach the handler", h[0], rr.Code)
+		}
+		if _, _, err := New(Options{}).Detect(ctx, types.DetectRequest{}); !errors.Is(err, ErrBadHeader) {
+			t.Errorf("%s: Detect() error = %v, want ErrBadHeader", h[0], err)
+		}
+	}
+}
@@ -6,13 +6,18 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
+	"net/http"
 	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
 	"llm-proxy/api/internal/util"
+	"llm-proxy/api/internal/v2/ocr/jsonrepair"
 	"llm-proxy/api/internal/v2/ocr/types"
+	"llm-proxy/api/internal/v2/ocr/validation"
+	"llm-proxy/api/internal/v2/pricing"
 
 	"github.com/google/generative-ai-go/genai"
 	"google.golang.org/api/googleapi"
@@ -35,6 +40,10 @@ type Engine struct {
 	apiKey      string
 	detectModel string
 	parseModel  string
+	httpc       *http.Client        // nil — транспорт SDK по умолчанию
+	prompts     *promptCache        // nil — system instruction отправляется в каждом запросе
+	images      *util.ImagePipeline // nil — изображение отправляется как есть
+	attempts    int                 // вызовов модели на шаг при semantic validation; 0 — validation.DefaultAttempts
 }
 
 func New(apiKey, detectModel, parseModel string) *Engine {
@@ -51,13 +60,91 @@ func New(apiKey, detectModel, parseModel string) *Engine {
 	}
 }
 
+// WithHTTPClient подменяет HTTP-клиент SDK (кассеты record/replay, трассировка).
+// SDK игнорирует option.WithAPIKey при заданном клиенте, поэтому ключ
+// добавляется заголовком x-goog-api-key на уровне транспорта.
+func (e *Engine) WithHTTPClient(c *http.Client) *Engine {
+	if c != nil {
+		e.httpc = c
+	}
+	return e
+}
+
+// WithPromptCache включает кэширование system instruction через cachedContents:
+// промпт со схемой загружается в Gemini один раз на ttl, запросы ссылаются на handle,
+// и закэшированные токены тарифицируются со скидкой. ttl <= 0 — кэш выключен.
+func (e *Engine) WithPromptCache(ttl time.Duration) *Engine {
+	if ttl > 0 {
+		e.prompts = newPromptCache(ttl)
+	}
+	return e
+}
+
+// WithImagePipeline включает предобработку изображений перед отправкой в Gemini.
+func (e *Engine) WithImagePipeline(p *util.ImagePipeline) *Engine {
+	e.images = p
+	return e
+}
+
+// WithValidationAttempts задаёт число вызовов модели на шаг, пока ответ не
+// пройдёт semantic validation: 1 — без повторов.
+func (e *Engine) WithValidationAttempts(n int) *Engine {
+	e.attempts = n
+	return e
+}
+
 func (e *Engine) Name() string { return "gemini" }
 
+// CacheFingerprint возвращает модель и хеш промпта шага для ключа кэша ответов.
+func (e *Engine) CacheFingerprint(step string) (model, hash string) {
+	model = e.parseModel
+	if step == "detect" {
+		model = e.detectModel
+	}
+	system, schemaJSON, err := loadSystemWithSchema(step)
+	if err != nil {
+		return model, ""
+	}
+	return model, util.SHA256Hex([]byte(system + "\x00" + schemaJSON))[:16]
+}
+
+// clientOptions возвращает опции genai-клиента с учётом подменённого HTTP-клиента.
+func (e *Engine) clientOptions() []option.ClientOption {
+	if e.httpc == nil {
+		return []option.ClientOption{option.WithAPIKey(e.apiKey)}
+	}
+	base := e.httpc.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	c := *e.httpc
+	c.Transport = &apiKeyTransport{key: e.apiKey, base: base}
+	// Клиент cachedContents в SDK убирает WithHTTPClient из опций и без ключа
+	// ищет application default credentials — поэтому ключ передаётся и явно.
+	return []option.ClientOption{option.WithHTTPClient(&c), option.WithAPIKey(e.apiKey)}
+}
+
+// apiKeyTransport добавляет ключ Gemini к каждому запросу.
+type apiKeyTransport struct {
+	key  string
+	base http.RoundTripper
+}
+
+func (t *apiKeyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := req.Clone(req.Context())
+	r.Header.Set("x-goog-api-key", t.key)
+	return t.base.RoundTrip(r)
+}
+
 // ─── DETECT ───────────────────────────────────────────────────────────────────
 
 // Detect оценивает качество фото и определяет учебный предмет.
 // Модель: detectModel (gemini-2.0-flash-lite) — задача простая, нужна скорость.
 func (e *Engine) Detect(ctx context.Context, in types.DetectRequest) (types.DetectResponse, *types.LLMStats, error) {
+	return validation.Detect(ctx, e.attempts, in, e.detect)
+}
+
+func (e *Engine) detect(ctx context.Context, in types.DetectRequest) (types.DetectResponse, *types.LLMStats, error) {
 	if e.apiKey == "" {
 		return types.DetectResponse{}, nil, fmt.Errorf("GEMINI_API_KEY not set")
 	}
@@ -72,18 +159,20 @@ func (e *Engine) Detect(ctx context.Context, in types.DetectRequest) (types.Dete
 		userPrompt = "Верни ТОЛЬКО JSON по detect.schema v2.2.2."
 	}
 
-	imgBytes, mime, err := decodeImage(in.Image)
+	refs, err := in.AllImages()
 	if err != nil {
 		return types.DetectResponse{}, nil, fmt.Errorf("gemini detect: %w", err)
 	}
-
-	parts := []genai.Part{
-		genai.Text(userPrompt),
-		&genai.Blob{MIMEType: mime, Data: imgBytes},
+	images, img, err := e.imageParts(refs, e.detectModel)
+	if err != nil {
+		return types.DetectResponse{}, nil, fmt.Errorf("gemini detect: %w", err)
 	}
 
+	parts := withCorrection(append([]genai.Part{genai.Text(userPrompt)}, images...), in.Correction)
+
 	var out types.DetectResponse
 	stats, err := e.call(ctx, e.detectModel, system, schema, 0, parts, &out, "detect")
+	stats.SetImage(img.BytesIn, img.BytesOut)
 	if err != nil {
 		return types.DetectResponse{}, stats, err
 	}
@@ -95,6 +184,10 @@ func (e *Engine) Detect(ctx context.Context, in types.DetectRequest) (types.Dete
 // Parse читает задание с фото и строит структурированный JSON с планом решения.
 // Модель: parseModel (gemini-2.5-flash) — лучший OCR рукописного текста + русский.
 func (e *Engine) Parse(ctx context.Context, in types.ParseRequest) (types.ParseResponse, *types.LLMStats, error) {
+	return validation.Parse(ctx, e.attempts, in, e.parse)
+}
+
+func (e *Engine) parse(ctx context.Context, in types.ParseRequest) (types.ParseResponse, *types.LLMStats, error) {
 	if e.apiKey == "" {
 		return types.ParseResponse{}, nil, fmt.Errorf("GEMINI_API_KEY not set")
 	}
@@ -104,7 +197,11 @@ func (e *Engine) Parse(ctx context.Context, in types.ParseRequest) (types.ParseR
 		return types.ParseResponse{}, nil, fmt.Errorf("gemini parse: %w", err)
 	}
 
-	imgBytes, mime, err := decodeImage(in.Image)
+	refs, err := in.AllImages()
+	if err != nil {
+		return types.ParseResponse{}, nil, fmt.Errorf("gemini parse: %w", err)
+	}
+	images, img, err := e.imageParts(refs, e.parseModel)
 	if err != nil {
 		return types.ParseResponse{}, nil, fmt.Errorf("gemini parse: %w", err)
 	}
@@ -127,17 +224,15 @@ func (e *Engine) Parse(ctx context.Context, in types.ParseRequest) (types.ParseR
 	}
 	userText := userPrompt + "\nINPUT_CONTEXT:\n" + string(ctxJSON)
 
-	parts := []genai.Part{
-		genai.Text(userText),
-		&genai.Blob{MIMEType: mime, Data: imgBytes},
-	}
+	parts := append([]genai.Part{genai.Text(userText)}, images...)
+	parts = withCorrection(parts, in.Correction)
 
 	var pr types.ParseResponse
 	stats, err := e.call(ctx, e.parseModel, system, schema, 0.1, parts, &pr, "parse")
+	stats.SetImage(img.BytesIn, img.BytesOut)
 	if err != nil {
 		return types.ParseResponse{}, stats, err
 	}
-	pr.ValidateItems()
 	return pr, stats, nil
 }
 
@@ -146,6 +241,10 @@ func (e *Engine) Parse(ctx context.Context, in types.ParseRequest) (types.ParseR
 // Hint генерирует педагогические подсказки L1/L2/L3 на основе разобранного задания.
 // Модель: parseModel — text-only, требует качественный русский педагогический текст.
 func (e *Engine) Hint(ctx context.Context, in types.HintRequest) (types.HintResponse, *types.LLMStats, error) {
+	return validation.Hint(ctx, e.attempts, in, e.hint)
+}
+
+func (e *Engine) hint(ctx context.Context, in types.HintRequest) (types.HintResponse, *types.LLMStats, error) {
 	if e.apiKey == "" {
 		return types.HintResponse{}, nil, fmt.Errorf("GEMINI_API_KEY not set")
 	}
@@ -170,15 +269,13 @@ func (e *Engine) Hint(ctx context.Context, in types.HintRequest) (types.HintResp
 	}
 
 	parts := []genai.Part{genai.Text(userText)}
+	parts = withCorrection(parts, in.Correction)
 
 	var hr types.HintResponse
 	stats, err := e.call(ctx, e.parseModel, system, schema, 1, parts, &hr, "hint")
 	if err != nil {
 		return types.HintResponse{}, stats, err
 	}
-	if err := hr.ValidateAgainstRequest(in); err != nil {
-		return types.HintResponse{}, stats, fmt.Errorf("gemini hint semantic validation: %w", err)
-	}
 	return hr, stats, nil
 }
 
@@ -187,6 +284,10 @@ func (e *Engine) Hint(ctx context.Context, in types.HintRequest) (types.HintResp
 // CheckSolution проверяет ответ ученика на фото против условия задачи.
 // Модель: parseModel — vision + математическое рассуждение.
 func (e *Engine) CheckSolution(ctx context.Context, in types.CheckRequest) (types.CheckResponse, *types.LLMStats, error) {
+	return validation.Check(ctx, e.attempts, in, e.checkSolution)
+}
+
+func (e *Engine) checkSolution(ctx context.Context, in types.CheckRequest) (types.CheckResponse, *types.LLMStats, error) {
 	if e.apiKey == "" {
 		return types.CheckResponse{}, nil, fmt.Errorf("GEMINI_API_KEY not set")
 	}
@@ -196,7 +297,11 @@ func (e *Engine) CheckSolution(ctx context.Context, in types.CheckRequest) (type
 		return types.CheckResponse{}, nil, fmt.Errorf("gemini check: %w", err)
 	}
 
-	imgBytes, mime, err := decodeImage(in.Image)
+	refs, err := in.AllImages()
+	if err != nil {
+		return types.CheckResponse{}, nil, fmt.Errorf("gemini check: %w", err)
+	}
+	images, img, err := e.imageParts(refs, e.parseModel)
 	if err != nil {
 		return types.CheckResponse{}, nil, fmt.Errorf("gemini check: %w", err)
 	}
@@ -229,21 +334,17 @@ func (e *Engine) CheckSolution(ctx context.Context, in types.CheckRequest) (type
 		}
 	}
 
-	parts := []genai.Part{
-		genai.Text(userText),
-		&genai.Blob{MIMEType: mime, Data: imgBytes},
-	}
+	parts := append([]genai.Part{genai.Text(userText)}, images...)
+	parts = withCorrection(parts, in.Correction)
 
 	var cr types.CheckResponse
 	stats, err := e.call(ctx, e.parseModel, system, schema, 0, parts, &cr, "check")
+	stats.SetImage(img.BytesIn, img.BytesOut)
 	if err != nil {
 		return types.CheckResponse{}, stats, err
 	}
 	cr.NormalizeDecision()
 	cr.SetIsCorrectFromDecision()
-	if err := cr.ValidateSemantics(in); err != nil {
-		return types.CheckResponse{}, stats, fmt.Errorf("gemini check semantic validation: %w", err)
-	}
 	return cr, stats, nil
 }
 
@@ -252,6 +353,10 @@ func (e *Engine) CheckSolution(ctx context.Context, in types.CheckRequest) (type
 // AnalogueSolution генерирует аналогичное задание тем же приёмом.
 // Модель: parseModel — text-only, генерация на русском языке.
 func (e *Engine) AnalogueSolution(ctx context.Context, in types.AnalogueRequest) (types.AnalogueResponse, *types.LLMStats, error) {
+	return validation.Analogue(ctx, e.attempts, in, e.analogueSolution)
+}
+
+func (e *Engine) analogueSolution(ctx context.Context, in types.AnalogueRequest) (types.AnalogueResponse, *types.LLMStats, error) {
 	if e.apiKey == "" {
 		return types.AnalogueResponse{}, nil, fmt.Errorf("GEMINI_API_KEY not set")
 	}
@@ -271,7 +376,7 @@ func (e *Engine) AnalogueSolution(ctx context.Context, in types.AnalogueRequest)
 		userText = "INPUT_JSON:\n" + string(inJSON)
 	}
 
-	parts := []genai.Part{genai.Text(userText)}
+	parts := withCorrection([]genai.Part{genai.Text(userText)}, in.Correction)
 
 	var ar types.AnalogueResponse
 	stats, err := e.call(ctx, e.parseModel, system, schema, 1, parts, &ar, "analogue")
@@ -325,7 +430,7 @@ func (e *Engine) call(
 	dst any,
 	op string,
 ) (*types.LLMStats, error) {
-	cl, err := genai.NewClient(ctx, option.WithAPIKey(e.apiKey))
+	cl, err := genai.NewClient(ctx, e.clientOptions()...)
 	if err != nil {
 		return nil, fmt.Errorf("gemini %s: new client: %w", op, err)
 	}
@@ -336,12 +441,23 @@ func (e *Engine) call(
 		Temperature:      ptrFloat32(temperature),
 		ResponseMIMEType: "application/json",
 	}
-	m.SystemInstruction = &genai.Content{
+	sysContent := &genai.Content{
 		Parts: []genai.Part{
 			genai.Text(systemPrompt),
 			genai.Text("\nJSON schema для ответа (следуй строго):\n" + schemaJSON),
 		},
 	}
+	// System instruction берётся из cachedContents, если кэш включён и доступен;
+	// при любой ошибке кэша промпт отправляется в запросе целиком.
+	if name := e.prompts.handle(ctx, model, sysContent, len(systemPrompt)+len(schemaJSON), e.createCachedContent); name != "" {
+		m.CachedContentName = name
+	} else {
+		m.SystemInstruction = sysContent
+	}
+
+	// Схема нужна ремонту ответа; без неё типы не приводятся.
+	var schemaMap map[string]any
+	_ = json.Unmarshal([]byte(schemaJSON), &schemaMap)
 
 	const maxAttempts = 4
 	var lastErr error
@@ -349,6 +465,14 @@ func (e *Engine) call(
 		start := time.Now()
 		resp, err := m.GenerateContent(ctx, parts...)
 		t := time.Since(start).Milliseconds()
+		if err != nil && m.CachedContentName != "" && isCacheMiss(err) {
+			log.Printf("[gemini] %s: cached content %s rejected, sending prompt inline: %v", op, m.CachedContentName, err)
+			e.prompts.invalidate(m.CachedContentName)
+			m.CachedContentName = ""
+			m.SystemInstruction = sysContent
+			resp, err = m.GenerateContent(ctx, parts...)
+			t = time.Since(start).Milliseconds()
+		}
 		if err != nil {
 			lastErr = err
 			delay := retryDelay(err, attempt)
@@ -375,17 +499,26 @@ func (e *Engine) call(
 			continue
 		}
 
-		txt = util.StripCodeFences(strings.TrimSpace(txt))
-		if err := json.Unmarshal([]byte(txt), dst); err != nil {
-			return nil, fmt.Errorf("gemini %s: bad JSON: %w", op, err)
-		}
-
-		var inTok, outTok int
+		var inTok, outTok, cached int
 		if resp.UsageMetadata != nil {
 			inTok = int(resp.UsageMetadata.PromptTokenCount)
 			outTok = int(resp.UsageMetadata.CandidatesTokenCount)
+			cached = int(resp.UsageMetadata.CachedContentTokenCount)
+		}
+		stats := &types.LLMStats{
+			InputTokens:  inTok,
+			OutputTokens: outTok,
+			CachedTokens: cached,
+			LatencyMs:    t,
+			Model:        model,
+			CostUSD:      pricing.Cost(model, inTok, cached, outTok),
+		}
+		txt = util.StripCodeFences(strings.TrimSpace(txt))
+		repair, err := jsonrepair.Decode(op, txt, schemaMap, dst)
+		stats.JSONRepair = repair
+		if err != nil {
+			return stats, fmt.Errorf("gemini %s: bad JSON: %w", op, err)
 		}
-		stats := &types.LLMStats{InputTokens: inTok, OutputTokens: outTok, LatencyMs: t}
 		return stats, nil
 	}
 	return nil, lastErr
@@ -409,12 +542,17 @@ func loadSystemWithSchema(name string) (system, schemaJSON string, err error) {
 	return sys, string(raw), nil
 }
 
-func decodeImage(image string) ([]byte, string, error) {
+// imageFormats — форматы изображений, которые принимает Gemini (HEIC — нативно);
+// остальные (AVIF, GIF) перекодируются в JPEG.
+var imageFormats = util.ImageFormats{"image/jpeg", "image/png", "image/webp", "image/heic", "image/heif"}
+
+// decodeImage декодирует изображение запроса и прогоняет его через предобработку для модели.
+func (e *Engine) decodeImage(image, model string) ([]byte, string, util.ImageStats, error) {
 	imgBytes, mimeFromDataURL, _ := util.DecodeBase64MaybeDataURL(image)
 	if len(imgBytes) == 0 {
 		raw, err := base64.StdEncoding.DecodeString(image)
 		if err != nil || len(raw) == 0 {
-			return nil, "", fmt.Errorf("invalid image base64")
+			return nil, "", util.ImageStats{}, fmt.Errorf("invalid image base64")
 		}
 		imgBytes = raw
 	}
@@ -422,7 +560,41 @@ func decodeImage(image string) ([]byte, string, error) {
 	if mime == "application/octet-stream" {
 		mime = "image/jpeg"
 	}
-	return imgBytes, mime, nil
+	return e.images.Prepare(model, imgBytes, mime, imageFormats)
+}
+
+// withCorrection добавляет к сообщению CORRECTION_REQUIRED, если запрос —
+// повторная генерация после отклонённого ответа.
+func withCorrection(parts []genai.Part, correction string) []genai.Part {
+	if correction == "" {
+		return parts
+	}
+	return append(parts, genai.Text(types.CorrectionMessage(correction)))
+}
+
+// imageParts готовит изображения запроса как части сообщения: перед каждым
+// изображением многостраничного запроса идёт подпись с номером и ролью.
+func (e *Engine) imageParts(refs []types.ImageRef, model string) ([]genai.Part, util.ImageStats, error) {
+	var (
+		parts []genai.Part
+		total util.ImageStats
+	)
+	for i, ref := range refs {
+		data, mime, st, err := e.decodeImage(ref.Image, model)
+		if err != nil {
+			if len(refs) > 1 {
+				err = fmt.Errorf("images[%d]: %w", i, err)
+			}
+			return nil, total, err
+		}
+		total.BytesIn += st.BytesIn
+		total.BytesOut += st.BytesOut
+		if label := types.ImageLabel(i, len(refs), ref.Role); label != "" {
+			parts = append(parts, genai.Text(label))
+		}
+		parts = append(parts, &genai.Blob{MIMEType: mime, Data: data})
+	}
+	return parts, total, nil
 }
 
 func firstText(resp *genai.GenerateContentResponse) string {
@@ -447,6 +619,10 @@ func ptrFloat32(v float32) *float32 { return &v }
 // ─── PARSE_RU ────────────────────────────────────────────────────────────────
 
 func (e *Engine) ParseRU(ctx context.Context, in types.ParseRURequest) (types.ParseRUResponse, *types.LLMStats, error) {
+	return validation.ParseRU(ctx, e.attempts, in, e.parseRU)
+}
+
+func (e *Engine) parseRU(ctx context.Context, in types.ParseRURequest) (types.ParseRUResponse, *types.LLMStats, error) {
 	if e.apiKey == "" {
 		return types.ParseRUResponse{}, nil, fmt.Errorf("GEMINI_API_KEY not set")
 	}
@@ -456,12 +632,17 @@ func (e *Engine) ParseRU(ctx context.Context, in types.ParseRURequest) (types.Pa
 		return types.ParseRUResponse{}, nil, fmt.Errorf("gemini parse_ru: %w", err)
 	}
 
-	imgBytes, mime, err := decodeImage(in.Image)
+	refs, err := in.AllImages()
+	if err != nil {
+		return types.ParseRUResponse{}, nil, fmt.Errorf("gemini parse_ru: %w", err)
+	}
+	images, img, err := e.imageParts(refs, e.parseModel)
 	if err != nil {
 		return types.ParseRUResponse{}, nil, fmt.Errorf("gemini parse_ru: %w", err)
 	}
 
 	in.Image = ""
+	in.ImageID, in.Images = "", nil
 	inJSON, _ := json.Marshal(in)
 	userPrompt, _ := util.LoadUserPrompt("parse_ru", promptSource, apiVersion, "parse")
 	if strings.TrimSpace(userPrompt) == "" {
@@ -469,19 +650,22 @@ func (e *Engine) ParseRU(ctx context.Context, in types.ParseRURequest) (types.Pa
 	}
 	userText := userPrompt + "\nINPUT_JSON:\n" + string(inJSON)
 
-	parts := []genai.Part{
-		genai.Text(userText),
-		&genai.Blob{MIMEType: mime, Data: imgBytes},
-	}
+	parts := append([]genai.Part{genai.Text(userText)}, images...)
+	parts = withCorrection(parts, in.Correction)
 
 	var out types.ParseRUResponse
 	stats, err := e.call(ctx, e.parseModel, system, schema, 0, parts, &out, "parse_ru")
+	stats.SetImage(img.BytesIn, img.BytesOut)
 	return out, stats, err
 }
 
 // ─── HINT_RU ────────────────────────────────────────────────────────────────
 
 func (e *Engine) HintRU(ctx context.Context, in types.HintRUCompactInput) (types.HintRUResponse, *types.LLMStats, error) {
+	return validation.HintRU(ctx, e.attempts, in, e.hintRU)
+}
+
+func (e *Engine) hintRU(ctx context.Context, in types.HintRUCompactInput) (types.HintRUResponse, *types.LLMStats, error) {
 	if e.apiKey == "" {
 		return types.HintRUResponse{}, nil, fmt.Errorf("GEMINI_API_KEY not set")
 	}
@@ -503,7 +687,7 @@ func (e *Engine) HintRU(ctx context.Context, in types.HintRUCompactInput) (types
 		}
 	}
 
-	parts := []genai.Part{genai.Text(userText)}
+	parts := withCorrection([]genai.Part{genai.Text(userText)}, in.Correction)
 
 	var out types.HintRUResponse
 	stats, err := e.call(ctx, e.parseModel, system, schema, 1, parts, &out, "hint_ru")
@@ -513,6 +697,10 @@ func (e *Engine) HintRU(ctx context.Context, in types.HintRUCompactInput) (types
 // ─── CHECK_RU ────────────────────────────────────────────────────────────────
 
 func (e *Engine) CheckRU(ctx context.Context, in types.CheckRUCompactInput) (types.CheckRUResponse, *types.LLMStats, error) {
+	return validation.CheckRU(ctx, e.attempts, in, e.checkRU)
+}
+
+func (e *Engine) checkRU(ctx context.Context, in types.CheckRUCompactInput) (types.CheckRUResponse, *types.LLMStats, error) {
 	if e.apiKey == "" {
 		return types.CheckRUResponse{}, nil, fmt.Errorf("GEMINI_API_KEY not set")
 	}
@@ -534,7 +722,7 @@ func (e *Engine) CheckRU(ctx context.Context, in types.CheckRUCompactInput) (typ
 		}
 	}
 
-	parts := []genai.Part{genai.Text(userText)}
+	parts := withCorrection([]genai.Part{genai.Text(userText)}, in.Correction)
 
 	var out types.CheckRUResponse
 	stats, err := e.call(ctx, e.parseModel, system, schema, 1, parts, &out, "check_ru")
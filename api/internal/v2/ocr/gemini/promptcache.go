@@ -0,0 +1,168 @@
+package gemini
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"llm-proxy/api/internal/util"
+
+	"github.com/google/generative-ai-go/genai"
+	"google.golang.org/api/googleapi"
+)
+
+const (
+	// minCachedPromptChars — короче этого system instruction не кэшируем:
+	// Gemini отклоняет cachedContents меньше ~1024 токенов.
+	minCachedPromptChars = 4096
+	// promptCacheRetryAfter — сколько не пытаться снова после ошибки создания кэша.
+	promptCacheRetryAfter = 10 * time.Minute
+	// promptCacheRenewBefore — handle, истекающий раньше этого запаса, пересоздаётся,
+	// чтобы он не пропал между выдачей и запросом.
+	promptCacheRenewBefore = time.Minute
+	// promptCacheCreateTimeout — лимит на создание cachedContent: оно идёт вне
+	// контекста запроса.
+	promptCacheCreateTimeout = 30 * time.Second
+)
+
+// createCachedContentFunc создаёт cachedContent и возвращает его имя.
+type createCachedContentFunc func(ctx context.Context, model string, system *genai.Content, ttl time.Duration) (string, error)
+
+// promptCache хранит handles cachedContents для system instruction (промпт + схема).
+// Один handle на пару модель + содержимое; по истечении TTL создаётся новый.
+type promptCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]promptCacheEntry
+	pending map[string]*promptCacheCreate
+}
+
+type promptCacheEntry struct {
+	name    string // cachedContents/{id}; пусто — создание не удалось
+	expires time.Time
+}
+
+// promptCacheCreate — выполняющееся создание handle; name готов после закрытия done.
+type promptCacheCreate struct {
+	done chan struct{}
+	name string
+}
+
+func newPromptCache(ttl time.Duration) *promptCache {
+	return &promptCache{
+		ttl:     ttl,
+		entries: make(map[string]promptCacheEntry),
+		pending: make(map[string]*promptCacheCreate),
+	}
+}
+
+// handle возвращает имя cachedContent для system instruction или "", если кэш
+// недоступен — тогда вызывающий передаёт SystemInstruction в запросе как обычно.
+// Handle одного промпта создаётся один раз: параллельные запросы ждут это
+// создание, запросы с другими промптами не ждут. Создание идёт в своём
+// контексте с собственным таймаутом, поэтому отмена запроса, который его
+// начал, не превращается в ошибку кэша для всех; отменённый запрос просто
+// перестаёт ждать.
+func (c *promptCache) handle(ctx context.Context, model string, system *genai.Content, size int, create createCachedContentFunc) string {
+	if c == nil || size < minCachedPromptChars {
+		return ""
+	}
+	key := promptCacheKey(model, system)
+
+	c.mu.Lock()
+	if e, ok := c.entries[key]; ok && time.Now().Add(promptCacheRenewBefore).Before(e.expires) {
+		c.mu.Unlock()
+		return e.name
+	}
+	p, ok := c.pending[key]
+	if !ok {
+		p = &promptCacheCreate{done: make(chan struct{})}
+		c.pending[key] = p
+		go c.create(context.WithoutCancel(ctx), key, model, system, p, create)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-p.done:
+		return p.name
+	case <-ctx.Done():
+		return ""
+	}
+}
+
+func (c *promptCache) create(ctx context.Context, key, model string, system *genai.Content, p *promptCacheCreate, create createCachedContentFunc) {
+	ctx, cancel := context.WithTimeout(ctx, promptCacheCreateTimeout)
+	defer cancel()
+	start := time.Now()
+	name, err := create(ctx, model, system, c.ttl)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		log.Printf("[gemini] prompt cache create failed model=%s: %v", model, err)
+		c.entries[key] = promptCacheEntry{expires: start.Add(promptCacheRetryAfter)}
+	} else {
+		c.entries[key] = promptCacheEntry{name: name, expires: start.Add(c.ttl)}
+	}
+	p.name = name
+	delete(c.pending, key)
+	close(p.done)
+}
+
+// createCachedContent создаёт cachedContent своим клиентом: клиент запроса
+// закрывается, когда запрос завершится.
+func (e *Engine) createCachedContent(ctx context.Context, model string, system *genai.Content, ttl time.Duration) (string, error) {
+	cl, err := genai.NewClient(ctx, e.clientOptions()...)
+	if err != nil {
+		return "", err
+	}
+	defer cl.Close()
+	cc, err := cl.CreateCachedContent(ctx, &genai.CachedContent{
+		Model:             model,
+		SystemInstruction: system,
+		Expiration:        genai.ExpireTimeOrTTL{TTL: ttl},
+	})
+	if err != nil {
+		return "", err
+	}
+	return cc.Name, nil
+}
+
+// invalidate забывает handle, который провайдер перестал принимать
+// (удалён или истёк раньше локального TTL).
+func (c *promptCache) invalidate(name string) {
+	if c == nil || name == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, e := range c.entries {
+		if e.name == name {
+			delete(c.entries, k)
+		}
+	}
+}
+
+func promptCacheKey(model string, system *genai.Content) string {
+	var b []byte
+	b = append(b, model...)
+	for _, p := range system.Parts {
+		if t, ok := p.(genai.Text); ok {
+			b = append(b, 0)
+			b = append(b, t...)
+		}
+	}
+	return util.SHA256Hex(b)
+}
+
+// isCacheMiss сообщает, что запрос отклонён из-за недействительного cachedContent.
+func isCacheMiss(err error) bool {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code == 403 || apiErr.Code == 404
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package gemini
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+func testSystem(text string) *genai.Content {
+	return &genai.Content{Parts: []genai.Part{genai.Text(strings.Repeat(text, minCachedPromptChars))}}
+}
+
+func TestPromptCacheCreatesOncePerKey(t *testing.T) {
+	c := newPromptCache(time.Hour)
+	release := make(chan struct{})
+	var calls atomic.Int32
+	create := func(ctx context.Context, model string, _ *genai.Content, _ time.Duration) (string, error) {
+		calls.Add(1)
+		if model == "slow" {
+			<-release
+		}
+		return "cachedContents/" + model, nil
+	}
+
+	// Пока создаётся handle одного промпта, другой промпт не ждёт.
+	var wg sync.WaitGroup
+	names := make([]string, 3)
+	for i := range names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			names[i] = c.handle(context.Background(), "slow", testSystem("a"), minCachedPromptChars, create)
+		}()
+	}
+	if got := c.handle(context.Background(), "fast", testSystem("b"), minCachedPromptChars, create); got != "cachedContents/fast" {
+		t.Errorf("handle(fast) = %q while another key is being created", got)
+	}
+	close(release)
+	wg.Wait()
+	for _, n := range names {
+		if n != "cachedContents/slow" {
+			t.Errorf("handle(slow) = %q", n)
+		}
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("create calls = %d, want 2", n)
+	}
+}
+
+func TestPromptCacheCallerCancelDoesNotPoisonKey(t *testing.T) {
+	c := newPromptCache(time.Hour)
+	release := make(chan struct{})
+	create := func(ctx context.Context, _ string, _ *genai.Content, _ time.Duration) (string, error) {
+		select {
+		case <-release:
+			return "cachedContents/1", nil
+		case <-ctx.Done():
+			return "", errors.New("create cancelled")
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan string)
+	go func() { done <- c.handle(ctx, "m", testSystem("a"), minCachedPromptChars, create) }()
+	cancel()
+	if got := <-done; got != "" {
+		t.Errorf("cancelled handle() = %q, want no cache", got)
+	}
+	close(release)
+	if got := c.handle(context.Background(), "m", testSystem("a"), minCachedPromptChars, create); got != "cachedContents/1" {
+		t.Errorf("handle() after cancelled caller = %q, want created handle", got)
+	}
+}
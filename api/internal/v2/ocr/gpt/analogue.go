@@ -11,12 +11,18 @@ import (
 	"time"
 
 	"llm-proxy/api/internal/util"
+	"llm-proxy/api/internal/v2/ocr/jsonrepair"
 	"llm-proxy/api/internal/v2/ocr/types"
+	"llm-proxy/api/internal/v2/ocr/validation"
 )
 
 const ANALOGUE = "analogue"
 
 func (e *Engine) AnalogueSolution(ctx context.Context, in types.AnalogueRequest) (types.AnalogueResponse, *types.LLMStats, error) {
+	return validation.Analogue(ctx, e.attempts, in, e.analogueSolution)
+}
+
+func (e *Engine) analogueSolution(ctx context.Context, in types.AnalogueRequest) (types.AnalogueResponse, *types.LLMStats, error) {
 	if e.apiKey == "" {
 		return types.AnalogueResponse{}, nil, fmt.Errorf("OPENAI_API_KEY is empty")
 	}
@@ -48,21 +54,17 @@ func (e *Engine) AnalogueSolution(ctx context.Context, in types.AnalogueRequest)
 	userJSON, _ := json.Marshal(userObj)
 
 	body := map[string]any{
-		"model": model,
-		"input": []any{
-			map[string]any{
-				"role": "system",
-				"content": []any{
-					map[string]any{"type": "input_text", "text": system},
-				},
-			},
+		"model":            model,
+		"prompt_cache_key": promptCacheKey(ANALOGUE, model, system),
+		"input": withCorrection([]any{
+			systemInput(system),
 			map[string]any{
 				"role": "user",
 				"content": []any{
 					map[string]any{"type": "input_text", "text": string(userJSON)},
 				},
 			},
-		},
+		}, in.Correction),
 		"temperature": 1,
 		"text": map[string]any{
 			"format": map[string]any{
@@ -95,8 +97,7 @@ func (e *Engine) AnalogueSolution(ctx context.Context, in types.AnalogueRequest)
 
 	raw, _ := io.ReadAll(resp.Body)
 	t := time.Since(start).Milliseconds()
-	inTok, outTok := parseUsage(raw)
-	stats := &types.LLMStats{InputTokens: inTok, OutputTokens: outTok, LatencyMs: t, Model: model}
+	stats := responseStats(raw, t, model)
 	out, err := util.ExtractResponsesText(bytes.NewReader(raw))
 	if err != nil || strings.TrimSpace(out) == "" {
 		out = fallbackExtractResponsesText(raw)
@@ -106,7 +107,9 @@ func (e *Engine) AnalogueSolution(ctx context.Context, in types.AnalogueRequest)
 		return types.AnalogueResponse{}, stats, fmt.Errorf("responses: empty output; body=%s", truncateBytes(raw, 1024))
 	}
 	var ar types.AnalogueResponse
-	if err := json.Unmarshal([]byte(out), &ar); err != nil {
+	repair, err := jsonrepair.Decode(ANALOGUE, out, schema, &ar)
+	stats.JSONRepair = repair
+	if err != nil {
 		return types.AnalogueResponse{}, stats, fmt.Errorf("openai analogue: bad JSON: %w", err)
 	}
 
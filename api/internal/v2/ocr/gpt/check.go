@@ -3,7 +3,6 @@ package gpt
 import (
 	"bytes"
 	"context"
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -15,12 +14,18 @@ import (
 	"time"
 
 	"llm-proxy/api/internal/util"
+	"llm-proxy/api/internal/v2/ocr/jsonrepair"
 	"llm-proxy/api/internal/v2/ocr/types"
+	"llm-proxy/api/internal/v2/ocr/validation"
 )
 
 const CHECK = "check"
 
 func (e *Engine) CheckSolution(ctx context.Context, in types.CheckRequest) (types.CheckResponse, *types.LLMStats, error) {
+	return validation.Check(ctx, e.attempts, in, e.checkSolution)
+}
+
+func (e *Engine) checkSolution(ctx context.Context, in types.CheckRequest) (types.CheckResponse, *types.LLMStats, error) {
 	log.Printf("[check] started, image_len=%d, task_text=%q, items_count=%d",
 		len(in.Image), truncateStr(in.RawTaskText, 50), len(in.TaskStruct.Items))
 
@@ -43,8 +48,9 @@ func (e *Engine) CheckSolution(ctx context.Context, in types.CheckRequest) (type
 		system = strings.ReplaceAll(system, "{{GRADE_FEEDBACK_SECTION}}", gradeSection)
 	}
 
-	// Композиция дополнительных блоков промпта
-	system = composeCheckBlocks(system, in.TaskStruct)
+	// Дополнительные блоки промпта идут отдельным блоком после стабильной части,
+	// чтобы префикс system совпадал между запросами и попадал в кэш OpenAI.
+	checkBlocks := composeCheckBlocks(in.TaskStruct)
 
 	schema, err := util.LoadPromptSchema(CHECK, e.Version())
 	if err != nil {
@@ -58,20 +64,16 @@ func (e *Engine) CheckSolution(ctx context.Context, in types.CheckRequest) (type
 	}
 
 	// Decode image from base64 and create data URL for multimodal input
-	imgBytes, mimeFromDataURL, _ := util.DecodeBase64MaybeDataURL(in.Image)
-	if len(imgBytes) == 0 {
-		raw, err := base64.StdEncoding.DecodeString(in.Image)
-		if err != nil {
-			return types.CheckResponse{}, nil, fmt.Errorf("openai check: invalid image base64")
-		}
-		imgBytes = raw
+	refs, err := in.AllImages()
+	if err != nil {
+		return types.CheckResponse{}, nil, fmt.Errorf("openai check: %w", err)
 	}
-	mime := util.PickMIME("", mimeFromDataURL, imgBytes)
-	if !isOpenAIImageMIME(mime) {
-		return types.CheckResponse{}, nil, fmt.Errorf("openai check: unsupported MIME %s (need image/jpeg|png|webp)", mime)
+	images, img, err := e.imageInputs(refs, model)
+	if err != nil {
+		return types.CheckResponse{}, nil, fmt.Errorf("openai check: %w", err)
 	}
-	dataURL := "data:" + mime + ";base64," + base64.StdEncoding.EncodeToString(imgBytes)
 	in.Image = "" // Clear from JSON since sending as separate image block
+	in.ImageID, in.Images = "", nil
 
 	userObj := map[string]any{
 		"task":  user,
@@ -80,23 +82,18 @@ func (e *Engine) CheckSolution(ctx context.Context, in types.CheckRequest) (type
 	userJSON, _ := json.Marshal(userObj)
 
 	body := map[string]any{
-		"model": model,
-		"input": []any{
-			map[string]any{
-				"role": "system",
-				"content": []any{
-					map[string]any{"type": "input_text", "text": system},
-				},
-			},
+		"model":            model,
+		"prompt_cache_key": promptCacheKey(CHECK, model, system),
+		"input": withCorrection([]any{
+			systemInput(system, checkBlocks),
 			map[string]any{
 				"type": "message",
 				"role": "user",
-				"content": []any{
+				"content": append([]any{
 					map[string]any{"type": "input_text", "text": "INPUT_JSON:\n" + string(userJSON)},
-					map[string]any{"type": "input_image", "image_url": dataURL},
-				},
+				}, images...),
 			},
-		},
+		}, in.Correction),
 		"text": map[string]any{
 			"format": map[string]any{
 				"type":   "json_schema",
@@ -138,8 +135,8 @@ func (e *Engine) CheckSolution(ctx context.Context, in types.CheckRequest) (type
 
 	raw, _ := io.ReadAll(resp.Body)
 	t := time.Since(start).Milliseconds()
-	inTok, outTok := parseUsage(raw)
-	stats := &types.LLMStats{InputTokens: inTok, OutputTokens: outTok, LatencyMs: t, Model: model}
+	stats := responseStats(raw, t, model)
+	stats.SetImage(img.BytesIn, img.BytesOut)
 	log.Printf("[check] OpenAI response body_len=%d", len(raw))
 
 	out, err := util.ExtractResponsesText(bytes.NewReader(raw))
@@ -153,7 +150,9 @@ func (e *Engine) CheckSolution(ctx context.Context, in types.CheckRequest) (type
 	}
 
 	var cr types.CheckResponse
-	if err := json.Unmarshal([]byte(out), &cr); err != nil {
+	repair, err := jsonrepair.Decode(CHECK, out, schema, &cr)
+	stats.JSONRepair = repair
+	if err != nil {
 		log.Printf("[check] ERROR: bad JSON from OpenAI: %v, out=%s", err, truncateStr(out, 500))
 		return types.CheckResponse{}, stats, fmt.Errorf("openai check: bad JSON: %w", err)
 	}
@@ -162,11 +161,6 @@ func (e *Engine) CheckSolution(ctx context.Context, in types.CheckRequest) (type
 	cr.NormalizeDecision()
 	// Заполняем IsCorrect из Decision для обратной совместимости с клиентами
 	cr.SetIsCorrectFromDecision()
-	if validationErr := cr.ValidateSemantics(in); validationErr != nil {
-		log.Printf("[check] semantic validation failed: %v", validationErr)
-		cr = types.ConservativeCheckResponse()
-		cr.SetIsCorrectFromDecision()
-	}
 
 	log.Printf("[check] success: status=%s, can_evaluate=%v, decision=%s, is_correct=%v",
 		cr.Status, cr.CanEvaluate, cr.Decision, cr.IsCorrect)
@@ -181,18 +175,7 @@ func truncateStr(s string, maxLen int) string {
 }
 
 func gradeSubdir(grade int) string {
-	switch grade {
-	case 1:
-		return "1_class"
-	case 2:
-		return "2_class"
-	case 3:
-		return "3_class"
-	case 4:
-		return "4_class"
-	default:
-		return ""
-	}
+	return util.GradeSubdir(grade)
 }
 
 func loadCheckFeedbackSection(grade int) (string, error) {
@@ -233,9 +216,11 @@ func loadHintAdvancedBlock(grade int, block string) (string, error) {
 	return strings.TrimSpace(string(data)), nil
 }
 
-// composeCheckBlocks добавляет к базовому промпту условные блоки для проверки ответа.
+// composeCheckBlocks собирает условные блоки промпта для проверки ответа.
+// Возвращает их одной строкой; базовый промпт не меняется — блоки отправляются
+// после него отдельной частью system-сообщения.
 // Загружает: advanced (по task_type), format (по формату), conditional (visual, multiple_subtasks).
-func composeCheckBlocks(system string, taskStruct types.TaskStructCheck) string {
+func composeCheckBlocks(taskStruct types.TaskStructCheck) string {
 	var blocks []string
 
 	if len(taskStruct.Items) > 0 {
@@ -282,10 +267,7 @@ func composeCheckBlocks(system string, taskStruct types.TaskStructCheck) string
 		}
 	}
 
-	if len(blocks) > 0 {
-		system = system + "\n\n" + strings.Join(blocks, "\n\n")
-	}
-	return system
+	return strings.Join(blocks, "\n\n")
 }
 
 // loadCheckBlock загружает промпт-блок по имени из prompt-директории.
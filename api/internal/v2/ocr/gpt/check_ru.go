@@ -13,12 +13,18 @@ import (
 	"time"
 
 	"llm-proxy/api/internal/util"
+	"llm-proxy/api/internal/v2/ocr/jsonrepair"
 	"llm-proxy/api/internal/v2/ocr/types"
+	"llm-proxy/api/internal/v2/ocr/validation"
 )
 
 const CHECK_RU = "check_ru"
 
 func (e *Engine) CheckRU(ctx context.Context, in types.CheckRUCompactInput) (types.CheckRUResponse, *types.LLMStats, error) {
+	return validation.CheckRU(ctx, e.attempts, in, e.checkRU)
+}
+
+func (e *Engine) checkRU(ctx context.Context, in types.CheckRUCompactInput) (types.CheckRUResponse, *types.LLMStats, error) {
 	if e.apiKey == "" {
 		return types.CheckRUResponse{}, nil, fmt.Errorf("OPENAI_API_KEY is empty")
 	}
@@ -60,21 +66,17 @@ func (e *Engine) CheckRU(ctx context.Context, in types.CheckRUCompactInput) (typ
 	userJSON, _ := json.Marshal(userObj)
 
 	body := map[string]any{
-		"model": model,
-		"input": []any{
-			map[string]any{
-				"role": "system",
-				"content": []any{
-					map[string]any{"type": "input_text", "text": system},
-				},
-			},
+		"model":            model,
+		"prompt_cache_key": promptCacheKey(CHECK_RU, model, system),
+		"input": withCorrection([]any{
+			systemInput(system),
 			map[string]any{
 				"role": "user",
 				"content": []any{
 					map[string]any{"type": "input_text", "text": string(userJSON)},
 				},
 			},
-		},
+		}, in.Correction),
 		"temperature": temp,
 		"text": map[string]any{
 			"format": map[string]any{
@@ -107,8 +109,7 @@ func (e *Engine) CheckRU(ctx context.Context, in types.CheckRUCompactInput) (typ
 
 	raw, _ := io.ReadAll(resp.Body)
 	t := time.Since(start).Milliseconds()
-	inTok, outTok := parseUsage(raw)
-	stats := &types.LLMStats{InputTokens: inTok, OutputTokens: outTok, LatencyMs: t, Model: model}
+	stats := responseStats(raw, t, model)
 	out, err := util.ExtractResponsesText(bytes.NewReader(raw))
 	if err != nil || strings.TrimSpace(out) == "" {
 		out = fallbackExtractResponsesText(raw)
@@ -118,7 +119,9 @@ func (e *Engine) CheckRU(ctx context.Context, in types.CheckRUCompactInput) (typ
 		return types.CheckRUResponse{}, stats, fmt.Errorf("responses: empty output; body=%s", truncateBytes(raw, 1024))
 	}
 	var cr types.CheckRUResponse
-	if err := json.Unmarshal([]byte(out), &cr); err != nil {
+	repair, err := jsonrepair.Decode(CHECK_RU, out, schema, &cr)
+	stats.JSONRepair = repair
+	if err != nil {
 		return types.CheckRUResponse{}, stats, fmt.Errorf("openai check_ru: bad JSON: %w", err)
 	}
 	return cr, stats, nil
@@ -3,7 +3,6 @@ package gpt
 import (
 	"bytes"
 	"context"
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -13,12 +12,18 @@ import (
 	"time"
 
 	"llm-proxy/api/internal/util"
+	"llm-proxy/api/internal/v2/ocr/jsonrepair"
 	"llm-proxy/api/internal/v2/ocr/types"
+	"llm-proxy/api/internal/v2/ocr/validation"
 )
 
 const DETECT = "detect"
 
 func (e *Engine) Detect(ctx context.Context, in types.DetectRequest) (types.DetectResponse, *types.LLMStats, error) {
+	return validation.Detect(ctx, e.attempts, in, e.detect)
+}
+
+func (e *Engine) detect(ctx context.Context, in types.DetectRequest) (types.DetectResponse, *types.LLMStats, error) {
 	if e.apiKey == "" {
 		return types.DetectResponse{}, nil, fmt.Errorf("OPENAI_API_KEY not set")
 	}
@@ -29,20 +34,16 @@ func (e *Engine) Detect(ctx context.Context, in types.DetectRequest) (types.Dete
 	}
 
 	// accept raw base64 or data: URL
-	imgBytes, mimeFromDataURL, _ := util.DecodeBase64MaybeDataURL(in.Image)
-	if len(imgBytes) == 0 {
-		raw, err := base64.StdEncoding.DecodeString(in.Image)
-		if err != nil {
-			return types.DetectResponse{}, nil, fmt.Errorf("openai detect: invalid image base64")
-		}
-		imgBytes = raw
+	refs, err := in.AllImages()
+	if err != nil {
+		return types.DetectResponse{}, nil, fmt.Errorf("openai detect: %w", err)
 	}
-	mime := util.PickMIME("", mimeFromDataURL, imgBytes)
-	if !isOpenAIImageMIME(mime) {
-		return types.DetectResponse{}, nil, fmt.Errorf("openai detect: unsupported MIME %s (need image/jpeg|png|webp)", mime)
+	images, img, err := e.imageInputs(refs, model)
+	if err != nil {
+		return types.DetectResponse{}, nil, fmt.Errorf("openai detect: %w", err)
 	}
-	dataURL := "data:" + mime + ";base64," + base64.StdEncoding.EncodeToString(imgBytes)
 	in.Image = ""
+	in.ImageID, in.Images = "", nil
 
 	system, err := util.LoadSystemPrompt(DETECT, e.Name(), e.Version(), "detect")
 	if err != nil {
@@ -67,23 +68,18 @@ func (e *Engine) Detect(ctx context.Context, in types.DetectRequest) (types.Dete
 	userJSON, _ := json.Marshal(userObj)
 
 	body := map[string]any{
-		"model": model,
-		"input": []any{
-			map[string]any{
-				"role": "system",
-				"content": []any{
-					map[string]any{"type": "input_text", "text": system},
-				},
-			},
+		"model":            model,
+		"prompt_cache_key": promptCacheKey(DETECT, model, system),
+		"input": withCorrection([]any{
+			systemInput(system),
 			map[string]any{
 				"type": "message",
 				"role": "user",
-				"content": []any{
+				"content": append([]any{
 					map[string]any{"type": "input_text", "text": "INPUT_JSON:\n" + string(userJSON)},
-					map[string]any{"type": "input_image", "image_url": dataURL},
-				},
+				}, images...),
 			},
-		},
+		}, in.Correction),
 		"temperature": 0,
 		"text": map[string]any{
 			"format": map[string]any{
@@ -120,8 +116,8 @@ func (e *Engine) Detect(ctx context.Context, in types.DetectRequest) (types.Dete
 	raw, _ := io.ReadAll(resp.Body)
 
 	// Извлекаем реальные токены из ответа OpenAI
-	inTok, outTok := parseUsage(raw)
-	stats := &types.LLMStats{InputTokens: inTok, OutputTokens: outTok, LatencyMs: t, Model: model}
+	stats := responseStats(raw, t, model)
+	stats.SetImage(img.BytesIn, img.BytesOut)
 
 	out, err := util.ExtractResponsesText(bytes.NewReader(raw))
 	if err != nil || strings.TrimSpace(out) == "" {
@@ -132,7 +128,9 @@ func (e *Engine) Detect(ctx context.Context, in types.DetectRequest) (types.Dete
 		return types.DetectResponse{}, stats, fmt.Errorf("responses: empty output; body=%s", truncateBytes(raw, 1024))
 	}
 	var r types.DetectResponse
-	if err := json.Unmarshal([]byte(out), &r); err != nil {
+	repair, err := jsonrepair.Decode(DETECT, out, schema, &r)
+	stats.JSONRepair = repair
+	if err != nil {
 		return types.DetectResponse{}, stats, fmt.Errorf("openai detect: bad JSON: %w", err)
 	}
 	return r, stats, nil
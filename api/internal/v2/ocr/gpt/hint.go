@@ -12,12 +12,18 @@ import (
 	"time"
 
 	"llm-proxy/api/internal/util"
+	"llm-proxy/api/internal/v2/ocr/jsonrepair"
 	"llm-proxy/api/internal/v2/ocr/types"
+	"llm-proxy/api/internal/v2/ocr/validation"
 )
 
 const HINT = "hint"
 
 func (e *Engine) Hint(ctx context.Context, in types.HintRequest) (types.HintResponse, *types.LLMStats, error) {
+	return validation.Hint(ctx, e.attempts, in, e.hint)
+}
+
+func (e *Engine) hint(ctx context.Context, in types.HintRequest) (types.HintResponse, *types.LLMStats, error) {
 	if e.apiKey == "" {
 		return types.HintResponse{}, nil, fmt.Errorf("OPENAI_API_KEY is empty")
 	}
@@ -40,11 +46,14 @@ func (e *Engine) Hint(ctx context.Context, in types.HintRequest) (types.HintResp
 	if err != nil {
 		return types.HintResponse{}, nil, err
 	}
+	// Advanced-блок по типу задачи отправляется отдельной частью system-сообщения,
+	// чтобы общий префикс промпта оставался кэшируемым.
+	var advanced string
 	if len(in.Items) > 0 {
 		in.Items[0].PedKeys.TaskType = types.NormalizeTaskType(in.Items[0].PedKeys.TaskType)
 		if block := types.HintAdvancedPromptBlock(in.Items[0].PedKeys.TaskType); block != "" {
-			if advanced, loadErr := loadHintAdvancedBlock(in.Task.Grade, block); loadErr == nil {
-				system += "\n\n" + advanced
+			if b, loadErr := loadHintAdvancedBlock(in.Task.Grade, block); loadErr == nil {
+				advanced = b
 			} else {
 				log.Printf("[hint] advanced block %q not loaded: %v", block, loadErr)
 			}
@@ -82,21 +91,17 @@ func (e *Engine) Hint(ctx context.Context, in types.HintRequest) (types.HintResp
 	userJSON, _ := json.Marshal(userObj)
 
 	body := map[string]any{
-		"model": model,
-		"input": []any{
-			map[string]any{
-				"role": "system",
-				"content": []any{
-					map[string]any{"type": "input_text", "text": system},
-				},
-			},
+		"model":            model,
+		"prompt_cache_key": promptCacheKey(HINT, model, system),
+		"input": withCorrection([]any{
+			systemInput(system, advanced),
 			map[string]any{
 				"role": "user",
 				"content": []any{
 					map[string]any{"type": "input_text", "text": string(userJSON)},
 				},
 			},
-		},
+		}, in.Correction),
 		"temperature": temp,
 		"text": map[string]any{
 			"format": map[string]any{
@@ -130,8 +135,7 @@ func (e *Engine) Hint(ctx context.Context, in types.HintRequest) (types.HintResp
 
 	raw, _ := io.ReadAll(resp.Body)
 	t := time.Since(start).Milliseconds()
-	inTok, outTok := parseUsage(raw)
-	stats := &types.LLMStats{InputTokens: inTok, OutputTokens: outTok, LatencyMs: t, Model: model}
+	stats := responseStats(raw, t, model)
 	out, err := util.ExtractResponsesText(bytes.NewReader(raw))
 	if err != nil || strings.TrimSpace(out) == "" {
 		out = fallbackExtractResponsesText(raw)
@@ -141,11 +145,10 @@ func (e *Engine) Hint(ctx context.Context, in types.HintRequest) (types.HintResp
 		return types.HintResponse{}, stats, fmt.Errorf("responses: empty output; body=%s", truncateBytes(raw, 1024))
 	}
 	var hr types.HintResponse
-	if err := json.Unmarshal([]byte(out), &hr); err != nil {
+	repair, err := jsonrepair.Decode(HINT, out, schema, &hr)
+	stats.JSONRepair = repair
+	if err != nil {
 		return types.HintResponse{}, stats, fmt.Errorf("openai hint: bad JSON: %w", err)
 	}
-	if err := hr.ValidateAgainstRequest(in); err != nil {
-		return types.HintResponse{}, stats, fmt.Errorf("openai hint: semantic validation: %w", err)
-	}
 	return hr, stats, nil
 }
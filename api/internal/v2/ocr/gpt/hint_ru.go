@@ -11,12 +11,18 @@ import (
 	"time"
 
 	"llm-proxy/api/internal/util"
+	"llm-proxy/api/internal/v2/ocr/jsonrepair"
 	"llm-proxy/api/internal/v2/ocr/types"
+	"llm-proxy/api/internal/v2/ocr/validation"
 )
 
 const HINT_RU = "hint_ru"
 
 func (e *Engine) HintRU(ctx context.Context, in types.HintRUCompactInput) (types.HintRUResponse, *types.LLMStats, error) {
+	return validation.HintRU(ctx, e.attempts, in, e.hintRU)
+}
+
+func (e *Engine) hintRU(ctx context.Context, in types.HintRUCompactInput) (types.HintRUResponse, *types.LLMStats, error) {
 	if e.apiKey == "" {
 		return types.HintRUResponse{}, nil, fmt.Errorf("OPENAI_API_KEY is empty")
 	}
@@ -50,21 +56,17 @@ func (e *Engine) HintRU(ctx context.Context, in types.HintRUCompactInput) (types
 	userJSON, _ := json.Marshal(userObj)
 
 	body := map[string]any{
-		"model": model,
-		"input": []any{
-			map[string]any{
-				"role": "system",
-				"content": []any{
-					map[string]any{"type": "input_text", "text": system},
-				},
-			},
+		"model":            model,
+		"prompt_cache_key": promptCacheKey(HINT_RU, model, system),
+		"input": withCorrection([]any{
+			systemInput(system),
 			map[string]any{
 				"role": "user",
 				"content": []any{
 					map[string]any{"type": "input_text", "text": string(userJSON)},
 				},
 			},
-		},
+		}, in.Correction),
 		"temperature": temp,
 		"text": map[string]any{
 			"format": map[string]any{
@@ -97,8 +99,7 @@ func (e *Engine) HintRU(ctx context.Context, in types.HintRUCompactInput) (types
 
 	raw, _ := io.ReadAll(resp.Body)
 	t := time.Since(start).Milliseconds()
-	inTok, outTok := parseUsage(raw)
-	stats := &types.LLMStats{InputTokens: inTok, OutputTokens: outTok, LatencyMs: t, Model: model}
+	stats := responseStats(raw, t, model)
 	out, err := util.ExtractResponsesText(bytes.NewReader(raw))
 	if err != nil || strings.TrimSpace(out) == "" {
 		out = fallbackExtractResponsesText(raw)
@@ -108,7 +109,9 @@ func (e *Engine) HintRU(ctx context.Context, in types.HintRUCompactInput) (types
 		return types.HintRUResponse{}, stats, fmt.Errorf("responses: empty output; body=%s", truncateBytes(raw, 1024))
 	}
 	var hr types.HintRUResponse
-	if err := json.Unmarshal([]byte(out), &hr); err != nil {
+	repair, err := jsonrepair.Decode(HINT_RU, out, schema, &hr)
+	stats.JSONRepair = repair
+	if err != nil {
 		return types.HintRUResponse{}, stats, fmt.Errorf("openai hint_ru: bad JSON: %w", err)
 	}
 	return hr, stats, nil
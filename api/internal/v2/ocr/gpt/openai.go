@@ -1,13 +1,17 @@
 package gpt
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"net"
 	"net/http"
 	"strings"
 	"time"
 
 	"llm-proxy/api/internal/util"
+	"llm-proxy/api/internal/v2/ocr/types"
+	"llm-proxy/api/internal/v2/pricing"
 	"llm-proxy/api/internal/v2/tmplrouter"
 )
 
@@ -16,6 +20,8 @@ type Engine struct {
 	Model      string
 	httpc      *http.Client
 	tmplRouter *tmplrouter.Router
+	images     *util.ImagePipeline // nil — изображение отправляется как есть
+	attempts   int                 // вызовов модели на шаг при semantic validation; 0 — validation.DefaultAttempts
 }
 
 // SetTemplateRouter injects the pedagogical template router.
@@ -57,10 +63,93 @@ func (e *Engine) WithHTTPClient(c *http.Client) *Engine {
 	return e
 }
 
+// WithImagePipeline включает предобработку изображений перед отправкой в OpenAI.
+func (e *Engine) WithImagePipeline(p *util.ImagePipeline) *Engine {
+	e.images = p
+	return e
+}
+
+// WithValidationAttempts задаёт число вызовов модели на шаг, пока ответ не
+// пройдёт semantic validation: 1 — без повторов.
+func (e *Engine) WithValidationAttempts(n int) *Engine {
+	e.attempts = n
+	return e
+}
+
+// imageFormats — форматы изображений, которые принимает Responses API;
+// остальные (HEIC, AVIF, GIF) перекодируются в JPEG.
+var imageFormats = util.ImageFormats{"image/jpeg", "image/png", "image/webp"}
+
+// imageDataURL декодирует изображение запроса (base64 или data URL), прогоняет
+// через предобработку для модели и возвращает data URL для input_image.
+func (e *Engine) imageDataURL(image, model string) (string, util.ImageStats, error) {
+	imgBytes, mimeFromDataURL, _ := util.DecodeBase64MaybeDataURL(image)
+	if len(imgBytes) == 0 {
+		raw, err := base64.StdEncoding.DecodeString(image)
+		if err != nil {
+			return "", util.ImageStats{}, fmt.Errorf("invalid image base64")
+		}
+		imgBytes = raw
+	}
+	mime := util.PickMIME("", mimeFromDataURL, imgBytes)
+	imgBytes, mime, st, err := e.images.Prepare(model, imgBytes, mime, imageFormats)
+	if err != nil {
+		return "", st, err
+	}
+	if !imageFormats.Accepts(mime) {
+		return "", st, fmt.Errorf("unsupported MIME %s (need image/jpeg|png|webp)", mime)
+	}
+	return "data:" + mime + ";base64," + base64.StdEncoding.EncodeToString(imgBytes), st, nil
+}
+
+// imageInputs готовит изображения запроса как элементы content: перед каждым
+// изображением многостраничного запроса идёт подпись с номером и ролью.
+// Размеры в статистике суммируются по всем изображениям.
+func (e *Engine) imageInputs(refs []types.ImageRef, model string) ([]any, util.ImageStats, error) {
+	var (
+		items []any
+		total util.ImageStats
+	)
+	for i, ref := range refs {
+		dataURL, st, err := e.imageDataURL(ref.Image, model)
+		if err != nil {
+			if len(refs) > 1 {
+				err = fmt.Errorf("images[%d]: %w", i, err)
+			}
+			return nil, total, err
+		}
+		total.BytesIn += st.BytesIn
+		total.BytesOut += st.BytesOut
+		if label := types.ImageLabel(i, len(refs), ref.Role); label != "" {
+			items = append(items, map[string]any{"type": "input_text", "text": label})
+		}
+		items = append(items, map[string]any{"type": "input_image", "image_url": dataURL})
+	}
+	return items, total, nil
+}
+
 func (e *Engine) Name() string     { return "gpt" }
 func (e *Engine) Version() string  { return "v2" }
 func (e *Engine) GetModel() string { return e.Model }
 
+// CacheFingerprint возвращает модель и хеш промпта шага для ключа кэша ответов.
+func (e *Engine) CacheFingerprint(step string) (model, hash string) {
+	model = e.GetModel()
+	if model == "" {
+		model = "gpt-4.1-mini"
+	}
+	system, err := util.LoadSystemPrompt(step, e.Name(), e.Version(), step)
+	if err != nil {
+		return model, ""
+	}
+	schema, err := util.LoadPromptSchema(step, e.Version())
+	if err != nil {
+		return model, ""
+	}
+	schemaJSON, _ := json.Marshal(schema)
+	return model, util.SHA256Hex([]byte(system + "\x00" + string(schemaJSON)))[:16]
+}
+
 // fallbackExtractResponsesText extracts model text from the Responses API envelope
 // per https://platform.openai.com/docs/api-reference/responses/object.
 // It prefers `output_text`, and otherwise concatenates any text segments
@@ -119,11 +208,51 @@ func truncateBytes(b []byte, n int) string {
 	return string(b)
 }
 
-func isOpenAIImageMIME(m string) bool {
-	m = strings.ToLower(strings.TrimSpace(m))
-	switch m {
-	case "image/jpeg", "image/jpg", "image/png", "image/webp":
-		return true
+// responseStats собирает метрики вызова из raw-тела ответа Responses API:
+// токены, закэшированную часть промпта и стоимость по прайс-листу.
+func responseStats(raw []byte, latencyMs int64, model string) *types.LLMStats {
+	inTok, outTok := parseUsage(raw)
+	cached := util.ExtractResponsesCachedTokens(raw)
+	return &types.LLMStats{
+		InputTokens:  inTok,
+		OutputTokens: outTok,
+		CachedTokens: cached,
+		LatencyMs:    latencyMs,
+		Model:        model,
+		CostUSD:      pricing.Cost(model, inTok, cached, outTok),
 	}
-	return false
+}
+
+// promptCacheKey возвращает prompt_cache_key для Responses API. OpenAI направляет
+// запросы с одинаковым ключом на одни и те же серверы, и общий префикс промпта
+// читается из кэша. Ключ зависит только от шага, модели и стабильной части system.
+func promptCacheKey(op, model, system string) string {
+	return op + "-" + util.SHA256Hex([]byte(model + "\x00" + system))[:16]
+}
+
+// systemInput собирает system-сообщение: стабильный промпт первым блоком,
+// динамические блоки (по типу задачи) — следующими. Кэш OpenAI работает по
+// префиксу, поэтому всё, что меняется от запроса к запросу, идёт в конце.
+func systemInput(system string, dynamic ...string) map[string]any {
+	content := []any{map[string]any{"type": "input_text", "text": system}}
+	for _, d := range dynamic {
+		if strings.TrimSpace(d) != "" {
+			content = append(content, map[string]any{"type": "input_text", "text": d})
+		}
+	}
+	return map[string]any{"role": "system", "content": content}
+}
+
+// withCorrection добавляет к input сообщение CORRECTION_REQUIRED, если
+// запрос — повторная генерация после отклонённого ответа.
+func withCorrection(input []any, correction string) []any {
+	if correction == "" {
+		return input
+	}
+	return append(input, map[string]any{
+		"role": "user",
+		"content": []any{
+			map[string]any{"type": "input_text", "text": types.CorrectionMessage(correction)},
+		},
+	})
 }
@@ -0,0 +1,85 @@
+package gpt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/png"
+	"math"
+	"strings"
+	"testing"
+
+	"llm-proxy/api/internal/util"
+)
+
+func TestResponseStats_CachedTokens(t *testing.T) {
+	raw := []byte(`{"usage":{"input_tokens":10000,"output_tokens":1000,"input_tokens_details":{"cached_tokens":6000}}}`)
+	stats := responseStats(raw, 42, "gpt-4.1-mini")
+	if stats.InputTokens != 10000 || stats.OutputTokens != 1000 || stats.CachedTokens != 6000 {
+		t.Fatalf("stats = %+v", stats)
+	}
+	if stats.Model != "gpt-4.1-mini" || stats.LatencyMs != 42 {
+		t.Errorf("stats = %+v", stats)
+	}
+	want := (4000*0.40 + 6000*0.10 + 1000*1.60) / 1e6
+	if math.Abs(stats.CostUSD-want) > 1e-12 {
+		t.Errorf("CostUSD = %v, want %v", stats.CostUSD, want)
+	}
+}
+
+func TestSystemInput_StablePrefixFirst(t *testing.T) {
+	msg := systemInput("STABLE", "", "BLOCKS")
+	content := msg["content"].([]any)
+	if len(content) != 2 {
+		t.Fatalf("content = %v, want stable part and one dynamic part", content)
+	}
+	if got := content[0].(map[string]any)["text"]; got != "STABLE" {
+		t.Errorf("first part = %v, want STABLE", got)
+	}
+	if got := content[1].(map[string]any)["text"]; got != "BLOCKS" {
+		t.Errorf("second part = %v, want BLOCKS", got)
+	}
+}
+
+func TestPromptCacheKey_DependsOnlyOnStablePart(t *testing.T) {
+	a := promptCacheKey(CHECK, "gpt-4.1-mini", "STABLE")
+	if a != promptCacheKey(CHECK, "gpt-4.1-mini", "STABLE") {
+		t.Error("key is not deterministic")
+	}
+	if a == promptCacheKey(CHECK, "gpt-4.1-mini", "OTHER") || a == promptCacheKey(CHECK, "gpt-4.1", "STABLE") {
+		t.Error("key must change with prompt and model")
+	}
+}
+
+func TestImageDataURL_Preprocessing(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 300, 150))); err != nil {
+		t.Fatal(err)
+	}
+	b64 := base64.StdEncoding.EncodeToString(buf.Bytes())
+
+	e := New("key", "gpt-4.1-mini").WithImagePipeline(&util.ImagePipeline{
+		Options:       util.ImageOptions{MaxDim: 2048},
+		MaxDimByModel: map[string]int{"gpt-4.1-mini": 100},
+	})
+	url, st, err := e.imageDataURL("data:image/png;base64,"+b64, "gpt-4.1-mini")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(url, "data:image/jpeg;base64,") || st.Width != 100 || st.Height != 50 {
+		t.Errorf("url prefix = %.30s, stats = %+v", url, st)
+	}
+	if st.BytesIn != buf.Len() || st.BytesOut == 0 {
+		t.Errorf("stats = %+v", st)
+	}
+
+	// Без пайплайна изображение уходит как есть.
+	url, st, err = New("key", "gpt-4.1-mini").imageDataURL(b64, "gpt-4.1-mini")
+	if err != nil || url != "data:image/png;base64,"+b64 || st.BytesIn != st.BytesOut {
+		t.Errorf("passthrough: err=%v stats=%+v", err, st)
+	}
+
+	if _, _, err := e.imageDataURL("%%%", "gpt-4.1-mini"); err == nil {
+		t.Error("want error for invalid base64")
+	}
+}
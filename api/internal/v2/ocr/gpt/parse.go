@@ -3,7 +3,6 @@ package gpt
 import (
 	"bytes"
 	"context"
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -12,12 +11,18 @@ import (
 	"time"
 
 	"llm-proxy/api/internal/util"
+	"llm-proxy/api/internal/v2/ocr/jsonrepair"
 	"llm-proxy/api/internal/v2/ocr/types"
+	"llm-proxy/api/internal/v2/ocr/validation"
 )
 
 const PARSE = "parse"
 
 func (e *Engine) Parse(ctx context.Context, in types.ParseRequest) (types.ParseResponse, *types.LLMStats, error) {
+	return validation.Parse(ctx, e.attempts, in, e.parse)
+}
+
+func (e *Engine) parse(ctx context.Context, in types.ParseRequest) (types.ParseResponse, *types.LLMStats, error) {
 	if e.apiKey == "" {
 		return types.ParseResponse{}, nil, fmt.Errorf("OPENAI_API_KEY is empty")
 	}
@@ -43,20 +48,16 @@ func (e *Engine) Parse(ctx context.Context, in types.ParseRequest) (types.ParseR
 	}
 
 	// accept raw base64 or data: URL
-	imgBytes, mimeFromDataURL, _ := util.DecodeBase64MaybeDataURL(in.Image)
-	if len(imgBytes) == 0 {
-		raw, err := base64.StdEncoding.DecodeString(in.Image)
-		if err != nil {
-			return types.ParseResponse{}, nil, fmt.Errorf("openai parse: invalid image base64")
-		}
-		imgBytes = raw
+	refs, err := in.AllImages()
+	if err != nil {
+		return types.ParseResponse{}, nil, fmt.Errorf("openai parse: %w", err)
 	}
-	mime := util.PickMIME("", mimeFromDataURL, imgBytes)
-	if !isOpenAIImageMIME(mime) {
-		return types.ParseResponse{}, nil, fmt.Errorf("openai parse: unsupported MIME %s (need image/jpeg|png|webp)", mime)
+	images, img, err := e.imageInputs(refs, model)
+	if err != nil {
+		return types.ParseResponse{}, nil, fmt.Errorf("openai parse: %w", err)
 	}
-	dataURL := "data:" + mime + ";base64," + base64.StdEncoding.EncodeToString(imgBytes)
 	in.Image = ""
+	in.ImageID, in.Images = "", nil
 
 	userObj := map[string]any{
 		"task": user,
@@ -65,22 +66,17 @@ func (e *Engine) Parse(ctx context.Context, in types.ParseRequest) (types.ParseR
 	userJSON, _ := json.Marshal(userObj)
 
 	body := map[string]any{
-		"model": model,
-		"input": []any{
-			map[string]any{
-				"role": "system",
-				"content": []any{
-					map[string]any{"type": "input_text", "text": system},
-				},
-			},
+		"model":            model,
+		"prompt_cache_key": promptCacheKey(PARSE, model, system),
+		"input": withCorrection([]any{
+			systemInput(system),
 			map[string]any{
 				"role": "user",
-				"content": []any{
+				"content": append([]any{
 					map[string]any{"type": "input_text", "text": "INPUT_JSON:\n" + string(userJSON)},
-					map[string]any{"type": "input_image", "image_url": dataURL},
-				},
+				}, images...),
 			},
-		},
+		}, in.Correction),
 		"temperature": 0.1,
 		"text": map[string]any{
 			"format": map[string]any{
@@ -113,8 +109,8 @@ func (e *Engine) Parse(ctx context.Context, in types.ParseRequest) (types.ParseR
 
 	raw, _ := io.ReadAll(resp.Body)
 	t := time.Since(start).Milliseconds()
-	inTok, outTok := parseUsage(raw)
-	stats := &types.LLMStats{InputTokens: inTok, OutputTokens: outTok, LatencyMs: t, Model: model}
+	stats := responseStats(raw, t, model)
+	stats.SetImage(img.BytesIn, img.BytesOut)
 	out, err := util.ExtractResponsesText(bytes.NewReader(raw))
 	if err != nil || strings.TrimSpace(out) == "" {
 		out = fallbackExtractResponsesText(raw)
@@ -124,10 +120,10 @@ func (e *Engine) Parse(ctx context.Context, in types.ParseRequest) (types.ParseR
 		return types.ParseResponse{}, stats, fmt.Errorf("responses: empty output; body=%s", truncateBytes(raw, 1024))
 	}
 	var pr types.ParseResponse
-	if err := json.Unmarshal([]byte(out), &pr); err != nil {
+	repair, err := jsonrepair.Decode(PARSE, out, schema, &pr)
+	stats.JSONRepair = repair
+	if err != nil {
 		return types.ParseResponse{}, stats, fmt.Errorf("openai parse: bad JSON: %w", err)
 	}
-	// P0.1: Validate final_answer ↔ solution_steps consistency
-	pr.ValidateItems()
 	return pr, stats, nil
 }
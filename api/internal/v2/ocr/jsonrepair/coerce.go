@@ -0,0 +1,223 @@
+package jsonrepair
+
+import (
+	"encoding/json"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// coerce приводит значение к типу по схеме: объект вместо массива, массив
+// из одного объекта вместо объекта, скаляр вместо массива, число или
+// объект вместо строки, строка вместо числа или булева. Значение, которое
+// привести нельзя, остаётся как есть — ошибку покажет разбор в структуру.
+func coerce(v any, schema map[string]any, fx *fixes) any {
+	if branch := pickBranch(v, schema); branch != nil {
+		return coerce(v, branch, fx)
+	}
+	types := schemaTypes(schema)
+	if len(types) > 0 && !matches(v, types) {
+		v = convert(v, types, schema, fx)
+	}
+	switch node := v.(type) {
+	case map[string]any:
+		props, _ := schema["properties"].(map[string]any)
+		for k, val := range node {
+			if ps, ok := props[k].(map[string]any); ok {
+				node[k] = coerce(val, ps, fx)
+			}
+		}
+	case []any:
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, elem := range node {
+				node[i] = coerce(elem, items, fx)
+			}
+		}
+	}
+	return v
+}
+
+// pickBranch выбирает ветку anyOf/oneOf (в них FixJSONSchemaStrict
+// превращает nullable-типы): подходящую по типу значения, иначе первую
+// не-null ветку.
+func pickBranch(v any, schema map[string]any) map[string]any {
+	branches, _ := schema["anyOf"].([]any)
+	if len(branches) == 0 {
+		branches, _ = schema["oneOf"].([]any)
+	}
+	var fallback map[string]any
+	for _, b := range branches {
+		branch, ok := b.(map[string]any)
+		if !ok {
+			continue
+		}
+		types := schemaTypes(branch)
+		if matches(v, types) {
+			return branch
+		}
+		if fallback == nil && !slices.Equal(types, []string{"null"}) {
+			fallback = branch
+		}
+	}
+	return fallback
+}
+
+// schemaTypes — допустимые типы узла схемы: "type" строкой или списком.
+func schemaTypes(schema map[string]any) []string {
+	switch t := schema["type"].(type) {
+	case string:
+		return []string{t}
+	case []any:
+		types := make([]string, 0, len(t))
+		for _, x := range t {
+			if s, ok := x.(string); ok {
+				types = append(types, s)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+func hasType(types []string, t string) bool { return slices.Contains(types, t) }
+
+func matches(v any, types []string) bool {
+	switch x := v.(type) {
+	case nil:
+		return hasType(types, "null")
+	case bool:
+		return hasType(types, "boolean")
+	case string:
+		return hasType(types, "string")
+	case json.Number:
+		if hasType(types, "number") {
+			return true
+		}
+		_, err := x.Int64()
+		return err == nil && hasType(types, "integer")
+	case []any:
+		return hasType(types, "array")
+	case map[string]any:
+		return hasType(types, "object")
+	}
+	return false
+}
+
+// convert приводит значение к первому допустимому типу, в который оно
+// переводится без потери смысла.
+func convert(v any, types []string, schema map[string]any, fx *fixes) any {
+	for _, t := range types {
+		var (
+			out any
+			ok  bool
+		)
+		switch t {
+		case "array":
+			out, ok = toArray(v, schema)
+		case "object":
+			out, ok = toObject(v)
+		case "string":
+			out, ok = toString(v)
+		case "number", "integer":
+			out, ok = toNumber(v, t == "integer")
+		case "boolean":
+			out, ok = toBoolean(v)
+		}
+		if ok {
+			fx.add("coerce_" + t)
+			return out
+		}
+	}
+	return v
+}
+
+// toArray: пустой объект и null — пустой массив; объект — массив из него,
+// если элементы массива объекты, иначе пустой массив; скаляр — массив из
+// одного элемента.
+func toArray(v any, schema map[string]any) (any, bool) {
+	switch x := v.(type) {
+	case nil:
+		return []any{}, true
+	case map[string]any:
+		items, _ := schema["items"].(map[string]any)
+		if len(x) == 0 || !matches(x, schemaTypes(items)) {
+			return []any{}, true
+		}
+		return []any{x}, true
+	}
+	return []any{v}, true
+}
+
+// toObject: массив из одного объекта — сам объект, пустой массив — пустой
+// объект, строка с JSON-объектом — разобранный объект.
+func toObject(v any) (any, bool) {
+	switch x := v.(type) {
+	case []any:
+		if len(x) == 0 {
+			return map[string]any{}, true
+		}
+		if len(x) == 1 {
+			if m, ok := x[0].(map[string]any); ok {
+				return m, true
+			}
+		}
+	case string:
+		if doc, err := unmarshal([]byte(strings.TrimSpace(x))); err == nil {
+			if m, ok := doc.(map[string]any); ok {
+				return m, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// toString: число и булево — их запись, объект и массив — JSON-строка.
+func toString(v any) (any, bool) {
+	switch x := v.(type) {
+	case json.Number:
+		return x.String(), true
+	case bool:
+		return strconv.FormatBool(x), true
+	case map[string]any, []any:
+		b, err := json.Marshal(x)
+		return string(b), err == nil
+	}
+	return nil, false
+}
+
+// toNumber: строка с числом, в том числе с десятичной запятой.
+func toNumber(v any, integer bool) (any, bool) {
+	s, ok := v.(string)
+	if !ok {
+		return nil, false
+	}
+	s = strings.TrimSpace(s)
+	if strings.Count(s, ",") == 1 && !strings.Contains(s, ".") {
+		s = strings.Replace(s, ",", ".", 1)
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, false
+	}
+	if integer {
+		if f != float64(int64(f)) {
+			return nil, false
+		}
+		return json.Number(strconv.FormatInt(int64(f), 10)), true
+	}
+	return json.Number(strconv.FormatFloat(f, 'f', -1, 64)), true
+}
+
+func toBoolean(v any) (any, bool) {
+	s, ok := v.(string)
+	if !ok {
+		return nil, false
+	}
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "true":
+		return true, true
+	case "false":
+		return false, true
+	}
+	return nil, false
+}
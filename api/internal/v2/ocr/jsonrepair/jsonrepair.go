@@ -0,0 +1,133 @@
+// Package jsonrepair — общий разбор JSON-ответа модели для всех движков v2.
+// Ответ, который не разбирается как есть, ремонтируется: из текста
+// извлекается первое JSON-значение (проза и markdown вокруг отбрасываются),
+// исправляются частые синтаксические ошибки (комментарии, одинарные кавычки,
+// висячие и пропущенные запятые, ключи без кавычек, Python-литералы), а
+// оборванный ответ закрывается без незавершённого поля. Затем значения
+// приводятся к JSON Schema шага: объект вместо массива, число строкой и т. п.
+// Если ремонт не помог, возвращается ошибка ErrMalformed — по ней цикл
+// validation повторяет вызов с требованием исправить ответ.
+package jsonrepair
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"llm-proxy/api/internal/metrics"
+)
+
+// Итоги разбора для stats.JSONRepair и метрики.
+const (
+	ResultClean    = "clean"    // ответ разобран как есть
+	ResultRepaired = "repaired" // понадобился ремонт синтаксиса или типов
+	ResultFailed   = "failed"   // ответ не удалось разобрать
+)
+
+// ErrMalformed — ответ модели не разбирается даже после ремонта.
+var ErrMalformed = errors.New("malformed JSON")
+
+var (
+	decoded = metrics.NewCounter(
+		"llm_proxy_json_repair_total",
+		"JSON decoding of v2 model output by step and result.",
+		"step", "result",
+	)
+	fixed = metrics.NewCounter(
+		"llm_proxy_json_repair_fixes_total",
+		"JSON repairs applied to v2 model output by step and kind.",
+		"step", "fix",
+	)
+)
+
+// Decode разбирает ответ модели шага step в dst, при необходимости
+// ремонтируя его. schema — JSON Schema шага; nil — без приведения типов.
+// Возвращает итог разбора (ResultClean | ResultRepaired | ResultFailed);
+// ошибка оборачивает ErrMalformed.
+func Decode(step, text string, schema map[string]any, dst any) (string, error) {
+	fixes, err := decode(text, schema, dst)
+	for _, f := range fixes {
+		fixed.Inc(step, f)
+	}
+	result := ResultClean
+	switch {
+	case err != nil:
+		result = ResultFailed
+		log.Printf("[jsonrepair] %s: %v", step, err)
+	case len(fixes) > 0:
+		result = ResultRepaired
+		log.Printf("[jsonrepair] %s: repaired %s", step, strings.Join(fixes, ","))
+	}
+	decoded.Inc(step, result)
+	return result, err
+}
+
+func decode(text string, schema map[string]any, dst any) ([]string, error) {
+	var fx fixes
+	raw := []byte(strings.TrimSpace(text))
+	doc, err := unmarshal(raw)
+	if err != nil {
+		repaired := repair(string(raw), rootOpeners(schema), &fx)
+		if doc, err = unmarshal([]byte(repaired)); err != nil {
+			return fx.list(), fmt.Errorf("%w: %v", ErrMalformed, err)
+		}
+		raw = []byte(repaired)
+	}
+	if schema != nil {
+		doc = coerce(doc, schema, &fx)
+	}
+	if len(fx) > 0 {
+		if raw, err = json.Marshal(doc); err != nil {
+			return fx.list(), fmt.Errorf("%w: %v", ErrMalformed, err)
+		}
+	}
+	if err := json.Unmarshal(raw, dst); err != nil {
+		return fx.list(), fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	return fx.list(), nil
+}
+
+// unmarshal разбирает ровно одно JSON-значение; числа сохраняются как
+// json.Number, чтобы повторная сериализация не меняла их запись.
+func unmarshal(raw []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, errors.New("unexpected data after top-level value")
+	}
+	return doc, nil
+}
+
+// rootOpeners — с каких скобок может начинаться ответ по схеме шага.
+func rootOpeners(schema map[string]any) string {
+	switch types := schemaTypes(schema); {
+	case len(types) == 0:
+		return "{["
+	case hasType(types, "object") && !hasType(types, "array"):
+		return "{"
+	case hasType(types, "array") && !hasType(types, "object"):
+		return "["
+	}
+	return "{["
+}
+
+// fixes — применённые виды ремонта без повторов, в порядке появления.
+type fixes []string
+
+func (f *fixes) add(kind string) {
+	for _, k := range *f {
+		if k == kind {
+			return
+		}
+	}
+	*f = append(*f, kind)
+}
+
+func (f fixes) list() []string { return f }
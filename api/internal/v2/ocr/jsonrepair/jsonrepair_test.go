@@ -0,0 +1,199 @@
+package jsonrepair
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestRepair(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+		fix   string
+	}{
+		{"prose around object", "Вот ответ:\n{\"a\": 1}\nГотово.", `{"a":1}`, "extract"},
+		{"first of two values", `{"a": 1} или {"b": [1, 2, 3], "c": "x"}`, `{"a":1}`, "extract"},
+		{"prose braces before answer", `Формат {ключ: значение}. Ответ: {"a": [1, 2, 3], "b": "x"}`, `{"a":[1,2,3],"b":"x"}`, "extract"},
+		{"trailing commas", `{"a": [1, 2,], "b": 3,}`, `{"a":[1,2],"b":3}`, "trailing_comma"},
+		{"line and block comments", "{\n// комментарий\n\"a\": 1, /* ещё */ \"b\": 2}", `{"a":1,"b":2}`, "comments"},
+		{"single quotes", `{'a': 'it\'s', 'b': 'x'}`, `{"a":"it's","b":"x"}`, "quotes"},
+		{"apostrophe inside single quotes", `{'a': 'it's fine'}`, `{"a":"it's fine"}`, "quotes"},
+		{"inner double quotes", `{"a": "он сказал "привет" и ушёл"}`, `{"a":"он сказал \"привет\" и ушёл"}`, "quotes"},
+		{"unquoted keys", `{a: 1, b_c: "x"}`, `{"a":1,"b_c":"x"}`, "unquoted_key"},
+		{"python literals", `{"a": True, "b": None, "c": False}`, `{"a":true,"b":null,"c":false}`, "literal"},
+		{"missing comma between members", "{\"a\": 1\n\"b\": 2}", `{"a":1,"b":2}`, "missing_comma"},
+		{"missing comma between elements", `["a" "b" {"c": 1} {"d": 2}]`, `["a","b",{"c":1},{"d":2}]`, "missing_comma"},
+		{"raw newline in string", "{\"a\": \"строка\nвторая\"}", `{"a":"строка\nвторая"}`, "control_char"},
+		{"number forms", `{"a": +1, "b": .5, "c": 2., "d": 007}`, `{"a":1,"b":0.5,"c":2,"d":"007"}`, "number"},
+		{"truncated string value", `{"a": 1, "b": "обор`, `{"a":1}`, "truncated"},
+		{"truncated key", `{"a": 1, "b`, `{"a":1}`, "truncated"},
+		{"truncated after colon", `{"a": 1, "b":`, `{"a":1}`, "truncated"},
+		{"truncated nested", `{"items": [{"id": 1}, {"id": 2, "plan": ["x", "y`, `{"items":[{"id":1},{"id":2,"plan":["x"]}]}`, "truncated"},
+		{"truncated number", `{"a": [1, 2, 3`, `{"a":[1,2]}`, "truncated"},
+		{"truncated literal", `{"a": 1, "b": tr`, `{"a":1}`, "truncated"},
+		{"mismatched bracket", `{"a": [1, 2}`, `{"a":[1,2]}`, "brackets"},
+		{"missing value", `{"a": , "b": 1}`, `{"b":1}`, "missing_value"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fx fixes
+			got := repair(tt.input, "{[", &fx)
+			assertJSON(t, got, tt.want)
+			if !slices.Contains(fx, tt.fix) {
+				t.Errorf("fixes = %v, want %q", fx, tt.fix)
+			}
+		})
+	}
+}
+
+func TestRepairWithoutJSON(t *testing.T) {
+	var fx fixes
+	if got := repair("не могу решить эту задачу", "{[", &fx); got != "не могу решить эту задачу" || len(fx) != 0 {
+		t.Errorf("repair() = %q, fixes %v; want input unchanged", got, fx)
+	}
+}
+
+// schema — фрагмент схемы PARSE после FixJSONSchemaStrict: nullable-типы
+// записаны через anyOf.
+var schema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"visual_facts": map[string]any{"type": "array", "items": map[string]any{"type": "object"}},
+		"flags":        map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+		"task": map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"grade":     map[string]any{"type": "integer"},
+				"score":     map[string]any{"anyOf": []any{map[string]any{"type": "number"}, map[string]any{"type": "null"}}},
+				"readable":  map[string]any{"type": "boolean"},
+				"title":     map[string]any{"type": "string"},
+				"plan":      map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+				"solution":  map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+				"answer":    map[string]any{"type": []any{"string", "number", "null"}},
+				"reference": map[string]any{"anyOf": []any{map[string]any{"type": "string"}, map[string]any{"type": "null"}}},
+			},
+		},
+	},
+}
+
+func TestCoerce(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+		fix   string
+	}{
+		{"empty object as array", `{"visual_facts": {}, "flags": {}}`, `{"visual_facts":[],"flags":[]}`, "coerce_array"},
+		{"object as array of objects", `{"visual_facts": {"kind": "x"}}`, `{"visual_facts":[{"kind":"x"}]}`, "coerce_array"},
+		{"object as array of strings", `{"flags": {"key": "val"}}`, `{"flags":[]}`, "coerce_array"},
+		{"scalar as array", `{"flags": "one"}`, `{"flags":["one"]}`, "coerce_array"},
+		{"null as array", `{"flags": null}`, `{"flags":[]}`, "coerce_array"},
+		{"array as object", `{"task": [{"title": "x"}]}`, `{"task":{"title":"x"}}`, "coerce_object"},
+		{"double-encoded object", `{"task": "{\"title\": \"x\"}"}`, `{"task":{"title":"x"}}`, "coerce_object"},
+		{"objects in string array", `{"task": {"plan": [{"action": "solve"}, "check"]}}`, `{"task":{"plan":["{\"action\":\"solve\"}","check"]}}`, "coerce_string"},
+		{"number as string", `{"task": {"title": 5}}`, `{"task":{"title":"5"}}`, "coerce_string"},
+		{"string integer", `{"task": {"grade": "3"}}`, `{"task":{"grade":3}}`, "coerce_integer"},
+		{"string with decimal comma", `{"task": {"score": "0,75"}}`, `{"task":{"score":0.75}}`, "coerce_number"},
+		{"string boolean", `{"task": {"readable": "True"}}`, `{"task":{"readable":true}}`, "coerce_boolean"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := unmarshal([]byte(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var fx fixes
+			got, _ := json.Marshal(coerce(doc, schema, &fx))
+			assertJSON(t, string(got), tt.want)
+			if !slices.Contains(fx, tt.fix) {
+				t.Errorf("fixes = %v, want %q", fx, tt.fix)
+			}
+		})
+	}
+}
+
+func TestCoerceKeepsValidValues(t *testing.T) {
+	for _, input := range []string{
+		`{"task": {"answer": "12", "reference": null, "score": null, "grade": 3}}`,
+		`{"task": {"answer": 12, "reference": "x", "score": 0.5}}`,
+		`{"visual_facts": [], "flags": ["a"], "unknown": {}}`,
+	} {
+		doc, err := unmarshal([]byte(input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var fx fixes
+		got, _ := json.Marshal(coerce(doc, schema, &fx))
+		assertJSON(t, string(got), input)
+		if len(fx) != 0 {
+			t.Errorf("coerce(%s) fixes = %v, want none", input, fx)
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	type task struct {
+		Grade int      `json:"grade"`
+		Plan  []string `json:"plan"`
+	}
+	type response struct {
+		Flags []string `json:"flags"`
+		Task  task     `json:"task"`
+	}
+	tests := []struct {
+		name    string
+		input   string
+		want    response
+		result  string
+		wantErr bool
+	}{
+		{"clean", `{"flags": ["a"], "task": {"grade": 3}}`, response{Flags: []string{"a"}, Task: task{Grade: 3}}, ResultClean, false},
+		{"syntax and types", "```json\n{'flags': {}, 'task': {'grade': '3', 'plan': ['x',],},}\n```",
+			response{Flags: []string{}, Task: task{Grade: 3, Plan: []string{"x"}}}, ResultRepaired, false},
+		{"truncated", `{"flags": ["a"], "task": {"grade": 3, "plan": ["x", "обор`,
+			response{Flags: []string{"a"}, Task: task{Grade: 3, Plan: []string{"x"}}}, ResultRepaired, false},
+		{"no JSON", "Извините, не могу помочь.", response{}, ResultFailed, true},
+		{"type mismatch", `{"task": {"grade": "три"}}`, response{}, ResultFailed, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got response
+			result, err := Decode("test", tt.input, schema, &got)
+			if (err != nil) != tt.wantErr || (err != nil && !errors.Is(err, ErrMalformed)) {
+				t.Fatalf("Decode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if result != tt.result {
+				t.Errorf("result = %q, want %q", result, tt.result)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Decode() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeWithoutSchema(t *testing.T) {
+	var got map[string]any
+	result, err := Decode("test", `{"a": 1,}`, nil, &got)
+	if err != nil || result != ResultRepaired || got["a"] != float64(1) {
+		t.Errorf("Decode() = %v, %q, %v", got, result, err)
+	}
+}
+
+func assertJSON(t *testing.T, got, want string) {
+	t.Helper()
+	var g, w any
+	if err := json.Unmarshal([]byte(got), &g); err != nil {
+		t.Fatalf("invalid JSON %q: %v", got, err)
+	}
+	if err := json.Unmarshal([]byte(want), &w); err != nil {
+		t.Fatalf("bad want %q: %v", want, err)
+	}
+	if !reflect.DeepEqual(g, w) {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
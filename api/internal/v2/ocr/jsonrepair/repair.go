@@ -0,0 +1,439 @@
+package jsonrepair
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Состояния контейнера при ремонте.
+const (
+	stValue = iota // ждём значение (элемент массива или значение поля)
+	stKey          // ждём ключ или закрывающую скобку объекта
+	stColon        // ключ прочитан, ждём двоеточие
+	stNext         // значение прочитано, ждём запятую или закрывающую скобку
+)
+
+type frame struct {
+	open  byte // '{' или '['
+	state int
+	// member — длина вывода до текущего члена (вместе с запятой перед ним):
+	// незавершённый член оборванного ответа отрезается до неё.
+	member int
+}
+
+var jsonNumber = regexp.MustCompile(`^-?(0|[1-9]\d*)(\.\d+)?([eE][+-]?\d+)?$`)
+
+// repair переписывает JSON-значение текста в синтаксически валидный JSON.
+// openers — допустимые первые скобки значения. Берётся первое значение в
+// тексте; скобки, из которых ремонт не извлёк ни одного элемента (например,
+// «{ключ: значение}» в прозе перед ответом), значением не считаются. Текст
+// без скобок возвращается как есть: ремонтировать нечего.
+func repair(s, openers string, fx *fixes) string {
+	var found *repairer
+	for from := 0; from < len(s); {
+		start := strings.IndexAny(s[from:], openers)
+		if start < 0 {
+			break
+		}
+		r := &repairer{s: s, i: from + start, start: from + start, fx: &fixes{}}
+		r.run()
+		if len(r.out) > 2 {
+			found = r
+			break
+		}
+		if found == nil {
+			found = r
+		}
+		from = max(r.i, from+start+1)
+	}
+	if found == nil {
+		return s
+	}
+	if found.start > 0 || strings.TrimSpace(s[found.i:]) != "" {
+		fx.add("extract")
+	}
+	for _, k := range *found.fx {
+		fx.add(k)
+	}
+	return string(found.out)
+}
+
+type repairer struct {
+	s     string
+	i     int
+	start int
+	out   []byte
+	stack []frame
+	fx    *fixes
+}
+
+func (r *repairer) top() *frame { return &r.stack[len(r.stack)-1] }
+
+func (r *repairer) run() {
+	for r.i < len(r.s) {
+		if r.skipSpaceAndComments() {
+			break
+		}
+		c := r.s[r.i]
+		switch {
+		case c == '{' || c == '[':
+			if !r.beginValue() {
+				return
+			}
+			r.out = append(r.out, c)
+			f := frame{open: c, state: stValue, member: len(r.out)}
+			if c == '{' {
+				f.state = stKey
+			}
+			r.stack = append(r.stack, f)
+			r.i++
+		case c == '}' || c == ']':
+			r.i++
+			r.close(c)
+		case c == ',':
+			r.i++
+			r.comma()
+		case c == ':':
+			r.i++
+			if f := r.top(); f.open == '{' && f.state == stColon {
+				r.out = append(r.out, ':')
+				f.state = stValue
+			} else {
+				r.fx.add("colon")
+			}
+		case c == '"' || c == '\'':
+			text, ok := r.readString(c)
+			if !ok {
+				continue // оборван на конце ответа
+			}
+			b, _ := json.Marshal(text)
+			if !r.scalar(b) {
+				return
+			}
+		case c == '-' || c == '+' || c == '.' || (c >= '0' && c <= '9'):
+			lit, ok := r.readNumber()
+			if !ok {
+				continue
+			}
+			if !r.scalar(lit) {
+				return
+			}
+		case isWordByte(c):
+			lit, ok := r.readWord()
+			if !ok {
+				continue
+			}
+			if !r.scalar(lit) {
+				return
+			}
+		default:
+			r.fx.add("junk")
+			_, size := utf8.DecodeRuneInString(r.s[r.i:])
+			r.i += size
+		}
+		if len(r.stack) == 0 {
+			return
+		}
+	}
+	if len(r.stack) > 0 {
+		r.fx.add("truncated")
+	}
+	for len(r.stack) > 0 {
+		if f := r.top(); f.state != stNext {
+			r.out = r.out[:f.member]
+			f.state = stNext
+		}
+		r.close(closer(r.top().open))
+	}
+}
+
+// skipSpaceAndComments пропускает пробелы и комментарии; true — конец текста.
+func (r *repairer) skipSpaceAndComments() bool {
+	for r.i < len(r.s) {
+		switch c := r.s[r.i]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			r.i++
+		case strings.HasPrefix(r.s[r.i:], "//") || c == '#':
+			r.fx.add("comments")
+			if n := strings.IndexByte(r.s[r.i:], '\n'); n >= 0 {
+				r.i += n + 1
+			} else {
+				r.i = len(r.s)
+			}
+		case strings.HasPrefix(r.s[r.i:], "/*"):
+			r.fx.add("comments")
+			if n := strings.Index(r.s[r.i+2:], "*/"); n >= 0 {
+				r.i += n + 4
+			} else {
+				r.i = len(r.s)
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// beginValue готовит вывод к новому значению: вставляет пропущенную запятую
+// или двоеточие. false — значение в позиции, где оно невозможно (контейнер
+// вместо ключа): ремонт прекращается.
+func (r *repairer) beginValue() bool {
+	if len(r.stack) == 0 {
+		return true
+	}
+	f := r.top()
+	switch f.state {
+	case stNext:
+		if f.open == '{' {
+			return false
+		}
+		r.fx.add("missing_comma")
+		f.member = len(r.out)
+		r.out = append(r.out, ',')
+	case stColon:
+		r.fx.add("colon")
+		r.out = append(r.out, ':')
+	case stKey:
+		return false
+	}
+	f.state = stNext
+	return true
+}
+
+// scalar пишет строку, число или литерал. Значение в позиции ключа
+// становится ключом; не-строка берётся в кавычки.
+func (r *repairer) scalar(lit []byte) bool {
+	f := r.top()
+	if f.open == '{' && (f.state == stKey || f.state == stNext) {
+		if f.state == stNext {
+			r.fx.add("missing_comma")
+			f.member = len(r.out)
+			r.out = append(r.out, ',')
+		}
+		if lit[0] != '"' {
+			r.fx.add("unquoted_key")
+			lit, _ = json.Marshal(string(lit))
+		}
+		r.out = append(r.out, lit...)
+		f.state = stColon
+		return true
+	}
+	if !r.beginValue() {
+		return false
+	}
+	r.out = append(r.out, lit...)
+	return true
+}
+
+// close закрывает верхний контейнер скобкой c, убирая висячую запятую и
+// поле без значения.
+func (r *repairer) close(c byte) {
+	if len(r.stack) == 0 {
+		return
+	}
+	f := r.top()
+	if c != closer(f.open) {
+		r.fx.add("brackets")
+	}
+	switch f.state {
+	case stColon:
+		r.fx.add("missing_value")
+		r.out = r.out[:f.member]
+	case stValue:
+		if f.open == '{' {
+			r.fx.add("missing_value")
+			r.out = r.out[:f.member]
+		} else if len(r.out) > 0 && r.out[len(r.out)-1] == ',' {
+			r.fx.add("trailing_comma")
+			r.out = r.out[:len(r.out)-1]
+		}
+	case stKey:
+		if len(r.out) > 0 && r.out[len(r.out)-1] == ',' {
+			r.fx.add("trailing_comma")
+			r.out = r.out[:len(r.out)-1]
+		}
+	}
+	r.out = append(r.out, closer(f.open))
+	r.stack = r.stack[:len(r.stack)-1]
+	if len(r.stack) > 0 {
+		r.top().state = stNext
+	}
+}
+
+// comma пишет запятую после значения; поле без значения перед запятой
+// отбрасывается, лишние запятые пропускаются.
+func (r *repairer) comma() {
+	f := r.top()
+	if f.open == '{' && (f.state == stValue || f.state == stColon) {
+		r.fx.add("missing_value")
+		r.out = r.out[:f.member]
+		if r.out[len(r.out)-1] == '{' {
+			f.state = stKey
+			return
+		}
+		f.state = stNext
+	}
+	if f.state != stNext {
+		r.fx.add("comma")
+		return
+	}
+	f.member = len(r.out)
+	r.out = append(r.out, ',')
+	if f.open == '{' {
+		f.state = stKey
+	} else {
+		f.state = stValue
+	}
+}
+
+// readString читает строку в кавычках quote. Кавычка внутри строки, за
+// которой не следует разделитель, считается частью текста. ok=false —
+// строка оборвана концом ответа.
+func (r *repairer) readString(quote byte) (string, bool) {
+	if quote == '\'' {
+		r.fx.add("quotes")
+	}
+	var b strings.Builder
+	for i := r.i + 1; i < len(r.s); i++ {
+		c := r.s[i]
+		switch {
+		case c == '\\':
+			if i+1 >= len(r.s) {
+				r.i = len(r.s)
+				return "", false
+			}
+			i++
+			r.escape(&b, &i)
+		case c == quote:
+			if endsString(r.s[i+1:]) {
+				r.i = i + 1
+				return b.String(), true
+			}
+			r.fx.add("quotes")
+			b.WriteByte(c)
+		case c < 0x20:
+			r.fx.add("control_char")
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	r.i = len(r.s)
+	return "", false
+}
+
+// escape разбирает escape-последовательность на позиции *i (после '\').
+func (r *repairer) escape(b *strings.Builder, i *int) {
+	switch c := r.s[*i]; c {
+	case '"', '\\', '/', '\'':
+		b.WriteByte(c)
+	case 'b':
+		b.WriteByte('\b')
+	case 'f':
+		b.WriteByte('\f')
+	case 'n':
+		b.WriteByte('\n')
+	case 'r':
+		b.WriteByte('\r')
+	case 't':
+		b.WriteByte('\t')
+	case 'u':
+		if *i+4 < len(r.s) {
+			var ch string
+			if err := json.Unmarshal([]byte(`"\u`+r.s[*i+1:*i+5]+`"`), &ch); err == nil {
+				b.WriteString(ch)
+				*i += 4
+				return
+			}
+		}
+		r.fx.add("escape")
+		b.WriteByte(c)
+	default:
+		r.fx.add("escape")
+		b.WriteByte(c)
+	}
+}
+
+// endsString — после кавычки идёт разделитель, скобка, другая строка,
+// комментарий или конец ответа.
+func endsString(rest string) bool {
+	rest = strings.TrimLeft(rest, " \t\r\n")
+	return rest == "" || strings.ContainsRune(",:{}[]\"'/", rune(rest[0]))
+}
+
+// readNumber читает число, исправляя ведущий '+', '.5' и '5.'. Запись, которую
+// не удалось привести к числу JSON, становится строкой. ok=false — число
+// оборвано концом ответа.
+func (r *repairer) readNumber() ([]byte, bool) {
+	j := r.i
+	for j < len(r.s) && strings.IndexByte("0123456789+-.eE", r.s[j]) >= 0 {
+		j++
+	}
+	if j == len(r.s) {
+		r.i = j
+		return nil, false
+	}
+	raw := r.s[r.i:j]
+	r.i = j
+	lit := strings.TrimPrefix(raw, "+")
+	if rest, neg := strings.CutPrefix(lit, "-"); strings.HasPrefix(rest, ".") {
+		lit = "0" + rest
+		if neg {
+			lit = "-" + lit
+		}
+	}
+	lit = strings.TrimSuffix(lit, ".")
+	if lit != raw {
+		r.fx.add("number")
+	}
+	if jsonNumber.MatchString(lit) {
+		return []byte(lit), true
+	}
+	r.fx.add("number")
+	b, _ := json.Marshal(raw)
+	return b, true
+}
+
+// readWord читает слово без кавычек: литерал JSON, Python-литерал, ключ или
+// строковое значение. ok=false — слово оборвано концом ответа.
+func (r *repairer) readWord() ([]byte, bool) {
+	j := r.i
+	for j < len(r.s) && isWordByte(r.s[j]) {
+		j++
+	}
+	if j == len(r.s) {
+		r.i = j
+		return nil, false
+	}
+	w := r.s[r.i:j]
+	r.i = j
+	if f := r.top(); f.open == '{' && (f.state == stKey || f.state == stNext) {
+		return []byte(w), true
+	}
+	switch w {
+	case "true", "false", "null":
+		return []byte(w), true
+	case "True", "False":
+		r.fx.add("literal")
+		return []byte(strings.ToLower(w)), true
+	case "None", "undefined", "NaN", "Infinity":
+		r.fx.add("literal")
+		return []byte("null"), true
+	}
+	r.fx.add("unquoted_value")
+	b, _ := json.Marshal(w)
+	return b, true
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c == '$' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func closer(open byte) byte {
+	if open == '{' {
+		return '}'
+	}
+	return ']'
+}
@@ -0,0 +1,108 @@
+// Package leakguard не даёт подсказкам и feedback CHECK выдать ответ
+// (анти-ГДЗ). После генерации текст для ученика сверяется с итоговым ответом
+// и промежуточными результатами solution_internal — цифрами и словами. При
+// утечке модель один раз перегенерирует ответ с требованием убрать ответ;
+// итог проверки попадает в stats.LeakCheck, лог и метрику.
+package leakguard
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"llm-proxy/api/internal/metrics"
+	"llm-proxy/api/internal/v2/ocr"
+	"llm-proxy/api/internal/v2/ocr/types"
+)
+
+// Итоги проверки для stats.LeakCheck и метрики.
+const (
+	ResultClean       = "clean"       // утечки нет
+	ResultRegenerated = "regenerated" // утечка устранена повторной генерацией
+	ResultLeaked      = "leaked"      // утечка осталась или повтор не удался
+)
+
+var checked = metrics.NewCounter(
+	"llm_proxy_answer_leak_total",
+	"Answer leakage checks of hints and check feedback by result.",
+	"step", "result",
+)
+
+const (
+	hintCorrection = "Подсказки раскрывают ответ: %s. Перепиши подсказки так, чтобы в них не было ни итогового ответа, " +
+		"ни промежуточных результатов — ни цифрами, ни словами. Оставь направление рассуждения: какое действие выполнить и почему."
+	checkCorrection = "Feedback раскрывает правильный ответ: %s. Перепиши feedback без правильного ответа и промежуточных " +
+		"результатов — ни цифрами, ни словами. Укажи, где искать ошибку; решение и вердикт не меняй."
+)
+
+// Engine — декоратор Hint и CheckSolution; остальные шаги делегируются как есть.
+type Engine struct {
+	ocr.Engine
+}
+
+func New(primary ocr.Engine) *Engine {
+	return &Engine{Engine: primary}
+}
+
+func (e *Engine) Hint(ctx context.Context, in types.HintRequest) (types.HintResponse, *types.LLMStats, error) {
+	out, stats, err := e.Engine.Hint(ctx, in)
+	if err != nil {
+		return out, stats, err
+	}
+	leaks := out.AnswerLeaks(in)
+	if len(leaks) == 0 {
+		return out, record(stats, "hint", ResultClean), nil
+	}
+	log.Printf("[leakguard] hint task=%s leaks answer: %s; regenerating", in.Task.TaskId, types.FormatLeaks(leaks))
+
+	retryIn := in
+	retryIn.Correction = correction(hintCorrection, leaks)
+	retried, retryStats, retryErr := e.Engine.Hint(ctx, retryIn)
+	if retryErr != nil {
+		log.Printf("[leakguard] hint task=%s regeneration failed: %v", in.Task.TaskId, retryErr)
+		return out, record(stats.Plus(retryStats), "hint", ResultLeaked), nil
+	}
+	stats = stats.Retry(retryStats)
+	if leaks := retried.AnswerLeaks(in); len(leaks) > 0 {
+		log.Printf("[leakguard] hint task=%s still leaks after regeneration: %s", in.Task.TaskId, types.FormatLeaks(leaks))
+		return retried, record(stats, "hint", ResultLeaked), nil
+	}
+	return retried, record(stats, "hint", ResultRegenerated), nil
+}
+
+func (e *Engine) CheckSolution(ctx context.Context, in types.CheckRequest) (types.CheckResponse, *types.LLMStats, error) {
+	out, stats, err := e.Engine.CheckSolution(ctx, in)
+	if err != nil {
+		return out, stats, err
+	}
+	leaks := out.FeedbackLeaks(in)
+	if len(leaks) == 0 {
+		return out, record(stats, "check", ResultClean), nil
+	}
+	log.Printf("[leakguard] check feedback leaks answer (decision=%s): %s; regenerating", out.Decision, types.FormatLeaks(leaks))
+
+	retryIn := in
+	retryIn.Correction = correction(checkCorrection, leaks)
+	retried, retryStats, retryErr := e.Engine.CheckSolution(ctx, retryIn)
+	if retryErr != nil {
+		log.Printf("[leakguard] check regeneration failed: %v", retryErr)
+		return out, record(stats.Plus(retryStats), "check", ResultLeaked), nil
+	}
+	stats = stats.Retry(retryStats)
+	if leaks := retried.FeedbackLeaks(in); len(leaks) > 0 {
+		log.Printf("[leakguard] check feedback still leaks after regeneration: %s", types.FormatLeaks(leaks))
+		return retried, record(stats, "check", ResultLeaked), nil
+	}
+	return retried, record(stats, "check", ResultRegenerated), nil
+}
+
+func correction(format string, leaks []types.Leak) string {
+	return fmt.Sprintf(format, types.FormatLeaks(leaks))
+}
+
+func record(stats *types.LLMStats, step, result string) *types.LLMStats {
+	checked.Inc(step, result)
+	stats = stats.OrEmpty()
+	stats.LeakCheck = result
+	return stats
+}
@@ -0,0 +1,82 @@
+package leakguard
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"llm-proxy/api/internal/v2/ocr/ocrtest"
+	"llm-proxy/api/internal/v2/ocr/types"
+)
+
+func solution() []types.ParseItem {
+	return []types.ParseItem{{
+		ItemId: "1",
+		SolutionInternal: types.SolutionInternal{
+			SolutionSteps: []string{"12 + 15 = 27"},
+			FinalAnswer:   "27",
+		},
+	}}
+}
+
+func TestHint(t *testing.T) {
+	in := types.HintRequest{Task: types.ParseTask{TaskTextClean: "Было 12 и 15. Сколько всего?"}, Items: solution()}
+	tests := []struct {
+		name      string
+		hints     []string
+		retryErr  error
+		want      string
+		wantText  string
+		wantCalls int
+	}{
+		{"clean", []string{"Сложи числа из условия."}, nil, ResultClean, "Сложи числа из условия.", 1},
+		{"regenerated", []string{"Получится 27.", "Сложи числа из условия."}, nil, ResultRegenerated, "Сложи числа из условия.", 2},
+		{"still leaks", []string{"Получится 27.", "Ответ — двадцать семь."}, nil, ResultLeaked, "Ответ — двадцать семь.", 2},
+		{"retry error keeps first", []string{"Получится 27."}, errors.New("boom"), ResultLeaked, "Получится 27.", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := ocrtest.NewQueue(tt.hints...)
+			s.RetryErr = tt.retryErr
+			out, stats, err := New(s).Hint(context.Background(), in)
+			if err != nil {
+				t.Fatalf("Hint() error = %v", err)
+			}
+			if stats.LeakCheck != tt.want {
+				t.Errorf("LeakCheck = %q, want %q", stats.LeakCheck, tt.want)
+			}
+			if got := out.Items[0].Hints[0].HintText; got != tt.wantText {
+				t.Errorf("hint = %q, want %q", got, tt.wantText)
+			}
+			if s.Calls() != tt.wantCalls {
+				t.Fatalf("calls = %d, want %d", s.Calls(), tt.wantCalls)
+			}
+			if tt.wantCalls > 1 && s.Corrections[1] == "" {
+				t.Error("regeneration must carry a correction")
+			}
+			if tt.wantCalls == 2 && stats.InputTokens != 20 {
+				t.Errorf("InputTokens = %d, want both calls summed", stats.InputTokens)
+			}
+			// Метрики — того вызова, чей ответ отдан.
+			wantModel := "queue-1"
+			if tt.wantCalls == 2 && tt.retryErr == nil {
+				wantModel = "queue-2"
+			}
+			if stats.Model != wantModel {
+				t.Errorf("Model = %q, want %q", stats.Model, wantModel)
+			}
+		})
+	}
+}
+
+func TestCheckSolution(t *testing.T) {
+	in := types.CheckRequest{TaskStruct: types.TaskStructCheck{TaskTextClean: "Было 12 и 15. Сколько всего?", Items: solution()}}
+	s := ocrtest.NewQueue("Правильно 27.", "Проверь сложение единиц.")
+	out, stats, err := New(s).CheckSolution(context.Background(), in)
+	if err != nil {
+		t.Fatalf("CheckSolution() error = %v", err)
+	}
+	if stats.LeakCheck != ResultRegenerated || out.Feedback != "Проверь сложение единиц." {
+		t.Errorf("got LeakCheck=%q feedback=%q", stats.LeakCheck, out.Feedback)
+	}
+}
@@ -24,6 +24,16 @@ func New(gemini, openai ocr.Engine) *Engine {
 
 func (e *Engine) Name() string { return "mixed" }
 
+// CacheFingerprint делегирует движку, который обслуживает detect и parse.
+func (e *Engine) CacheFingerprint(step string) (model, hash string) {
+	if f, ok := e.gemini.(interface {
+		CacheFingerprint(string) (string, string)
+	}); ok {
+		return f.CacheFingerprint(step)
+	}
+	return e.gemini.Name(), ""
+}
+
 func (e *Engine) Detect(ctx context.Context, in types.DetectRequest) (types.DetectResponse, *types.LLMStats, error) {
 	return e.gemini.Detect(ctx, in)
 }
@@ -0,0 +1,81 @@
+// Package ocrtest — тестовые движки для декораторов v2 (leakguard, safety,
+// readability): ответы с заданными текстами для ребёнка без обращения к
+// провайдерам LLM.
+package ocrtest
+
+import (
+	"context"
+	"fmt"
+
+	"llm-proxy/api/internal/v2/ocr/fake"
+	"llm-proxy/api/internal/v2/ocr/types"
+)
+
+// Queue отдаёт тексты по очереди: каждый вызов Hint, CheckSolution,
+// AnalogueSolution или HintRU забирает следующий текст из Texts в поле,
+// которое видит ребёнок, и запоминает Correction запроса. Остальные шаги
+// выполняет фейковый движок.
+type Queue struct {
+	*fake.Engine
+	Texts       []string
+	RetryErr    error    // ошибка повторной генерации (вызова с Correction)
+	Corrections []string // Correction каждого вызова по порядку
+}
+
+func NewQueue(texts ...string) *Queue {
+	return &Queue{Engine: fake.New(fake.Options{}), Texts: texts}
+}
+
+// Calls — число вызовов движка.
+func (q *Queue) Calls() int { return len(q.Corrections) }
+
+// next забирает следующий текст. Метрики вызова n: 10 входных токенов и
+// модель "queue-n" — по ней видно, какому вызову принадлежат метрики ответа.
+func (q *Queue) next(correction string) (string, *types.LLMStats, error) {
+	q.Corrections = append(q.Corrections, correction)
+	stats := &types.LLMStats{InputTokens: 10, Model: fmt.Sprintf("queue-%d", len(q.Corrections))}
+	if correction != "" && q.RetryErr != nil {
+		return "", stats, q.RetryErr
+	}
+	text := q.Texts[0]
+	q.Texts = q.Texts[1:]
+	return text, stats, nil
+}
+
+func (q *Queue) Hint(_ context.Context, in types.HintRequest) (types.HintResponse, *types.LLMStats, error) {
+	text, stats, err := q.next(in.Correction)
+	if err != nil {
+		return types.HintResponse{}, stats, err
+	}
+	out := types.HintResponse{Items: []types.HintItem{{ItemId: "1", Hints: []types.Hint{{Level: types.HintL1, HintText: text}}}}}
+	return out, stats, nil
+}
+
+func (q *Queue) CheckSolution(_ context.Context, in types.CheckRequest) (types.CheckResponse, *types.LLMStats, error) {
+	text, stats, err := q.next(in.Correction)
+	if err != nil {
+		return types.CheckResponse{}, stats, err
+	}
+	return types.CheckResponse{Decision: types.CheckDecisionIncorrect, Feedback: text}, stats, nil
+}
+
+func (q *Queue) AnalogueSolution(_ context.Context, in types.AnalogueRequest) (types.AnalogueResponse, *types.LLMStats, error) {
+	text, stats, err := q.next(in.Correction)
+	if err != nil {
+		return types.AnalogueResponse{}, stats, err
+	}
+	return types.AnalogueResponse{ExampleTask: text}, stats, nil
+}
+
+// HintRU кладёт текст в объяснение первой карточки; child_message всегда
+// "Давай разберёмся.".
+func (q *Queue) HintRU(_ context.Context, in types.HintRUCompactInput) (types.HintRUResponse, *types.LLMStats, error) {
+	text, stats, err := q.next(in.Correction)
+	if err != nil {
+		return types.HintRUResponse{}, stats, err
+	}
+	return types.HintRUResponse{
+		ChildMessage: "Давай разберёмся.",
+		HintCards:    []types.RUHintCard{{Explanation: text}},
+	}, stats, nil
+}
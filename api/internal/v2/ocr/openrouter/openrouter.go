@@ -8,7 +8,11 @@
 //   - Формат сообщений: messages[] (не input[])
 //   - Structured output: response_format (не text.format)
 //   - Ответ: choices[0].message.content
-//   - Usage: usage.prompt_tokens / completion_tokens
+//   - Usage: usage.prompt_tokens / completion_tokens (+ prompt_tokens_details.cached_tokens)
+//
+// Кэш промпта: system-сообщение состоит из стабильной части и динамических
+// блоков после неё. Для провайдеров с явными точками кэширования (Anthropic,
+// Gemini) стабильная часть помечается cache_control; OpenAI кэширует префикс сам.
 package openrouter
 
 import (
@@ -29,7 +33,9 @@ import (
 	"time"
 
 	"llm-proxy/api/internal/util"
+	"llm-proxy/api/internal/v2/ocr/jsonrepair"
 	"llm-proxy/api/internal/v2/ocr/types"
+	"llm-proxy/api/internal/v2/ocr/validation"
 	"llm-proxy/api/internal/v2/tmplrouter"
 )
 
@@ -49,11 +55,39 @@ type StepModels struct {
 	Analogue string // OPENROUTER_ANALOGUE_MODEL
 }
 
+// Override возвращает копию с моделью model для перечисленных шагов.
+// RU-шаги используют модели базовых шагов: parse_ru → Parse, hint_ru → Hint, check_ru → Check.
+func (m StepModels) Override(model string, steps ...string) StepModels {
+	for _, step := range steps {
+		switch step {
+		case "detect":
+			m.Detect = model
+		case "parse", "parse_ru":
+			m.Parse = model
+		case "hint", "hint_ru":
+			m.Hint = model
+		case "check", "check_ru":
+			m.Check = model
+		case "analogue":
+			m.Analogue = model
+		}
+	}
+	return m
+}
+
 type Engine struct {
 	apiKey     string
 	models     StepModels
 	httpc      *http.Client
 	tmplRouter *tmplrouter.Router
+	prompts    promptSet
+	images     *util.ImagePipeline // nil — изображение отправляется как есть
+	attempts   int                 // вызовов модели на шаг при semantic validation; 0 — validation.DefaultAttempts
+}
+
+// promptSet загружает промпты из корня root (пустой — PROMPT_DIR).
+type promptSet struct {
+	root string
 }
 
 // SetTemplateRouter injects the pedagogical template router.
@@ -82,44 +116,103 @@ func New(apiKey string, models StepModels) *Engine {
 	}
 }
 
+// WithHTTPClient подменяет HTTP-клиент (кассеты record/replay, трассировка).
+func (e *Engine) WithHTTPClient(c *http.Client) *Engine {
+	if c != nil {
+		e.httpc = c
+	}
+	return e
+}
+
+// WithPromptDir задаёт альтернативный корень промптов (эксперименты).
+func (e *Engine) WithPromptDir(dir string) *Engine {
+	e.prompts = promptSet{root: dir}
+	return e
+}
+
+// WithImagePipeline включает предобработку изображений перед отправкой провайдеру.
+func (e *Engine) WithImagePipeline(p *util.ImagePipeline) *Engine {
+	e.images = p
+	return e
+}
+
+// WithValidationAttempts задаёт число вызовов модели на шаг, пока ответ не
+// пройдёт semantic validation: 1 — без повторов.
+func (e *Engine) WithValidationAttempts(n int) *Engine {
+	e.attempts = n
+	return e
+}
+
 func (e *Engine) Name() string { return "openrouter" }
 
+// CacheFingerprint возвращает модель и хеш базового промпта шага для ключа кэша ответов.
+func (e *Engine) CacheFingerprint(step string) (model, hash string) {
+	switch step {
+	case "detect":
+		model = e.models.Detect
+	case "parse":
+		model = e.models.Parse
+	}
+	system, schemaJSON, err := e.prompts.systemWithSchema(step, 0)
+	if err != nil {
+		return model, ""
+	}
+	return model, promptHash(system, schemaJSON, model)
+}
+
 // ─── DETECT ───────────────────────────────────────────────────────────────────
 
 func (e *Engine) Detect(ctx context.Context, in types.DetectRequest) (types.DetectResponse, *types.LLMStats, error) {
-	system, schemaJSON, err := loadSystemWithSchema("detect", 0)
+	return validation.Detect(ctx, e.attempts, in, e.detect)
+}
+
+func (e *Engine) detect(ctx context.Context, in types.DetectRequest) (types.DetectResponse, *types.LLMStats, error) {
+	system, schemaJSON, err := e.prompts.systemWithSchema("detect", 0)
 	if err != nil {
 		return types.DetectResponse{}, nil, fmt.Errorf("openrouter detect: %w", err)
 	}
-	userPrompt, _ := util.LoadUserPrompt("detect", promptSource, apiVersion, "detect")
+	userPrompt, _ := e.prompts.userPrompt("detect", "detect")
 	if strings.TrimSpace(userPrompt) == "" {
 		userPrompt = "Верни ТОЛЬКО JSON по detect.schema v2.2.2."
 	}
 
-	imgBytes, mime, err := decodeImage(in.Image)
+	refs, err := in.AllImages()
+	if err != nil {
+		return types.DetectResponse{}, nil, fmt.Errorf("openrouter detect: %w", err)
+	}
+	images, img, err := e.imageParts(refs, e.models.Detect)
 	if err != nil {
 		return types.DetectResponse{}, nil, fmt.Errorf("openrouter detect: %w", err)
 	}
 
-	messages := []message{
+	messages := withCorrection([]message{
 		systemMsg(system),
-		userMsgWithImage(userPrompt, mime, imgBytes),
-	}
+		userMsgWithImages(userPrompt, images),
+	}, in.Correction)
 
 	var out types.DetectResponse
 	stats, err := e.call(ctx, e.models.Detect, "detect", messages, schemaJSON, &out)
+	stats.SetImage(img.BytesIn, img.BytesOut)
 	return out, stats, err
 }
 
 // ─── PARSE ────────────────────────────────────────────────────────────────────
 
 func (e *Engine) Parse(ctx context.Context, in types.ParseRequest) (types.ParseResponse, *types.LLMStats, error) {
-	system, schemaJSON, err := loadSystemWithSchema("parse", int(in.Grade))
+	return validation.Parse(ctx, e.attempts, in, e.parse)
+}
+
+func (e *Engine) parse(ctx context.Context, in types.ParseRequest) (types.ParseResponse, *types.LLMStats, error) {
+	system, schemaJSON, err := e.prompts.systemWithSchema("parse", int(in.Grade))
 	if err != nil {
 		return types.ParseResponse{}, nil, fmt.Errorf("openrouter parse: %w", err)
 	}
 
-	imgBytes, mime, err := decodeImage(in.Image)
+	refs, err := in.AllImages()
+	if err != nil {
+		return types.ParseResponse{}, nil, fmt.Errorf("openrouter parse: %w", err)
+	}
+	images, img, err := e.imageParts(refs, e.models.Parse)
 	if err != nil {
 		return types.ParseResponse{}, nil, fmt.Errorf("openrouter parse: %w", err)
 	}
@@ -135,7 +228,7 @@ func (e *Engine) Parse(ctx context.Context, in types.ParseRequest) (types.ParseR
 	}
 	ctxJSON, _ := json.Marshal(ctxData)
 
-	userPrompt, _ := util.LoadUserPrompt("parse", promptSource, apiVersion, "parse")
+	userPrompt, _ := e.prompts.userPrompt("parse", "parse")
 	if strings.TrimSpace(userPrompt) == "" {
 		userPrompt = "Верни ТОЛЬКО JSON по parse.schema v2.1.1."
 	}
@@ -143,37 +236,28 @@ func (e *Engine) Parse(ctx context.Context, in types.ParseRequest) (types.ParseR
 
 	messages := []message{
 		systemMsg(system),
-		userMsgWithImage(userText, mime, imgBytes),
+		userMsgWithImages(userText, images),
 	}
+	messages = withCorrection(messages, in.Correction)
 
 	var pr types.ParseResponse
 	stats, err := e.call(ctx, e.models.Parse, "parse", messages, schemaJSON, &pr)
+	stats.SetImage(img.BytesIn, img.BytesOut)
 	if err != nil {
 		return types.ParseResponse{}, stats, err
 	}
 	stats.PromptHash = promptHash(system, userText, schemaJSON, e.models.Parse)
-	if pr.ValidateItems() > 0 {
-		retryMessages := appendCorrection(messages,
-			"В предыдущем результате final_answer противоречил последнему выводу solution_steps. "+
-				"Реши задачу заново независимо, проверь обратным действием и верни согласованный JSON. "+
-				"Если подтвердить ответ нельзя, верни final_answer=null и unsafe_to_finalize_answer=true.")
-		var retried types.ParseResponse
-		retryStats, retryErr := e.call(ctx, e.models.Parse, "parse", retryMessages, schemaJSON, &retried)
-		stats.Add(retryStats)
-		if retryErr == nil {
-			retried.ValidateItems()
-			pr = retried
-		} else {
-			log.Printf("[openrouter] parse semantic retry failed: %v", retryErr)
-		}
-	}
 	return pr, stats, nil
 }
 
 // ─── HINT ─────────────────────────────────────────────────────────────────────
 
 func (e *Engine) Hint(ctx context.Context, in types.HintRequest) (types.HintResponse, *types.LLMStats, error) {
-	system, schemaJSON, err := loadSystemWithSchema("hint", in.Task.Grade)
+	return validation.Hint(ctx, e.attempts, in, e.hint)
+}
+
+func (e *Engine) hint(ctx context.Context, in types.HintRequest) (types.HintResponse, *types.LLMStats, error) {
+	system, schemaJSON, err := e.prompts.systemWithSchema("hint", in.Task.Grade)
 	if err != nil {
 		return types.HintResponse{}, nil, fmt.Errorf("openrouter hint: %w", err)
 	}
@@ -181,13 +265,14 @@ func (e *Engine) Hint(ctx context.Context, in types.HintRequest) (types.HintResp
 	// Условная дозагрузка педагогического блока по типу задачи (шаг 09).
 	// Каждый тип задачи имеет отдельный файл hint.advanced_{task_type}.system.txt
 	// с расширенной педагогикой (частые ошибки, паттерны L1/L2/L3 для типа).
+	var advanced string
 	var advancedTopics []string
 	if len(in.Items) > 0 {
 		taskType := types.NormalizeTaskType(in.Items[0].PedKeys.TaskType)
 		in.Items[0].PedKeys.TaskType = taskType
 		if block := types.HintAdvancedPromptBlock(taskType); block != "" {
-			if advanced, aerr := loadHintAdvancedBlock(in.Task.Grade, block); aerr == nil && strings.TrimSpace(advanced) != "" {
-				system = system + "\n\n" + advanced
+			if b, aerr := e.prompts.hintAdvancedBlock(in.Task.Grade, block); aerr == nil && strings.TrimSpace(b) != "" {
+				advanced = b
 				advancedTopics = append(advancedTopics, block)
 			} else if aerr != nil {
 				log.Printf("[openrouter] hint advanced block %q not loaded: %v", block, aerr)
@@ -212,7 +297,7 @@ func (e *Engine) Hint(ctx context.Context, in types.HintRequest) (types.HintResp
 
 	inJSON, _ := json.Marshal(in)
 	// Загружаем user-шаблон с учётом класса
-	userTemplate, _ := loadHintUserPrompt(in.Task.Grade)
+	userTemplate, _ := e.prompts.hintUserPrompt(in.Task.Grade)
 	var userText string
 	if strings.Contains(userTemplate, "{{PARSE_OUTPUT_JSON}}") {
 		userText = strings.ReplaceAll(userTemplate, "{{PARSE_OUTPUT_JSON}}", string(inJSON))
@@ -229,31 +314,15 @@ func (e *Engine) Hint(ctx context.Context, in types.HintRequest) (types.HintResp
 		userText = fmt.Sprintf("Класс ученика: %d (1–4).\n\n", grade) + userText
 	}
 
-	messages := []message{systemMsg(system), userMsgText(userText)}
+	messages := []message{systemMsg(system, advanced), userMsgText(userText)}
+	messages = withCorrection(messages, in.Correction)
 
 	var hr types.HintResponse
 	stats, err := e.call(ctx, e.models.Hint, "hint", messages, schemaJSON, &hr)
 	if stats != nil {
-		stats.PromptHash = promptHash(system, userText, schemaJSON, e.models.Hint)
+		stats.PromptHash = promptHash(system, advanced, userText, schemaJSON, e.models.Hint)
 		stats.PromptBlocks = strings.Join(advancedTopics, ",")
 	}
-	if err == nil {
-		if validationErr := hr.ValidateAgainstRequest(in); validationErr != nil {
-			retryMessages := appendCorrection(messages,
-				"Предыдущая подсказка не прошла semantic validation: "+validationErr.Error()+". "+
-					"Покрой каждый шаг solution_internal.plan, выставь точный plan_coverage и верни все обязательные уровни L1/L2/L3.")
-			var retried types.HintResponse
-			retryStats, retryErr := e.call(ctx, e.models.Hint, "hint", retryMessages, schemaJSON, &retried)
-			stats.Add(retryStats)
-			if retryErr != nil {
-				return types.HintResponse{}, stats, fmt.Errorf("openrouter hint semantic retry: %w", retryErr)
-			}
-			if retryValidationErr := retried.ValidateAgainstRequest(in); retryValidationErr != nil {
-				return types.HintResponse{}, stats, fmt.Errorf("openrouter hint semantic validation: %w", retryValidationErr)
-			}
-			hr = retried
-		}
-	}
 	// Устанавливаем метрики после вызова (LLM ответ перезаписывает поля)
 	if grade > 0 {
 		hr.PromptVersion = fmt.Sprintf("%d_class", grade)
@@ -267,20 +336,28 @@ func (e *Engine) Hint(ctx context.Context, in types.HintRequest) (types.HintResp
 // ─── CHECK ────────────────────────────────────────────────────────────────────
 
 func (e *Engine) CheckSolution(ctx context.Context, in types.CheckRequest) (types.CheckResponse, *types.LLMStats, error) {
-	system, schemaJSON, err := loadSystemWithSchema("check", int(in.Student.Grade))
+	return validation.Check(ctx, e.attempts, in, e.checkSolution)
+}
+
+func (e *Engine) checkSolution(ctx context.Context, in types.CheckRequest) (types.CheckResponse, *types.LLMStats, error) {
+	system, schemaJSON, err := e.prompts.systemWithSchema("check", int(in.Student.Grade))
 	if err != nil {
 		return types.CheckResponse{}, nil, fmt.Errorf("openrouter check: %w", err)
 	}
 
 	// Подставляем grade-специфичную секцию feedback
-	if gradeSection, serr := loadCheckFeedbackSection(int(in.Student.Grade)); serr == nil {
+	if gradeSection, serr := e.prompts.checkFeedbackSection(int(in.Student.Grade)); serr == nil {
 		system = strings.ReplaceAll(system, "{{GRADE_FEEDBACK_SECTION}}", gradeSection)
 	}
 
-	// Композиция дополнительных блоков промпта
-	system, checkBlocks := composeCheckBlocks(system, in.TaskStruct)
+	// Дополнительные блоки промпта идут после стабильной части отдельным блоком.
+	dynamic, checkBlocks := e.prompts.composeCheckBlocks(in.TaskStruct)
 
-	imgBytes, mime, err := decodeImage(in.Image)
+	refs, err := in.AllImages()
+	if err != nil {
+		return types.CheckResponse{}, nil, fmt.Errorf("openrouter check: %w", err)
+	}
+	images, img, err := e.imageParts(refs, e.models.Check)
 	if err != nil {
 		return types.CheckResponse{}, nil, fmt.Errorf("openrouter check: %w", err)
 	}
@@ -300,7 +377,7 @@ func (e *Engine) CheckSolution(ctx context.Context, in types.CheckRequest) (type
 	}
 	reqJSON, _ := json.Marshal(reqForJSON)
 
-	userTemplate, _ := util.LoadUserPrompt("check", promptSource, apiVersion, "check")
+	userTemplate, _ := e.prompts.userPrompt("check", "check")
 	var userText string
 	if strings.Contains(userTemplate, "{{request_json}}") {
 		userText = strings.ReplaceAll(userTemplate, "{{request_json}}", string(reqJSON))
@@ -311,53 +388,91 @@ func (e *Engine) CheckSolution(ctx context.Context, in types.CheckRequest) (type
 		}
 	}
 
-	messages := []message{systemMsg(system), userMsgWithImage(userText, mime, imgBytes)}
+	messages := []message{systemMsg(system, dynamic), userMsgWithImages(userText, images)}
+	messages = withCorrection(messages, in.Correction)
 
 	var cr types.CheckResponse
 	stats, err := e.call(ctx, e.models.Check, "check", messages, schemaJSON, &cr)
+	stats.SetImage(img.BytesIn, img.BytesOut)
 	if err != nil {
 		return types.CheckResponse{}, stats, err
 	}
-	stats.PromptHash = promptHash(system, userText, schemaJSON, e.models.Check)
+	stats.PromptHash = promptHash(system, dynamic, userText, schemaJSON, e.models.Check)
 	stats.PromptBlocks = strings.Join(checkBlocks, ",")
 	cr.NormalizeDecision()
 	cr.SetIsCorrectFromDecision()
-	if validationErr := cr.ValidateSemantics(in); validationErr != nil {
-		retryMessages := appendCorrection(messages,
-			"Предыдущая проверка не прошла semantic validation: "+validationErr.Error()+". "+
-				"Независимо реши задачу до сравнения с ответом ученика, подтверди эталон вторым способом, "+
-				"заполни все verification-поля и visual_evidence для визуальной задачи.")
-		var retried types.CheckResponse
-		retryStats, retryErr := e.call(ctx, e.models.Check, "check", retryMessages, schemaJSON, &retried)
-		stats.Add(retryStats)
-		if retryErr == nil {
-			retried.NormalizeDecision()
-			retried.SetIsCorrectFromDecision()
-			if retryValidationErr := retried.ValidateSemantics(in); retryValidationErr == nil {
-				return retried, stats, nil
-			} else {
-				log.Printf("[openrouter] check semantic retry invalid: %v", retryValidationErr)
-			}
-		} else {
-			log.Printf("[openrouter] check semantic retry failed: %v", retryErr)
-		}
-		fallback := types.ConservativeCheckResponse()
-		fallback.SetIsCorrectFromDecision()
-		return fallback, stats, nil
-	}
 	return cr, stats, err
 }
 
+// ─── CHECK VERIFY ─────────────────────────────────────────────────────────────
+
+// VerifyCheck — второе мнение по вердикту CHECK на модели шага check.
+func (e *Engine) VerifyCheck(ctx context.Context, in types.CheckVerifyRequest) (types.CheckVerifyResponse, *types.LLMStats, error) {
+	system, err := util.LoadSystemPromptIn(e.prompts.root, "check_verify", promptSource, apiVersion, "check")
+	if err != nil {
+		return types.CheckVerifyResponse{}, nil, fmt.Errorf("openrouter check_verify: load system prompt: %w", err)
+	}
+	schema, err := util.LoadPromptSchemaIn(e.prompts.root, "check_verify", apiVersion)
+	if err != nil {
+		return types.CheckVerifyResponse{}, nil, fmt.Errorf("openrouter check_verify: load schema: %w", err)
+	}
+	schemaRaw, _ := json.Marshal(schema)
+	schemaJSON := string(schemaRaw)
+
+	refs, err := in.Check.AllImages()
+	if err != nil {
+		return types.CheckVerifyResponse{}, nil, fmt.Errorf("openrouter check_verify: %w", err)
+	}
+	images, img, err := e.imageParts(refs, e.models.Check)
+	if err != nil {
+		return types.CheckVerifyResponse{}, nil, fmt.Errorf("openrouter check_verify: %w", err)
+	}
+
+	reqForJSON := struct {
+		TaskStruct  types.TaskStructCheck    `json:"task_struct"`
+		RawTaskText string                   `json:"raw_task_text"`
+		Student     types.StudentCheck       `json:"student"`
+		FirstCheck  types.CheckVerifyRequest `json:"first_check"`
+	}{
+		TaskStruct:  in.Check.TaskStruct,
+		RawTaskText: in.Check.RawTaskText,
+		Student:     in.Check.Student,
+		FirstCheck:  in,
+	}
+	reqJSON, _ := json.Marshal(reqForJSON)
+
+	userTemplate, _ := e.prompts.userPrompt("check_verify", "check")
+	userText := "INPUT_JSON:\n" + string(reqJSON)
+	if strings.Contains(userTemplate, "{{request_json}}") {
+		userText = strings.ReplaceAll(userTemplate, "{{request_json}}", string(reqJSON))
+	}
+
+	messages := []message{systemMsg(system), userMsgWithImages(userText, images)}
+
+	var vr types.CheckVerifyResponse
+	stats, err := e.call(ctx, e.models.Check, "check_verify", messages, schemaJSON, &vr)
+	stats.SetImage(img.BytesIn, img.BytesOut)
+	if err != nil {
+		return types.CheckVerifyResponse{}, stats, err
+	}
+	stats.PromptHash = promptHash(system, userText, schemaJSON, e.models.Check)
+	return vr, stats, nil
+}
+
 // ─── ANALOGUE ─────────────────────────────────────────────────────────────────
 
 func (e *Engine) AnalogueSolution(ctx context.Context, in types.AnalogueRequest) (types.AnalogueResponse, *types.LLMStats, error) {
-	system, schemaJSON, err := loadSystemWithSchema("analogue", 0)
+	return validation.Analogue(ctx, e.attempts, in, e.analogueSolution)
+}
+
+func (e *Engine) analogueSolution(ctx context.Context, in types.AnalogueRequest) (types.AnalogueResponse, *types.LLMStats, error) {
+	system, schemaJSON, err := e.prompts.systemWithSchema("analogue", 0)
 	if err != nil {
 		return types.AnalogueResponse{}, nil, fmt.Errorf("openrouter analogue: %w", err)
 	}
 
 	inJSON, _ := json.Marshal(in)
-	userTemplate, _ := util.LoadUserPrompt("analogue", promptSource, apiVersion, "analogue")
+	userTemplate, _ := e.prompts.userPrompt("analogue", "analogue")
 	var userText string
 	if strings.TrimSpace(userTemplate) != "" {
 		userText = userTemplate + "\n\nINPUT_JSON:\n" + string(inJSON)
@@ -366,6 +481,7 @@ func (e *Engine) AnalogueSolution(ctx context.Context, in types.AnalogueRequest)
 	}
 
 	messages := []message{systemMsg(system), userMsgText(userText)}
+	messages = withCorrection(messages, in.Correction)
 
 	var ar types.AnalogueResponse
 	stats, err := e.call(ctx, e.models.Analogue, "analogue", messages, schemaJSON, &ar)
@@ -388,9 +504,15 @@ type message struct {
 }
 
 type contentPart struct {
-	Type     string    `json:"type"`
-	Text     string    `json:"text,omitempty"`
-	ImageURL *imageURL `json:"image_url,omitempty"`
+	Type         string        `json:"type"`
+	Text         string        `json:"text,omitempty"`
+	ImageURL     *imageURL     `json:"image_url,omitempty"`
+	CacheControl *cacheControl `json:"cache_control,omitempty"`
+}
+
+// cacheControl — точка кэширования промпта (OpenRouter передаёт её Anthropic и Gemini).
+type cacheControl struct {
+	Type string `json:"type"` // "ephemeral"
 }
 
 type imageURL struct {
@@ -419,6 +541,10 @@ type chatResponse struct {
 		PromptTokens     int     `json:"prompt_tokens"`
 		CompletionTokens int     `json:"completion_tokens"`
 		Cost             float64 `json:"cost"`
+		// PromptTokensDetails.CachedTokens — часть prompt_tokens, прочитанная из кэша.
+		PromptTokensDetails struct {
+			CachedTokens int `json:"cached_tokens"`
+		} `json:"prompt_tokens_details"`
 	} `json:"usage"`
 }
 
@@ -431,6 +557,36 @@ func isGeminiModel(model string) bool {
 	return strings.Contains(m, "gemini") || strings.Contains(m, "google/")
 }
 
+// supportsCacheControl проверяет, нужна ли модели явная точка кэширования
+// cache_control. OpenAI, DeepSeek и другие кэшируют префикс автоматически.
+func supportsCacheControl(model string) bool {
+	m := strings.ToLower(model)
+	return strings.Contains(m, "anthropic/") || strings.Contains(m, "claude") || isGeminiModel(model)
+}
+
+// withCacheBreakpoint возвращает копию messages, в которой стабильная (первая)
+// часть system-сообщения помечена cache_control. Исходные сообщения не меняются:
+// их переиспользуют ретраи с CORRECTION_REQUIRED.
+func withCacheBreakpoint(messages []message) []message {
+	out := make([]message, len(messages))
+	copy(out, messages)
+	for i, m := range out {
+		if m.Role != "system" {
+			continue
+		}
+		parts, ok := m.Content.([]contentPart)
+		if !ok || len(parts) == 0 {
+			return out
+		}
+		marked := make([]contentPart, len(parts))
+		copy(marked, parts)
+		marked[0].CacheControl = &cacheControl{Type: "ephemeral"}
+		out[i].Content = marked
+		return out
+	}
+	return out
+}
+
 // tempPtr возвращает указатель на float64 — для заполнения Temperature в chatRequest.
 func tempPtr(t float64) *float64 { return &t }
 
@@ -477,12 +633,16 @@ func (e *Engine) call(
 	// умеренная для творческих (подсказки).
 	var temp *float64
 	switch op {
-	case "check", "check_ru", "parse", "parse_ru", "detect":
+	case "check", "check_ru", "check_verify", "parse", "parse_ru", "detect":
 		temp = tempPtr(0.1) // максимальный детерминизм
 	case "hint", "hint_ru":
 		temp = tempPtr(0.2) // вариативность, но без случайности
 	}
 
+	if supportsCacheControl(model) {
+		messages = withCacheBreakpoint(messages)
+	}
+
 	reqBody := chatRequest{
 		Model:          model,
 		Messages:       messages,
@@ -565,6 +725,7 @@ func (e *Engine) call(
 	stats := &types.LLMStats{
 		InputTokens:  cr.Usage.PromptTokens,
 		OutputTokens: cr.Usage.CompletionTokens,
+		CachedTokens: cr.Usage.PromptTokensDetails.CachedTokens,
 		LatencyMs:    latencyMs,
 		Model:        model,
 		CostUSD:      cr.Usage.Cost,
@@ -572,85 +733,113 @@ func (e *Engine) call(
 
 	text := util.StripCodeFences(strings.TrimSpace(cr.Choices[0].Message.Content))
 
-	// Исправляем частую ошибку LLM: {} вместо [] для array-полей.
-	// Gemini в json_object режиме делает это систематически,
-	// но другие модели тоже иногда возвращают объект вместо массива.
-	text = fixEmptyArrayFields(text)
-
-	if err := json.Unmarshal([]byte(text), dst); err != nil {
+	// Gemini в json_object режиме систематически отдаёт {} вместо [] и
+	// объекты вместо строк; ремонт приводит ответ к схеме шага.
+	repair, err := jsonrepair.Decode(op, text, schema, dst)
+	stats.JSONRepair = repair
+	if err != nil {
 		return stats, fmt.Errorf("openrouter %s: bad JSON: %w", op, err)
 	}
 
-	log.Printf("[openrouter] %s model=%s latency=%dms in=%d out=%d",
-		op, model, latencyMs, stats.InputTokens, stats.OutputTokens)
+	log.Printf("[openrouter] %s model=%s latency=%dms in=%d cached=%d out=%d",
+		op, model, latencyMs, stats.InputTokens, stats.CachedTokens, stats.OutputTokens)
 
 	return stats, nil
 }
 
 // ─── helpers ──────────────────────────────────────────────────────────────────
 
-func systemMsg(text string) message {
-	return message{Role: "system", Content: text}
+func (ps promptSet) userPrompt(name string, subdirs ...string) (string, error) {
+	return util.LoadUserPromptIn(ps.root, name, promptSource, apiVersion, subdirs...)
+}
+
+// systemMsg собирает system-сообщение: стабильный промпт первой частью,
+// динамические блоки (по типу задачи) — следующими, чтобы префикс кэшировался.
+func systemMsg(text string, dynamic ...string) message {
+	parts := []contentPart{{Type: "text", Text: text}}
+	for _, d := range dynamic {
+		if strings.TrimSpace(d) != "" {
+			parts = append(parts, contentPart{Type: "text", Text: d})
+		}
+	}
+	return message{Role: "system", Content: parts}
 }
 
 func userMsgText(text string) message {
 	return message{Role: "user", Content: text}
 }
 
-func userMsgWithImage(text, mime string, imgBytes []byte) message {
-	dataURL := "data:" + mime + ";base64," + base64.StdEncoding.EncodeToString(imgBytes)
+func userMsgWithImages(text string, images []contentPart) message {
 	return message{
-		Role: "user",
-		Content: []contentPart{
-			{Type: "text", Text: text},
-			{Type: "image_url", ImageURL: &imageURL{URL: dataURL}},
-		},
+		Role:    "user",
+		Content: append([]contentPart{{Type: "text", Text: text}}, images...),
+	}
+}
+
+// imageParts готовит изображения запроса как части сообщения: перед каждым
+// изображением многостраничного запроса идёт подпись с номером и ролью.
+func (e *Engine) imageParts(refs []types.ImageRef, model string) ([]contentPart, util.ImageStats, error) {
+	var (
+		parts []contentPart
+		total util.ImageStats
+	)
+	for i, ref := range refs {
+		data, mime, st, err := e.decodeImage(ref.Image, model)
+		if err != nil {
+			if len(refs) > 1 {
+				err = fmt.Errorf("images[%d]: %w", i, err)
+			}
+			return nil, total, err
+		}
+		total.BytesIn += st.BytesIn
+		total.BytesOut += st.BytesOut
+		if label := types.ImageLabel(i, len(refs), ref.Role); label != "" {
+			parts = append(parts, contentPart{Type: "text", Text: label})
+		}
+		dataURL := "data:" + mime + ";base64," + base64.StdEncoding.EncodeToString(data)
+		parts = append(parts, contentPart{Type: "image_url", ImageURL: &imageURL{URL: dataURL}})
 	}
+	return parts, total, nil
 }
 
 func appendCorrection(messages []message, correction string) []message {
 	result := make([]message, 0, len(messages)+1)
 	result = append(result, messages...)
-	result = append(result, userMsgText("CORRECTION_REQUIRED:\n"+correction))
+	result = append(result, userMsgText(types.CorrectionMessage(correction)))
 	return result
 }
 
+// withCorrection добавляет CORRECTION_REQUIRED, если запрос — повторная
+// генерация после отклонённого ответа.
+func withCorrection(messages []message, correction string) []message {
+	if correction == "" {
+		return messages
+	}
+	return appendCorrection(messages, correction)
+}
+
 func promptHash(parts ...string) string {
 	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
 	return fmt.Sprintf("%x", sum[:8])
 }
 
 func gradeSubdir(grade int) string {
-	switch grade {
-	case 1:
-		return "1_class"
-	case 2:
-		return "2_class"
-	case 3:
-		return "3_class"
-	case 4:
-		return "4_class"
-	default:
-		return ""
-	}
+	return util.GradeSubdir(grade)
 }
 
-// loadHintUserPrompt загружает пользовательский шаблон для подсказок с учётом класса.
-func loadHintUserPrompt(grade int) (string, error) {
+// hintUserPrompt загружает пользовательский шаблон для подсказок с учётом класса.
+func (ps promptSet) hintUserPrompt(grade int) (string, error) {
 	if subdir := gradeSubdir(grade); subdir != "" {
-		if p, err := util.LoadUserPrompt("hint", promptSource, apiVersion, "hint", subdir); err == nil {
+		if p, err := util.LoadUserPromptIn(ps.root, "hint", promptSource, apiVersion, "hint", subdir); err == nil {
 			return p, nil
 		}
 	}
-	return util.LoadUserPrompt("hint", promptSource, apiVersion, "hint")
+	return util.LoadUserPromptIn(ps.root, "hint", promptSource, apiVersion, "hint")
 }
 
-func loadHintAdvancedBlock(grade int, block string) (string, error) {
+func (ps promptSet) hintAdvancedBlock(grade int, block string) (string, error) {
 	name := "hint.advanced_" + block + ".system.txt"
-	baseRoot := os.Getenv("PROMPT_DIR")
-	if baseRoot == "" {
-		baseRoot = filepath.Join("api", "internal")
-	}
+	baseRoot := util.PromptRoot(ps.root)
 	if subdir := gradeSubdir(grade); subdir != "" {
 		path := filepath.Join(baseRoot, apiVersion, "prompt", "hint", subdir, name)
 		if data, err := os.ReadFile(path); err == nil {
@@ -665,24 +854,24 @@ func loadHintAdvancedBlock(grade int, block string) (string, error) {
 	return strings.TrimSpace(string(data)), nil
 }
 
-func loadPrompt(name string, grade int) (string, error) {
+func (ps promptSet) system(name string, grade int) (string, error) {
 	// Для подсказок и проверки используем поддиректорию класса
 	if name == "hint" || name == "hint_ru" || name == "check" || name == "check_ru" {
 		if subdir := gradeSubdir(grade); subdir != "" {
-			if p, err := util.LoadSystemPrompt(name, promptSource, apiVersion, name, subdir); err == nil {
+			if p, err := util.LoadSystemPromptIn(ps.root, name, promptSource, apiVersion, name, subdir); err == nil {
 				return p, nil
 			}
 		}
 	}
-	return util.LoadSystemPrompt(name, promptSource, apiVersion, name)
+	return util.LoadSystemPromptIn(ps.root, name, promptSource, apiVersion, name)
 }
 
-func loadSystemWithSchema(name string, grade int) (system, schemaJSON string, err error) {
-	sys, err := loadPrompt(name, grade)
+func (ps promptSet) systemWithSchema(name string, grade int) (system, schemaJSON string, err error) {
+	sys, err := ps.system(name, grade)
 	if err != nil {
 		return "", "", fmt.Errorf("load system prompt %q: %w", name, err)
 	}
-	schema, err := util.LoadPromptSchema(name, apiVersion)
+	schema, err := util.LoadPromptSchemaIn(ps.root, name, apiVersion)
 	if err != nil {
 		return "", "", fmt.Errorf("load schema %q: %w", name, err)
 	}
@@ -693,12 +882,17 @@ func loadSystemWithSchema(name string, grade int) (system, schemaJSON string, er
 	return sys, string(raw), nil
 }
 
-func decodeImage(image string) ([]byte, string, error) {
+// imageFormats — форматы изображений, которые принимают vision-модели OpenRouter;
+// остальные (HEIC, AVIF) перекодируются в JPEG.
+var imageFormats = util.ImageFormats{"image/jpeg", "image/png", "image/webp", "image/gif"}
+
+// decodeImage декодирует изображение запроса и прогоняет его через предобработку для модели.
+func (e *Engine) decodeImage(image, model string) ([]byte, string, util.ImageStats, error) {
 	imgBytes, mimeFromDataURL, _ := util.DecodeBase64MaybeDataURL(image)
 	if len(imgBytes) == 0 {
 		raw, err := base64.StdEncoding.DecodeString(image)
 		if err != nil || len(raw) == 0 {
-			return nil, "", fmt.Errorf("invalid image base64")
+			return nil, "", util.ImageStats{}, fmt.Errorf("invalid image base64")
 		}
 		imgBytes = raw
 	}
@@ -706,91 +900,7 @@ func decodeImage(image string) ([]byte, string, error) {
 	if mime == "application/octet-stream" {
 		mime = "image/jpeg"
 	}
-	return imgBytes, mime, nil
-}
-
-// fixEmptyArrayFields исправляет два вида ошибок LLM в JSON:
-//
-//  1. Пустые массивы: {} → [] для известных array-полей
-//  2. Объекты вместо массивов: {"key":"val"} → [] (если поле должно быть массивом)
-//  3. Объекты вместо строк в plan/solution_steps:
-//     LLM иногда возвращает [{...}, ...] вместо ["...", ...]
-//     Каждый объект-элемент сериализуется в JSON-строку.
-func fixEmptyArrayFields(s string) string {
-	// Быстрая замена пустых {} → [] для array-полей
-	arrayFields := []string{
-		"visual_facts", "items", "plan", "solution_steps",
-		"flags", "constraints", "labels", "issues", "hints", "error_spans", "buttons", "visual_evidence",
-	}
-	for _, f := range arrayFields {
-		s = strings.ReplaceAll(s, `"`+f+`":{}`, `"`+f+`":[]`)
-		s = strings.ReplaceAll(s, `"`+f+`": {}`, `"`+f+`": []`)
-	}
-
-	// Глубокая нормализация: объекты вместо массивов → пустые массивы,
-	// объекты в string-массивах → строки
-	var doc interface{}
-	if err := json.Unmarshal([]byte(s), &doc); err != nil {
-		return s
-	}
-	fixArrayFields(doc, arrayFields)
-	fixStringArrayElements(doc)
-	if fixed, err := json.Marshal(doc); err == nil {
-		return string(fixed)
-	}
-	return s
-}
-
-// fixArrayFields заменяет объекты на пустые [] для полей, которые должны быть массивами.
-func fixArrayFields(v interface{}, arrayFields []string) {
-	fieldSet := make(map[string]bool, len(arrayFields))
-	for _, f := range arrayFields {
-		fieldSet[f] = true
-	}
-	switch node := v.(type) {
-	case map[string]interface{}:
-		for key, val := range node {
-			if fieldSet[key] {
-				if _, isObj := val.(map[string]interface{}); isObj {
-					node[key] = []interface{}{}
-				}
-			} else {
-				fixArrayFields(val, arrayFields)
-			}
-		}
-	case []interface{}:
-		for _, elem := range node {
-			fixArrayFields(elem, arrayFields)
-		}
-	}
-}
-
-// fixStringArrayElements рекурсивно конвертирует объекты-элементы
-// в массивах plan/solution_steps в JSON-строки.
-func fixStringArrayElements(v interface{}) {
-	stringArrayFields := map[string]bool{"plan": true, "solution_steps": true}
-	switch node := v.(type) {
-	case map[string]interface{}:
-		for key, val := range node {
-			if stringArrayFields[key] {
-				if arr, ok := val.([]interface{}); ok {
-					for i, elem := range arr {
-						if _, isStr := elem.(string); !isStr {
-							if b, err := json.Marshal(elem); err == nil {
-								arr[i] = string(b)
-							}
-						}
-					}
-				}
-			} else {
-				fixStringArrayElements(val)
-			}
-		}
-	case []interface{}:
-		for _, elem := range node {
-			fixStringArrayElements(elem)
-		}
-	}
+	return e.images.Prepare(model, imgBytes, mime, imageFormats)
 }
 
 func truncate(b []byte, n int) string {
@@ -803,18 +913,27 @@ func truncate(b []byte, n int) string {
 // ─── PARSE_RU ─────────────────────────────────────────────────────────────────
 
 func (e *Engine) ParseRU(ctx context.Context, in types.ParseRURequest) (types.ParseRUResponse, *types.LLMStats, error) {
-	system, schemaJSON, err := loadSystemWithSchema("parse_ru", 0)
+	return validation.ParseRU(ctx, e.attempts, in, e.parseRU)
+}
+
+func (e *Engine) parseRU(ctx context.Context, in types.ParseRURequest) (types.ParseRUResponse, *types.LLMStats, error) {
+	system, schemaJSON, err := e.prompts.systemWithSchema("parse_ru", 0)
 	if err != nil {
 		return types.ParseRUResponse{}, nil, fmt.Errorf("openrouter parse_ru: %w", err)
 	}
 
-	imgBytes, mime, err := decodeImage(in.Image)
+	refs, err := in.AllImages()
+	if err != nil {
+		return types.ParseRUResponse{}, nil, fmt.Errorf("openrouter parse_ru: %w", err)
+	}
+	images, img, err := e.imageParts(refs, e.models.Parse)
 	if err != nil {
 		return types.ParseRUResponse{}, nil, fmt.Errorf("openrouter parse_ru: %w", err)
 	}
 
 	in.Image = ""
-	userPrompt, _ := util.LoadUserPrompt("parse_ru", promptSource, apiVersion, "parse")
+	in.ImageID, in.Images = "", nil
+	userPrompt, _ := e.prompts.userPrompt("parse_ru", "parse")
 	if strings.TrimSpace(userPrompt) == "" {
 		userPrompt = "Верни ТОЛЬКО JSON по parse_ru.output.schema."
 	}
@@ -824,24 +943,30 @@ func (e *Engine) ParseRU(ctx context.Context, in types.ParseRURequest) (types.Pa
 
 	messages := []message{
 		systemMsg(system),
-		userMsgWithImage(userText, mime, imgBytes),
+		userMsgWithImages(userText, images),
 	}
+	messages = withCorrection(messages, in.Correction)
 
 	var out types.ParseRUResponse
 	stats, err := e.call(ctx, e.models.Parse, "parse_ru", messages, schemaJSON, &out)
+	stats.SetImage(img.BytesIn, img.BytesOut)
 	return out, stats, err
 }
 
 // ─── HINT_RU ─────────────────────────────────────────────────────────────────
 
 func (e *Engine) HintRU(ctx context.Context, in types.HintRUCompactInput) (types.HintRUResponse, *types.LLMStats, error) {
-	system, schemaJSON, err := loadSystemWithSchema("hint_ru", 0)
+	return validation.HintRU(ctx, e.attempts, in, e.hintRU)
+}
+
+func (e *Engine) hintRU(ctx context.Context, in types.HintRUCompactInput) (types.HintRUResponse, *types.LLMStats, error) {
+	system, schemaJSON, err := e.prompts.systemWithSchema("hint_ru", 0)
 	if err != nil {
 		return types.HintRUResponse{}, nil, fmt.Errorf("openrouter hint_ru: %w", err)
 	}
 
 	inJSON, _ := json.Marshal(in)
-	userPrompt, _ := util.LoadUserPrompt("hint_ru", promptSource, apiVersion, "hint")
+	userPrompt, _ := e.prompts.userPrompt("hint_ru", "hint")
 	var userText string
 	if strings.Contains(userPrompt, "COMPACT_INPUT:") {
 		userText = strings.ReplaceAll(userPrompt, "COMPACT_INPUT:", "COMPACT_INPUT:\n"+string(inJSON))
@@ -853,6 +978,7 @@ func (e *Engine) HintRU(ctx context.Context, in types.HintRUCompactInput) (types
 	}
 
 	messages := []message{systemMsg(system), userMsgText(userText)}
+	messages = withCorrection(messages, in.Correction)
 
 	var out types.HintRUResponse
 	stats, err := e.call(ctx, e.models.Hint, "hint_ru", messages, schemaJSON, &out)
@@ -862,13 +988,17 @@ func (e *Engine) HintRU(ctx context.Context, in types.HintRUCompactInput) (types
 // ─── CHECK_RU ────────────────────────────────────────────────────────────
 
 func (e *Engine) CheckRU(ctx context.Context, in types.CheckRUCompactInput) (types.CheckRUResponse, *types.LLMStats, error) {
-	system, schemaJSON, err := loadSystemWithSchema("check_ru", in.Grade)
+	return validation.CheckRU(ctx, e.attempts, in, e.checkRU)
+}
+
+func (e *Engine) checkRU(ctx context.Context, in types.CheckRUCompactInput) (types.CheckRUResponse, *types.LLMStats, error) {
+	system, schemaJSON, err := e.prompts.systemWithSchema("check_ru", in.Grade)
 	if err != nil {
 		return types.CheckRUResponse{}, nil, fmt.Errorf("openrouter check_ru: %w", err)
 	}
 
 	// Подставляем grade-специфичную секцию feedback
-	if gradeSection, serr := loadCheckRUFeedbackSection(in.Grade); serr == nil {
+	if gradeSection, serr := e.prompts.checkRUFeedbackSection(in.Grade); serr == nil {
 		system = strings.ReplaceAll(system, "{{GRADE_FEEDBACK_SECTION}}", gradeSection)
 	}
 
@@ -876,7 +1006,7 @@ func (e *Engine) CheckRU(ctx context.Context, in types.CheckRUCompactInput) (typ
 	system = composeCheckRUBlocks(system)
 
 	inJSON, _ := json.Marshal(in)
-	userPrompt, _ := util.LoadUserPrompt("check_ru", promptSource, apiVersion, "check")
+	userPrompt, _ := e.prompts.userPrompt("check_ru", "check")
 	var userText string
 	if strings.Contains(userPrompt, "COMPACT_INPUT:") {
 		userText = strings.ReplaceAll(userPrompt, "COMPACT_INPUT:", "COMPACT_INPUT:\n"+string(inJSON))
@@ -888,6 +1018,7 @@ func (e *Engine) CheckRU(ctx context.Context, in types.CheckRUCompactInput) (typ
 	}
 
 	messages := []message{systemMsg(system), userMsgText(userText)}
+	messages = withCorrection(messages, in.Correction)
 
 	var out types.CheckRUResponse
 	stats, err := e.call(ctx, e.models.Check, "check_ru", messages, schemaJSON, &out)
@@ -902,16 +1033,13 @@ func (e *Engine) Embed(ctx context.Context, in types.EmbedRequest) (types.EmbedR
 	return types.EmbedResponse{}, nil, fmt.Errorf("embed: not supported by openrouter engine")
 }
 
-func loadCheckFeedbackSection(grade int) (string, error) {
+func (ps promptSet) checkFeedbackSection(grade int) (string, error) {
 	subdir := gradeSubdir(grade)
 	if subdir == "" {
 		return "", fmt.Errorf("unknown grade: %d", grade)
 	}
 
-	baseRoot := os.Getenv("PROMPT_DIR")
-	if baseRoot == "" {
-		baseRoot = filepath.Join("api", "internal")
-	}
+	baseRoot := util.PromptRoot(ps.root)
 	p := filepath.Join(baseRoot, apiVersion, "prompt", "check", subdir, "check.feedback.txt")
 	b, err := os.ReadFile(p)
 	if err != nil {
@@ -920,16 +1048,13 @@ func loadCheckFeedbackSection(grade int) (string, error) {
 	return strings.TrimSpace(string(b)), nil
 }
 
-func loadCheckRUFeedbackSection(grade int) (string, error) {
+func (ps promptSet) checkRUFeedbackSection(grade int) (string, error) {
 	subdir := gradeSubdir(grade)
 	if subdir == "" {
 		return "", fmt.Errorf("unknown grade: %d", grade)
 	}
 
-	baseRoot := os.Getenv("PROMPT_DIR")
-	if baseRoot == "" {
-		baseRoot = filepath.Join("api", "internal")
-	}
+	baseRoot := util.PromptRoot(ps.root)
 	p := filepath.Join(baseRoot, apiVersion, "prompt", "check", subdir, "check_ru.feedback.txt")
 	b, err := os.ReadFile(p)
 	if err != nil {
@@ -938,9 +1063,10 @@ func loadCheckRUFeedbackSection(grade int) (string, error) {
 	return strings.TrimSpace(string(b)), nil
 }
 
-// composeCheckBlocks добавляет к базовому промпту условные блоки для проверки ответа.
+// composeCheckBlocks собирает условные блоки промпта для проверки ответа и их имена.
+// Блоки отправляются после базового промпта отдельной частью system-сообщения.
 // Загружает: advanced (по task_type), format (по формату), conditional (visual, high_risk, multiple_subtasks).
-func composeCheckBlocks(system string, taskStruct types.TaskStructCheck) (string, []string) {
+func (ps promptSet) composeCheckBlocks(taskStruct types.TaskStructCheck) (string, []string) {
 	var blocks []string
 	var blockNames []string
 	appendBlock := func(name, content string) {
@@ -949,7 +1075,7 @@ func composeCheckBlocks(system string, taskStruct types.TaskStructCheck) (string
 	}
 
 	loadCheckBlock := func(name string) (string, error) {
-		return util.LoadSystemPrompt(name, promptSource, apiVersion, "check", name)
+		return util.LoadSystemPromptIn(ps.root, name, promptSource, apiVersion, "check", name)
 	}
 
 	if len(taskStruct.Items) > 0 {
@@ -998,7 +1124,7 @@ func composeCheckBlocks(system string, taskStruct types.TaskStructCheck) (string
 				log.Printf("[openrouter] check verification block %q not loaded: %v", name, err)
 			}
 		}
-		if isHighRiskTask(taskStruct.Items[0]) {
+		if types.IsHighRiskTask(taskStruct.Items[0]) {
 			if v, err := loadCheckBlock("check.high_risk"); err == nil && strings.TrimSpace(v) != "" {
 				appendBlock("check.high_risk", v)
 			} else if err != nil {
@@ -1007,10 +1133,7 @@ func composeCheckBlocks(system string, taskStruct types.TaskStructCheck) (string
 		}
 	}
 
-	if len(blocks) > 0 {
-		system = system + "\n\n" + strings.Join(blocks, "\n\n")
-	}
-	return system, blockNames
+	return strings.Join(blocks, "\n\n"), blockNames
 }
 
 func isVisualTask(taskStruct types.TaskStructCheck) bool {
@@ -1037,12 +1160,6 @@ func hasMultipleSubtasks(taskStruct types.TaskStructCheck) bool {
 	return len(taskStruct.Items) == 1 && slicesContain(taskStruct.Items[0].PedKeys.Constraints, "has_subparts")
 }
 
-func isHighRiskTask(item types.ParseItem) bool {
-	taskType := types.NormalizeTaskType(item.PedKeys.TaskType)
-	return taskType == types.TaskTypeLogic || taskType == types.TaskTypePatternsLogic ||
-		taskType == types.TaskTypeSetsLogic || slicesContain(item.PedKeys.Constraints, "high_risk")
-}
-
 func slicesContain(values []string, target string) bool {
 	for _, value := range values {
 		if value == target {
@@ -1,134 +1,26 @@
 package openrouter
 
 import (
+	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"image"
+	"io"
+	"net/http"
 	"os"
 	"path/filepath"
+	"reflect"
 	"slices"
 	"strings"
 	"testing"
 
+	"llm-proxy/api/internal/util"
+	"llm-proxy/api/internal/v2/ocr/jsonrepair"
 	"llm-proxy/api/internal/v2/ocr/types"
 )
 
-func TestFixEmptyArrayFields(t *testing.T) {
-	tests := []struct {
-		name     string
-		input    string
-		expected string
-	}{
-		{
-			name:     "visual_facts empty object becomes array",
-			input:    `{"visual_facts":{}}`,
-			expected: `{"visual_facts":[]}`,
-		},
-		{
-			name:     "visual_facts non-empty object becomes empty array",
-			input:    `{"visual_facts":{"key":"val"}}`,
-			expected: `{"visual_facts":[]}`,
-		},
-		{
-			name:     "items empty object becomes array",
-			input:    `{"items":{}}`,
-			expected: `{"items":[]}`,
-		},
-		{
-			name:     "items non-empty object becomes empty array",
-			input:    `{"items":{"foo":"bar"}}`,
-			expected: `{"items":[]}`,
-		},
-		{
-			name:     "plan empty object becomes array",
-			input:    `{"plan":{}}`,
-			expected: `{"plan":[]}`,
-		},
-		{
-			name:     "solution_steps empty object becomes array",
-			input:    `{"solution_steps":{}}`,
-			expected: `{"solution_steps":[]}`,
-		},
-		{
-			name:     "multiple array fields fixed",
-			input:    `{"visual_facts":{},"items":{},"flags":{}}`,
-			expected: `{"flags":[],"items":[],"visual_facts":[]}`,
-		},
-		{
-			name:     "normal JSON with existing arrays passes through",
-			input:    `{"visual_facts":["a","b"],"items":[1,2]}`,
-			expected: `{"items":[1,2],"visual_facts":["a","b"]}`,
-		},
-		{
-			name:     "normal JSON without array fields passes through",
-			input:    `{"name":"test","value":42}`,
-			expected: `{"name":"test","value":42}`,
-		},
-		{
-			name:     "nested object with array field is fixed",
-			input:    `{"data":{"visual_facts":{},"nested":{"items":{}}}}`,
-			expected: `{"data":{"nested":{"items":[]},"visual_facts":[]}}`,
-		},
-		{
-			name:     "deeply nested array fields are fixed",
-			input:    `{"level1":{"level2":{"visual_facts":{},"items":{}}}}`,
-			expected: `{"level1":{"level2":{"items":[],"visual_facts":[]}}}`,
-		},
-		{
-			name:     "array field inside array element is fixed",
-			input:    `{"rows":[{"visual_facts":{}},{"items":{}}]}`,
-			expected: `{"rows":[{"visual_facts":[]},{"items":[]}]}`,
-		},
-		{
-			name:     "spaces around colon are handled",
-			input:    `{"visual_facts": {}}`,
-			expected: `{"visual_facts":[]}`,
-		},
-		{
-			name:     "non-array field with empty object stays unchanged",
-			input:    `{"metadata":{},"visual_facts":{}}`,
-			expected: `{"metadata":{},"visual_facts":[]}`,
-		},
-		{
-			name:     "plan with string array elements is unchanged",
-			input:    `{"plan":["step1","step2"]}`,
-			expected: `{"plan":["step1","step2"]}`,
-		},
-		{
-			name:     "plan with object elements converted to strings",
-			input:    `{"plan":[{"action":"solve"},{"action":"check"}]}`,
-			expected: `{"plan":["{\"action\":\"solve\"}","{\"action\":\"check\"}"]}`,
-		},
-		{
-			name:     "solution_steps with object elements converted to strings",
-			input:    `{"solution_steps":[{"step":1},{"step":2}]}`,
-			expected: `{"solution_steps":["{\"step\":1}","{\"step\":2}"]}`,
-		},
-		{
-			name:     "empty string returns unchanged",
-			input:    ``,
-			expected: ``,
-		},
-		{
-			name:     "invalid JSON returns unchanged",
-			input:    `{invalid json`,
-			expected: `{invalid json`,
-		},
-		{
-			name:     "complex real-world response",
-			input:    `{"task_id":"t1","visual_facts":{},"items":{},"plan":["a"],"solution_steps":[],"metadata":{"x":1}}`,
-			expected: `{"items":[],"metadata":{"x":1},"plan":["a"],"solution_steps":[],"task_id":"t1","visual_facts":[]}`,
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got := fixEmptyArrayFields(tt.input)
-			if got != tt.expected {
-				t.Errorf("fixEmptyArrayFields(%q)\n  got:  %q\n  want: %q", tt.input, got, tt.expected)
-			}
-		})
-	}
-}
-
 func TestComposeCheckBlocks_UsesCanonicalTaxonomyAndVisualGuard(t *testing.T) {
 	root := t.TempDir()
 	promptDir := filepath.Join(root, "v2", "prompt", "check")
@@ -151,69 +43,226 @@ func TestComposeCheckBlocks_UsesCanonicalTaxonomyAndVisualGuard(t *testing.T) {
 		VisualFacts: []types.VisualFact{{Kind: "fraction_total_parts", Value: 6, Critical: true}},
 		Items:       []types.ParseItem{{PedKeys: types.PedKeys{TaskType: "fractions"}}},
 	}
-	composed, blocks := composeCheckBlocks("BASE", task)
+	composed, blocks := promptSet{}.composeCheckBlocks(task)
 	for _, block := range []string{"check.advanced_arithmetic", "check.verify_arithmetic", "check.visual"} {
 		if !slices.Contains(blocks, block) {
 			t.Errorf("block %q not loaded; got %v", block, blocks)
 		}
 	}
-	for _, marker := range []string{"BASE", "ADVANCED_ARITHMETIC", "VERIFY_ARITHMETIC", "VISUAL_EVIDENCE"} {
+	for _, marker := range []string{"ADVANCED_ARITHMETIC", "VERIFY_ARITHMETIC", "VISUAL_EVIDENCE"} {
 		if !strings.Contains(composed, marker) {
 			t.Errorf("composed prompt does not contain %q", marker)
 		}
 	}
 }
 
-func TestFixEmptyArrayFields_SemanticEqual(t *testing.T) {
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestCall_RepairsJSONAgainstSchema(t *testing.T) {
+	schemaJSON := `{"type":"object","properties":{
+		"visual_facts":{"type":"array","items":{"type":"object","properties":{"kind":{"type":"string"}}}},
+		"flags":{"type":["array","null"],"items":{"type":"string"}},
+		"plan":{"type":"array","items":{"type":"string"}}}}`
+	type response struct {
+		VisualFacts []map[string]any `json:"visual_facts"`
+		Flags       []string         `json:"flags"`
+		Plan        []string         `json:"plan"`
+	}
 	tests := []struct {
 		name       string
-		input      string
-		arrayField string
+		content    string
+		want       response
+		wantRepair string
+		wantErr    bool
 	}{
-		{
-			name:       "visual_facts becomes array",
-			input:      `{"visual_facts":{},"other":"keep"}`,
-			arrayField: "visual_facts",
-		},
-		{
-			name:       "items becomes array",
-			input:      `{"items":{"key":"val"},"other":"keep"}`,
-			arrayField: "items",
-		},
-		{
-			name:       "flags becomes array",
-			input:      `{"flags":{},"other":"keep"}`,
-			arrayField: "flags",
-		},
-		{
-			name:       "nested visual_facts becomes array",
-			input:      `{"data":{"visual_facts":{}}}`,
-			arrayField: "visual_facts",
-		},
+		{"clean", `{"visual_facts":[],"flags":null,"plan":["a"]}`, response{VisualFacts: []map[string]any{}, Plan: []string{"a"}}, jsonrepair.ResultClean, false},
+		{"gemini json_object quirks", "Ответ:\n{\"visual_facts\":{},\"flags\":{},\"plan\":[{\"action\":\"solve\"},\"check\",],}",
+			response{VisualFacts: []map[string]any{}, Flags: []string{}, Plan: []string{`{"action":"solve"}`, "check"}}, jsonrepair.ResultRepaired, false},
+		{"unrepairable", "Не могу разобрать фото.", response{}, jsonrepair.ResultFailed, true},
 	}
-
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := fixEmptyArrayFields(tt.input)
-			var obj map[string]any
-			if err := json.Unmarshal([]byte(got), &obj); err != nil {
-				t.Fatalf("fixEmptyArrayFields returned invalid JSON: %v\ngot: %s", err, got)
+			client := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+				body, _ := json.Marshal(map[string]any{
+					"choices": []any{map[string]any{"message": map[string]any{"content": tt.content}}},
+				})
+				return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewReader(body)), Header: http.Header{}}, nil
+			})}
+			e := New("key", StepModels{}).WithHTTPClient(client)
+			var got response
+			stats, err := e.call(context.Background(), "google/gemini-2.5-flash", "parse", nil, schemaJSON, &got)
+			if (err != nil) != tt.wantErr || (err != nil && !errors.Is(err, jsonrepair.ErrMalformed)) {
+				t.Fatalf("call() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if stats.JSONRepair != tt.wantRepair {
+				t.Errorf("JSONRepair = %q, want %q", stats.JSONRepair, tt.wantRepair)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
 			}
+		})
+	}
+}
+
+func TestVerifyCheck_SendsFirstVerdict(t *testing.T) {
+	t.Setenv("PROMPT_DIR", "../../..")
+	var sent chatRequest
+	client := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		if err := json.NewDecoder(r.Body).Decode(&sent); err != nil {
+			t.Fatal(err)
+		}
+		content := `{"verdict":"dispute","decision":"correct","expected_answer":"13","confidence":0.8,"reason":"r","feedback":"f"}`
+		body, _ := json.Marshal(map[string]any{
+			"choices": []any{map[string]any{"message": map[string]any{"content": content}}},
+			"usage":   map[string]any{"prompt_tokens": 5, "completion_tokens": 3, "cost": 0.001},
+		})
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewReader(body)), Header: http.Header{}}, nil
+	})}
+	e := New("key", StepModels{Check: "verifier/model"}).WithHTTPClient(client)
+
+	expected := "12"
+	in := types.CheckVerifyRequest{
+		Check:          types.CheckRequest{Image: "aGVsbG8="},
+		Decision:       types.CheckDecisionIncorrect,
+		ExpectedAnswer: &expected,
+	}
+	out, stats, err := e.VerifyCheck(context.Background(), in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Verdict != types.CheckVerifyDispute || out.ExpectedAnswer != "13" {
+		t.Errorf("response = %+v", out)
+	}
+	if stats.Model != "verifier/model" || stats.PromptHash == "" {
+		t.Errorf("stats = %+v", stats)
+	}
+	if sent.ResponseFormat == nil || sent.ResponseFormat.JSONSchema == nil || sent.ResponseFormat.JSONSchema.Name != "check_verify" {
+		t.Fatalf("response_format = %+v", sent.ResponseFormat)
+	}
+	user, _ := json.Marshal(sent.Messages[1].Content)
+	if !strings.Contains(string(user), `\"expected_answer\":\"12\"`) || !strings.Contains(string(user), `\"decision\":\"incorrect\"`) {
+		t.Errorf("first verdict not sent to verifier: %s", user)
+	}
+}
+
+func TestImageParts_LabelsEachImage(t *testing.T) {
+	e := New("key", StepModels{})
+	refs, err := types.CollectImages("aGVsbG8=", "", []types.ImageRef{{Image: "d29ybGQ=", Role: "answer"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts, st, err := e.imageParts(refs, "openai/gpt-4.1-mini")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"text", "image_url", "text", "image_url"}
+	if len(parts) != len(want) {
+		t.Fatalf("parts = %+v", parts)
+	}
+	for i, p := range parts {
+		if p.Type != want[i] {
+			t.Errorf("parts[%d].Type = %s, want %s", i, p.Type, want[i])
+		}
+	}
+	if parts[2].Text != "Изображение 2 из 2 (role: answer):" {
+		t.Errorf("label = %q", parts[2].Text)
+	}
+	if st.BytesIn != 10 || st.BytesOut != 10 {
+		t.Errorf("stats = %+v", st)
+	}
 
-			// check top-level or nested
-			v := obj[tt.arrayField]
-			if v == nil {
-				// check nested under "data"
-				if data, ok := obj["data"].(map[string]any); ok {
-					v = data[tt.arrayField]
+	single, _, err := e.imageParts(refs[:1], "openai/gpt-4.1-mini")
+	if err != nil || len(single) != 1 || single[0].Type != "image_url" {
+		t.Errorf("single image must not be labelled: %+v, %v", single, err)
+	}
+}
+
+func TestCall_PromptCaching(t *testing.T) {
+	tests := []struct {
+		name           string
+		model          string
+		wantBreakpoint bool
+	}{
+		{"anthropic gets explicit breakpoint", "anthropic/claude-sonnet-4", true},
+		{"gemini gets explicit breakpoint", "google/gemini-2.5-flash", true},
+		{"openai caches prefix automatically", "openai/gpt-4.1-mini", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent struct {
+				Messages []struct {
+					Role    string        `json:"role"`
+					Content []contentPart `json:"content"`
+				} `json:"messages"`
+			}
+			client := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+				raw, _ := io.ReadAll(r.Body)
+				if err := json.Unmarshal(raw, &sent); err != nil {
+					t.Fatalf("request: %v\n%s", err, raw)
 				}
+				body, _ := json.Marshal(map[string]any{
+					"choices": []any{map[string]any{"message": map[string]any{"content": `{"ok":true}`}}},
+					"usage": map[string]any{
+						"prompt_tokens": 5000, "completion_tokens": 10, "cost": 0.0004,
+						"prompt_tokens_details": map[string]any{"cached_tokens": 4800},
+					},
+				})
+				return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewReader(body)), Header: http.Header{}}, nil
+			})}
+			e := New("key", StepModels{}).WithHTTPClient(client)
+
+			messages := []message{
+				systemMsg("STABLE", "DYNAMIC"),
+				{Role: "user", Content: []contentPart{{Type: "text", Text: "user"}}},
+			}
+			var dst map[string]any
+			stats, err := e.call(context.Background(), tt.model, "check", messages, `{}`, &dst)
+			if err != nil {
+				t.Fatal(err)
 			}
-			if v == nil {
-				t.Fatalf("field %q not found in output", tt.arrayField)
+			if stats.CachedTokens != 4800 || stats.InputTokens != 5000 || stats.CostUSD != 0.0004 {
+				t.Errorf("stats = %+v", stats)
+			}
+
+			system := sent.Messages[0].Content
+			if len(system) != 2 || system[0].Text != "STABLE" || system[1].Text != "DYNAMIC" {
+				t.Fatalf("system parts = %+v, want stable part before dynamic", system)
 			}
-			if _, isArr := v.([]any); !isArr {
-				t.Errorf("field %q should be array, got %T (%v)", tt.arrayField, v, v)
+			if got := system[0].CacheControl != nil; got != tt.wantBreakpoint {
+				t.Errorf("cache_control on stable part = %v, want %v", got, tt.wantBreakpoint)
+			}
+			if system[1].CacheControl != nil {
+				t.Error("dynamic part must not be a cache breakpoint")
+			}
+			if messages[0].Content.([]contentPart)[0].CacheControl != nil {
+				t.Error("call mutated caller messages")
 			}
 		})
 	}
 }
+
+func TestDecodeImage_TranscodesUnsupportedFormats(t *testing.T) {
+	e := New("key", StepModels{})
+	heic := base64.StdEncoding.EncodeToString([]byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00mif1heic"))
+	if _, _, _, err := e.decodeImage(heic, "openai/gpt-4.1-mini"); err == nil || !strings.Contains(err.Error(), "image/heic") {
+		t.Fatalf("HEIC without decoder: err = %v", err)
+	}
+
+	util.RegisterImageDecoder("image/heic", heicStub{})
+	defer util.RegisterImageDecoder("image/heic", nil)
+	data, mime, st, err := e.decodeImage(heic, "openai/gpt-4.1-mini")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mime != "image/jpeg" || !st.Processed || st.Width != 8 || len(data) != st.BytesOut {
+		t.Errorf("mime = %s, stats = %+v", mime, st)
+	}
+}
+
+type heicStub struct{}
+
+func (heicStub) Decode([]byte) (image.Image, error) {
+	return image.NewGray(image.Rect(0, 0, 8, 4)), nil
+}
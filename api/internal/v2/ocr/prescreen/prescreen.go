@@ -0,0 +1,167 @@
+// Package prescreen оценивает фото перед DETECT локально, без LLM:
+// резкость (дисперсия лапласиана), яркость, контраст, разрешение и
+// пропорции. Явно непригодное фото (тёмное, размытое, слишком маленькое)
+// сразу получает recommend_retake без вызова модели; оценки возвращаются
+// в quality.local для подбора порогов.
+package prescreen
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"llm-proxy/api/internal/metrics"
+	"llm-proxy/api/internal/util"
+	"llm-proxy/api/internal/v2/ocr"
+	"llm-proxy/api/internal/v2/ocr/types"
+)
+
+// Model — значение stats.Model, когда ответ дал пре-скрининг без модели.
+const Model = "local/prescreen"
+
+// Mode — что делать с результатом оценки.
+type Mode string
+
+const (
+	ModeOff     Mode = "off"     // не оценивать
+	ModeObserve Mode = "observe" // только вернуть оценки, решение за моделью
+	ModeEnforce Mode = "enforce" // при превышении порогов отвечать без модели
+)
+
+// ParseMode разбирает режим; пустая строка — off.
+func ParseMode(s string) (Mode, error) {
+	switch m := Mode(strings.ToLower(strings.TrimSpace(s))); m {
+	case "":
+		return ModeOff, nil
+	case ModeOff, ModeObserve, ModeEnforce:
+		return m, nil
+	default:
+		return "", fmt.Errorf("unknown prescreen mode %q; use off, observe or enforce", s)
+	}
+}
+
+// Результаты для метрики.
+const (
+	ResultPass    = "pass"    // пороги не превышены
+	ResultRetake  = "retake"  // пороги превышены
+	ResultSkipped = "skipped" // изображение не декодировалось
+)
+
+var screened = metrics.NewCounter(
+	"llm_proxy_prescreen_total",
+	"Local photo pre-screen results by mode.",
+	"mode", "result",
+)
+
+// Thresholds — пороги пре-скрининга; нулевое значение отключает проверку.
+type Thresholds struct {
+	MinBlur       float64 // blur: дисперсия лапласиана ниже порога
+	MinBrightness float64 // low_light: средняя яркость ниже порога
+	MinContrast   float64 // low_light: СКО яркости ниже порога
+	MinSide       int     // too_small_text: короткая сторона в пикселях меньше порога
+	MaxAspect     float64 // too_small_text: длинная сторона больше короткой в MaxAspect раз
+}
+
+// Issues возвращает проблемы фото по порогам.
+func (t Thresholds) Issues(q util.ImageQuality) []types.QualityIssue {
+	var issues []types.QualityIssue
+	if t.MinBlur > 0 && q.Blur < t.MinBlur {
+		issues = append(issues, types.IssueBlur)
+	}
+	if (t.MinBrightness > 0 && q.Brightness < t.MinBrightness) || (t.MinContrast > 0 && q.Contrast < t.MinContrast) {
+		issues = append(issues, types.IssueLowLight)
+	}
+	// Узкая полоса после вписывания в квадрат модели превращает текст в нечитаемые строки.
+	if (t.MinSide > 0 && min(q.Width, q.Height) < t.MinSide) || (t.MaxAspect > 0 && q.Aspect > t.MaxAspect) {
+		issues = append(issues, types.IssueTooSmallText)
+	}
+	return issues
+}
+
+// Engine — декоратор DETECT; остальные шаги делегируются как есть.
+type Engine struct {
+	ocr.Engine
+	mode       Mode
+	thresholds Thresholds
+}
+
+func New(primary ocr.Engine, mode Mode, thresholds Thresholds) *Engine {
+	return &Engine{Engine: primary, mode: mode, thresholds: thresholds}
+}
+
+func (e *Engine) Detect(ctx context.Context, in types.DetectRequest) (types.DetectResponse, *types.LLMStats, error) {
+	if e.mode == ModeOff {
+		return e.Engine.Detect(ctx, in)
+	}
+	start := time.Now()
+	local, issues, ok := e.screen(in)
+	if !ok {
+		screened.Inc(string(e.mode), ResultSkipped)
+		return e.Engine.Detect(ctx, in)
+	}
+	if len(issues) == 0 {
+		screened.Inc(string(e.mode), ResultPass)
+	} else {
+		screened.Inc(string(e.mode), ResultRetake)
+	}
+
+	if e.mode == ModeEnforce && len(issues) > 0 {
+		out := types.DetectResponse{
+			SchemaVersion: "2.2.2",
+			Quality: types.Quality{
+				RecommendRetake: true,
+				Issues:          issues,
+				Local:           local,
+			},
+			Classification: types.Classification{SubjectCandidate: types.SubjectOther},
+		}
+		return out, &types.LLMStats{Model: Model, LatencyMs: time.Since(start).Milliseconds()}, nil
+	}
+
+	out, stats, err := e.Engine.Detect(ctx, in)
+	if err != nil {
+		return out, stats, err
+	}
+	out.Quality.Local = local
+	return out, stats, nil
+}
+
+// screen оценивает все изображения запроса. ok=false — хотя бы одно не
+// удалось декодировать, и решение остаётся за моделью.
+func (e *Engine) screen(in types.DetectRequest) (local []types.LocalQuality, issues []types.QualityIssue, ok bool) {
+	refs, err := in.AllImages()
+	if err != nil {
+		return nil, nil, false
+	}
+	for _, ref := range refs {
+		data, mimeFromDataURL, _ := util.DecodeBase64MaybeDataURL(ref.Image)
+		if len(data) == 0 {
+			return nil, nil, false
+		}
+		q, err := util.AnalyzeImage(data, util.PickMIME("", mimeFromDataURL, data))
+		if err != nil {
+			return nil, nil, false
+		}
+		found := e.thresholds.Issues(q)
+		local = append(local, types.LocalQuality{
+			Width:      q.Width,
+			Height:     q.Height,
+			Aspect:     round2(q.Aspect),
+			Blur:       round2(q.Blur),
+			Brightness: round2(q.Brightness),
+			Contrast:   round2(q.Contrast),
+			Issues:     found,
+		})
+		for _, issue := range found {
+			if !slices.Contains(issues, issue) {
+				issues = append(issues, issue)
+			}
+		}
+	}
+	return local, issues, true
+}
+
+func round2(v float64) float64 { return math.Round(v*100) / 100 }
@@ -0,0 +1,103 @@
+package prescreen
+
+import (
+	"context"
+	"encoding/base64"
+	"slices"
+	"testing"
+
+	"llm-proxy/api/internal/util/imagetest"
+	"llm-proxy/api/internal/v2/ocr/fake"
+	"llm-proxy/api/internal/v2/ocr/types"
+)
+
+// counting — фейковый движок, считающий вызовы DETECT.
+type counting struct {
+	*fake.Engine
+	calls int
+}
+
+func (c *counting) Detect(ctx context.Context, in types.DetectRequest) (types.DetectResponse, *types.LLMStats, error) {
+	c.calls++
+	return c.Engine.Detect(ctx, in)
+}
+
+// photo кодирует в base64 PNG w×h с клетками яркости lo/hi.
+func photo(w, h int, lo, hi uint8) string {
+	return base64.StdEncoding.EncodeToString(imagetest.Stripes(w, h, lo, hi))
+}
+
+var thresholds = Thresholds{MinBlur: 30, MinBrightness: 35, MinContrast: 12, MinSide: 480, MaxAspect: 4}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name       string
+		mode       Mode
+		image      string
+		wantCalls  int
+		wantRetake bool
+		wantIssues []types.QualityIssue
+		wantLocal  bool
+	}{
+		{"good photo goes to model", ModeEnforce, photo(800, 600, 20, 235), 1, false, nil, true},
+		{"dark photo short-circuits", ModeEnforce, photo(800, 600, 5, 25), 0, true, []types.QualityIssue{types.IssueLowLight}, true},
+		{"flat photo is blurry and dark", ModeEnforce, photo(800, 600, 20, 20), 0, true, []types.QualityIssue{types.IssueBlur, types.IssueLowLight}, true},
+		{"tiny photo", ModeEnforce, photo(300, 200, 20, 235), 0, true, []types.QualityIssue{types.IssueTooSmallText}, true},
+		{"narrow strip", ModeEnforce, photo(1000, 200, 20, 235), 0, true, []types.QualityIssue{types.IssueTooSmallText}, true},
+		{"observe never short-circuits", ModeObserve, photo(800, 600, 5, 25), 1, false, nil, true},
+		{"undecodable image is skipped", ModeEnforce, base64.StdEncoding.EncodeToString([]byte("not an image")), 1, false, nil, false},
+		{"off", ModeOff, photo(800, 600, 5, 25), 1, false, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			primary := &counting{Engine: fake.New(fake.Options{})}
+			out, stats, err := New(primary, tt.mode, thresholds).Detect(context.Background(), types.DetectRequest{Image: tt.image})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if primary.calls != tt.wantCalls {
+				t.Errorf("engine calls = %d, want %d", primary.calls, tt.wantCalls)
+			}
+			if tt.wantRetake {
+				if !out.Quality.RecommendRetake || !slices.Equal(out.Quality.Issues, tt.wantIssues) {
+					t.Errorf("quality = %+v, want issues %v", out.Quality, tt.wantIssues)
+				}
+				if stats == nil || stats.Model != Model {
+					t.Errorf("stats = %+v", stats)
+				}
+			}
+			if got := len(out.Quality.Local) == 1; got != tt.wantLocal {
+				t.Errorf("local = %+v", out.Quality.Local)
+			}
+		})
+	}
+}
+
+func TestDetect_MultiImageMergesIssues(t *testing.T) {
+	primary := &counting{Engine: fake.New(fake.Options{})}
+	in := types.DetectRequest{
+		Image:  photo(800, 600, 20, 235),
+		Images: []types.ImageRef{{Image: photo(800, 600, 5, 25), Role: "answer"}},
+	}
+	out, _, err := New(primary, ModeEnforce, thresholds).Detect(context.Background(), in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if primary.calls != 0 || !out.Quality.RecommendRetake || len(out.Quality.Local) != 2 {
+		t.Fatalf("calls = %d, quality = %+v", primary.calls, out.Quality)
+	}
+	if len(out.Quality.Local[0].Issues) != 0 || !slices.Equal(out.Quality.Local[1].Issues, []types.QualityIssue{types.IssueLowLight}) {
+		t.Errorf("per-image issues = %+v", out.Quality.Local)
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	for in, want := range map[string]Mode{"": ModeOff, "Observe": ModeObserve, " enforce ": ModeEnforce} {
+		if got, err := ParseMode(in); err != nil || got != want {
+			t.Errorf("ParseMode(%q) = %q, %v", in, got, err)
+		}
+	}
+	if _, err := ParseMode("strict"); err == nil {
+		t.Error("want error for unknown mode")
+	}
+}
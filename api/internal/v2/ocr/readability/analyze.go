@@ -0,0 +1,153 @@
+package readability
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"llm-proxy/api/internal/util"
+	"llm-proxy/api/internal/v2/prompt"
+)
+
+// Metrics — показатели читаемости русского текста.
+type Metrics struct {
+	Sentences        int
+	Words            int     // слова из букв; числа не считаются
+	MaxSentenceWords int     // самое длинное предложение
+	AvgWordLetters   float64 // средняя длина слова в буквах
+	AvgSyllables     float64 // среднее число слогов в слове
+	MaxWordSyllables int
+	LongestWord      string
+}
+
+var reSentenceEnd = regexp.MustCompile(`[.!?…]+|\n+`)
+
+// syllables — число слогов: в русском слове их столько же, сколько гласных.
+func syllables(word string) int {
+	n := 0
+	for _, r := range word {
+		if strings.ContainsRune("аеёиоуыэюяАЕЁИОУЫЭЮЯ", r) {
+			n++
+		}
+	}
+	return n
+}
+
+// words — слова предложения: буквы, возможно через дефис ("какой-то").
+func words(sentence string) []string {
+	return strings.FieldsFunc(sentence, func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '-'
+	})
+}
+
+// Analyze считает длину предложений и слов и число слогов.
+func Analyze(text string) Metrics {
+	var m Metrics
+	var letters, syl int
+	for _, sentence := range reSentenceEnd.Split(text, -1) {
+		n := 0
+		for _, w := range words(sentence) {
+			w = strings.Trim(w, "-")
+			if w == "" {
+				continue
+			}
+			n++
+			letters += len([]rune(w))
+			s := syllables(w)
+			syl += s
+			if s > m.MaxWordSyllables {
+				m.MaxWordSyllables, m.LongestWord = s, w
+			}
+		}
+		if n == 0 {
+			continue
+		}
+		m.Sentences++
+		m.Words += n
+		m.MaxSentenceWords = max(m.MaxSentenceWords, n)
+	}
+	if m.Words > 0 {
+		m.AvgWordLetters = float64(letters) / float64(m.Words)
+		m.AvgSyllables = float64(syl) / float64(m.Words)
+	}
+	return m
+}
+
+// Thresholds — пороги класса. Terms — термины, которые ещё не изучены:
+// слово со звёздочкой на конце — основа ("слагаем*"), иначе точная форма.
+type Thresholds struct {
+	MaxSentenceWords int      `json:"max_sentence_words"`
+	MaxAvgSyllables  float64  `json:"max_avg_syllables"`
+	MaxWordSyllables int      `json:"max_word_syllables"`
+	Terms            []string `json:"terms"`
+
+	terms *regexp.Regexp
+}
+
+// grades — пороги из prompt/readability.json по подкаталогу класса.
+var grades = mustParseThresholds(prompt.Readability)
+
+func mustParseThresholds(raw string) map[string]Thresholds {
+	var m map[string]Thresholds
+	if err := json.Unmarshal([]byte(raw), &m); err != nil {
+		panic(fmt.Sprintf("readability.json: %v", err))
+	}
+	for k, t := range m {
+		t.compile()
+		m[k] = t
+	}
+	return m
+}
+
+func (t *Thresholds) compile() {
+	var alts []string
+	for _, term := range t.Terms {
+		term = strings.ReplaceAll(strings.ToLower(strings.TrimSpace(term)), "ё", "е")
+		if stem, ok := strings.CutSuffix(term, "*"); ok {
+			alts = append(alts, regexp.QuoteMeta(stem)+`\p{L}*`)
+		} else if term != "" {
+			alts = append(alts, regexp.QuoteMeta(term))
+		}
+	}
+	if len(alts) > 0 {
+		t.terms = regexp.MustCompile(`(?:^|[^\p{L}])(` + strings.Join(alts, "|") + `)(?:$|[^\p{L}])`)
+	}
+}
+
+// ForGrade возвращает пороги класса 1–4; ok=false — класс неизвестен.
+func ForGrade(grade int) (Thresholds, bool) {
+	t, ok := grades[util.GradeSubdir(grade)]
+	return t, ok
+}
+
+// Issues возвращает превышения порогов: длинные предложения и слова,
+// средняя сложность слов, термины не по классу.
+func (t Thresholds) Issues(text string) []string {
+	if strings.TrimSpace(text) == "" {
+		return nil
+	}
+	m := Analyze(text)
+	var out []string
+	if t.MaxSentenceWords > 0 && m.MaxSentenceWords > t.MaxSentenceWords {
+		out = append(out, fmt.Sprintf("sentence of %d words > %d", m.MaxSentenceWords, t.MaxSentenceWords))
+	}
+	if t.MaxWordSyllables > 0 && m.MaxWordSyllables > t.MaxWordSyllables {
+		out = append(out, fmt.Sprintf("word %q has %d syllables > %d", m.LongestWord, m.MaxWordSyllables, t.MaxWordSyllables))
+	}
+	if t.MaxAvgSyllables > 0 && m.AvgSyllables > t.MaxAvgSyllables {
+		out = append(out, fmt.Sprintf("%.1f syllables per word > %.1f", m.AvgSyllables, t.MaxAvgSyllables))
+	}
+	if t.terms != nil {
+		norm := strings.ReplaceAll(strings.ToLower(text), "ё", "е")
+		seen := map[string]bool{}
+		for _, sm := range t.terms.FindAllStringSubmatch(norm, -1) {
+			if !seen[sm[1]] {
+				seen[sm[1]] = true
+				out = append(out, fmt.Sprintf("term %q", sm[1]))
+			}
+		}
+	}
+	return out
+}
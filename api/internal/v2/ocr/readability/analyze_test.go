@@ -0,0 +1,60 @@
+package readability
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAnalyze(t *testing.T) {
+	m := Analyze("Посмотри на картинку. Сколько всего яблок? Посчитай 12 яблок ещё раз!")
+	if m.Sentences != 3 {
+		t.Errorf("Sentences = %d, want 3", m.Sentences)
+	}
+	if m.Words != 10 {
+		t.Errorf("Words = %d, want 10 (numbers are not words)", m.Words)
+	}
+	if m.MaxSentenceWords != 4 {
+		t.Errorf("MaxSentenceWords = %d, want 4", m.MaxSentenceWords)
+	}
+	if m.MaxWordSyllables != 3 || m.LongestWord != "Посмотри" {
+		t.Errorf("longest = %q (%d), want Посмотри (3)", m.LongestWord, m.MaxWordSyllables)
+	}
+	if got := syllables("слагаемое"); got != 5 {
+		t.Errorf("syllables(слагаемое) = %d, want 5", got)
+	}
+}
+
+func TestThresholds_Issues(t *testing.T) {
+	tests := []struct {
+		grade int
+		text  string
+		want  []string // подстроки ожидаемых замечаний; nil — текст подходит
+	}{
+		{1, "Посмотри внимательно на последнее число.", nil},
+		{1, "Найди сумму: сложи первое слагаемое и второе.", []string{`term "слагаемое"`}},
+		{3, "Найди сумму: сложи первое слагаемое и второе.", nil},
+		{1, "Чтобы узнать, сколько всего конфет стало у Маши, нужно к тем конфетам, что были, прибавить ещё подаренные.", []string{"sentence of 17 words > 12"}},
+		{2, "Внимательнейшие рассматривания.", []string{"syllables per word"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			th, ok := ForGrade(tt.grade)
+			if !ok {
+				t.Fatalf("ForGrade(%d) not found", tt.grade)
+			}
+			got := th.Issues(tt.text)
+			if tt.want == nil && len(got) != 0 {
+				t.Fatalf("Issues() = %q, want none", got)
+			}
+			joined := strings.Join(got, "; ")
+			for _, w := range tt.want {
+				if !strings.Contains(joined, w) {
+					t.Errorf("Issues() = %q, want %q", got, w)
+				}
+			}
+		})
+	}
+	if _, ok := ForGrade(0); ok {
+		t.Error("unknown grade must have no thresholds")
+	}
+}
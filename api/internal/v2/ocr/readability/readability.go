@@ -0,0 +1,168 @@
+// Package readability следит, чтобы подсказки и feedback CHECK были по силам
+// ученику своего класса: короткие предложения, простые слова, без терминов,
+// которые ещё не изучены ("слагаемое" в 1 классе). Пороги по классам —
+// prompt/readability.json, ключ — подкаталог класса промптов. При превышении
+// модель один раз переписывает текст (режим retry); если не помогло — или в
+// режиме warn — к ответу прикладывается предупреждение в warnings.
+package readability
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"llm-proxy/api/internal/metrics"
+	"llm-proxy/api/internal/v2/ocr"
+	"llm-proxy/api/internal/v2/ocr/types"
+)
+
+// Mode — что делать с превышением порогов.
+type Mode string
+
+const (
+	ModeOff   Mode = "off"   // не проверять
+	ModeWarn  Mode = "warn"  // только предупреждение в ответе
+	ModeRetry Mode = "retry" // одна повторная генерация, затем предупреждение
+)
+
+// ParseMode разбирает режим; пустая строка — warn.
+func ParseMode(s string) (Mode, error) {
+	switch m := Mode(strings.ToLower(strings.TrimSpace(s))); m {
+	case "":
+		return ModeWarn, nil
+	case ModeOff, ModeWarn, ModeRetry:
+		return m, nil
+	default:
+		return "", fmt.Errorf("unknown readability mode %q; use off, warn or retry", s)
+	}
+}
+
+// Итоги проверки для stats.Readability и метрики.
+const (
+	ResultOK      = "ok"      // пороги не превышены
+	ResultRetried = "retried" // превышение устранено повторной генерацией
+	ResultWarned  = "warned"  // превышение осталось, в ответе warnings
+	ResultSkipped = "skipped" // класс неизвестен
+)
+
+// WarningPrefix — начало предупреждения в warnings ответа.
+const WarningPrefix = "readability: "
+
+var checked = metrics.NewCounter(
+	"llm_proxy_readability_total",
+	"Grade readability checks of hints and check feedback by result.",
+	"step", "result",
+)
+
+const correctionText = "Текст слишком сложен для ученика %d класса: %s. Перепиши проще: предложения не длиннее %d слов, " +
+	"короткие знакомые слова, без терминов, которых ученик ещё не знает. Смысл и структуру ответа не меняй."
+
+// Engine — декоратор Hint и CheckSolution; остальные шаги делегируются как есть.
+type Engine struct {
+	ocr.Engine
+	mode Mode
+}
+
+func New(primary ocr.Engine, mode Mode) *Engine {
+	return &Engine{Engine: primary, mode: mode}
+}
+
+// hintIssues — превышения по каждой подсказке: "1/L2: sentence of 18 words > 12".
+func hintIssues(r types.HintResponse, t Thresholds) []string {
+	var out []string
+	for _, item := range r.Items {
+		for _, h := range item.Hints {
+			for _, issue := range t.Issues(h.HintText) {
+				out = append(out, fmt.Sprintf("%s/%s: %s", item.ItemId, h.Level, issue))
+			}
+		}
+	}
+	return out
+}
+
+func feedbackIssues(r types.CheckResponse, t Thresholds) []string {
+	var out []string
+	for _, issue := range t.Issues(r.Feedback) {
+		out = append(out, "feedback: "+issue)
+	}
+	return out
+}
+
+func warnings(issues []string) []string {
+	out := make([]string, len(issues))
+	for i, issue := range issues {
+		out[i] = WarningPrefix + issue
+	}
+	return out
+}
+
+func (e *Engine) Hint(ctx context.Context, in types.HintRequest) (types.HintResponse, *types.LLMStats, error) {
+	out, stats, err := e.Engine.Hint(ctx, in)
+	if err != nil || e.mode == ModeOff {
+		return out, stats, err
+	}
+	t, ok := ForGrade(in.Task.Grade)
+	if !ok {
+		return out, record(stats, "hint", ResultSkipped), nil
+	}
+	issues := hintIssues(out, t)
+	if len(issues) == 0 {
+		return out, record(stats, "hint", ResultOK), nil
+	}
+	log.Printf("[readability] hint task=%s grade=%d: %s", in.Task.TaskId, in.Task.Grade, strings.Join(issues, "; "))
+	if e.mode == ModeRetry {
+		retryIn := in
+		retryIn.Correction = fmt.Sprintf(correctionText, in.Task.Grade, strings.Join(issues, "; "), t.MaxSentenceWords)
+		retried, retryStats, retryErr := e.Engine.Hint(ctx, retryIn)
+		if retryErr != nil {
+			log.Printf("[readability] hint task=%s retry failed: %v", in.Task.TaskId, retryErr)
+			stats = stats.Plus(retryStats)
+		} else if again := hintIssues(retried, t); len(again) > 0 {
+			out, issues, stats = retried, again, stats.Retry(retryStats)
+		} else {
+			return retried, record(stats.Retry(retryStats), "hint", ResultRetried), nil
+		}
+	}
+	out.Warnings = append(out.Warnings, warnings(issues)...)
+	return out, record(stats, "hint", ResultWarned), nil
+}
+
+func (e *Engine) CheckSolution(ctx context.Context, in types.CheckRequest) (types.CheckResponse, *types.LLMStats, error) {
+	out, stats, err := e.Engine.CheckSolution(ctx, in)
+	if err != nil || e.mode == ModeOff {
+		return out, stats, err
+	}
+	grade := int(in.Student.Grade)
+	t, ok := ForGrade(grade)
+	if !ok {
+		return out, record(stats, "check", ResultSkipped), nil
+	}
+	issues := feedbackIssues(out, t)
+	if len(issues) == 0 {
+		return out, record(stats, "check", ResultOK), nil
+	}
+	log.Printf("[readability] check grade=%d: %s", grade, strings.Join(issues, "; "))
+	if e.mode == ModeRetry {
+		retryIn := in
+		retryIn.Correction = fmt.Sprintf(correctionText, grade, strings.Join(issues, "; "), t.MaxSentenceWords)
+		retried, retryStats, retryErr := e.Engine.CheckSolution(ctx, retryIn)
+		if retryErr != nil {
+			log.Printf("[readability] check retry failed: %v", retryErr)
+			stats = stats.Plus(retryStats)
+		} else if again := feedbackIssues(retried, t); len(again) > 0 {
+			out, issues, stats = retried, again, stats.Retry(retryStats)
+		} else {
+			return retried, record(stats.Retry(retryStats), "check", ResultRetried), nil
+		}
+	}
+	out.Warnings = append(out.Warnings, warnings(issues)...)
+	return out, record(stats, "check", ResultWarned), nil
+}
+
+func record(stats *types.LLMStats, step, result string) *types.LLMStats {
+	checked.Inc(step, result)
+	stats = stats.OrEmpty()
+	stats.Readability = result
+	return stats
+}
@@ -0,0 +1,73 @@
+package readability
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"llm-proxy/api/internal/v2/ocr/ocrtest"
+	"llm-proxy/api/internal/v2/ocr/types"
+)
+
+const (
+	simple  = "Посмотри, сколько всего яблок."
+	complex = "Сложи первое слагаемое и второе."
+)
+
+func TestHint(t *testing.T) {
+	tests := []struct {
+		name      string
+		mode      Mode
+		grade     int
+		texts     []string
+		want      string
+		warnings  int
+		wantCalls int
+	}{
+		{"ok", ModeRetry, 1, []string{simple}, ResultOK, 0, 1},
+		{"retried", ModeRetry, 1, []string{complex, simple}, ResultRetried, 0, 2},
+		{"retry still complex", ModeRetry, 1, []string{complex, complex}, ResultWarned, 1, 2},
+		{"warn only", ModeWarn, 1, []string{complex}, ResultWarned, 1, 1},
+		{"term allowed in grade 3", ModeRetry, 3, []string{complex}, ResultOK, 0, 1},
+		{"unknown grade", ModeRetry, 0, []string{complex}, ResultSkipped, 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := ocrtest.NewQueue(tt.texts...)
+			in := types.HintRequest{Task: types.ParseTask{Grade: tt.grade}}
+			out, stats, err := New(s, tt.mode).Hint(context.Background(), in)
+			if err != nil {
+				t.Fatalf("Hint() error = %v", err)
+			}
+			if stats.Readability != tt.want {
+				t.Errorf("Readability = %q, want %q", stats.Readability, tt.want)
+			}
+			if len(out.Warnings) != tt.warnings {
+				t.Errorf("Warnings = %q, want %d", out.Warnings, tt.warnings)
+			}
+			for _, w := range out.Warnings {
+				if !strings.HasPrefix(w, WarningPrefix+"1/L1: ") {
+					t.Errorf("warning %q: want item and level", w)
+				}
+			}
+			if s.Calls() != tt.wantCalls {
+				t.Fatalf("calls = %d, want %d", s.Calls(), tt.wantCalls)
+			}
+			if tt.wantCalls == 2 && !strings.Contains(s.Corrections[1], "1 класса") {
+				t.Errorf("correction = %q, want grade", s.Corrections[1])
+			}
+		})
+	}
+}
+
+func TestCheckSolution(t *testing.T) {
+	s := ocrtest.NewQueue(complex, simple)
+	in := types.CheckRequest{Student: types.StudentCheck{Grade: 1}}
+	out, stats, err := New(s, ModeRetry).CheckSolution(context.Background(), in)
+	if err != nil {
+		t.Fatalf("CheckSolution() error = %v", err)
+	}
+	if stats.Readability != ResultRetried || out.Feedback != simple || len(out.Warnings) != 0 {
+		t.Errorf("got readability=%q feedback=%q warnings=%q", stats.Readability, out.Feedback, out.Warnings)
+	}
+}
@@ -0,0 +1,187 @@
+package respcache
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const minSweepInterval = time.Minute
+
+// disk — второй уровень кэша: по файлу на ключ в каталоге dir.
+// Переживает рестарт. Устаревшие файлы удаляются при чтении и периодической
+// чисткой; при превышении квоты вытесняются самые старые записи.
+type disk struct {
+	dir   string
+	ttl   time.Duration
+	quota int64 // суммарный объём файлов; 0 — без квоты
+	now   func() time.Time
+
+	mu   sync.Mutex
+	used int64 // суммарный размер файлов
+}
+
+func newDisk(dir string, ttl time.Duration, quota int64) (*disk, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("respcache: create %s: %w", dir, err)
+	}
+	d := &disk{dir: dir, ttl: ttl, quota: quota, now: time.Now}
+	d.sweep()
+	if ttl > 0 {
+		go d.janitor(max(ttl/4, minSweepInterval))
+	}
+	return d, nil
+}
+
+func (d *disk) path(key string) string {
+	// Подкаталог по первым символам ключа, чтобы не копить всё в одной папке.
+	return filepath.Join(d.dir, key[:2], key+".json")
+}
+
+func (d *disk) get(key string) (*entry, bool) {
+	raw, err := os.ReadFile(d.path(key))
+	if err != nil {
+		return nil, false
+	}
+	var e entry
+	if err := json.Unmarshal(raw, &e); err != nil {
+		d.remove(d.path(key), int64(len(raw)))
+		return nil, false
+	}
+	if d.ttl > 0 && d.now().Sub(e.StoredAt) > d.ttl {
+		d.remove(d.path(key), int64(len(raw)))
+		return nil, false
+	}
+	e.key = key
+	return &e, true
+}
+
+// put пишет запись атомарно: во временный файл, затем rename. Если запись
+// не помещается в квоту, сначала вытесняются старые.
+func (d *disk) put(e *entry) error {
+	p := d.path(e.key)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	raw, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	size := int64(len(raw))
+	if d.quota > 0 && size > d.quota {
+		return fmt.Errorf("entry of %d bytes exceeds disk quota %d", size, d.quota)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.quota > 0 && d.used+size > d.quota {
+		d.sweepLocked(size)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	var replaced int64
+	if st, err := os.Stat(p); err == nil {
+		replaced = st.Size()
+	}
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	d.used += size - replaced
+	return nil
+}
+
+func (d *disk) remove(p string, size int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if os.Remove(p) == nil {
+		d.used -= size
+	}
+}
+
+// sweep удаляет устаревшие записи, вытесняет лишние по квоте и
+// пересчитывает занятый объём. Возвращает число удалённых файлов.
+func (d *disk) sweep() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.sweepLocked(0)
+}
+
+// sweepLocked освобождает место под запись размера reserve: при
+// превышении квоты удаляются самые старые файлы, пока занятый объём вместе
+// с reserve не опустится до 90% квоты, — чтобы не обходить каталог на
+// каждой записи.
+func (d *disk) sweepLocked(reserve int64) int {
+	type file struct {
+		path  string
+		size  int64
+		mtime time.Time
+	}
+	now := d.now()
+	var (
+		files   []file
+		used    int64
+		removed int
+	)
+	_ = filepath.WalkDir(d.dir, func(p string, de fs.DirEntry, err error) error {
+		if err != nil || de.IsDir() {
+			return nil
+		}
+		info, err := de.Info()
+		if err != nil {
+			return nil
+		}
+		// Недописанные временные файлы остаются от падения между записью и rename.
+		if strings.HasPrefix(de.Name(), ".tmp-") || (d.ttl > 0 && now.Sub(info.ModTime()) > d.ttl) {
+			if os.Remove(p) == nil {
+				removed++
+			}
+			return nil
+		}
+		files = append(files, file{p, info.Size(), info.ModTime()})
+		used += info.Size()
+		return nil
+	})
+	if d.quota > 0 && used+reserve > d.quota {
+		target := d.quota/10*9 - reserve
+		slices.SortFunc(files, func(a, b file) int { return a.mtime.Compare(b.mtime) })
+		for _, f := range files {
+			if used <= target {
+				break
+			}
+			if os.Remove(f.path) == nil {
+				used -= f.size
+				removed++
+			}
+		}
+	}
+	d.used = used
+	return removed
+}
+
+func (d *disk) janitor(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for range t.C {
+		if n := d.sweep(); n > 0 {
+			log.Printf("[respcache] removed %d disk entries", n)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package respcache
+
+import (
+	"container/list"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"llm-proxy/api/internal/v2/ocr/types"
+)
+
+// entry — сохранённый ответ шага: JSON ответа и статистика исходного вызова.
+type entry struct {
+	StoredAt time.Time       `json:"stored_at"`
+	Response json.RawMessage `json:"response"`
+	Stats    *types.LLMStats `json:"stats,omitempty"`
+	key      string
+}
+
+// lru — потокобезопасный LRU ограниченного размера с TTL записей.
+type lru struct {
+	mu    sync.Mutex
+	size  int
+	ttl   time.Duration
+	order *list.List // front — самая свежая
+	items map[string]*list.Element
+	now   func() time.Time
+}
+
+func newLRU(size int, ttl time.Duration) *lru {
+	return &lru{size: size, ttl: ttl, order: list.New(), items: map[string]*list.Element{}, now: time.Now}
+}
+
+func (c *lru) get(key string) (*entry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*entry)
+	if c.ttl > 0 && c.now().Sub(e.StoredAt) > c.ttl {
+		c.order.Remove(el)
+		delete(c.items, key)
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return e, true
+}
+
+func (c *lru) put(e *entry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[e.key]; ok {
+		el.Value = e
+		c.order.MoveToFront(el)
+		return
+	}
+	c.items[e.key] = c.order.PushFront(e)
+	for c.order.Len() > c.size {
+		last := c.order.Back()
+		c.order.Remove(last)
+		delete(c.items, last.Value.(*entry).key)
+	}
+}
+
+func (c *lru) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
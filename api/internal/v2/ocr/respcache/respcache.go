@@ -0,0 +1,249 @@
+// Package respcache кэширует ответы detect и parse. Дети часто присылают одно
+// и то же фото повторно (ретрай, ещё одна подсказка, проверка после подсказки),
+// и каждый раз платить за detect и parse заново незачем.
+//
+// Ключ — SHA-256 от декодированных байтов изображения (util.SHA256Hex), шага,
+// движка и модели, хеша промпта и значимых полей запроса. Первый уровень —
+// in-memory LRU, второй (опционально) — каталог на диске; у обоих TTL.
+// Результат поиска попадает в LLMStats.Cache (заголовок X-LLM-Cache) и метрики;
+// заголовок X-Cache-Bypass: 1 или Cache-Control: no-cache обходит кэш.
+package respcache
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"llm-proxy/api/internal/metrics"
+	"llm-proxy/api/internal/util"
+	"llm-proxy/api/internal/v2/ocr"
+	"llm-proxy/api/internal/v2/ocr/types"
+)
+
+// Шаги, ответы которых кэшируются.
+const (
+	StepDetect = "detect"
+	StepParse  = "parse"
+)
+
+// Значения LLMStats.Cache.
+const (
+	ResultMemoryHit = "hit-memory"
+	ResultDiskHit   = "hit-disk"
+	ResultMiss      = "miss"
+	ResultBypass    = "bypass"
+)
+
+// HeaderBypass — заголовок запроса, отключающий кэш для этого запроса.
+const HeaderBypass = "X-Cache-Bypass"
+
+var lookups = metrics.NewCounter(
+	"llm_proxy_response_cache_total",
+	"Response cache lookups by step and result.",
+	"step", "result",
+)
+
+// Fingerprinter — движок, сообщающий модель и хеш промпта шага. Без него
+// ключ строится по имени движка, и смена промпта не инвалидирует кэш до TTL.
+type Fingerprinter interface {
+	CacheFingerprint(step string) (model, promptHash string)
+}
+
+// Options — настройки кэша.
+type Options struct {
+	Size      int           // максимум записей в памяти
+	TTL       time.Duration // время жизни записи; 0 — без ограничения
+	Dir       string        // каталог дискового уровня; пусто — только память
+	DiskQuota int64         // суммарный объём дискового уровня в байтах; 0 — без квоты
+}
+
+// Cache — двухуровневое хранилище ответов; общее для всех движков.
+type Cache struct {
+	mem  *lru
+	disk *disk
+}
+
+func New(opts Options) (*Cache, error) {
+	if opts.Size <= 0 {
+		opts.Size = 1000
+	}
+	c := &Cache{mem: newLRU(opts.Size, opts.TTL)}
+	if opts.Dir != "" {
+		d, err := newDisk(opts.Dir, opts.TTL, opts.DiskQuota)
+		if err != nil {
+			return nil, err
+		}
+		c.disk = d
+	}
+	return c, nil
+}
+
+func (c *Cache) get(key string) (*entry, string) {
+	if e, ok := c.mem.get(key); ok {
+		return e, ResultMemoryHit
+	}
+	if c.disk != nil {
+		if e, ok := c.disk.get(key); ok {
+			c.mem.put(e)
+			return e, ResultDiskHit
+		}
+	}
+	return nil, ResultMiss
+}
+
+func (c *Cache) put(e *entry) {
+	c.mem.put(e)
+	if c.disk != nil {
+		if err := c.disk.put(e); err != nil {
+			log.Printf("[respcache] disk write: %v", err)
+		}
+	}
+}
+
+// ─── per-request bypass ───────────────────────────────────────────────────────
+
+type bypassKey struct{}
+
+// WithBypass помечает контекст: кэш не читается и не пополняется.
+func WithBypass(ctx context.Context) context.Context {
+	return context.WithValue(ctx, bypassKey{}, true)
+}
+
+func bypassed(ctx context.Context) bool {
+	v, _ := ctx.Value(bypassKey{}).(bool)
+	return v
+}
+
+// Middleware переносит X-Cache-Bypass / Cache-Control: no-cache в контекст.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if wantsBypass(r) {
+			r = r.WithContext(WithBypass(r.Context()))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func wantsBypass(r *http.Request) bool {
+	switch strings.ToLower(strings.TrimSpace(r.Header.Get(HeaderBypass))) {
+	case "1", "true", "yes":
+		return true
+	}
+	cc := strings.ToLower(r.Header.Get("Cache-Control"))
+	return strings.Contains(cc, "no-cache") || strings.Contains(cc, "no-store")
+}
+
+// ─── engine decorator ─────────────────────────────────────────────────────────
+
+// Engine — декоратор движка: Detect и Parse идут через кэш, остальное — напрямую.
+type Engine struct {
+	ocr.Engine
+	cache *Cache
+}
+
+func Wrap(primary ocr.Engine, cache *Cache) *Engine {
+	return &Engine{Engine: primary, cache: cache}
+}
+
+func (e *Engine) Detect(ctx context.Context, in types.DetectRequest) (types.DetectResponse, *types.LLMStats, error) {
+	fields := in
+	fields.Image, fields.Images = "", nil
+	return cached(e, ctx, StepDetect, imagesHash(in.Image, in.Images), fields, in, e.Engine.Detect)
+}
+
+func (e *Engine) Parse(ctx context.Context, in types.ParseRequest) (types.ParseResponse, *types.LLMStats, error) {
+	fields := in
+	fields.Image, fields.Images = "", nil
+	return cached(e, ctx, StepParse, imagesHash(in.Image, in.Images), fields, in, e.Engine.Parse)
+}
+
+// key собирает ключ записи. fields — запрос без изображений, imgHash — их хеш.
+func (e *Engine) key(step, imgHash string, fields any) string {
+	model, promptHash := e.Engine.Name(), ""
+	if f, ok := e.Engine.(Fingerprinter); ok {
+		model, promptHash = f.CacheFingerprint(step)
+	}
+	fieldsJSON, _ := json.Marshal(fields)
+	parts := []string{step, e.Engine.Name(), model, promptHash, imgHash, string(fieldsJSON)}
+	return util.SHA256Hex([]byte(strings.Join(parts, "\x00")))
+}
+
+func cached[I, T any](
+	e *Engine, ctx context.Context, step, imgHash string, fields any, in I,
+	run func(context.Context, I) (T, *types.LLMStats, error),
+) (T, *types.LLMStats, error) {
+	if bypassed(ctx) {
+		lookups.Inc(step, ResultBypass)
+		out, stats, err := run(ctx, in)
+		return out, withResult(stats, ResultBypass), err
+	}
+
+	start := time.Now()
+	key := e.key(step, imgHash, fields)
+	if hit, result := e.cache.get(key); hit != nil {
+		var out T
+		if err := json.Unmarshal(hit.Response, &out); err == nil {
+			lookups.Inc(step, result)
+			return out, hitStats(hit.Stats, result, time.Since(start)), nil
+		}
+	}
+	lookups.Inc(step, ResultMiss)
+
+	out, stats, err := run(ctx, in)
+	if err != nil {
+		return out, stats, err
+	}
+	if raw, merr := json.Marshal(out); merr == nil {
+		var snap *types.LLMStats
+		if stats != nil {
+			s := *stats
+			snap = &s
+		}
+		e.cache.put(&entry{key: key, StoredAt: time.Now().UTC(), Response: raw, Stats: snap})
+	}
+	return out, withResult(stats, ResultMiss), nil
+}
+
+// hitStats описывает попадание: модель и промпт исходного вызова, но ни
+// токенов, ни стоимости — провайдер в этот раз не вызывался.
+func hitStats(orig *types.LLMStats, result string, latency time.Duration) *types.LLMStats {
+	s := &types.LLMStats{LatencyMs: latency.Milliseconds(), Cache: result}
+	if orig != nil {
+		s.Model = orig.Model
+		s.PromptHash = orig.PromptHash
+		s.PromptBlocks = orig.PromptBlocks
+	}
+	return s
+}
+
+func withResult(stats *types.LLMStats, result string) *types.LLMStats {
+	if stats != nil {
+		stats.Cache = result
+	}
+	return stats
+}
+
+// imagesHash хеширует изображения запроса вместе с ролями. Запрос только с
+// полем image даёт тот же хеш, что и до появления images.
+func imagesHash(image string, refs []types.ImageRef) string {
+	if len(refs) == 0 {
+		return imageHash(image)
+	}
+	parts := []string{imageHash(image)}
+	for _, ref := range refs {
+		parts = append(parts, ref.Role+"="+imageHash(ref.Image))
+	}
+	return util.SHA256Hex([]byte(strings.Join(parts, "\x00")))
+}
+
+// imageHash хеширует декодированные байты изображения, чтобы data:URL и
+// «голый» base64 одного фото давали один ключ.
+func imageHash(image string) string {
+	if b, _, err := util.DecodeBase64MaybeDataURL(image); err == nil && len(b) > 0 {
+		return util.SHA256Hex(b)
+	}
+	return util.SHA256Hex([]byte(image))
+}
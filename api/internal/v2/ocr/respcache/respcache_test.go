@@ -0,0 +1,162 @@
+package respcache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"llm-proxy/api/internal/v2/ocr/fake"
+	"llm-proxy/api/internal/v2/ocr/types"
+)
+
+// counting — фейковый движок, считающий вызовы провайдера.
+type counting struct {
+	*fake.Engine
+	detects, parses int
+}
+
+func (c *counting) Detect(ctx context.Context, in types.DetectRequest) (types.DetectResponse, *types.LLMStats, error) {
+	c.detects++
+	out, stats, err := c.Engine.Detect(ctx, in)
+	if stats != nil {
+		stats.CostUSD = 0.01
+	}
+	return out, stats, err
+}
+
+func (c *counting) Parse(ctx context.Context, in types.ParseRequest) (types.ParseResponse, *types.LLMStats, error) {
+	c.parses++
+	return c.Engine.Parse(ctx, in)
+}
+
+const img = "aGVsbG8gd29ybGQ=" // "hello world"
+
+func TestCache_DetectHitByDecodedImage(t *testing.T) {
+	cache, _ := New(Options{Size: 10, TTL: time.Hour})
+	eng := &counting{Engine: fake.New(fake.Options{})}
+	e := Wrap(eng, cache)
+	ctx := context.Background()
+
+	_, stats, err := e.Detect(ctx, types.DetectRequest{Image: img, Locale: "ru-RU"})
+	if err != nil || stats.Cache != ResultMiss {
+		t.Fatalf("first call: cache=%q err=%v", stats.Cache, err)
+	}
+	// То же фото как data:URL — тот же ключ.
+	out, stats, err := e.Detect(ctx, types.DetectRequest{Image: "data:image/jpeg;base64," + img, Locale: "ru-RU"})
+	if err != nil || stats.Cache != ResultMemoryHit || stats.CostUSD != 0 || stats.Model == "" {
+		t.Fatalf("second call: stats=%+v err=%v", stats, err)
+	}
+	if out.Classification.SubjectCandidate == "" {
+		t.Errorf("cached response is empty: %+v", out)
+	}
+	if eng.detects != 1 {
+		t.Errorf("provider calls = %d, want 1", eng.detects)
+	}
+	if lookups.Value(StepDetect, ResultMemoryHit) < 1 {
+		t.Error("hit not counted in metrics")
+	}
+
+	// Другие поля запроса — другой ключ.
+	if _, stats, _ := e.Detect(ctx, types.DetectRequest{Image: img, Locale: "en-US"}); stats.Cache != ResultMiss {
+		t.Errorf("different locale: cache=%q", stats.Cache)
+	}
+	// Обход кэша.
+	if _, stats, _ := e.Detect(WithBypass(ctx), types.DetectRequest{Image: img, Locale: "ru-RU"}); stats.Cache != ResultBypass || eng.detects != 3 {
+		t.Errorf("bypass: cache=%q calls=%d", stats.Cache, eng.detects)
+	}
+}
+
+func TestCache_DiskTierAndTTL(t *testing.T) {
+	dir := t.TempDir()
+	in := types.ParseRequest{Image: img, TaskId: "t1", Grade: 2}
+
+	first, _ := New(Options{Size: 10, TTL: time.Hour, Dir: dir})
+	eng := &counting{Engine: fake.New(fake.Options{})}
+	if _, _, err := Wrap(eng, first).Parse(context.Background(), in); err != nil {
+		t.Fatal(err)
+	}
+
+	// Новый процесс: память пуста, запись читается с диска.
+	second, _ := New(Options{Size: 10, TTL: time.Hour, Dir: dir})
+	out, stats, err := Wrap(eng, second).Parse(context.Background(), in)
+	if err != nil || stats.Cache != ResultDiskHit || len(out.Items) == 0 {
+		t.Fatalf("disk tier: stats=%+v items=%d err=%v", stats, len(out.Items), err)
+	}
+	if eng.parses != 1 {
+		t.Errorf("provider calls = %d, want 1", eng.parses)
+	}
+
+	// Истёкшая запись не отдаётся ни из памяти, ни с диска.
+	later := func() time.Time { return time.Now().Add(2 * time.Hour) }
+	second.mem.now = later
+	second.disk.now = later
+	if _, stats, _ := Wrap(eng, second).Parse(context.Background(), in); stats.Cache != ResultMiss || eng.parses != 2 {
+		t.Errorf("expired: cache=%q calls=%d", stats.Cache, eng.parses)
+	}
+}
+
+func TestDisk_SweepAndQuota(t *testing.T) {
+	d, err := newDisk(t.TempDir(), time.Hour, 2000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, _ := json.Marshal(strings.Repeat("x", 300))
+	base := time.Now().Add(-time.Minute)
+	key := func(i int) string { return fmt.Sprintf("%02x%062d", i, i) }
+	for i := range 10 {
+		if err := d.put(&entry{key: key(i), StoredAt: base, Response: resp}); err != nil {
+			t.Fatal(err)
+		}
+		// Порядок вытеснения — по mtime; разносим его явно.
+		mtime := base.Add(time.Duration(i) * time.Second)
+		_ = os.Chtimes(d.path(key(i)), mtime, mtime)
+	}
+	if d.used > d.quota {
+		t.Errorf("used = %d, want within quota %d", d.used, d.quota)
+	}
+	if _, ok := d.get(key(0)); ok {
+		t.Error("oldest entry must be evicted over quota")
+	}
+	if _, ok := d.get(key(9)); !ok {
+		t.Error("newest entry must survive eviction")
+	}
+
+	// Периодическая чистка удаляет устаревшие записи без повторного чтения.
+	d.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	if n := d.sweep(); n == 0 || d.used != 0 {
+		t.Errorf("sweep removed %d, used = %d; want all expired removed", n, d.used)
+	}
+}
+
+func TestLRU_Evicts(t *testing.T) {
+	c := newLRU(2, 0)
+	for _, k := range []string{"a", "b", "c"} {
+		c.put(&entry{key: k, StoredAt: time.Now()})
+	}
+	if _, ok := c.get("a"); ok || c.len() != 2 {
+		t.Errorf("oldest entry must be evicted; len=%d", c.len())
+	}
+}
+
+func TestMiddleware_Bypass(t *testing.T) {
+	for header, want := range map[[2]string]bool{
+		{HeaderBypass, "1"}:            true,
+		{"Cache-Control", "no-cache"}:  true,
+		{"Cache-Control", "max-age=0"}: false,
+	} {
+		var got bool
+		h := Middleware(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) { got = bypassed(r.Context()) }))
+		req := httptest.NewRequest(http.MethodPost, "/v2/detect", nil)
+		req.Header.Set(header[0], header[1])
+		h.ServeHTTP(httptest.NewRecorder(), req)
+		if got != want {
+			t.Errorf("%s: %s → bypass=%v, want %v", header[0], header[1], got, want)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package safety
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Violation — найденное нарушение.
+type Violation struct {
+	Category Category
+	Match    string // фрагмент текста; для классификатора — пусто
+	Source   string // "rules" или имя классификатора
+}
+
+func (v Violation) String() string {
+	if v.Match == "" {
+		return fmt.Sprintf("%s (%s)", v.Category, v.Source)
+	}
+	return fmt.Sprintf("%s %q", v.Category, v.Match)
+}
+
+// Classifier — подключаемый классификатор текста (модерационная модель,
+// внешний сервис). Возвращает категории нарушений; ошибка классификатора
+// не блокирует ответ — остаются словари и шаблоны.
+type Classifier interface {
+	Name() string
+	Classify(ctx context.Context, text string) ([]Category, error)
+}
+
+type rule struct {
+	category Category
+	re       *regexp.Regexp
+}
+
+// Filter проверяет текст по словарям, шаблонам и классификаторам.
+type Filter struct {
+	rules       []rule
+	allow       *regexp.Regexp // разрешённые фразы целыми словами; nil — нет
+	classifiers []Classifier
+}
+
+// NewFilter компилирует правила; ошибка — неверное регулярное выражение.
+func NewFilter(r Rules) (*Filter, error) {
+	f := &Filter{}
+	var allow []string
+	for _, a := range r.Allow {
+		if a = normalize(a); a != "" {
+			allow = append(allow, regexp.QuoteMeta(a))
+		}
+	}
+	if len(allow) > 0 {
+		f.allow = regexp.MustCompile(`(^|[^\p{L}\p{N}])(?:` + strings.Join(allow, "|") + `)($|[^\p{L}\p{N}])`)
+	}
+	for _, cat := range sortedCategories(r.Words) {
+		var alts []string
+		for _, w := range r.Words[cat] {
+			w = normalize(w)
+			if stem, ok := strings.CutSuffix(w, "*"); ok {
+				alts = append(alts, regexp.QuoteMeta(stem)+`\p{L}*`)
+			} else if w != "" {
+				alts = append(alts, regexp.QuoteMeta(w))
+			}
+		}
+		if len(alts) == 0 {
+			continue
+		}
+		re, err := regexp.Compile(`(?:^|[^\p{L}])(` + strings.Join(alts, "|") + `)(?:$|[^\p{L}])`)
+		if err != nil {
+			return nil, fmt.Errorf("safety words %s: %w", cat, err)
+		}
+		f.rules = append(f.rules, rule{category: cat, re: re})
+	}
+	for _, cat := range sortedCategories(r.Patterns) {
+		for _, p := range r.Patterns[cat] {
+			re, err := regexp.Compile(`(?i)` + p)
+			if err != nil {
+				return nil, fmt.Errorf("safety pattern %s %q: %w", cat, p, err)
+			}
+			f.rules = append(f.rules, rule{category: cat, re: re})
+		}
+	}
+	return f, nil
+}
+
+// WithClassifier подключает классификатор; вызывается для каждого непустого текста.
+func (f *Filter) WithClassifier(c Classifier) *Filter {
+	f.classifiers = append(f.classifiers, c)
+	return f
+}
+
+func sortedCategories(m map[Category][]string) []Category {
+	cats := make([]Category, 0, len(m))
+	for c := range m {
+		cats = append(cats, c)
+	}
+	slices.Sort(cats)
+	return cats
+}
+
+func normalize(s string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(s)), "ё", "е")
+}
+
+// Check возвращает нарушения в тексте; nil — текст безопасен.
+func (f *Filter) Check(ctx context.Context, text string) []Violation {
+	if strings.TrimSpace(text) == "" {
+		return nil
+	}
+	norm := normalize(text)
+	// Фраза вырезается только целиком: часть слова не должна ни разрезать
+	// запрещённое слово, ни склеить его из обрывков. Граница после фразы
+	// поглощается совпадением, поэтому подряд идущие фразы — за несколько
+	// проходов.
+	for f.allow != nil {
+		cut := f.allow.ReplaceAllString(norm, "$1 $2")
+		if cut == norm {
+			break
+		}
+		norm = cut
+	}
+	var out []Violation
+	for _, r := range f.rules {
+		m := r.re.FindStringSubmatch(norm)
+		if m == nil {
+			continue
+		}
+		match := m[0]
+		if len(m) > 1 && m[1] != "" {
+			match = m[1]
+		}
+		out = append(out, Violation{Category: r.category, Match: strings.TrimSpace(match), Source: "rules"})
+	}
+	for _, c := range f.classifiers {
+		cats, err := c.Classify(ctx, text)
+		if err != nil {
+			log.Printf("[safety] classifier %s failed: %v", c.Name(), err)
+			continue
+		}
+		for _, cat := range cats {
+			out = append(out, Violation{Category: cat, Source: c.Name()})
+		}
+	}
+	return out
+}
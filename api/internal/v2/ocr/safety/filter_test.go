@@ -0,0 +1,128 @@
+package safety
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func defaultFilter(t *testing.T) *Filter {
+	t.Helper()
+	f, err := NewFilter(DefaultRules())
+	if err != nil {
+		t.Fatalf("NewFilter(DefaultRules()) error = %v", err)
+	}
+	return f
+}
+
+func TestFilter_Check(t *testing.T) {
+	tests := []struct {
+		text string
+		want Category // пусто — текст безопасен
+	}{
+		{"Посмотри, сколько яблок было сначала, и сравни с тем, сколько осталось.", ""},
+		{"Молодец! Проверь второе действие ещё раз.", ""},
+		{"Это же просто! Сложи два числа.", CategoryShaming},
+		{"Даже первоклассник знает таблицу умножения.", CategoryShaming},
+		{"Неужели ты не видишь ошибку?", CategoryShaming},
+		{"Не будь дураком, посчитай ещё раз.", CategoryShaming},
+		{"Папа купил пиво и хлеб.", CategoryAdult},
+		{"Подробнее читай на https://example.com/rules", CategoryLink},
+		{"Зайди на сайт uchi.ru и реши ещё.", CategoryLink},
+		{"Ответ 3.5 — проверь запятую.", ""},
+		{"Блин, опять ошибка, твою ж…", ""},
+		{"Хлеба было 5 буханок, а небо голубое.", ""},
+		{"Решай, а то получишь по жопе.", CategoryProfanity},
+		{"Насчитай 12 ступенек. Ёлка стоит у крыльца.", ""},
+		{"Угол B тупой: он больше прямого.", ""},
+	}
+	f := defaultFilter(t)
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got := f.Check(context.Background(), tt.text)
+			if tt.want == "" {
+				if len(got) != 0 {
+					t.Errorf("Check() = %v, want safe", got)
+				}
+				return
+			}
+			if len(got) == 0 || got[0].Category != tt.want {
+				t.Errorf("Check() = %v, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+type stubClassifier struct {
+	cats []Category
+	err  error
+}
+
+func (c stubClassifier) Name() string { return "stub" }
+
+func (c stubClassifier) Classify(context.Context, string) ([]Category, error) { return c.cats, c.err }
+
+func TestFilter_Classifier(t *testing.T) {
+	f := defaultFilter(t).WithClassifier(stubClassifier{cats: []Category{CategoryAdult}})
+	got := f.Check(context.Background(), "Безобидный текст.")
+	if len(got) != 1 || got[0].Source != "stub" || got[0].Category != CategoryAdult {
+		t.Errorf("Check() = %v, want classifier violation", got)
+	}
+
+	f = defaultFilter(t).WithClassifier(stubClassifier{err: errors.New("timeout")})
+	if got := f.Check(context.Background(), "Безобидный текст."); len(got) != 0 {
+		t.Errorf("classifier error must not block: got %v", got)
+	}
+}
+
+func TestLoadRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	raw := `{"words": {"adult": ["лотере*"]}, "patterns": {"shaming": ["ну\\s+ты\\s+даешь"]}, "allow": ["пиво"]}`
+	if err := os.WriteFile(path, []byte(raw), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	rules, err := LoadRules(path)
+	if err != nil {
+		t.Fatalf("LoadRules() error = %v", err)
+	}
+	f, err := NewFilter(rules)
+	if err != nil {
+		t.Fatalf("NewFilter() error = %v", err)
+	}
+	ctx := context.Background()
+	if got := f.Check(ctx, "Купили лотерейный билет."); len(got) == 0 {
+		t.Error("extra word must be checked")
+	}
+	if got := f.Check(ctx, "Ну ты даёшь!"); len(got) == 0 {
+		t.Error("extra pattern must be checked")
+	}
+	if got := f.Check(ctx, "В задаче про пиво."); len(got) != 0 {
+		t.Errorf("allowed phrase must be skipped, got %v", got)
+	}
+	if got := f.Check(ctx, "Это же просто!"); len(got) == 0 {
+		t.Error("default rules must stay in place")
+	}
+
+	if _, err := NewFilter(Rules{Patterns: map[Category][]string{CategoryLink: {"("}}}); err == nil {
+		t.Error("bad pattern must fail")
+	}
+}
+
+func TestAllowMatchesWholeWords(t *testing.T) {
+	f, err := NewFilter(Rules{
+		Words: map[Category][]string{CategoryAdult: {"лотерея"}},
+		Allow: []string{"тер", "задача про лотерея"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if got := f.Check(ctx, "Это лотерея."); len(got) == 0 {
+		t.Error("allowed fragment inside a word must not hide a blocked word")
+	}
+	if got := f.Check(ctx, "Задача про лотерея, задача про лотерея."); len(got) != 0 {
+		t.Errorf("repeated allowed phrase must be skipped, got %v", got)
+	}
+}
@@ -0,0 +1,92 @@
+package safety
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Category — вид нарушения.
+type Category string
+
+const (
+	CategoryProfanity Category = "profanity" // мат и грубая лексика
+	CategoryShaming   Category = "shaming"   // оскорбления и пристыжение: "это же просто!", "даже первоклассник знает"
+	CategoryAdult     Category = "adult"     // взрослые темы: алкоголь, насилие, азартные игры
+	CategoryLink      Category = "link"      // внешние ссылки, почта, контакты
+)
+
+// Rules — словари и шаблоны фильтра. Слово со звёздочкой на конце — основа:
+// "алкогол*" ловит "алкоголь", "алкоголя"; без звёздочки — точная словоформа.
+// Слова ищутся с начала слова, регистр и ё/е не различаются. Allow —
+// фразы, которые вырезаются из текста до проверки (исключения словаря).
+type Rules struct {
+	Words    map[Category][]string `json:"words"`
+	Patterns map[Category][]string `json:"patterns"` // регулярные выражения RE2
+	Allow    []string              `json:"allow"`
+}
+
+// DefaultRules — встроенные правила для текстов детям 7–10 лет.
+func DefaultRules() Rules {
+	return Rules{
+		Words: map[Category][]string{
+			CategoryProfanity: {
+				"бля*", "хуй*", "хуе*", "хуя*", "пизд*", "еба*", "ебл*", "ебу*", "ебн*", "заеб*", "выеб*",
+				"уеб*", "наеб*", "съеб*", "отъеб*", "сука", "суки", "суку", "сукин*", "мудак*", "мудил*",
+				"говн*", "дерьм*", "жоп*", "срать", "залуп*", "шлюх*", "гандон*", "пидор*", "пидар*",
+			},
+			CategoryShaming: {
+				"дура", "дурак*", "дурочк*", "тупица", "тупицы", "идиот*", "глупый",
+				"глупая", "бестолоч*", "бестолков*", "балбес*", "лентяй*", "неуч*", "позор*", "стыдно",
+			},
+			CategoryAdult: {
+				"секс*", "порн*", "эрот*", "алкогол*", "водк*", "пиво", "пива", "пьян*", "сигарет*",
+				"курени*", "наркот*", "казино", "азартн*", "убий*", "самоубий*", "насили*", "оружи*",
+			},
+		},
+		Patterns: map[Category][]string{
+			CategoryShaming: {
+				`это\s+(?:же|ведь)\s+(?:очень\s+|совсем\s+)?(?:просто|легко|элементарн\p{L}*)`,
+				`(?:^|[^\p{L}])элементарно(?:$|[^\p{L}])`,
+				`(?:даже|любой|каждый)\s+(?:первоклассник|малыш|ребенок|детсадовец)\s+(?:знает|умеет|справится|решит|поймет)`,
+				`как\s+можно\s+(?:этого\s+|такое\s+)?не\s+(?:знать|понять|понимать|видеть)`,
+				`неужели\s+(?:ты\s+)?(?:так\s+и\s+)?не\s+(?:знаешь|понимаешь|видишь|понял|поняла)`,
+				`сколько\s+(?:можно|раз)\s+(?:повторять|объяснять)`,
+				`(?:опять|снова)\s+(?:ты\s+)?(?:ошибся|ошиблась|не\s+справился|не\s+справилась)`,
+			},
+			CategoryLink: {
+				`https?://\S+`,
+				`(?:^|[^\p{L}\p{N}])www\.\S+`,
+				`t\.me/\S+`,
+				`[\p{L}\p{N}._%+-]+@[\p{L}\p{N}-]+\.[\p{L}]{2,}`,
+				`(?:^|[^\p{L}\p{N}.])[a-z0-9][a-z0-9-]*\.(?:ru|com|org|net|рф|io|me|info|su|xyz|ua|by|kz)(?:$|[^\p{L}\p{N}])`,
+			},
+		},
+	}
+}
+
+// LoadRules читает дополнительные правила из JSON-файла и добавляет их к
+// встроенным; пустой путь — только встроенные правила.
+func LoadRules(path string) (Rules, error) {
+	rules := DefaultRules()
+	if strings.TrimSpace(path) == "" {
+		return rules, nil
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return Rules{}, fmt.Errorf("safety rules: read %s: %w", path, err)
+	}
+	var extra Rules
+	if err := json.Unmarshal(raw, &extra); err != nil {
+		return Rules{}, fmt.Errorf("safety rules: parse %s: %w", path, err)
+	}
+	for cat, words := range extra.Words {
+		rules.Words[cat] = append(rules.Words[cat], words...)
+	}
+	for cat, patterns := range extra.Patterns {
+		rules.Patterns[cat] = append(rules.Patterns[cat], patterns...)
+	}
+	rules.Allow = append(rules.Allow, extra.Allow...)
+	return rules, nil
+}
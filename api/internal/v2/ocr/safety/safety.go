@@ -0,0 +1,300 @@
+// Package safety — фильтр безопасности и тона для всех текстов v2, которые
+// видит ребёнок 7–10 лет: hint_text, feedback, child_message, example_task и
+// т.п. Текст проверяется словарями, регулярными шаблонами и подключаемыми
+// классификаторами (мат, пристыжение, взрослые темы, внешние ссылки). При
+// нарушении ответ один раз перегенерируется с требованием исправить тон
+// (режим regenerate), а если и это не помогло — небезопасные поля заменяются
+// нейтральным текстом. Итог попадает в stats.Safety, лог и метрики.
+package safety
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"llm-proxy/api/internal/metrics"
+	"llm-proxy/api/internal/v2/ocr"
+	"llm-proxy/api/internal/v2/ocr/types"
+)
+
+// Mode — что делать с нарушением.
+type Mode string
+
+const (
+	ModeOff        Mode = "off"        // не проверять
+	ModeFallback   Mode = "fallback"   // сразу заменить небезопасные поля
+	ModeRegenerate Mode = "regenerate" // одна повторная генерация, затем замена
+)
+
+// ParseMode разбирает режим; пустая строка — regenerate.
+func ParseMode(s string) (Mode, error) {
+	switch m := Mode(strings.ToLower(strings.TrimSpace(s))); m {
+	case "":
+		return ModeRegenerate, nil
+	case ModeOff, ModeFallback, ModeRegenerate:
+		return m, nil
+	default:
+		return "", fmt.Errorf("unknown safety filter mode %q; use off, fallback or regenerate", s)
+	}
+}
+
+// Итоги проверки для stats.Safety и метрики.
+const (
+	ResultClean       = "clean"       // нарушений нет
+	ResultRegenerated = "regenerated" // нарушение устранено повторной генерацией
+	ResultFallback    = "fallback"    // небезопасные поля заменены нейтральным текстом
+	ResultBlocked     = "blocked"     // заменить нечем — ответ не отдаётся
+)
+
+// ErrUnsafe — ответ небезопасен и не имеет нейтральной замены (ANALOGUE).
+var ErrUnsafe = errors.New("generated text failed the child safety filter")
+
+var (
+	violations = metrics.NewCounter(
+		"llm_proxy_safety_violations_total",
+		"Child safety filter violations in generated text by step and category.",
+		"step", "category",
+	)
+	checks = metrics.NewCounter(
+		"llm_proxy_safety_checks_total",
+		"Child safety filter checks by step and result.",
+		"step", "result",
+	)
+)
+
+// Нейтральные тексты вместо небезопасных полей.
+const (
+	fallbackHint  = "Перечитай условие и подумай, что нужно найти. Попробуй сделать первый шаг сам — у тебя получится!"
+	fallbackCheck = "Давай проверим решение ещё раз вместе: посмотри внимательно на каждый шаг."
+	fallbackRU    = "Давай разберём задание вместе: перечитай его ещё раз внимательно."
+)
+
+const correctionText = "Текст для ребёнка 7–10 лет нарушает правила безопасности и тона: %s. " +
+	"Перепиши все тексты для ребёнка доброжелательно и спокойно: без грубых и оценочных слов, " +
+	"без фраз вроде «это же просто», без взрослых тем и без ссылок. Содержание и структуру ответа не меняй."
+
+// Engine — декоратор текстовых шагов; DETECT, PARSE и остальные
+// делегируются как есть.
+type Engine struct {
+	ocr.Engine
+	filter *Filter
+	mode   Mode
+}
+
+func New(primary ocr.Engine, filter *Filter, mode Mode) *Engine {
+	return &Engine{Engine: primary, filter: filter, mode: mode}
+}
+
+// field — текстовое поле ответа, которое видит ребёнок.
+type field struct {
+	name string
+	text *string
+}
+
+type finding struct {
+	field      field
+	violations []Violation
+}
+
+func formatFindings(found []finding) string {
+	parts := make([]string, 0, len(found))
+	for _, f := range found {
+		vs := make([]string, len(f.violations))
+		for i, v := range f.violations {
+			vs[i] = v.String()
+		}
+		parts = append(parts, f.field.name+": "+strings.Join(vs, ", "))
+	}
+	return strings.Join(parts, "; ")
+}
+
+func (e *Engine) scan(ctx context.Context, fields []field) []finding {
+	var out []finding
+	for _, f := range fields {
+		if f.text == nil {
+			continue
+		}
+		if vs := e.filter.Check(ctx, *f.text); len(vs) > 0 {
+			out = append(out, finding{field: f, violations: vs})
+		}
+	}
+	return out
+}
+
+// step описывает шаг для общего цикла проверки.
+type step[Req, Resp any] struct {
+	name     string
+	call     func(context.Context, Req) (Resp, *types.LLMStats, error)
+	fields   func(*Resp) []field
+	correct  func(Req, string) Req
+	fallback string // пусто — заменить нечем, небезопасный ответ не отдаётся
+}
+
+func guard[Req, Resp any](ctx context.Context, e *Engine, s step[Req, Resp], in Req) (Resp, *types.LLMStats, error) {
+	out, stats, err := s.call(ctx, in)
+	if err != nil || e.mode == ModeOff {
+		return out, stats, err
+	}
+	res := &out
+	found := e.scan(ctx, s.fields(res))
+	if len(found) == 0 {
+		return out, record(stats, s.name, ResultClean), nil
+	}
+	for _, f := range found {
+		for _, v := range f.violations {
+			violations.Inc(s.name, string(v.Category))
+		}
+	}
+	log.Printf("[safety] %s: %s", s.name, formatFindings(found))
+
+	if e.mode == ModeRegenerate {
+		retried, retryStats, retryErr := s.call(ctx, s.correct(in, fmt.Sprintf(correctionText, formatFindings(found))))
+		if retryErr != nil {
+			log.Printf("[safety] %s regeneration failed: %v", s.name, retryErr)
+			stats = stats.Plus(retryStats)
+		} else if again := e.scan(ctx, s.fields(&retried)); len(again) > 0 {
+			log.Printf("[safety] %s still unsafe after regeneration: %s", s.name, formatFindings(again))
+			res, found, stats = &retried, again, stats.Retry(retryStats)
+		} else {
+			return retried, record(stats.Retry(retryStats), s.name, ResultRegenerated), nil
+		}
+	}
+
+	if s.fallback == "" {
+		var zero Resp
+		return zero, record(stats, s.name, ResultBlocked), ErrUnsafe
+	}
+	for _, f := range found {
+		*f.field.text = s.fallback
+	}
+	return *res, record(stats, s.name, ResultFallback), nil
+}
+
+func (e *Engine) Hint(ctx context.Context, in types.HintRequest) (types.HintResponse, *types.LLMStats, error) {
+	return guard(ctx, e, step[types.HintRequest, types.HintResponse]{
+		name:   "hint",
+		call:   e.Engine.Hint,
+		fields: hintFields,
+		correct: func(in types.HintRequest, c string) types.HintRequest {
+			in.Correction = c
+			return in
+		},
+		fallback: fallbackHint,
+	}, in)
+}
+
+func (e *Engine) CheckSolution(ctx context.Context, in types.CheckRequest) (types.CheckResponse, *types.LLMStats, error) {
+	return guard(ctx, e, step[types.CheckRequest, types.CheckResponse]{
+		name:   "check",
+		call:   e.Engine.CheckSolution,
+		fields: func(r *types.CheckResponse) []field { return []field{{"feedback", &r.Feedback}} },
+		correct: func(in types.CheckRequest, c string) types.CheckRequest {
+			in.Correction = c
+			return in
+		},
+		fallback: fallbackCheck,
+	}, in)
+}
+
+func (e *Engine) AnalogueSolution(ctx context.Context, in types.AnalogueRequest) (types.AnalogueResponse, *types.LLMStats, error) {
+	return guard(ctx, e, step[types.AnalogueRequest, types.AnalogueResponse]{
+		name:   "analogue",
+		call:   e.Engine.AnalogueSolution,
+		fields: analogueFields,
+		correct: func(in types.AnalogueRequest, c string) types.AnalogueRequest {
+			in.Correction = c
+			return in
+		},
+	}, in)
+}
+
+func (e *Engine) HintRU(ctx context.Context, in types.HintRUCompactInput) (types.HintRUResponse, *types.LLMStats, error) {
+	return guard(ctx, e, step[types.HintRUCompactInput, types.HintRUResponse]{
+		name:   "hint_ru",
+		call:   e.Engine.HintRU,
+		fields: hintRUFields,
+		correct: func(in types.HintRUCompactInput, c string) types.HintRUCompactInput {
+			in.Correction = c
+			return in
+		},
+		fallback: fallbackRU,
+	}, in)
+}
+
+func (e *Engine) CheckRU(ctx context.Context, in types.CheckRUCompactInput) (types.CheckRUResponse, *types.LLMStats, error) {
+	return guard(ctx, e, step[types.CheckRUCompactInput, types.CheckRUResponse]{
+		name:   "check_ru",
+		call:   e.Engine.CheckRU,
+		fields: checkRUFields,
+		correct: func(in types.CheckRUCompactInput, c string) types.CheckRUCompactInput {
+			in.Correction = c
+			return in
+		},
+		fallback: fallbackRU,
+	}, in)
+}
+
+func hintFields(r *types.HintResponse) []field {
+	var out []field
+	for i := range r.Items {
+		for j := range r.Items[i].Hints {
+			out = append(out, field{fmt.Sprintf("items[%d].hints[%d].hint_text", i, j), &r.Items[i].Hints[j].HintText})
+		}
+	}
+	return out
+}
+
+func analogueFields(r *types.AnalogueResponse) []field {
+	out := []field{{"example_task", &r.ExampleTask}}
+	for i := range r.SolutionSteps {
+		out = append(out, field{fmt.Sprintf("solution_steps[%d]", i), &r.SolutionSteps[i]})
+	}
+	return out
+}
+
+func hintRUFields(r *types.HintRUResponse) []field {
+	out := []field{{"child_message", &r.ChildMessage}}
+	for i := range r.RoadmapSteps {
+		out = append(out, field{fmt.Sprintf("roadmap_steps[%d]", i), &r.RoadmapSteps[i]})
+	}
+	for i := range r.HintCards {
+		c := &r.HintCards[i]
+		p := fmt.Sprintf("hint_cards[%d].", i)
+		out = append(out,
+			field{p + "title", &c.Title},
+			field{p + "explanation", &c.Explanation},
+			field{p + "example_on_other_material", c.ExampleOnOtherMaterial},
+			field{p + "child_question", &c.ChildQuestion},
+		)
+		for j := range c.AlgorithmSteps {
+			out = append(out, field{fmt.Sprintf("%salgorithm_steps[%d]", p, j), &c.AlgorithmSteps[j]})
+		}
+	}
+	return out
+}
+
+func checkRUFields(r *types.CheckRUResponse) []field {
+	out := []field{{"child_message", &r.ChildMessage}}
+	for i := range r.CheckedActions {
+		out = append(out, field{fmt.Sprintf("checked_actions[%d].short_comment", i), &r.CheckedActions[i].ShortComment})
+	}
+	for i := range r.ErrorGroups {
+		g := &r.ErrorGroups[i]
+		p := fmt.Sprintf("error_groups[%d].", i)
+		out = append(out,
+			field{p + "location_hint", &g.LocationHint},
+			field{p + "feedback", &g.Feedback},
+			field{p + "self_check_question", &g.SelfCheckQuestion},
+		)
+	}
+	return out
+}
+
+func record(stats *types.LLMStats, step, result string) *types.LLMStats {
+	checks.Inc(step, result)
+	stats = stats.OrEmpty()
+	stats.Safety = result
+	return stats
+}
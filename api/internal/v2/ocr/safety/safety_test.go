@@ -0,0 +1,71 @@
+package safety
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"llm-proxy/api/internal/v2/ocr/ocrtest"
+	"llm-proxy/api/internal/v2/ocr/types"
+)
+
+func TestCheckSolution(t *testing.T) {
+	tests := []struct {
+		name      string
+		mode      Mode
+		texts     []string
+		want      string
+		wantText  string
+		wantCalls int
+	}{
+		{"clean", ModeRegenerate, []string{"Проверь второе действие."}, ResultClean, "Проверь второе действие.", 1},
+		{"regenerated", ModeRegenerate, []string{"Это же просто!", "Проверь второе действие."}, ResultRegenerated, "Проверь второе действие.", 2},
+		{"regenerate then fallback", ModeRegenerate, []string{"Это же просто!", "Ну ты и балбес."}, ResultFallback, fallbackCheck, 2},
+		{"fallback mode", ModeFallback, []string{"Это же просто!"}, ResultFallback, fallbackCheck, 1},
+		{"off", ModeOff, []string{"Это же просто!"}, "", "Это же просто!", 1},
+	}
+	f := defaultFilter(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := ocrtest.NewQueue(tt.texts...)
+			out, stats, err := New(s, f, tt.mode).CheckSolution(context.Background(), types.CheckRequest{})
+			if err != nil {
+				t.Fatalf("CheckSolution() error = %v", err)
+			}
+			if stats.Safety != tt.want {
+				t.Errorf("Safety = %q, want %q", stats.Safety, tt.want)
+			}
+			if out.Feedback != tt.wantText {
+				t.Errorf("feedback = %q, want %q", out.Feedback, tt.wantText)
+			}
+			if s.Calls() != tt.wantCalls {
+				t.Fatalf("calls = %d, want %d", s.Calls(), tt.wantCalls)
+			}
+			if tt.wantCalls == 2 && s.Corrections[1] == "" {
+				t.Error("regeneration must carry a correction")
+			}
+		})
+	}
+}
+
+func TestAnalogueSolution_Blocked(t *testing.T) {
+	s := ocrtest.NewQueue("Вася купил 3 бутылки пива.", "Вася выпил водки.")
+	_, stats, err := New(s, defaultFilter(t), ModeRegenerate).AnalogueSolution(context.Background(), types.AnalogueRequest{})
+	if !errors.Is(err, ErrUnsafe) {
+		t.Fatalf("error = %v, want ErrUnsafe", err)
+	}
+	if stats.Safety != ResultBlocked {
+		t.Errorf("Safety = %q, want %q", stats.Safety, ResultBlocked)
+	}
+}
+
+func TestHintRU_FallbackOnlyUnsafeField(t *testing.T) {
+	s := ocrtest.NewQueue("Подробнее на www.example.com")
+	out, _, err := New(s, defaultFilter(t), ModeFallback).HintRU(context.Background(), types.HintRUCompactInput{})
+	if err != nil {
+		t.Fatalf("HintRU() error = %v", err)
+	}
+	if out.HintCards[0].Explanation != fallbackRU || out.ChildMessage != "Давай разберёмся." {
+		t.Errorf("got child_message=%q explanation=%q", out.ChildMessage, out.HintCards[0].Explanation)
+	}
+}
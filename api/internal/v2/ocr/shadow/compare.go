@@ -0,0 +1,115 @@
+package shadow
+
+import (
+	"fmt"
+	"strings"
+
+	"llm-proxy/api/internal/v2/ocr/types"
+)
+
+// diff добавляет расхождение "field: primary → shadow", если значения различаются.
+func diff(diffs []string, field string, primary, shadow any) []string {
+	p, s := fmt.Sprint(primary), fmt.Sprint(shadow)
+	if p == s {
+		return diffs
+	}
+	return append(diffs, fmt.Sprintf("%s: %s → %s", field, p, s))
+}
+
+func compareDetect(_ types.DetectRequest, p, s types.DetectResponse) comparison {
+	var d []string
+	d = diff(d, "subject_candidate", p.Classification.SubjectCandidate, s.Classification.SubjectCandidate)
+	d = diff(d, "recommend_retake", p.Quality.RecommendRetake, s.Quality.RecommendRetake)
+	return comparison{Diffs: d}
+}
+
+func compareParse(_ types.ParseRequest, p, s types.ParseResponse) comparison {
+	var d []string
+	d = diff(d, "subject", p.Task.Subject, s.Task.Subject)
+	d = diff(d, "items", len(p.Items), len(s.Items))
+	if len(p.Items) > 0 && len(s.Items) > 0 {
+		d = diff(d, "task_type", p.Items[0].PedKeys.TaskType, s.Items[0].PedKeys.TaskType)
+		d = diff(d, "final_answer", p.Items[0].SolutionInternal.FinalAnswer, s.Items[0].SolutionInternal.FinalAnswer)
+	}
+	// ValidateItems мутирует ответ; здесь это безопасно — p и s уже снимки.
+	return comparison{
+		Diffs:        d,
+		PrimaryValid: validity(parseConsistency(&p)),
+		ShadowValid:  validity(parseConsistency(&s)),
+	}
+}
+
+func parseConsistency(r *types.ParseResponse) error {
+	if n := r.ValidateItems(); n > 0 {
+		return fmt.Errorf("%d inconsistent items", n)
+	}
+	return nil
+}
+
+func countHints(r types.HintResponse) int {
+	n := 0
+	for _, item := range r.Items {
+		n += len(item.Hints)
+	}
+	return n
+}
+
+func compareHint(in types.HintRequest, p, s types.HintResponse) comparison {
+	var d []string
+	d = diff(d, "hints", countHints(p), countHints(s))
+	d = diff(d, "items", len(p.Items), len(s.Items))
+	c := comparison{
+		PrimaryValid: validity(p.ValidateAgainstRequest(in)),
+		ShadowValid:  validity(s.ValidateAgainstRequest(in)),
+	}
+	c.Diffs = diff(d, "valid", *c.PrimaryValid, *c.ShadowValid)
+	return c
+}
+
+func compareCheck(in types.CheckRequest, p, s types.CheckResponse) comparison {
+	var d []string
+	d = diff(d, "decision", p.Decision, s.Decision)
+	d = diff(d, "can_evaluate", p.CanEvaluate, s.CanEvaluate)
+	d = diff(d, "status", p.Status, s.Status)
+	c := comparison{
+		PrimaryValid: validity(p.ValidateSemantics(in)),
+		ShadowValid:  validity(s.ValidateSemantics(in)),
+	}
+	c.Diffs = diff(d, "valid", *c.PrimaryValid, *c.ShadowValid)
+	return c
+}
+
+func compareAnalogue(_ types.AnalogueRequest, p, s types.AnalogueResponse) comparison {
+	valid := func(r types.AnalogueResponse) error {
+		if strings.TrimSpace(r.ExampleTask) == "" || len(r.SolutionSteps) == 0 {
+			return fmt.Errorf("empty analogue")
+		}
+		return nil
+	}
+	c := comparison{PrimaryValid: validity(valid(p)), ShadowValid: validity(valid(s))}
+	c.Diffs = diff(diff(nil, "solution_steps", len(p.SolutionSteps), len(s.SolutionSteps)), "valid", *c.PrimaryValid, *c.ShadowValid)
+	return c
+}
+
+func compareParseRU(_ types.ParseRURequest, p, s types.ParseRUResponse) comparison {
+	var d []string
+	d = diff(d, "recommend_retake", p.ParseMeta.RecommendRetake, s.ParseMeta.RecommendRetake)
+	d = diff(d, "coverage", p.ActionPlan.Coverage, s.ActionPlan.Coverage)
+	d = diff(d, "actions", len(p.ActionPlan.Actions), len(s.ActionPlan.Actions))
+	return comparison{Diffs: d}
+}
+
+func compareHintRU(_ types.HintRUCompactInput, p, s types.HintRUResponse) comparison {
+	var d []string
+	d = diff(d, "status", p.Status, s.Status)
+	d = diff(d, "hint_cards", len(p.HintCards), len(s.HintCards))
+	d = diff(d, "anti_gdz_violation_risk", p.AntiGDZViolationRisk, s.AntiGDZViolationRisk)
+	return comparison{Diffs: d}
+}
+
+func compareCheckRU(_ types.CheckRUCompactInput, p, s types.CheckRUResponse) comparison {
+	var d []string
+	d = diff(d, "status", p.Status, s.Status)
+	d = diff(d, "error_groups", len(p.ErrorGroups), len(s.ErrorGroups))
+	return comparison{Diffs: d}
+}
@@ -0,0 +1,90 @@
+package shadow
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"llm-proxy/api/internal/v2/ocr/types"
+)
+
+// Record — одна строка JSONL-отчёта.
+type Record struct {
+	Time          time.Time `json:"ts"`
+	Step          string    `json:"step"`
+	PrimaryEngine string    `json:"primary_engine"`
+	ShadowEngine  string    `json:"shadow_engine"`
+	Agree         bool      `json:"agree"`
+	Diffs         []string  `json:"diffs,omitempty"`
+	PrimaryValid  *bool     `json:"primary_valid,omitempty"`
+	ShadowValid   *bool     `json:"shadow_valid,omitempty"`
+	PrimaryError  string    `json:"primary_error,omitempty"`
+	ShadowError   string    `json:"shadow_error,omitempty"`
+	PrimaryStats  *Stats    `json:"primary_stats,omitempty"`
+	ShadowStats   *Stats    `json:"shadow_stats,omitempty"`
+}
+
+// Stats — сериализуемая копия types.LLMStats.
+type Stats struct {
+	Model        string  `json:"model,omitempty"`
+	InputTokens  int     `json:"input_tokens"`
+	OutputTokens int     `json:"output_tokens"`
+	CachedTokens int     `json:"cached_tokens,omitempty"`
+	LatencyMs    int64   `json:"latency_ms"`
+	CostUSD      float64 `json:"cost_usd,omitempty"`
+	PromptHash   string  `json:"prompt_hash,omitempty"`
+}
+
+func statsOf(s *types.LLMStats) *Stats {
+	if s == nil {
+		return nil
+	}
+	return &Stats{
+		Model:        s.Model,
+		InputTokens:  s.InputTokens,
+		OutputTokens: s.OutputTokens,
+		CachedTokens: s.CachedTokens,
+		LatencyMs:    s.LatencyMs,
+		CostUSD:      s.CostUSD,
+		PromptHash:   s.PromptHash,
+	}
+}
+
+// Reporter дописывает записи в JSONL-файл; безопасен для конкурентного использования.
+type Reporter struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewReporter(path string) (*Reporter, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("shadow report: create dir: %w", err)
+		}
+	}
+	return &Reporter{path: path}, nil
+}
+
+// Path возвращает путь к файлу отчёта.
+func (r *Reporter) Path() string { return r.path }
+
+func (r *Reporter) Write(rec Record) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("shadow report: marshal: %w", err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("shadow report: open %s: %w", r.path, err)
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("shadow report: write %s: %w", r.path, err)
+	}
+	return f.Close()
+}
@@ -0,0 +1,237 @@
+// Package shadow реализует теневой режим: выборка запросов дополнительно
+// и асинхронно отправляется в движок-кандидат, а результаты сравниваются с
+// основным движком и пишутся в JSONL-отчёт.
+//
+// Ответ кандидата никогда не попадает к клиенту: декоратор всегда возвращает
+// результат основного движка, а кандидат работает в отдельной горутине с
+// собственным таймаутом и ограничением параллелизма. Если лимит исчерпан,
+// теневой вызов пропускается — основной трафик не ждёт кандидата.
+package shadow
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+
+	"llm-proxy/api/internal/v2/ocr"
+	"llm-proxy/api/internal/v2/ocr/types"
+)
+
+// Шаги, которые можно отправлять в тень.
+const (
+	StepDetect   = "detect"
+	StepParse    = "parse"
+	StepHint     = "hint"
+	StepCheck    = "check"
+	StepAnalogue = "analogue"
+	StepParseRU  = "parse_ru"
+	StepHintRU   = "hint_ru"
+	StepCheckRU  = "check_ru"
+)
+
+var knownSteps = []string{StepDetect, StepParse, StepHint, StepCheck, StepAnalogue, StepParseRU, StepHintRU, StepCheckRU}
+
+// ParseSteps разбирает список шагов через запятую ("hint,check").
+func ParseSteps(s string) (map[string]bool, error) {
+	steps := map[string]bool{}
+	for _, part := range strings.Split(s, ",") {
+		step := strings.ToLower(strings.TrimSpace(part))
+		if step == "" {
+			continue
+		}
+		known := false
+		for _, k := range knownSteps {
+			if k == step {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown shadow step %q; use %s", step, strings.Join(knownSteps, ", "))
+		}
+		steps[step] = true
+	}
+	return steps, nil
+}
+
+// Options — настройки теневого режима.
+type Options struct {
+	SampleRate  float64         // доля запросов шага, уходящих в тень (0..1)
+	Steps       map[string]bool // шаги, для которых включена тень
+	Timeout     time.Duration   // таймаут вызова кандидата
+	MaxInFlight int             // максимум одновременных теневых вызовов
+}
+
+// Engine — декоратор основного движка. Методы, не затронутые теневым режимом
+// (Embed), делегируются основному движку через встраивание.
+type Engine struct {
+	ocr.Engine
+	candidate ocr.Engine
+	report    *Reporter
+	opts      Options
+	sem       chan struct{}
+	wg        sync.WaitGroup
+	sample    func() float64
+}
+
+func New(primary, candidate ocr.Engine, report *Reporter, opts Options) *Engine {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 3 * time.Minute
+	}
+	if opts.MaxInFlight <= 0 {
+		opts.MaxInFlight = 4
+	}
+	return &Engine{
+		Engine:    primary,
+		candidate: candidate,
+		report:    report,
+		opts:      opts,
+		sem:       make(chan struct{}, opts.MaxInFlight),
+		sample:    rand.Float64,
+	}
+}
+
+// Wait дожидается завершения всех запущенных теневых вызовов.
+func (e *Engine) Wait() { e.wg.Wait() }
+
+// comparison — результат сравнения выходов одного шага.
+type comparison struct {
+	Diffs        []string
+	PrimaryValid *bool
+	ShadowValid  *bool
+}
+
+func validity(err error) *bool {
+	ok := err == nil
+	return &ok
+}
+
+// launch запускает теневой вызов, если шаг попал в выборку.
+func launch[I, T any](
+	e *Engine, ctx context.Context, step string, in I,
+	primary T, primaryStats *types.LLMStats, primaryErr error,
+	run func(context.Context, I) (T, *types.LLMStats, error),
+	compare func(in I, primary, shadow T) comparison,
+) {
+	if !e.opts.Steps[step] || e.opts.SampleRate <= 0 || e.sample() >= e.opts.SampleRate {
+		return
+	}
+	select {
+	case e.sem <- struct{}{}:
+	default:
+		log.Printf("[shadow] %s skipped: %d calls in flight", step, cap(e.sem))
+		return
+	}
+	// Хендлер может нормализовать ответ основного движка после возврата,
+	// а движки нормализуют вход на месте (task_type в hint), поэтому горутина
+	// работает со снимками, а не с живыми значениями.
+	primary, snapErr := clone(primary)
+	if snapErr == nil {
+		in, snapErr = clone(in)
+	}
+	if snapErr != nil {
+		<-e.sem
+		log.Printf("[shadow] %s skipped: snapshot: %v", step, snapErr)
+		return
+	}
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		defer func() { <-e.sem }()
+
+		// Тень не должна обрываться вместе с клиентским запросом.
+		sctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), e.opts.Timeout)
+		defer cancel()
+		out, stats, err := run(sctx, in)
+
+		rec := Record{
+			Time:          time.Now().UTC(),
+			Step:          step,
+			PrimaryEngine: e.Engine.Name(),
+			ShadowEngine:  e.candidate.Name(),
+			PrimaryStats:  statsOf(primaryStats),
+			ShadowStats:   statsOf(stats),
+		}
+		if primaryErr != nil {
+			rec.PrimaryError = primaryErr.Error()
+		}
+		if err != nil {
+			rec.ShadowError = err.Error()
+		}
+		if primaryErr == nil && err == nil {
+			c := compare(in, primary, out)
+			rec.Diffs = c.Diffs
+			rec.PrimaryValid = c.PrimaryValid
+			rec.ShadowValid = c.ShadowValid
+		}
+		rec.Agree = len(rec.Diffs) == 0 && (primaryErr == nil) == (err == nil)
+		if err := e.report.Write(rec); err != nil {
+			log.Printf("[shadow] %s report: %v", step, err)
+		}
+	}()
+}
+
+func clone[T any](v T) (T, error) {
+	var out T
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return out, err
+	}
+	err = json.Unmarshal(raw, &out)
+	return out, err
+}
+
+// ─── decorated steps ──────────────────────────────────────────────────────────
+
+func (e *Engine) Detect(ctx context.Context, in types.DetectRequest) (types.DetectResponse, *types.LLMStats, error) {
+	out, stats, err := e.Engine.Detect(ctx, in)
+	launch(e, ctx, StepDetect, in, out, stats, err, e.candidate.Detect, compareDetect)
+	return out, stats, err
+}
+
+func (e *Engine) Parse(ctx context.Context, in types.ParseRequest) (types.ParseResponse, *types.LLMStats, error) {
+	out, stats, err := e.Engine.Parse(ctx, in)
+	launch(e, ctx, StepParse, in, out, stats, err, e.candidate.Parse, compareParse)
+	return out, stats, err
+}
+
+func (e *Engine) Hint(ctx context.Context, in types.HintRequest) (types.HintResponse, *types.LLMStats, error) {
+	out, stats, err := e.Engine.Hint(ctx, in)
+	launch(e, ctx, StepHint, in, out, stats, err, e.candidate.Hint, compareHint)
+	return out, stats, err
+}
+
+func (e *Engine) CheckSolution(ctx context.Context, in types.CheckRequest) (types.CheckResponse, *types.LLMStats, error) {
+	out, stats, err := e.Engine.CheckSolution(ctx, in)
+	launch(e, ctx, StepCheck, in, out, stats, err, e.candidate.CheckSolution, compareCheck)
+	return out, stats, err
+}
+
+func (e *Engine) AnalogueSolution(ctx context.Context, in types.AnalogueRequest) (types.AnalogueResponse, *types.LLMStats, error) {
+	out, stats, err := e.Engine.AnalogueSolution(ctx, in)
+	launch(e, ctx, StepAnalogue, in, out, stats, err, e.candidate.AnalogueSolution, compareAnalogue)
+	return out, stats, err
+}
+
+func (e *Engine) ParseRU(ctx context.Context, in types.ParseRURequest) (types.ParseRUResponse, *types.LLMStats, error) {
+	out, stats, err := e.Engine.ParseRU(ctx, in)
+	launch(e, ctx, StepParseRU, in, out, stats, err, e.candidate.ParseRU, compareParseRU)
+	return out, stats, err
+}
+
+func (e *Engine) HintRU(ctx context.Context, in types.HintRUCompactInput) (types.HintRUResponse, *types.LLMStats, error) {
+	out, stats, err := e.Engine.HintRU(ctx, in)
+	launch(e, ctx, StepHintRU, in, out, stats, err, e.candidate.HintRU, compareHintRU)
+	return out, stats, err
+}
+
+func (e *Engine) CheckRU(ctx context.Context, in types.CheckRUCompactInput) (types.CheckRUResponse, *types.LLMStats, error) {
+	out, stats, err := e.Engine.CheckRU(ctx, in)
+	launch(e, ctx, StepCheckRU, in, out, stats, err, e.candidate.CheckRU, compareCheckRU)
+	return out, stats, err
+}
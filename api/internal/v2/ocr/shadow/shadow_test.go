@@ -0,0 +1,155 @@
+package shadow
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"llm-proxy/api/internal/v2/ocr/fake"
+	"llm-proxy/api/internal/v2/ocr/types"
+)
+
+// scenarioEngine — фейковый движок с зафиксированным сценарием.
+type scenarioEngine struct {
+	*fake.Engine
+	sc   fake.Scenario
+	name string
+}
+
+func (e scenarioEngine) Name() string { return e.name }
+
+func (e scenarioEngine) CheckSolution(ctx context.Context, in types.CheckRequest) (types.CheckResponse, *types.LLMStats, error) {
+	return e.Engine.CheckSolution(fake.WithScenario(ctx, e.sc), in)
+}
+
+func (e scenarioEngine) Hint(ctx context.Context, in types.HintRequest) (types.HintResponse, *types.LLMStats, error) {
+	return e.Engine.Hint(fake.WithScenario(ctx, e.sc), in)
+}
+
+func readReport(t *testing.T, path string) []Record {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var recs []Record
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var r Record
+		if err := json.Unmarshal(sc.Bytes(), &r); err != nil {
+			t.Fatal(err)
+		}
+		recs = append(recs, r)
+	}
+	return recs
+}
+
+func TestShadow_CheckDisagreementIsReported(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shadow", "report.jsonl")
+	report, err := NewReporter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	primary := scenarioEngine{Engine: fake.New(fake.Options{}), sc: fake.ScenarioOK, name: "primary"}
+	candidate := scenarioEngine{Engine: fake.New(fake.Options{}), sc: fake.ScenarioIncorrect, name: "candidate"}
+	e := New(primary, candidate, report, Options{SampleRate: 1, Steps: map[string]bool{StepCheck: true, StepHint: true}})
+
+	parse, _, _ := primary.Parse(context.Background(), types.ParseRequest{TaskId: "t1"})
+	in := types.CheckRequest{TaskStruct: types.TaskStructCheck{Items: parse.Items}}
+
+	// Клиентский контекст отменяется сразу — тень всё равно должна отработать.
+	ctx, cancel := context.WithCancel(context.Background())
+	out, _, err := e.CheckSolution(ctx, in)
+	cancel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Decision != types.CheckDecisionCorrect {
+		t.Fatalf("client got shadow output: %s", out.Decision)
+	}
+	// Мутация ответа хендлером не должна влиять на сравнение.
+	out.Decision = types.CheckDecisionCannotEvaluate
+
+	hintIn := types.HintRequest{Task: parse.Task, Items: parse.Items}
+	if _, _, err := e.Hint(context.Background(), hintIn); err != nil {
+		t.Fatal(err)
+	}
+	e.Wait()
+
+	recs := readReport(t, path)
+	if len(recs) != 2 {
+		t.Fatalf("records = %d, want 2", len(recs))
+	}
+	byStep := map[string]Record{}
+	for _, r := range recs {
+		byStep[r.Step] = r
+	}
+
+	check := byStep[StepCheck]
+	if check.Agree || check.PrimaryEngine != "primary" || check.ShadowEngine != "candidate" {
+		t.Errorf("check record = %+v", check)
+	}
+	if len(check.Diffs) == 0 || !strings.HasPrefix(check.Diffs[0], "decision: correct → incorrect") {
+		t.Errorf("check diffs = %v", check.Diffs)
+	}
+	if check.PrimaryValid == nil || !*check.PrimaryValid || check.ShadowValid == nil || !*check.ShadowValid {
+		t.Errorf("validity = %v/%v", check.PrimaryValid, check.ShadowValid)
+	}
+	if check.PrimaryStats == nil || check.ShadowStats == nil || check.ShadowStats.Model != "fake/incorrect" {
+		t.Errorf("stats = %+v / %+v", check.PrimaryStats, check.ShadowStats)
+	}
+
+	hint := byStep[StepHint]
+	if !hint.Agree || len(hint.Diffs) != 0 {
+		t.Errorf("hint record = %+v", hint)
+	}
+}
+
+func TestShadow_SamplingAndSteps(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.jsonl")
+	report, _ := NewReporter(path)
+	primary := fake.New(fake.Options{})
+	e := New(primary, fake.New(fake.Options{}), report, Options{SampleRate: 0.5, Steps: map[string]bool{StepDetect: true}})
+
+	e.sample = func() float64 { return 0.7 } // вне выборки
+	_, _, _ = e.Detect(context.Background(), types.DetectRequest{})
+	e.sample = func() float64 { return 0.1 }
+	_, _, _ = e.Parse(context.Background(), types.ParseRequest{}) // шаг не включён
+	_, _, _ = e.Detect(context.Background(), types.DetectRequest{})
+	e.Wait()
+
+	if recs := readReport(t, path); len(recs) != 1 || recs[0].Step != StepDetect {
+		t.Fatalf("records = %+v", recs)
+	}
+}
+
+func TestShadow_ShadowErrorRecorded(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.jsonl")
+	report, _ := NewReporter(path)
+	e := New(fake.New(fake.Options{}), fake.New(fake.Options{ErrorRate: 1}), report,
+		Options{SampleRate: 1, Steps: map[string]bool{StepDetect: true}, Timeout: time.Second})
+	if _, _, err := e.Detect(context.Background(), types.DetectRequest{}); err != nil {
+		t.Fatalf("primary must not see shadow error: %v", err)
+	}
+	e.Wait()
+	recs := readReport(t, path)
+	if len(recs) != 1 || recs[0].Agree || recs[0].ShadowError == "" {
+		t.Fatalf("records = %+v", recs)
+	}
+}
+
+func TestParseSteps(t *testing.T) {
+	steps, err := ParseSteps(" hint, check ,")
+	if err != nil || !steps[StepHint] || !steps[StepCheck] || len(steps) != 2 {
+		t.Fatalf("ParseSteps = %v, %v", steps, err)
+	}
+	if _, err := ParseSteps("hint,embed"); err == nil {
+		t.Error("embed must be rejected")
+	}
+}
@@ -11,6 +11,7 @@ type AnalogueRequest struct {
 	Locale      string         `json:"locale,omitempty"` // "ru-RU" | "en-US"
 	RawTaskText string         `json:"raw_task_text"`
 	Grade       int64          `json:"grade"` // 1..4
+	Correction  string         `json:"-"`     // требование к повторной генерации, см. CorrectionMessage
 }
 
 // TaskStruct — структура задачи из запроса
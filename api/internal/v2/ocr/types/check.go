@@ -2,7 +2,10 @@ package types
 
 import (
 	"fmt"
+	"math/big"
 	"strings"
+
+	"llm-proxy/api/internal/v2/arith"
 )
 
 // --- CHECK (v1) ----------------------------------------------------
@@ -25,10 +28,13 @@ type TaskStructCheck struct {
 // CheckRequest — вход запроса (CHECK.request.v1)
 type CheckRequest struct {
 	Image            string          `json:"image"`
+	ImageID          string          `json:"image_id,omitempty"` // ID из POST /v2/images вместо image
+	Images           []ImageRef      `json:"images,omitempty"`   // ответ на отдельном листе и т.п.; image идёт первым
 	TaskStruct       TaskStructCheck `json:"task_struct"`
 	RawTaskText      string          `json:"raw_task_text"`
 	Student          StudentCheck    `json:"student"`
 	PhotoQualityHint string          `json:"photo_quality_hint"`
+	Correction       string          `json:"-"` // требование к повторной генерации, см. CorrectionMessage
 }
 
 // CheckStatus — статус обработки
@@ -73,6 +79,17 @@ type CheckDebug struct {
 	ParseConsistent      *bool                 `json:"parse_consistent,omitempty"`
 	VerificationComplete *bool                 `json:"verification_complete,omitempty"`
 	VisualEvidence       []CheckVisualEvidence `json:"visual_evidence,omitempty"`
+	Votes                []CheckVote           `json:"votes,omitempty"`          // голоса ансамбля проверки
+	VoteAgreement        *float64              `json:"vote_agreement,omitempty"` // доля голосов за итоговое решение
+	Verification         *CheckVerification    `json:"verification,omitempty"`   // второе мнение верификатора
+}
+
+// CheckVote — результат одной выборки в режиме ансамбля.
+type CheckVote struct {
+	Model      string        `json:"model"`
+	Decision   CheckDecision `json:"decision,omitempty"`
+	Confidence *float64      `json:"confidence,omitempty"`
+	Error      string        `json:"error,omitempty"`
 }
 
 // CheckVisualEvidence is one independently observed visual assertion.
@@ -111,12 +128,13 @@ type CheckResponse struct {
 	Decision      CheckDecision      `json:"decision"`   // P0.3: enum вместо is_correct
 	IsCorrect     *bool              `json:"is_correct"` // deprecated: для обратной совместимости
 	Feedback      string             `json:"feedback"`
-	ErrorSpans    []ErrorSpan        `json:"error_spans"`    // nullable array
-	Confidence    *float64           `json:"confidence"`     // nullable, 0-1
-	PhotoQuality  *PhotoQuality      `json:"photo_quality"`  // nullable
-	FailureReason *string            `json:"failure_reason"` // nullable
-	Debug         *CheckDebug        `json:"debug"`          // nullable
-	ErrorDetails  *CheckErrorDetails `json:"error_details"`  // технические детали для отчёта родителю
+	ErrorSpans    []ErrorSpan        `json:"error_spans"`        // nullable array
+	Confidence    *float64           `json:"confidence"`         // nullable, 0-1
+	PhotoQuality  *PhotoQuality      `json:"photo_quality"`      // nullable
+	FailureReason *string            `json:"failure_reason"`     // nullable
+	Debug         *CheckDebug        `json:"debug"`              // nullable
+	ErrorDetails  *CheckErrorDetails `json:"error_details"`      // технические детали для отчёта родителю
+	Warnings      []string           `json:"warnings,omitempty"` // предупреждения постобработки (readability)
 }
 
 // NormalizeDecision заполняет Decision из IsCorrect для обратной совместимости
@@ -172,13 +190,17 @@ func (r CheckResponse) ValidateSemantics(in CheckRequest) error {
 		if r.Debug.NormalizedAnswer == nil || strings.TrimSpace(*r.Debug.NormalizedAnswer) == "" {
 			return fmt.Errorf("evaluated response requires normalized_answer")
 		}
+		if want, ok := checkTaskValue(in); ok {
+			if got, ok := arith.AnswerValue(*r.Debug.ExpectedAnswer); ok && got.Cmp(want) != 0 {
+				return fmt.Errorf("expected_answer %q contradicts arithmetic: task evaluates to %s", *r.Debug.ExpectedAnswer, arith.Format(want))
+			}
+		}
 		if !checkRequestIsVisual(in) {
-			normalizedStudent := normalizeCheckAnswer(*r.Debug.NormalizedAnswer)
-			normalizedExpected := normalizeCheckAnswer(*r.Debug.ExpectedAnswer)
-			if r.Decision == CheckDecisionCorrect && normalizedStudent != normalizedExpected {
+			equal := checkAnswersEqual(*r.Debug.NormalizedAnswer, *r.Debug.ExpectedAnswer, checkAnswerOrdered(in))
+			if r.Decision == CheckDecisionCorrect && !equal {
 				return fmt.Errorf("correct decision contradicts normalized and expected answers")
 			}
-			if r.Decision == CheckDecisionIncorrect && normalizedStudent == normalizedExpected {
+			if r.Decision == CheckDecisionIncorrect && equal {
 				return fmt.Errorf("incorrect decision contradicts equal normalized and expected answers")
 			}
 		}
@@ -227,6 +249,41 @@ func normalizeCheckAnswer(value string) string {
 	return strings.Join(strings.Fields(value), "")
 }
 
+// checkAnswersEqual сравнивает ответы: величины — с учётом единиц
+// ("1 м 20 см" и "1,2 м" равны), остальное по каноническому виду
+// ("3/4" и "0,75", "XIV" и "14", "двенадцать" и "12") или как строки.
+// ordered — порядок элементов списка важен.
+func checkAnswersEqual(student, expected string, ordered bool) bool {
+	if equal, ok := arith.SameQuantity(student, expected); ok {
+		return equal
+	}
+	return arith.Equivalent(student, expected, ordered) ||
+		normalizeCheckAnswer(student) == normalizeCheckAnswer(expected) ||
+		arith.Equal(student, expected)
+}
+
+// checkAnswerOrdered — PARSE пометил, что в ответе-списке важен порядок.
+func checkAnswerOrdered(in CheckRequest) bool {
+	for _, item := range in.TaskStruct.Items {
+		if containsString(item.PedKeys.Constraints, "ordered_answer") {
+			return true
+		}
+	}
+	return false
+}
+
+// checkTaskValue вычисляет условие, если это чистый пример: у задания с одним
+// пунктом — текст пункта, без пунктов — текст задания.
+func checkTaskValue(in CheckRequest) (want *big.Rat, ok bool) {
+	switch len(in.TaskStruct.Items) {
+	case 0:
+		return arith.TaskValue(in.TaskStruct.TaskTextClean)
+	case 1:
+		return arith.TaskValue(in.TaskStruct.Items[0].ItemTextClean)
+	}
+	return nil, false
+}
+
 func checkRequestIsVisual(in CheckRequest) bool {
 	if in.TaskStruct.VisualReasoning != nil && strings.TrimSpace(*in.TaskStruct.VisualReasoning) != "" {
 		return true
@@ -245,7 +302,7 @@ func checkRequestIsVisual(in CheckRequest) bool {
 }
 
 // ConservativeCheckResponse avoids publishing an unsupported correct/incorrect
-// verdict when semantic validation still fails after one retry.
+// verdict when semantic validation still fails after all retries.
 func ConservativeCheckResponse() CheckResponse {
 	reason := "ground_truth_unverified"
 	return CheckResponse{
@@ -0,0 +1,65 @@
+package types
+
+// --- CHECK VERIFY ------------------------------------------------------
+// Второе мнение по вердикту CHECK: другая модель получает задачу, фото,
+// первый вердикт, эталон и визуальные наблюдения и подтверждает или оспаривает их.
+
+// CheckVerifyRequest — вход верификатора.
+type CheckVerifyRequest struct {
+	Check            CheckRequest          `json:"-"` // исходный запрос проверки (фото и task_struct)
+	Decision         CheckDecision         `json:"decision"`
+	Confidence       *float64              `json:"confidence"`
+	ExpectedAnswer   *string               `json:"expected_answer"`
+	NormalizedAnswer *string               `json:"normalized_answer"`
+	DecisionReason   *string               `json:"decision_reason"`
+	VisualEvidence   []CheckVisualEvidence `json:"visual_evidence"`
+}
+
+// NewCheckVerifyRequest собирает вход верификатора из запроса и первого вердикта.
+func NewCheckVerifyRequest(in CheckRequest, first CheckResponse) CheckVerifyRequest {
+	req := CheckVerifyRequest{Check: in, Decision: first.Decision, Confidence: first.Confidence}
+	if first.Debug != nil {
+		req.ExpectedAnswer = first.Debug.ExpectedAnswer
+		req.NormalizedAnswer = first.Debug.NormalizedAnswer
+		req.DecisionReason = first.Debug.DecisionReason
+		req.VisualEvidence = first.Debug.VisualEvidence
+	}
+	return req
+}
+
+// CheckVerifyVerdict — итог второго мнения.
+type CheckVerifyVerdict string
+
+const (
+	CheckVerifyConfirm CheckVerifyVerdict = "confirm" // вердикт подтверждён
+	CheckVerifyDispute CheckVerifyVerdict = "dispute" // вердикт оспорен
+)
+
+// CheckVerifyResponse — ответ верификатора (check_verify.schema.json).
+type CheckVerifyResponse struct {
+	Verdict        CheckVerifyVerdict `json:"verdict"`
+	Decision       CheckDecision      `json:"decision"`        // собственное решение верификатора
+	ExpectedAnswer string             `json:"expected_answer"` // эталон, пересчитанный независимо
+	Confidence     float64            `json:"confidence"`
+	Reason         string             `json:"reason"`
+	Feedback       string             `json:"feedback"` // текст для ребёнка, если решение меняется
+}
+
+// CheckVerification — след второго мнения в CheckDebug.
+type CheckVerification struct {
+	Model      string             `json:"model"`
+	Trigger    string             `json:"trigger"` // low_confidence | high_risk
+	Verdict    CheckVerifyVerdict `json:"verdict,omitempty"`
+	Decision   CheckDecision      `json:"decision,omitempty"`
+	Reason     string             `json:"reason,omitempty"`
+	Resolution string             `json:"resolution"` // кто определил итоговое решение
+	Error      string             `json:"error,omitempty"`
+}
+
+// IsHighRiskTask сообщает, что задача из класса, где модели чаще ошибаются
+// (логика, закономерности, явная метка high_risk).
+func IsHighRiskTask(item ParseItem) bool {
+	taskType := NormalizeTaskType(item.PedKeys.TaskType)
+	return taskType == TaskTypeLogic || taskType == TaskTypePatternsLogic ||
+		taskType == TaskTypeSetsLogic || containsString(item.PedKeys.Constraints, "high_risk")
+}
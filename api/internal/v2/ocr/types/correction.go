@@ -0,0 +1,11 @@
+package types
+
+// CorrectionMessage — текст дополнительного сообщения модели с требованием
+// исправить предыдущий ответ. Требование приходит в поле Correction запроса
+// шага: его заполняют цикл validation (semantic validation, ремонт JSON) и
+// декораторы повторной генерации (утечка ответа, читаемость, безопасность
+// текста). Клиент Correction не передаёт, в промпт-JSON оно не попадает
+// (json:"-"); движок отправляет его отдельным сообщением после основного.
+func CorrectionMessage(correction string) string {
+	return "CORRECTION_REQUIRED:\n" + correction
+}
@@ -1,10 +1,13 @@
 package types
 
 // DetectRequest — DETECT.request.v1
-// Required: image. Optional: locale ("ru-RU" | "en-US").
+// Required: image или images. Optional: locale ("ru-RU" | "en-US").
 type DetectRequest struct {
-	Image  string `json:"image"`            // Image handle (URL or base64 id)
-	Locale string `json:"locale,omitempty"` // "ru-RU" | "en-US"
+	Image      string     `json:"image"`              // Image handle (URL or base64 id)
+	ImageID    string     `json:"image_id,omitempty"` // ID из POST /v2/images вместо image
+	Images     []ImageRef `json:"images,omitempty"`   // дополнительные страницы; image идёт первым
+	Locale     string     `json:"locale,omitempty"`   // "ru-RU" | "en-US"
+	Correction string     `json:"-"`                  // требование к повторной генерации, см. CorrectionMessage
 }
 
 // Subject — enum for subject classification (shared by Detect and Parse)
@@ -39,6 +42,18 @@ const (
 type Quality struct {
 	RecommendRetake bool           `json:"recommend_retake"`
 	Issues          []QualityIssue `json:"issues"`
+	Local           []LocalQuality `json:"local,omitempty"` // локальные оценки по изображениям запроса; заполняет prescreen
+}
+
+// LocalQuality — оценки фото без LLM; возвращаются для подбора порогов.
+type LocalQuality struct {
+	Width      int            `json:"width"`
+	Height     int            `json:"height"`
+	Aspect     float64        `json:"aspect"`
+	Blur       float64        `json:"blur"`       // дисперсия лапласиана; меньше — размытее
+	Brightness float64        `json:"brightness"` // средняя яркость 0..255
+	Contrast   float64        `json:"contrast"`   // СКО яркости
+	Issues     []QualityIssue `json:"issues,omitempty"`
 }
 
 // Classification — subject classification result
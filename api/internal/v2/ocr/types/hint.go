@@ -30,6 +30,7 @@ type HintRequest struct {
 	AppliedPolicy HintPolicy  `json:"applied_policy"`
 	Template      string      `json:"template,omitempty"`      // selected pedagogical template profile, resolved by child_bot backend
 	ExtraContext  string      `json:"extra_context,omitempty"` // verified retrieval grounding supplied by child_bot
+	Correction    string      `json:"-"`                       // требование к повторной генерации, см. CorrectionMessage
 }
 
 // TaskRef — reference to parsed task
@@ -99,6 +100,7 @@ type HintResponse struct {
 	Task           HintTask   `json:"task"`
 	Items          []HintItem `json:"items"`
 	UI             HintUI     `json:"ui"`
+	Warnings       []string   `json:"warnings,omitempty"` // предупреждения постобработки (readability)
 }
 
 // ValidateAgainstRequest enforces semantic invariants that JSON Schema cannot
@@ -0,0 +1,101 @@
+package types
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ImageRef — одно изображение многостраничного запроса: страницы задания,
+// ответ на отдельном листе. Role подсказывает модели, что на изображении.
+type ImageRef struct {
+	Image   string `json:"image,omitempty"`    // base64, data URL или http(s) URL
+	ImageID string `json:"image_id,omitempty"` // ID из POST /v2/images вместо image
+	Role    string `json:"role,omitempty"`     // "task" | "answer" | "page2" | ...
+}
+
+const (
+	// MaxImages — максимум изображений в одном запросе (image + images).
+	MaxImages = 6
+	// MaxImagesBytes — суммарная длина base64 всех изображений запроса.
+	// Файлы multipart приходят бинарными и кодируются уже после лимита тела
+	// (10 MB), поэтому запас — на рост base64 на треть.
+	MaxImagesBytes = 14 << 20
+)
+
+var reImageRole = regexp.MustCompile(`^[a-z][a-z0-9_]{0,31}$`)
+
+// CollectImages объединяет устаревшие поля image/image_id и массив images:
+// изображение верхнего уровня идёт первым. Проверяет, что есть хотя бы одно
+// изображение, их число, суммарный размер и формат ролей. У каждого
+// изображения задано ровно одно из image и image_id.
+func CollectImages(image, imageID string, images []ImageRef) ([]ImageRef, error) {
+	refs := make([]ImageRef, 0, len(images)+1)
+	switch {
+	case strings.TrimSpace(image) != "" && imageID != "":
+		return nil, fmt.Errorf("image and image_id are mutually exclusive")
+	case strings.TrimSpace(image) != "" || imageID != "":
+		refs = append(refs, ImageRef{Image: image, ImageID: imageID})
+	}
+	for i, ref := range images {
+		hasImage := strings.TrimSpace(ref.Image) != ""
+		if hasImage == (ref.ImageID != "") {
+			if hasImage {
+				return nil, fmt.Errorf("images[%d]: image and image_id are mutually exclusive", i)
+			}
+			return nil, fmt.Errorf("images[%d]: empty image", i)
+		}
+		if ref.Role != "" && !reImageRole.MatchString(ref.Role) {
+			return nil, fmt.Errorf("images[%d]: bad role %q", i, ref.Role)
+		}
+		refs = append(refs, ref)
+	}
+	if len(refs) == 0 {
+		return nil, fmt.Errorf("image is required")
+	}
+	if len(refs) > MaxImages {
+		return nil, fmt.Errorf("too many images: %d > %d", len(refs), MaxImages)
+	}
+	total := 0
+	for _, ref := range refs {
+		total += len(ref.Image)
+	}
+	if total > MaxImagesBytes {
+		return nil, fmt.Errorf("images too large: %d > %d bytes", total, MaxImagesBytes)
+	}
+	return refs, nil
+}
+
+// ImageLabel — подпись перед изображением в мультимодальном сообщении.
+// Одно изображение без роли не подписывается: запрос остаётся таким же,
+// как до появления images.
+func ImageLabel(i, n int, role string) string {
+	if n <= 1 && role == "" {
+		return ""
+	}
+	label := fmt.Sprintf("Изображение %d из %d", i+1, n)
+	if role != "" {
+		label += " (role: " + role + ")"
+	}
+	return label + ":"
+}
+
+// AllImages возвращает изображения запроса с учётом устаревшего поля image.
+func (r DetectRequest) AllImages() ([]ImageRef, error) {
+	return CollectImages(r.Image, r.ImageID, r.Images)
+}
+
+// AllImages возвращает изображения запроса с учётом устаревшего поля image.
+func (r ParseRequest) AllImages() ([]ImageRef, error) {
+	return CollectImages(r.Image, r.ImageID, r.Images)
+}
+
+// AllImages возвращает изображения запроса с учётом устаревшего поля image.
+func (r CheckRequest) AllImages() ([]ImageRef, error) {
+	return CollectImages(r.Image, r.ImageID, r.Images)
+}
+
+// AllImages возвращает изображения запроса с учётом устаревшего поля image.
+func (r ParseRURequest) AllImages() ([]ImageRef, error) {
+	return CollectImages(r.Image, r.ImageID, r.Images)
+}
@@ -0,0 +1,80 @@
+package types
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCollectImages(t *testing.T) {
+	t.Parallel()
+	big := strings.Repeat("A", MaxImagesBytes/2+1)
+	tests := []struct {
+		name    string
+		image   string
+		imageID string
+		images  []ImageRef
+		want    []string // роли по порядку
+		wantErr string
+	}{
+		{name: "legacy image only", image: "aGVsbG8=", want: []string{""}},
+		{name: "image goes first", image: "aGVsbG8=", images: []ImageRef{{Image: "d29ybGQ=", Role: "answer"}}, want: []string{"", "answer"}},
+		{name: "images only", images: []ImageRef{{Image: "a", Role: "task"}, {Image: "b", Role: "page2"}}, want: []string{"task", "page2"}},
+		{name: "nothing", wantErr: "image is required"},
+		{name: "empty entry", image: "a", images: []ImageRef{{Role: "answer"}}, wantErr: "images[0]: empty image"},
+		{name: "bad role", images: []ImageRef{{Image: "a", Role: "Ответ"}}, wantErr: "bad role"},
+		{name: "too many", image: "a", images: repeatImages("b"), wantErr: "too many images"},
+		{name: "too large", image: big, images: []ImageRef{{Image: big}}, wantErr: "images too large"},
+		{name: "image id", imageID: "img_1", images: []ImageRef{{ImageID: "img_2", Role: "answer"}}, want: []string{"", "answer"}},
+		{name: "image and image id", image: "a", imageID: "img_1", wantErr: "mutually exclusive"},
+		{name: "entry with image and image id", images: []ImageRef{{Image: "a", ImageID: "img_1"}}, wantErr: "images[0]: image and image_id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CollectImages(tt.image, tt.imageID, tt.images)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d images, want %d", len(got), len(tt.want))
+			}
+			for i, ref := range got {
+				if ref.Role != tt.want[i] {
+					t.Errorf("images[%d].Role = %q, want %q", i, ref.Role, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func repeatImages(image string) []ImageRef {
+	refs := make([]ImageRef, MaxImages)
+	for i := range refs {
+		refs[i] = ImageRef{Image: image}
+	}
+	return refs
+}
+
+func TestImageLabel(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		i, n int
+		role string
+		want string
+	}{
+		{0, 1, "", ""},
+		{0, 1, "task", "Изображение 1 из 1 (role: task):"},
+		{1, 2, "answer", "Изображение 2 из 2 (role: answer):"},
+		{0, 2, "", "Изображение 1 из 2:"},
+	}
+	for _, tt := range tests {
+		if got := ImageLabel(tt.i, tt.n, tt.role); got != tt.want {
+			t.Errorf("ImageLabel(%d, %d, %q) = %q, want %q", tt.i, tt.n, tt.role, got, tt.want)
+		}
+	}
+}
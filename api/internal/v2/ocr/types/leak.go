@@ -0,0 +1,290 @@
+package types
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"llm-proxy/api/internal/v2/arith"
+)
+
+// Leak — итоговый ответ или промежуточный результат решения, найденный в
+// тексте, который видит ученик (анти-ГДЗ).
+type Leak struct {
+	ItemID       string // пусто для feedback CHECK
+	Where        string // "L1" | "L2" | "L3" | "feedback"
+	Value        string // найденный фрагмент
+	Intermediate bool   // промежуточный результат, а не итоговый ответ
+}
+
+func (l Leak) String() string {
+	kind := "answer"
+	if l.Intermediate {
+		kind = "intermediate"
+	}
+	if l.ItemID == "" {
+		return fmt.Sprintf("%s: %s %q", l.Where, kind, l.Value)
+	}
+	return fmt.Sprintf("%s/%s: %s %q", l.ItemID, l.Where, kind, l.Value)
+}
+
+// FormatLeaks — найденные утечки одной строкой для логов и корректирующего
+// сообщения модели.
+func FormatLeaks(leaks []Leak) string {
+	parts := make([]string, len(leaks))
+	for i, l := range leaks {
+		parts[i] = l.String()
+	}
+	return strings.Join(parts, "; ")
+}
+
+const (
+	// minLeakTextRunes — короче текстовый ответ не ищем: "да", "нет", "А"
+	// встречаются в любой подсказке.
+	minLeakTextRunes = 4
+	// minIntermediate — промежуточные целые меньше этого не ищем: "2", "5"
+	// слишком часто звучат в подсказке по другим поводам.
+	minIntermediate = 10
+)
+
+type secretValue struct {
+	v            *big.Rat
+	intermediate bool
+}
+
+// answerSecrets — что не должно попасть в текст для ученика.
+type answerSecrets struct {
+	values     []secretValue
+	quantities []arith.Quantity // ответы с единицами в базовых единицах
+	texts      []string         // нечисловые ответы в нормализованном виде
+	given      []*big.Rat
+}
+
+// givenNumbers — числа из условия и других текстов, которые ученик и так
+// видит: их упоминание ответа не выдаёт.
+func givenNumbers(texts ...string) []*big.Rat {
+	var out []*big.Rat
+	for _, t := range texts {
+		for _, n := range arith.Numbers(t) {
+			out = append(out, n.Value)
+		}
+	}
+	return out
+}
+
+func containsRat(list []*big.Rat, v *big.Rat) bool {
+	for _, x := range list {
+		if x.Cmp(v) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeLeakText(s string) string {
+	s = strings.NewReplacer("ё", "е", "\u00a0", " ", "\u202f", " ").Replace(strings.ToLower(s))
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// addAnswer добавляет итоговый ответ: его число (в том числе записанное
+// римскими цифрами, словами или с наименованием — "22 ученика"), величину
+// ("1 м 20 см" ищется и как "120 см", и как "1,2 м") или, для нечисловых
+// ответов, сам текст.
+func (s *answerSecrets) addAnswer(answer string, context string) {
+	answer = strings.TrimSpace(answer)
+	if answer == "" {
+		return
+	}
+	a := arith.Canonicalize(answer)
+	switch a.Kind {
+	case arith.KindNumber:
+		if v, ok := new(big.Rat).SetString(a.Canonical); ok {
+			s.addValue(v, false)
+		}
+		return
+	case arith.KindQuantity:
+		if q, ok := arith.ParseQuantity(a.Canonical); ok {
+			s.addQuantity(q, context)
+		}
+		return
+	case arith.KindList:
+		for _, item := range a.Items {
+			if item.Kind == arith.KindNumber {
+				if v, ok := new(big.Rat).SetString(item.Canonical); ok {
+					s.addValue(v, false)
+				}
+			}
+		}
+	default:
+		if v, ok := arith.AnswerValue(answer); ok {
+			s.addValue(v, false)
+			return
+		}
+	}
+	text := normalizeLeakText(answer)
+	if len([]rune(text)) >= minLeakTextRunes && !strings.Contains(normalizeLeakText(context), text) {
+		s.texts = append(s.texts, text)
+	}
+}
+
+// addQuantity добавляет величину, если её нет в условии.
+func (s *answerSecrets) addQuantity(q arith.Quantity, context string) {
+	for _, g := range arith.Quantities(context) {
+		if sameQuantity(g.Quantity, q) {
+			return
+		}
+	}
+	s.quantities = append(s.quantities, q)
+}
+
+func sameQuantity(a, b arith.Quantity) bool {
+	return a.Dim == b.Dim && a.Value.Cmp(b.Value) == 0
+}
+
+func (s *answerSecrets) addValue(v *big.Rat, intermediate bool) {
+	if containsRat(s.given, v) {
+		return
+	}
+	if intermediate && v.IsInt() && new(big.Rat).Abs(v).Cmp(big.NewRat(minIntermediate, 1)) < 0 {
+		return
+	}
+	for i, sv := range s.values {
+		if sv.v.Cmp(v) == 0 {
+			s.values[i].intermediate = sv.intermediate && intermediate
+			return
+		}
+	}
+	s.values = append(s.values, secretValue{v: v, intermediate: intermediate})
+}
+
+// addSolution добавляет итоговый ответ, ответ второго прохода и результаты
+// шагов решения.
+func (s *answerSecrets) addSolution(si SolutionInternal, context string) {
+	s.addAnswer(formatAnswerForComparison(si.FinalAnswer), context)
+	if si.Verification != nil {
+		s.addAnswer(formatAnswerForComparison(si.Verification.DerivedAnswer), context)
+	}
+	for _, step := range si.SolutionSteps {
+		for _, v := range arith.StepResults(step) {
+			s.addValue(v, true)
+		}
+	}
+}
+
+// find ищет секреты в тексте. Итоговый ответ меньше 10 ищется только
+// цифрами: "два" и "три" в подсказке — обычные слова.
+func (s *answerSecrets) find(text, itemID, where string) []Leak {
+	var out []Leak
+	seen := map[string]bool{}
+	add := func(l Leak) {
+		if !seen[l.Value] {
+			seen[l.Value] = true
+			out = append(out, l)
+		}
+	}
+	for _, n := range arith.Numbers(text) {
+		for _, sv := range s.values {
+			if sv.v.Cmp(n.Value) != 0 {
+				continue
+			}
+			if n.Words && sv.v.IsInt() && sv.v.Cmp(big.NewRat(minIntermediate, 1)) < 0 {
+				continue
+			}
+			add(Leak{ItemID: itemID, Where: where, Value: n.Text, Intermediate: sv.intermediate})
+		}
+	}
+	if len(s.quantities) > 0 {
+		for _, q := range arith.Quantities(text) {
+			for _, sq := range s.quantities {
+				if sameQuantity(q.Quantity, sq) {
+					add(Leak{ItemID: itemID, Where: where, Value: q.Text})
+				}
+			}
+		}
+	}
+	norm := normalizeLeakText(text)
+	for _, t := range s.texts {
+		if containsPhrase(norm, t) {
+			add(Leak{ItemID: itemID, Where: where, Value: t})
+		}
+	}
+	return out
+}
+
+// containsPhrase ищет фразу целыми словами: по краям — не буква и не цифра.
+func containsPhrase(text, phrase string) bool {
+	for from := 0; ; {
+		i := strings.Index(text[from:], phrase)
+		if i < 0 {
+			return false
+		}
+		i += from
+		before, _ := utf8.DecodeLastRuneInString(text[:i])
+		after, _ := utf8.DecodeRuneInString(text[i+len(phrase):])
+		if !isWordRune(before) && !isWordRune(after) {
+			return true
+		}
+		_, size := utf8.DecodeRuneInString(text[i:])
+		from = i + size
+	}
+}
+
+// isWordRune — буква или цифра; RuneError — край строки.
+func isWordRune(r rune) bool {
+	return r != utf8.RuneError && (unicode.IsLetter(r) || unicode.IsNumber(r))
+}
+
+// AnswerLeaks ищет в подсказках итоговый ответ и промежуточные результаты
+// решения из PARSE — цифрами и словами. Числа из условия задания утечкой
+// не считаются.
+func (r HintResponse) AnswerLeaks(in HintRequest) []Leak {
+	items := make(map[string]ParseItem, len(in.Items))
+	for _, item := range in.Items {
+		items[item.ItemId] = item
+	}
+	var out []Leak
+	for _, hi := range r.Items {
+		item, ok := items[hi.ItemId]
+		if !ok {
+			continue
+		}
+		context := in.Task.TaskTextClean + "\n" + item.ItemTextClean
+		s := answerSecrets{given: givenNumbers(context)}
+		s.addSolution(item.SolutionInternal, context)
+		for _, h := range hi.Hints {
+			out = append(out, s.find(h.HintText, hi.ItemId, string(h.Level))...)
+		}
+	}
+	return out
+}
+
+// FeedbackLeaks ищет правильный ответ и промежуточные результаты в feedback
+// CHECK. При верном ответе ученика называть его можно; числа из условия и
+// из ответа ученика утечкой не считаются.
+func (r CheckResponse) FeedbackLeaks(in CheckRequest) []Leak {
+	if r.Decision == CheckDecisionCorrect || strings.TrimSpace(r.Feedback) == "" {
+		return nil
+	}
+	given := in.TaskStruct.TaskTextClean + "\n" + in.RawTaskText
+	for _, item := range in.TaskStruct.Items {
+		given += "\n" + item.ItemTextClean
+	}
+	if r.Debug != nil {
+		if r.Debug.NormalizedAnswer != nil {
+			given += "\n" + *r.Debug.NormalizedAnswer
+		}
+		if r.Debug.RawAnswerText != nil {
+			given += "\n" + *r.Debug.RawAnswerText
+		}
+	}
+	s := answerSecrets{given: givenNumbers(given)}
+	for _, item := range in.TaskStruct.Items {
+		s.addSolution(item.SolutionInternal, given)
+	}
+	if r.Debug != nil && r.Debug.ExpectedAnswer != nil {
+		s.addAnswer(*r.Debug.ExpectedAnswer, given)
+	}
+	return s.find(r.Feedback, "", "feedback")
+}
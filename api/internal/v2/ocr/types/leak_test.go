@@ -0,0 +1,132 @@
+package types
+
+import (
+	"strings"
+	"testing"
+)
+
+func leakHintRequest() HintRequest {
+	return HintRequest{
+		Task: ParseTask{TaskTextClean: "В классе 12 девочек и 15 мальчиков. 5 учеников ушли домой. Сколько учеников осталось?"},
+		Items: []ParseItem{{
+			ItemId: "1",
+			SolutionInternal: SolutionInternal{
+				SolutionSteps: []string{"1) 12 + 15 = 27 (уч.)", "2) 27 - 5 = 22 (уч.)"},
+				FinalAnswer:   "22 ученика",
+			},
+		}},
+	}
+}
+
+func hintWith(texts ...string) HintResponse {
+	levels := []HintLevel{HintL1, HintL2, HintL3}
+	item := HintItem{ItemId: "1"}
+	for i, text := range texts {
+		item.Hints = append(item.Hints, Hint{Level: levels[i], HintText: text})
+	}
+	return HintResponse{Items: []HintItem{item}}
+}
+
+func TestAnswerLeaks(t *testing.T) {
+	tests := []struct {
+		name string
+		hint string
+		want string // FormatLeaks; пусто — утечки нет
+	}{
+		{name: "clean", hint: "Сначала узнай, сколько всего учеников было в классе.", want: ""},
+		{name: "task numbers allowed", hint: "Сложи 12 и 15, потом вычти тех, кто ушёл (5).", want: ""},
+		{name: "final digits", hint: "Получится 22 ученика.", want: `1/L1: answer "22"`},
+		{name: "final words", hint: "Ответ — двадцать два.", want: `1/L1: answer "двадцать два"`},
+		{name: "intermediate", hint: "Всего было 27 учеников.", want: `1/L1: intermediate "27"`},
+		{name: "small words ignored", hint: "Задача решается в два действия.", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := FormatLeaks(hintWith(tt.hint).AnswerLeaks(leakHintRequest()))
+			if got != tt.want {
+				t.Errorf("AnswerLeaks(%q) = %q, want %q", tt.hint, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnswerLeaks_TextAnswer(t *testing.T) {
+	in := HintRequest{
+		Task: ParseTask{TaskTextClean: "Какая фигура лишняя: круг, овал, квадрат?"},
+		Items: []ParseItem{{
+			ItemId:           "1",
+			SolutionInternal: SolutionInternal{FinalAnswer: "квадрат"},
+		}},
+	}
+	// Слово из условия ответа не выдаёт.
+	if leaks := hintWith("Посмотри, у какой фигуры есть углы.", "Сравни квадрат с остальными.").AnswerLeaks(in); len(leaks) != 0 {
+		t.Errorf("answer present in task text must not leak, got %v", leaks)
+	}
+
+	in.Task.TaskTextClean = "Какая фигура лишняя на рисунке?"
+	leaks := hintWith("Лишний — квадрат.").AnswerLeaks(in)
+	if len(leaks) != 1 || leaks[0].Value != "квадрат" {
+		t.Errorf("AnswerLeaks() = %v, want text answer leak", leaks)
+	}
+}
+
+func TestFeedbackLeaks(t *testing.T) {
+	student := "25"
+	in := CheckRequest{TaskStruct: TaskStructCheck{
+		TaskTextClean: leakHintRequest().Task.TaskTextClean,
+		Items:         leakHintRequest().Items,
+	}}
+	tests := []struct {
+		name     string
+		decision CheckDecision
+		feedback string
+		want     bool
+	}{
+		{"incorrect clean", CheckDecisionIncorrect, "Проверь второе действие: сколько учеников ушло?", false},
+		{"incorrect leaks answer", CheckDecisionIncorrect, "Неверно, должно получиться 22.", true},
+		{"student answer allowed", CheckDecisionIncorrect, "У тебя получилось 25 — проверь вычитание.", false},
+		{"correct may name answer", CheckDecisionCorrect, "Верно, 22 ученика!", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := CheckResponse{Decision: tt.decision, Feedback: tt.feedback, Debug: &CheckDebug{NormalizedAnswer: &student}}
+			leaks := out.FeedbackLeaks(in)
+			if (len(leaks) > 0) != tt.want {
+				t.Errorf("FeedbackLeaks(%q) = %v, want leak=%v", tt.feedback, leaks, tt.want)
+			}
+			for _, l := range leaks {
+				if !strings.HasPrefix(l.String(), "feedback:") {
+					t.Errorf("leak %q: want feedback location", l)
+				}
+			}
+		})
+	}
+}
+
+func TestAnswerLeaks_Quantity(t *testing.T) {
+	in := HintRequest{
+		Task: ParseTask{TaskTextClean: "Длина доски 80 см, её удлинили на 40 см. Какой стала длина доски?"},
+		Items: []ParseItem{{
+			ItemId:           "1",
+			SolutionInternal: SolutionInternal{FinalAnswer: "1 м 20 см"},
+		}},
+	}
+	tests := []struct {
+		name string
+		hint string
+		want string
+	}{
+		{name: "unit conversion", hint: "Вспомни: 1 м = 100 см.", want: ""},
+		{name: "other units", hint: "Получится 1,2 м", want: `1/L1: answer "1,2 м"`},
+		{name: "same units", hint: "Доска станет 1 м 20 см.", want: `1/L1: answer "1 м 20 см"`},
+		{name: "base units", hint: "Всего 120 см.", want: `1/L1: answer "120 см"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := FormatLeaks(hintWith(tt.hint).AnswerLeaks(in))
+			if got != tt.want {
+				t.Errorf("AnswerLeaks(%q) = %q, want %q", tt.hint, got, tt.want)
+			}
+		})
+	}
+}
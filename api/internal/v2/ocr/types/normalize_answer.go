@@ -0,0 +1,19 @@
+package types
+
+import "llm-proxy/api/internal/v2/arith"
+
+// NormalizeAnswerRequest — вход /v2/normalize_answer: канонизация ответа
+// без модели, для сравнения ответов на стороне бота.
+type NormalizeAnswerRequest struct {
+	Answer    string  `json:"answer"`
+	CompareTo *string `json:"compare_to,omitempty"` // эталон; тогда в ответе будет equivalent
+	Ordered   bool    `json:"ordered,omitempty"`    // порядок элементов списка важен
+}
+
+// NormalizeAnswerResponse — канонический вид ответа и, если задан
+// compare_to, результат сравнения с эталоном.
+type NormalizeAnswerResponse struct {
+	Answer     arith.Answer  `json:"answer"`
+	CompareTo  *arith.Answer `json:"compare_to,omitempty"`
+	Equivalent *bool         `json:"equivalent,omitempty"`
+}
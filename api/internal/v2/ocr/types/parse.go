@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+
+	"llm-proxy/api/internal/v2/arith"
 )
 
 // Pre-compiled regexes for answer extraction (compiled once, not per-call).
@@ -12,16 +14,20 @@ var (
 	reAnswer        = regexp.MustCompile(`(?i)ответ[:\s]+\s*([-+]?\d+(?:[.,]\d+)?(?:\s*/\s*\d+)?(?:\s+[[:alpha:]а-яА-ЯёЁ²³./]+)?)`)
 	reTotal         = regexp.MustCompile(`(?i)итого[:\s]+\s*([-+]?\d+(?:[.,]\d+)?(?:\s*/\s*\d+)?)`)
 	reLeadingNumber = regexp.MustCompile(`^[-+]?\d+(?:[.,]\d+)?(?:\s*/\s*\d+)?`)
+	reAnswerLabel   = regexp.MustCompile(`(?i)ответ[:\s]+`)
 )
 
 // ParseRequest — вход запроса (PARSE.request.v1)
 type ParseRequest struct {
-	Image             string `json:"image"`
-	TaskId            string `json:"task_id"`
-	Grade             int64  `json:"grade"`
-	SubjectCandidate  string `json:"subject_candidate"`
-	SubjectConfidence string `json:"subject_confidence"`
-	Locale            string `json:"locale"`
+	Image             string     `json:"image"`
+	ImageID           string     `json:"image_id,omitempty"` // ID из POST /v2/images вместо image
+	Images            []ImageRef `json:"images,omitempty"`   // многостраничное задание; image идёт первым
+	TaskId            string     `json:"task_id"`
+	Grade             int64      `json:"grade"`
+	SubjectCandidate  string     `json:"subject_candidate"`
+	SubjectConfidence string     `json:"subject_confidence"`
+	Locale            string     `json:"locale"`
+	Correction        string     `json:"-"` // требование к повторной генерации, см. CorrectionMessage
 }
 
 // H3Reason — enum for hint policy h3_reason
@@ -109,7 +115,7 @@ func (si *SolutionInternal) ValidateFinalAnswer() (consistent bool, derivedAnswe
 		}
 		if si.FinalAnswer != nil && derivedAnswer != "" {
 			finalAnswer := formatAnswerForComparison(si.FinalAnswer)
-			return normalizeAnswer(derivedAnswer) == normalizeAnswer(finalAnswer), derivedAnswer
+			return answersMatch(derivedAnswer, finalAnswer), derivedAnswer
 		}
 	}
 	if si.FinalAnswer == nil {
@@ -134,11 +140,36 @@ func (si *SolutionInternal) ValidateFinalAnswer() (consistent bool, derivedAnswe
 		return true, ""
 	}
 
+	// Величины сравниваются с единицами: "= 120 см" и "1 м 20 см" совпадают,
+	// хотя извлечённое число 120 — нет.
+	if equal, ok := arith.SameQuantity(stepConclusion(lastStep), finalAnswerStr); ok {
+		return equal, derivedAnswer
+	}
+
 	// Normalize and compare
-	consistent = normalizeAnswer(derivedAnswer) == normalizeAnswer(finalAnswerStr)
+	consistent = answersMatch(derivedAnswer, finalAnswerStr)
 	return consistent, derivedAnswer
 }
 
+// ArithmeticIssues пересчитывает арифметику решения без модели: равенства
+// в каждом шаге и, если условие — чистый пример ("36 : 4 + 5 ="), сам
+// final_answer. Пустой результат — расхождений не найдено.
+func (si *SolutionInternal) ArithmeticIssues(itemText string) []string {
+	var issues []string
+	for i, step := range si.SolutionSteps {
+		for _, m := range arith.CheckStep(step) {
+			issues = append(issues, fmt.Sprintf("solution_steps[%d]: %s", i, m))
+		}
+	}
+	if want, ok := arith.TaskValue(itemText); ok {
+		final := formatAnswerForComparison(si.FinalAnswer)
+		if got, ok := arith.AnswerValue(final); ok && got.Cmp(want) != 0 {
+			issues = append(issues, fmt.Sprintf("final_answer: %s, want %s", final, arith.Format(want)))
+		}
+	}
+	return issues
+}
+
 // ParseItem — parsed item (sub-task)
 type ParseItem struct {
 	ItemId           string           `json:"item_id"`
@@ -162,17 +193,21 @@ type ParseResponse struct {
 // P0.1: Called after JSON unmarshal to catch PARSE errors before CHECK.
 // Only flags true contradictions: when final_answer explicitly differs from
 // the answer derived from the last solution step's conclusion pattern.
+// Арифметика шагов и ответа пересчитывается (ArithmeticIssues); ошибка в
+// вычислениях тоже делает ответ небезопасным и добавляет флаг arithmetic_error.
 func (pr *ParseResponse) ValidateItems() int {
 	inconsistent := 0
 	for i := range pr.Items {
 		item := &pr.Items[i]
 		item.PedKeys.TaskType = NormalizeTaskType(item.PedKeys.TaskType)
 		consistent, _ := item.SolutionInternal.ValidateFinalAnswer()
-		if !consistent {
+		arithmeticOK := len(item.SolutionInternal.ArithmeticIssues(item.ItemTextClean)) == 0
+		if !consistent || !arithmeticOK {
 			item.ItemQuality.UnsafeToFinalizeAnswer = true
 			item.SolutionInternal.FinalAnswer = nil
-			if !containsString(pr.Task.Quality.Flags, "solution_inconsistent") {
-				pr.Task.Quality.Flags = append(pr.Task.Quality.Flags, "solution_inconsistent")
+			pr.addQualityFlag("solution_inconsistent")
+			if !arithmeticOK {
+				pr.addQualityFlag("arithmetic_error")
 			}
 			inconsistent++
 		}
@@ -180,6 +215,29 @@ func (pr *ParseResponse) ValidateItems() int {
 	return inconsistent
 }
 
+// ValidateSemantics сообщает о первом пункте, где final_answer противоречит
+// solution_steps или арифметика шагов неверна. В отличие от ValidateItems
+// ответ не меняется: ошибка уходит модели в повторном запросе.
+func (pr ParseResponse) ValidateSemantics() error {
+	for _, item := range pr.Items {
+		si := item.SolutionInternal
+		if consistent, derived := si.ValidateFinalAnswer(); !consistent {
+			return fmt.Errorf("item %s: final_answer %q contradicts solution_steps (derived %q)",
+				item.ItemId, formatAnswerForComparison(si.FinalAnswer), derived)
+		}
+		if issues := si.ArithmeticIssues(item.ItemTextClean); len(issues) > 0 {
+			return fmt.Errorf("item %s: arithmetic errors: %s", item.ItemId, strings.Join(issues, "; "))
+		}
+	}
+	return nil
+}
+
+func (pr *ParseResponse) addQualityFlag(flag string) {
+	if !containsString(pr.Task.Quality.Flags, flag) {
+		pr.Task.Quality.Flags = append(pr.Task.Quality.Flags, flag)
+	}
+}
+
 func containsString(values []string, target string) bool {
 	for _, value := range values {
 		if value == target {
@@ -230,6 +288,34 @@ func formatAnswerForComparison(answer interface{}) string {
 	}
 }
 
+// stepConclusion — результат шага вместе с единицами: всё после "Ответ:"
+// или после последнего "=".
+func stepConclusion(step string) string {
+	if loc := reAnswerLabel.FindStringIndex(step); loc != nil {
+		return step[loc[1]:]
+	}
+	if i := strings.LastIndex(step, "="); i >= 0 {
+		return step[i+1:]
+	}
+	return ""
+}
+
+// answersMatch сравнивает ответы: величины — с учётом единиц ("1 м 20 см" и
+// "120 см" совпадают, "120 см" и "120 мм" — нет), остальное по
+// каноническому виду (arith.Canonicalize: "XIV" и "14", "7 ост. 2" и
+// "7 (ост. 2)"), после нормализации или по значению числа в начале.
+func answersMatch(a, b string) bool {
+	if equal, ok := arith.SameQuantity(a, b); ok {
+		return equal
+	}
+	if arith.Equivalent(a, b, false) || normalizeAnswer(a) == normalizeAnswer(b) {
+		return true
+	}
+	va, okA := arith.AnswerValue(a)
+	vb, okB := arith.AnswerValue(b)
+	return okA && okB && va.Cmp(vb) == 0
+}
+
 // normalizeAnswer normalizes an answer string for comparison.
 // Handles: spaces, comma/dot decimal separators, trailing zeros.
 func normalizeAnswer(s string) string {
@@ -4,11 +4,14 @@ package types
 
 // ParseRURequest — входной запрос PARSE_RU
 type ParseRURequest struct {
-	Image            string `json:"image"`
-	TaskId           string `json:"task_id"`
-	Grade            int    `json:"grade"`
-	SubjectCandidate string `json:"subject_candidate"`
-	Locale           string `json:"locale"`
+	Image            string     `json:"image"`
+	ImageID          string     `json:"image_id,omitempty"` // ID из POST /v2/images вместо image
+	Images           []ImageRef `json:"images,omitempty"`   // многостраничное задание; image идёт первым
+	TaskId           string     `json:"task_id"`
+	Grade            int        `json:"grade"`
+	SubjectCandidate string     `json:"subject_candidate"`
+	Locale           string     `json:"locale"`
+	Correction       string     `json:"-"` // требование к повторной генерации, см. CorrectionMessage
 }
 
 // RUParseMeta — метаданные распознавания
@@ -70,6 +73,7 @@ type HintRUCompactInput struct {
 	SourceItems    []string        `json:"source_items"`
 	AntiGDZBans    []string        `json:"anti_gdz_bans"`
 	Limits         RULimits        `json:"limits"`
+	Correction     string          `json:"-"` // требование к повторной генерации, см. CorrectionMessage
 }
 
 // RUHintPayload — payload для одного действия в HINT
@@ -140,6 +144,7 @@ type CheckRUCompactInput struct {
 	SourceItems    []string         `json:"source_items"`
 	AntiGDZBans    []string         `json:"anti_gdz_bans"`
 	Limits         RULimits         `json:"limits"`
+	Correction     string           `json:"-"` // требование к повторной генерации, см. CorrectionMessage
 }
 
 // RUCheckPayload — payload для одного действия в CHECK
@@ -0,0 +1,141 @@
+package types
+
+import "fmt"
+
+const (
+	ruHintReady      = "ready"
+	ruCheckCorrect   = "correct"
+	ruCheckNeedsFix  = "needs_fix"
+	ruResultHasIssue = "has_issue"
+	ruCoverageFull   = "full"
+)
+
+// ValidateSemantics проверяет план PARSE_RU: у каждого действия есть
+// уникальный action_id, а нечитаемое фото не даёт полного покрытия.
+func (r ParseRUResponse) ValidateSemantics() error {
+	if !r.ParseMeta.Readable && r.ActionPlan.Coverage == ruCoverageFull {
+		return fmt.Errorf("readable=false contradicts coverage=full")
+	}
+	seen := make(map[string]bool, len(r.ActionPlan.Actions))
+	for i, a := range r.ActionPlan.Actions {
+		if a.ActionID == "" {
+			return fmt.Errorf("actions[%d]: empty action_id", i)
+		}
+		if seen[a.ActionID] {
+			return fmt.Errorf("actions[%d]: duplicate action_id %q", i, a.ActionID)
+		}
+		seen[a.ActionID] = true
+	}
+	return nil
+}
+
+// ValidateAgainstRequest проверяет HINT_RU по входу: карточки и кнопки
+// ссылаются на действия и правила из payload, лимиты соблюдены, готовая
+// подсказка содержит хотя бы одну карточку.
+func (r HintRUResponse) ValidateAgainstRequest(in HintRUCompactInput) error {
+	if r.Status == ruHintReady && len(r.HintCards) == 0 {
+		return fmt.Errorf("status=ready requires hint_cards")
+	}
+	if limit := in.Limits.MaxHintCards; limit > 0 && len(r.HintCards) > limit {
+		return fmt.Errorf("hint_cards: got %d, limit %d", len(r.HintCards), limit)
+	}
+	actions := make(map[string]bool, len(in.ActionsPayload))
+	rules := map[string]bool{}
+	for _, a := range in.ActionsPayload {
+		actions[a.ActionID] = true
+		for _, rule := range a.RelevantRules {
+			rules[rule.RuleID] = true
+		}
+	}
+	for i, c := range r.HintCards {
+		if err := knownAction(actions, c.ActionID); err != nil {
+			return fmt.Errorf("hint_cards[%d]: %w", i, err)
+		}
+	}
+	return validateRuleButtons(r.RuleButtons, in.Limits.MaxRuleButtons, actions, rules)
+}
+
+// ValidateAgainstRequest проверяет CHECK_RU по входу: результаты и группы
+// ошибок относятся к действиям и правилам из payload, статус согласован с
+// результатами (correct — без ошибок, needs_fix — хотя бы одна ошибка).
+func (r CheckRUResponse) ValidateAgainstRequest(in CheckRUCompactInput) error {
+	actions := make(map[string]bool, len(in.ActionsPayload))
+	rules := map[string]bool{}
+	for _, a := range in.ActionsPayload {
+		actions[a.ActionID] = true
+		for _, rule := range a.RelevantRules {
+			rules[rule.RuleID] = true
+		}
+	}
+	issues := len(r.ErrorGroups)
+	checked := make(map[string]bool, len(r.CheckedActions))
+	for i, a := range r.CheckedActions {
+		if err := knownAction(actions, a.ActionID); err != nil {
+			return fmt.Errorf("checked_actions[%d]: %w", i, err)
+		}
+		if checked[a.ActionID] {
+			return fmt.Errorf("checked_actions[%d]: duplicate action_id %q", i, a.ActionID)
+		}
+		checked[a.ActionID] = true
+		if a.Result == ruResultHasIssue {
+			issues++
+		}
+	}
+	if limit := in.Limits.MaxErrorGroups; limit > 0 && len(r.ErrorGroups) > limit {
+		return fmt.Errorf("error_groups: got %d, limit %d", len(r.ErrorGroups), limit)
+	}
+	for i, g := range r.ErrorGroups {
+		if err := knownAction(actions, g.ActionID); err != nil {
+			return fmt.Errorf("error_groups[%d]: %w", i, err)
+		}
+		for _, id := range g.RuleIDs {
+			if len(rules) > 0 && !rules[id] {
+				return fmt.Errorf("error_groups[%d]: rule_id %q is not in relevant_rules", i, id)
+			}
+		}
+	}
+	switch {
+	case r.Status == ruCheckCorrect && issues > 0:
+		return fmt.Errorf("status=correct contradicts has_issue results or error_groups")
+	case r.Status == ruCheckNeedsFix && issues == 0:
+		return fmt.Errorf("status=needs_fix requires has_issue result or error_groups")
+	}
+	return validateRuleButtons(r.RuleButtons, in.Limits.MaxRuleButtons, actions, rules)
+}
+
+// knownAction — action_id есть в payload. Пустой payload и пустой
+// action_id не проверяются: сослаться не на что.
+func knownAction(actions map[string]bool, id string) error {
+	if len(actions) == 0 || id == "" || actions[id] {
+		return nil
+	}
+	return fmt.Errorf("unknown action_id %q", id)
+}
+
+func validateRuleButtons(buttons []RURuleButton, limit int, actions, rules map[string]bool) error {
+	if limit > 0 && len(buttons) > limit {
+		return fmt.Errorf("rule_buttons: got %d, limit %d", len(buttons), limit)
+	}
+	for i, b := range buttons {
+		if err := knownAction(actions, b.ActionID); err != nil {
+			return fmt.Errorf("rule_buttons[%d]: %w", i, err)
+		}
+		if len(rules) > 0 && !rules[b.RuleID] {
+			return fmt.Errorf("rule_buttons[%d]: rule_id %q is not in relevant_rules", i, b.RuleID)
+		}
+	}
+	return nil
+}
+
+// ConservativeCheckRUResponse — ответ CHECK_RU, когда проверка не прошла
+// semantic validation и после повторных попыток: без вердикта.
+func ConservativeCheckRUResponse() CheckRUResponse {
+	return CheckRUResponse{
+		Status:         "cannot_check",
+		Confidence:     "none",
+		ChildMessage:   "Не получилось надёжно проверить ответ. Попробуй проверить ещё раз позже.",
+		CheckedActions: []RUCheckedAction{},
+		ErrorGroups:    []RUErrorGroup{},
+		RuleButtons:    []RURuleButton{},
+	}
+}
@@ -0,0 +1,123 @@
+package types
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseRUResponseValidateSemantics(t *testing.T) {
+	t.Parallel()
+	plan := func(readable bool, coverage string, ids ...string) ParseRUResponse {
+		r := ParseRUResponse{ParseMeta: RUParseMeta{Readable: readable}, ActionPlan: RUActionPlan{Coverage: coverage}}
+		for _, id := range ids {
+			r.ActionPlan.Actions = append(r.ActionPlan.Actions, RUAction{ActionID: id})
+		}
+		return r
+	}
+	tests := []struct {
+		name    string
+		r       ParseRUResponse
+		wantErr string
+	}{
+		{"valid", plan(true, "full", "a1", "a2"), ""},
+		{"unreadable partial", plan(false, "partial", "a1"), ""},
+		{"unreadable full", plan(false, "full", "a1"), "readable=false"},
+		{"empty id", plan(true, "full", ""), "empty action_id"},
+		{"duplicate id", plan(true, "full", "a1", "a1"), "duplicate action_id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkErr(t, tt.r.ValidateSemantics(), tt.wantErr)
+		})
+	}
+}
+
+func TestHintRUResponseValidateAgainstRequest(t *testing.T) {
+	t.Parallel()
+	in := HintRUCompactInput{
+		ActionsPayload: []RUHintPayload{{ActionID: "a1", RelevantRules: []RUCompactRuleHint{{RuleID: "r1"}}}},
+		Limits:         RULimits{MaxHintCards: 1, MaxRuleButtons: 1},
+	}
+	card := RUHintCard{ActionID: "a1"}
+	tests := []struct {
+		name    string
+		r       HintRUResponse
+		wantErr string
+	}{
+		{"valid", HintRUResponse{Status: "ready", HintCards: []RUHintCard{card}, RuleButtons: []RURuleButton{{RuleID: "r1", ActionID: "a1"}}}, ""},
+		{"cannot help without cards", HintRUResponse{Status: "cannot_help"}, ""},
+		{"ready without cards", HintRUResponse{Status: "ready"}, "requires hint_cards"},
+		{"too many cards", HintRUResponse{Status: "ready", HintCards: []RUHintCard{card, card}}, "limit 1"},
+		{"unknown action", HintRUResponse{Status: "ready", HintCards: []RUHintCard{{ActionID: "a9"}}}, `unknown action_id "a9"`},
+		{"unknown rule", HintRUResponse{Status: "ready", HintCards: []RUHintCard{card}, RuleButtons: []RURuleButton{{RuleID: "r9", ActionID: "a1"}}}, "not in relevant_rules"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkErr(t, tt.r.ValidateAgainstRequest(in), tt.wantErr)
+		})
+	}
+}
+
+func TestCheckRUResponseValidateAgainstRequest(t *testing.T) {
+	t.Parallel()
+	in := CheckRUCompactInput{
+		ActionsPayload: []RUCheckPayload{
+			{ActionID: "a1", RelevantRules: []RUCompactRuleCheck{{RuleID: "r1"}}},
+			{ActionID: "a2"},
+		},
+		Limits: RULimits{MaxErrorGroups: 1},
+	}
+	action := func(id, result string) RUCheckedAction { return RUCheckedAction{ActionID: id, Result: result} }
+	tests := []struct {
+		name    string
+		r       CheckRUResponse
+		wantErr string
+	}{
+		{"correct", CheckRUResponse{Status: "correct", CheckedActions: []RUCheckedAction{action("a1", "correct"), action("a2", "correct")}}, ""},
+		{"needs fix", CheckRUResponse{Status: "needs_fix", CheckedActions: []RUCheckedAction{action("a1", "has_issue")},
+			ErrorGroups: []RUErrorGroup{{ActionID: "a1", RuleIDs: []string{"r1"}}}}, ""},
+		{"correct with issue", CheckRUResponse{Status: "correct", CheckedActions: []RUCheckedAction{action("a1", "has_issue")}}, "status=correct"},
+		{"needs fix without issue", CheckRUResponse{Status: "needs_fix", CheckedActions: []RUCheckedAction{action("a1", "correct")}}, "status=needs_fix"},
+		{"duplicate action", CheckRUResponse{Status: "almost", CheckedActions: []RUCheckedAction{action("a1", "unclear"), action("a1", "unclear")}}, "duplicate"},
+		{"unknown action", CheckRUResponse{Status: "almost", CheckedActions: []RUCheckedAction{action("a9", "unclear")}}, `unknown action_id "a9"`},
+		{"too many groups", CheckRUResponse{Status: "needs_fix", ErrorGroups: []RUErrorGroup{{ActionID: "a1"}, {ActionID: "a2"}}}, "limit 1"},
+		{"unknown group rule", CheckRUResponse{Status: "needs_fix", ErrorGroups: []RUErrorGroup{{ActionID: "a1", RuleIDs: []string{"r9"}}}}, "not in relevant_rules"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkErr(t, tt.r.ValidateAgainstRequest(in), tt.wantErr)
+		})
+	}
+}
+
+func TestParseResponseValidateSemantics(t *testing.T) {
+	t.Parallel()
+	response := func(step, final string) ParseResponse {
+		return ParseResponse{Items: []ParseItem{{
+			ItemId:           "1",
+			SolutionInternal: SolutionInternal{SolutionSteps: []string{step}, FinalAnswer: final},
+		}}}
+	}
+	checkErr(t, response("27444 + 32646 = 60090", "60090").ValidateSemantics(), "")
+	checkErr(t, response("27444 + 32646 = 60090", "59844").ValidateSemantics(), "contradicts solution_steps")
+	checkErr(t, response("27444 + 32646 = 60000", "60000").ValidateSemantics(), "arithmetic errors")
+
+	r := response("27444 + 32646 = 60090", "59844")
+	_ = r.ValidateSemantics()
+	if r.Items[0].SolutionInternal.FinalAnswer == nil || r.Items[0].ItemQuality.UnsafeToFinalizeAnswer {
+		t.Fatal("ValidateSemantics modified the response")
+	}
+}
+
+func checkErr(t *testing.T, err error, want string) {
+	t.Helper()
+	if want == "" {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return
+	}
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Fatalf("error = %v, want containing %q", err, want)
+	}
+}
@@ -147,6 +147,56 @@ func TestKnownTesterRegressions(t *testing.T) {
 			t.Fatal("2/5 plan coverage was accepted")
 		}
 	})
+	t.Run("8 mixed length answer is accepted as correct", func(t *testing.T) {
+		assertCheckAnswers(t, CheckDecisionCorrect, "1 м 20 см", "120 см", false)
+	})
+	t.Run("9 decimal metres equal centimetres", func(t *testing.T) {
+		assertCheckAnswers(t, CheckDecisionCorrect, "1,2 м", "120 см", false)
+	})
+	t.Run("10 same number in other units is not correct", func(t *testing.T) {
+		assertCheckAnswers(t, CheckDecisionCorrect, "120 мм", "120 см", true)
+		assertCheckAnswers(t, CheckDecisionIncorrect, "120 мм", "120 см", false)
+	})
+	t.Run("11 hours and minutes equal minutes", func(t *testing.T) {
+		assertCheckAnswers(t, CheckDecisionCorrect, "1 ч 30 мин", "90 минут", false)
+	})
+	t.Run("12 rubles and kopecks", func(t *testing.T) {
+		assertCheckAnswers(t, CheckDecisionIncorrect, "5 р. 50 к.", "550 коп.", true)
+	})
+	t.Run("13 parse final answer in mixed units matches the last step", func(t *testing.T) {
+		response := ParseResponse{Items: []ParseItem{{SolutionInternal: SolutionInternal{
+			SolutionSteps: []string{"80 см + 40 см = 120 см"}, FinalAnswer: "1 м 20 см",
+		}}}}
+		if got := response.ValidateItems(); got != 0 {
+			t.Fatalf("ValidateItems()=%d, want 0", got)
+		}
+	})
+	t.Run("14 parse final answer in other units is a contradiction", func(t *testing.T) {
+		assertParseContradiction(t, "3 кг + 200 г = 3200 г", "3 кг 20 г")
+	})
+	t.Run("15 fraction and decimal answers are equivalent", func(t *testing.T) {
+		assertCheckAnswers(t, CheckDecisionCorrect, "0,75", "3/4", false)
+	})
+	t.Run("16 division with remainder in different notation", func(t *testing.T) {
+		assertCheckAnswers(t, CheckDecisionCorrect, "7 ост. 2", "7 (остаток 2)", false)
+		assertCheckAnswers(t, CheckDecisionCorrect, "7", "7 ост. 2", true)
+	})
+	t.Run("17 roman numeral and number word", func(t *testing.T) {
+		assertCheckAnswers(t, CheckDecisionCorrect, "XIV", "14", false)
+		assertCheckAnswers(t, CheckDecisionCorrect, "двенадцать", "12", false)
+	})
+	t.Run("18 unordered list answer", func(t *testing.T) {
+		assertCheckAnswers(t, CheckDecisionCorrect, "6, 4, 2", "2, 4, 6", false)
+	})
+	t.Run("19 ordered list answer respects order", func(t *testing.T) {
+		response := validCheckResponse()
+		student, expected := "6, 4, 2", "2, 4, 6"
+		response.Debug.NormalizedAnswer, response.Debug.ExpectedAnswer = &student, &expected
+		request := CheckRequest{TaskStruct: TaskStructCheck{Items: []ParseItem{{PedKeys: PedKeys{Constraints: []string{"ordered_answer"}}}}}}
+		if err := response.ValidateSemantics(request); err == nil {
+			t.Fatal("correct verdict for a list in the wrong order was accepted")
+		}
+	})
 }
 
 func assertParseContradiction(t *testing.T, step string, finalAnswer interface{}) {
@@ -159,6 +209,17 @@ func assertParseContradiction(t *testing.T, step string, finalAnswer interface{}
 	}
 }
 
+func assertCheckAnswers(t *testing.T, decision CheckDecision, student, expected string, wantErr bool) {
+	t.Helper()
+	response := validCheckResponse()
+	response.Decision = decision
+	response.Debug.NormalizedAnswer = &student
+	response.Debug.ExpectedAnswer = &expected
+	if err := response.ValidateSemantics(CheckRequest{}); (err != nil) != wantErr {
+		t.Fatalf("%s for %q vs %q: error=%v, wantErr=%v", decision, student, expected, err, wantErr)
+	}
+}
+
 func hintValidationRequest() HintRequest {
 	return HintRequest{
 		Task: ParseTask{Subject: SubjectMath},
@@ -195,3 +256,75 @@ func validCheckResponse() CheckResponse {
 		},
 	}
 }
+
+func TestParseResponseValidateItems_RecomputesArithmetic(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		itemText string
+		steps    []string
+		final    interface{}
+		want     int
+	}{
+		{name: "correct steps", steps: []string{"1) 12 + 5 = 17", "2) 17 · 2 = 34"}, final: "34", want: 0},
+		{name: "wrong intermediate step", steps: []string{"1) 12 + 5 = 18", "2) 18 · 2 = 36"}, final: "36", want: 1},
+		{name: "wrong remainder", steps: []string{"17 : 5 = 3 (ост. 1)"}, final: "3 (ост. 1)", want: 1},
+		{name: "expression task without steps", itemText: "36 : 4 + 5 =", final: 13.0, want: 1},
+		{name: "expression task answered correctly", itemText: "36 : 4 + 5 =", final: 14.0, want: 0},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			response := ParseResponse{Items: []ParseItem{{
+				ItemTextClean:    tt.itemText,
+				SolutionInternal: SolutionInternal{SolutionSteps: tt.steps, FinalAnswer: tt.final},
+			}}}
+			if got := response.ValidateItems(); got != tt.want {
+				t.Fatalf("ValidateItems()=%d, want %d", got, tt.want)
+			}
+			if tt.want > 0 && !containsString(response.Task.Quality.Flags, "arithmetic_error") {
+				t.Fatalf("flags = %v, want arithmetic_error", response.Task.Quality.Flags)
+			}
+		})
+	}
+}
+
+func TestCheckResponseValidateSemantics_Arithmetic(t *testing.T) {
+	t.Parallel()
+	request := CheckRequest{TaskStruct: TaskStructCheck{Items: []ParseItem{{ItemTextClean: "36 : 4 + 5 ="}}}}
+
+	response := validCheckResponse()
+	if err := response.ValidateSemantics(request); err == nil {
+		t.Fatal("expected_answer 4 for 36 : 4 + 5 was accepted")
+	}
+
+	expected, student := "14", "14"
+	response.Debug.ExpectedAnswer, response.Debug.NormalizedAnswer = &expected, &student
+	if err := response.ValidateSemantics(request); err != nil {
+		t.Fatalf("verified verdict rejected: %v", err)
+	}
+
+	half, decimal := "1/2", "0,5"
+	response.Debug.ExpectedAnswer, response.Debug.NormalizedAnswer = &half, &decimal
+	if err := response.ValidateSemantics(CheckRequest{}); err != nil {
+		t.Fatalf("equal fraction and decimal rejected: %v", err)
+	}
+	response.Decision = CheckDecisionIncorrect
+	if err := response.ValidateSemantics(CheckRequest{}); err == nil {
+		t.Fatal("incorrect verdict for 0,5 = 1/2 was accepted")
+	}
+}
+
+func TestParseResponseValidateItems_ComparesAnswerValues(t *testing.T) {
+	t.Parallel()
+	response := ParseResponse{Items: []ParseItem{{
+		SolutionInternal: SolutionInternal{
+			SolutionSteps: []string{"Половина: 1 : 2 = 1/2"},
+			FinalAnswer:   "0,5",
+		},
+	}}}
+	if got := response.ValidateItems(); got != 0 {
+		t.Fatalf("ValidateItems()=%d, want 0 for 1/2 = 0,5", got)
+	}
+}
@@ -5,11 +5,72 @@ package types
 type LLMStats struct {
 	InputTokens  int     // реальные входные токены от API
 	OutputTokens int     // реальные выходные токены от API
+	CachedTokens int     // входные токены, прочитанные из кэша промпта провайдера (входят в InputTokens)
 	LatencyMs    int64   // время от отправки запроса до получения ответа
 	Model        string  // конкретная модель, обработавшая запрос
 	PromptHash   string  // короткий SHA-256 фактически отправленного system prompt
 	PromptBlocks string  // подключённые динамические блоки через запятую
 	CostUSD      float64 // provider-reported cost, если доступен
+	Cache        string  // результат кэша ответов: hit-memory | hit-disk | miss | bypass; пусто — кэш не участвовал
+	LeakCheck    string  // проверка утечки ответа (leakguard): clean | regenerated | leaked; пусто — не проверялось
+	Safety       string  // фильтр безопасности текста: clean | regenerated | fallback | blocked; пусто — не проверялось
+	Readability  string  // читаемость по классу: ok | retried | warned | skipped; пусто — не проверялось
+	Validation   string  // semantic validation ответа: valid | repaired | failed; пусто — не проверялось
+	JSONRepair   string  // разбор JSON ответа модели: clean | repaired | failed; пусто — не разбирался
+
+	ImageBytesIn  int // размер изображения из запроса до предобработки; 0 — шаг без изображения
+	ImageBytesOut int // размер изображения, фактически отправленного провайдеру
+}
+
+// SetImage записывает размеры изображения до и после предобработки.
+// Безопасен для nil: при ошибке до вызова провайдера статистики нет.
+func (s *LLMStats) SetImage(bytesIn, bytesOut int) {
+	if s == nil {
+		return
+	}
+	s.ImageBytesIn = bytesIn
+	s.ImageBytesOut = bytesOut
+}
+
+// OrEmpty возвращает s, а вместо nil — пустые метрики: итог проверки
+// записывается и тогда, когда движок метрик не вернул.
+func (s *LLMStats) OrEmpty() *LLMStats {
+	if s == nil {
+		return &LLMStats{}
+	}
+	return s
+}
+
+// Plus добавляет метрики вызова other, ответ которого не отдаётся (повтор
+// не удался), к s и возвращает результат. Безопасен для nil: без
+// накопленных метрик результат — копия other.
+func (s *LLMStats) Plus(other *LLMStats) *LLMStats {
+	if s == nil && other != nil {
+		c := *other
+		return &c
+	}
+	s = s.OrEmpty()
+	s.Add(other)
+	return s
+}
+
+// Retry возвращает метрики повторного вызова, ответ которого отдаётся
+// вместо прежнего: модель, промпт, изображение и итоги кэша, разбора и
+// проверок берутся у retry, а токены, время и стоимость суммируются со всеми
+// прежними вызовами s. Безопасен для nil.
+func (s *LLMStats) Retry(retry *LLMStats) *LLMStats {
+	if retry == nil {
+		return s.OrEmpty()
+	}
+	out := *retry
+	if s != nil {
+		out.InputTokens += s.InputTokens
+		out.OutputTokens += s.OutputTokens
+		out.CachedTokens += s.CachedTokens
+		out.LatencyMs += s.LatencyMs
+		out.CostUSD += s.CostUSD
+	}
+	return &out
 }
 
 // Add добавляет метрики другого вызова к накопленным.
@@ -19,6 +80,7 @@ func (s *LLMStats) Add(other *LLMStats) {
 	}
 	s.InputTokens += other.InputTokens
 	s.OutputTokens += other.OutputTokens
+	s.CachedTokens += other.CachedTokens
 	s.LatencyMs += other.LatencyMs
 	s.CostUSD += other.CostUSD
 	if s.PromptHash == "" {
@@ -27,4 +89,8 @@ func (s *LLMStats) Add(other *LLMStats) {
 	if s.PromptBlocks == "" {
 		s.PromptBlocks = other.PromptBlocks
 	}
+	// Повторный вызов отправляет то же изображение — размеры не суммируются.
+	if s.ImageBytesIn == 0 {
+		s.ImageBytesIn, s.ImageBytesOut = other.ImageBytesIn, other.ImageBytesOut
+	}
 }
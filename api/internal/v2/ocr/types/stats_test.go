@@ -0,0 +1,32 @@
+package types
+
+import "testing"
+
+func TestLLMStats_PlusRetry(t *testing.T) {
+	first := &LLMStats{InputTokens: 10, CostUSD: 0.5, Model: "a", Cache: "miss", Validation: "failed", JSONRepair: "failed", ImageBytesIn: 7}
+	retry := &LLMStats{InputTokens: 20, CostUSD: 0.25, Model: "b", Cache: "bypass", Validation: "valid", JSONRepair: "clean", ImageBytesIn: 7}
+
+	got := first.Retry(retry)
+	if got.InputTokens != 30 || got.CostUSD != 0.75 {
+		t.Errorf("Retry() tokens=%d cost=%v, want both calls summed", got.InputTokens, got.CostUSD)
+	}
+	if got.Model != "b" || got.Cache != "bypass" || got.Validation != "valid" || got.JSONRepair != "clean" || got.ImageBytesIn != 7 {
+		t.Errorf("Retry() = %+v, want result fields of the retry", got)
+	}
+	if retry.InputTokens != 20 {
+		t.Error("Retry() must not modify its argument")
+	}
+
+	got = (&LLMStats{InputTokens: 10, Model: "a", Cache: "miss"}).Plus(retry)
+	if got.InputTokens != 30 || got.Model != "a" || got.Cache != "miss" {
+		t.Errorf("Plus() = %+v, want summed tokens and own result fields", got)
+	}
+
+	var none *LLMStats
+	if got := none.Plus(retry); got == retry || got.Model != "b" {
+		t.Errorf("nil.Plus() = %+v, want a copy of the argument", got)
+	}
+	if got := none.Retry(nil); got == nil {
+		t.Error("nil.Retry(nil) = nil, want empty stats")
+	}
+}
@@ -0,0 +1,288 @@
+// Package validation — общий цикл semantic validation для шагов v2 всех
+// движков: ответ модели проверяется инвариантами, которые не выражает JSON
+// Schema (согласованность final_answer, покрытие плана подсказками, вердикт
+// CHECK против эталона, ссылки HINT_RU/CHECK_RU на действия и правила). При
+// ошибке модель вызывается повторно с CORRECTION_REQUIRED и текстом ошибки
+// валидатора — до заданного числа попыток. Когда попытки исчерпаны, шаг
+// ведёт себя одинаково в любом движке: PARSE помечает ответ небезопасным,
+// CHECK и CHECK_RU отдают консервативный ответ без вердикта, остальные
+// шаги возвращают ошибку — неполная подсказка не публикуется. Ответ, JSON
+// которого не удалось отремонтировать (jsonrepair.ErrMalformed), тоже
+// повторяется в пределах тех же попыток, а после них возвращается ошибкой;
+// у DETECT и ANALOGUE инвариантов сверх схемы нет, повторяется только он.
+package validation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"llm-proxy/api/internal/metrics"
+	"llm-proxy/api/internal/v2/ocr/jsonrepair"
+	"llm-proxy/api/internal/v2/ocr/types"
+)
+
+// DefaultAttempts — вызовов модели на шаг по умолчанию: ответ и один повтор.
+const DefaultAttempts = 2
+
+// Итоги проверки для stats.Validation и метрики.
+const (
+	ResultValid    = "valid"    // ответ прошёл проверку с первой попытки
+	ResultRepaired = "repaired" // ошибку исправил повторный вызов
+	ResultFailed   = "failed"   // попытки исчерпаны
+)
+
+var checked = metrics.NewCounter(
+	"llm_proxy_semantic_validation_total",
+	"Semantic validation of v2 step responses by result.",
+	"step", "result",
+)
+
+// Attempts нормализует число попыток: n < 1 — DefaultAttempts.
+func Attempts(n int) int {
+	if n < 1 {
+		return DefaultAttempts
+	}
+	return n
+}
+
+// Call — вызов шага движка без проверки.
+type Call[Req, Resp any] func(context.Context, Req) (Resp, *types.LLMStats, error)
+
+type step[Req, Resp any] struct {
+	name     string
+	validate func(Req, *Resp) error
+	advice   string // что исправить, в дополнение к ошибке валидатора
+	correct  func(Req, string) Req
+	// exhausted приводит последний ответ к публикуемому виду; ошибка —
+	// ответ не отдаётся.
+	exhausted func(*Resp, error) error
+}
+
+func run[Req, Resp any](ctx context.Context, attempts int, s step[Req, Resp], in Req, call Call[Req, Resp]) (Resp, *types.LLMStats, error) {
+	attempts = Attempts(attempts)
+	var (
+		out    Resp
+		parsed bool // хотя бы один ответ разобран: есть что отдать в exhausted
+		stats  *types.LLMStats
+		fail   error // ошибка последней попытки: валидатора или разбора JSON
+		req    = in
+	)
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if attempt > 1 {
+			req = s.correct(in, correction(fail, s.advice))
+		}
+		resp, callStats, err := call(ctx, req)
+		if err != nil && !errors.Is(err, jsonrepair.ErrMalformed) {
+			if attempt == 1 {
+				return resp, callStats, err
+			}
+			log.Printf("[validation] %s retry failed: %v", s.name, err)
+			stats = stats.Plus(callStats)
+			break
+		}
+		// Итоги кэша, разбора JSON и проверок — последней попытки: её ответ
+		// и отдаётся.
+		stats = stats.Retry(callStats)
+		if err != nil {
+			// Ремонт JSON не помог: повтор с требованием вернуть JSON по схеме.
+			fail = err
+		} else if fail = s.validate(in, &resp); fail == nil {
+			result := ResultValid
+			if attempt > 1 {
+				result = ResultRepaired
+			}
+			return resp, record(stats, s.name, result), nil
+		} else {
+			out, parsed = resp, true
+		}
+		log.Printf("[validation] %s attempt %d/%d: %v", s.name, attempt, attempts, fail)
+	}
+	stats = record(stats, s.name, ResultFailed)
+	if !parsed {
+		var zero Resp
+		return zero, stats, fail
+	}
+	if err := s.exhausted(&out, fail); err != nil {
+		var zero Resp
+		return zero, stats, err
+	}
+	return out, stats, nil
+}
+
+func correction(fail error, advice string) string {
+	if errors.Is(fail, jsonrepair.ErrMalformed) {
+		return "Предыдущий ответ не удалось разобрать как JSON: " + fail.Error() +
+			". Верни только один JSON-объект строго по схеме, без пояснений и markdown."
+	}
+	return "Предыдущий ответ не прошёл semantic validation: " + fail.Error() + ". " + advice
+}
+
+// joinCorrection добавляет требование к уже заданному: повторная генерация
+// декоратора (утечка, тон) тоже проходит проверку.
+func joinCorrection(prev, c string) string {
+	if prev == "" {
+		return c
+	}
+	return prev + "\n" + c
+}
+
+func record(stats *types.LLMStats, step, result string) *types.LLMStats {
+	checked.Inc(step, result)
+	stats = stats.OrEmpty()
+	stats.Validation = result
+	return stats
+}
+
+// Detect — DETECT: проверок сверх схемы нет, повторяется только ответ,
+// JSON которого не удалось отремонтировать.
+func Detect(ctx context.Context, attempts int, in types.DetectRequest, call Call[types.DetectRequest, types.DetectResponse]) (types.DetectResponse, *types.LLMStats, error) {
+	return run(ctx, attempts, step[types.DetectRequest, types.DetectResponse]{
+		name:     "detect",
+		validate: func(types.DetectRequest, *types.DetectResponse) error { return nil },
+		correct: func(in types.DetectRequest, c string) types.DetectRequest {
+			in.Correction = joinCorrection(in.Correction, c)
+			return in
+		},
+		exhausted: func(_ *types.DetectResponse, err error) error { return err },
+	}, in, call)
+}
+
+// Parse — PARSE: final_answer согласован с solution_steps, арифметика верна.
+// После исчерпания попыток противоречивые пункты помечаются
+// unsafe_to_finalize_answer (ValidateItems).
+func Parse(ctx context.Context, attempts int, in types.ParseRequest, call Call[types.ParseRequest, types.ParseResponse]) (types.ParseResponse, *types.LLMStats, error) {
+	return run(ctx, attempts, step[types.ParseRequest, types.ParseResponse]{
+		name: "parse",
+		validate: func(_ types.ParseRequest, r *types.ParseResponse) error {
+			if err := r.ValidateSemantics(); err != nil {
+				return err
+			}
+			r.ValidateItems()
+			return nil
+		},
+		advice: "Реши задачу заново независимо, проверь обратным действием и верни согласованный JSON. " +
+			"Если подтвердить ответ нельзя, верни final_answer=null и unsafe_to_finalize_answer=true.",
+		correct: func(in types.ParseRequest, c string) types.ParseRequest {
+			in.Correction = joinCorrection(in.Correction, c)
+			return in
+		},
+		exhausted: func(r *types.ParseResponse, _ error) error {
+			r.ValidateItems()
+			return nil
+		},
+	}, in, call)
+}
+
+// Hint — HINT: подсказки покрывают план каждого пункта на всех уровнях.
+func Hint(ctx context.Context, attempts int, in types.HintRequest, call Call[types.HintRequest, types.HintResponse]) (types.HintResponse, *types.LLMStats, error) {
+	return run(ctx, attempts, step[types.HintRequest, types.HintResponse]{
+		name: "hint",
+		validate: func(in types.HintRequest, r *types.HintResponse) error {
+			return r.ValidateAgainstRequest(in)
+		},
+		advice: "Покрой каждый шаг solution_internal.plan, выставь точный plan_coverage и верни все обязательные уровни L1/L2/L3.",
+		correct: func(in types.HintRequest, c string) types.HintRequest {
+			in.Correction = joinCorrection(in.Correction, c)
+			return in
+		},
+		exhausted: func(_ *types.HintResponse, err error) error {
+			return fmt.Errorf("hint semantic validation: %w", err)
+		},
+	}, in, call)
+}
+
+// Check — CHECK: вердикт согласован с независимо подтверждённым эталоном.
+// После исчерпания попыток — ConservativeCheckResponse.
+func Check(ctx context.Context, attempts int, in types.CheckRequest, call Call[types.CheckRequest, types.CheckResponse]) (types.CheckResponse, *types.LLMStats, error) {
+	return run(ctx, attempts, step[types.CheckRequest, types.CheckResponse]{
+		name: "check",
+		validate: func(in types.CheckRequest, r *types.CheckResponse) error {
+			return r.ValidateSemantics(in)
+		},
+		advice: "Независимо реши задачу до сравнения с ответом ученика, подтверди эталон вторым способом, " +
+			"заполни все verification-поля и visual_evidence для визуальной задачи.",
+		correct: func(in types.CheckRequest, c string) types.CheckRequest {
+			in.Correction = joinCorrection(in.Correction, c)
+			return in
+		},
+		exhausted: func(r *types.CheckResponse, _ error) error {
+			*r = types.ConservativeCheckResponse()
+			r.SetIsCorrectFromDecision()
+			return nil
+		},
+	}, in, call)
+}
+
+// ParseRU — PARSE_RU: уникальные action_id, покрытие согласовано с читаемостью.
+func ParseRU(ctx context.Context, attempts int, in types.ParseRURequest, call Call[types.ParseRURequest, types.ParseRUResponse]) (types.ParseRUResponse, *types.LLMStats, error) {
+	return run(ctx, attempts, step[types.ParseRURequest, types.ParseRUResponse]{
+		name: "parse_ru",
+		validate: func(_ types.ParseRURequest, r *types.ParseRUResponse) error {
+			return r.ValidateSemantics()
+		},
+		advice: "Дай каждому действию непустой уникальный action_id; для нечитаемого фото не ставь coverage=full.",
+		correct: func(in types.ParseRURequest, c string) types.ParseRURequest {
+			in.Correction = joinCorrection(in.Correction, c)
+			return in
+		},
+		exhausted: func(_ *types.ParseRUResponse, err error) error {
+			return fmt.Errorf("parse_ru semantic validation: %w", err)
+		},
+	}, in, call)
+}
+
+// HintRU — HINT_RU: карточки и кнопки ссылаются на действия и правила входа.
+func HintRU(ctx context.Context, attempts int, in types.HintRUCompactInput, call Call[types.HintRUCompactInput, types.HintRUResponse]) (types.HintRUResponse, *types.LLMStats, error) {
+	return run(ctx, attempts, step[types.HintRUCompactInput, types.HintRUResponse]{
+		name: "hint_ru",
+		validate: func(in types.HintRUCompactInput, r *types.HintRUResponse) error {
+			return r.ValidateAgainstRequest(in)
+		},
+		advice: "Используй только action_id и rule_id из COMPACT_INPUT, соблюдай limits; " +
+			"при status=ready верни хотя бы одну карточку.",
+		correct: func(in types.HintRUCompactInput, c string) types.HintRUCompactInput {
+			in.Correction = joinCorrection(in.Correction, c)
+			return in
+		},
+		exhausted: func(_ *types.HintRUResponse, err error) error {
+			return fmt.Errorf("hint_ru semantic validation: %w", err)
+		},
+	}, in, call)
+}
+
+// CheckRU — CHECK_RU: результаты согласованы со статусом и входом.
+// После исчерпания попыток — ConservativeCheckRUResponse.
+func CheckRU(ctx context.Context, attempts int, in types.CheckRUCompactInput, call Call[types.CheckRUCompactInput, types.CheckRUResponse]) (types.CheckRUResponse, *types.LLMStats, error) {
+	return run(ctx, attempts, step[types.CheckRUCompactInput, types.CheckRUResponse]{
+		name: "check_ru",
+		validate: func(in types.CheckRUCompactInput, r *types.CheckRUResponse) error {
+			return r.ValidateAgainstRequest(in)
+		},
+		advice: "Используй только action_id и rule_id из COMPACT_INPUT, соблюдай limits и согласуй status с checked_actions: " +
+			"correct — без has_issue и error_groups, needs_fix — хотя бы одна ошибка.",
+		correct: func(in types.CheckRUCompactInput, c string) types.CheckRUCompactInput {
+			in.Correction = joinCorrection(in.Correction, c)
+			return in
+		},
+		exhausted: func(r *types.CheckRUResponse, _ error) error {
+			*r = types.ConservativeCheckRUResponse()
+			return nil
+		},
+	}, in, call)
+}
+
+// Analogue — ANALOGUE: проверок сверх схемы нет, повторяется только ответ,
+// JSON которого не удалось отремонтировать.
+func Analogue(ctx context.Context, attempts int, in types.AnalogueRequest, call Call[types.AnalogueRequest, types.AnalogueResponse]) (types.AnalogueResponse, *types.LLMStats, error) {
+	return run(ctx, attempts, step[types.AnalogueRequest, types.AnalogueResponse]{
+		name:     "analogue",
+		validate: func(types.AnalogueRequest, *types.AnalogueResponse) error { return nil },
+		correct: func(in types.AnalogueRequest, c string) types.AnalogueRequest {
+			in.Correction = joinCorrection(in.Correction, c)
+			return in
+		},
+		exhausted: func(_ *types.AnalogueResponse, err error) error { return err },
+	}, in, call)
+}
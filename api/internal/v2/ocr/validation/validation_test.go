@@ -0,0 +1,325 @@
+package validation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"llm-proxy/api/internal/v2/ocr/jsonrepair"
+	"llm-proxy/api/internal/v2/ocr/types"
+)
+
+// script отдаёт ответы по очереди (последний повторяется) и запоминает
+// корректировки каждого вызова.
+type script[Req, Resp any] struct {
+	outs        []Resp
+	errAt       int   // номер вызова с ошибкой, с 1; 0 — без ошибок
+	err         error // ошибка вызова errAt; nil — ошибка провайдера
+	correction  func(Req) string
+	corrections []string
+}
+
+func (s *script[Req, Resp]) call(_ context.Context, in Req) (Resp, *types.LLMStats, error) {
+	s.corrections = append(s.corrections, s.correction(in))
+	if len(s.corrections) == s.errAt {
+		var zero Resp
+		if s.err != nil {
+			return zero, &types.LLMStats{InputTokens: 10, JSONRepair: jsonrepair.ResultFailed}, s.err
+		}
+		return zero, nil, errors.New("boom")
+	}
+	out := s.outs[0]
+	if len(s.outs) > 1 {
+		s.outs = s.outs[1:]
+	}
+	return out, &types.LLMStats{InputTokens: 10, JSONRepair: jsonrepair.ResultClean}, nil
+}
+
+func hintScript(outs ...types.HintResponse) *script[types.HintRequest, types.HintResponse] {
+	return &script[types.HintRequest, types.HintResponse]{
+		outs:       outs,
+		correction: func(in types.HintRequest) string { return in.Correction },
+	}
+}
+
+// Вне математики подсказок быть не должно: непустой ответ не проходит проверку.
+var (
+	hintIn      = types.HintRequest{Task: types.ParseTask{Subject: "russian"}}
+	hintValid   = types.HintResponse{}
+	hintInvalid = types.HintResponse{Items: []types.HintItem{{ItemId: "1"}}}
+)
+
+func TestHint(t *testing.T) {
+	tests := []struct {
+		name      string
+		attempts  int
+		outs      []types.HintResponse
+		errAt     int
+		want      string
+		wantErr   bool
+		wantCalls int
+	}{
+		{"valid", 2, []types.HintResponse{hintValid}, 0, ResultValid, false, 1},
+		{"repaired", 2, []types.HintResponse{hintInvalid, hintValid}, 0, ResultRepaired, false, 2},
+		{"repaired on third attempt", 3, []types.HintResponse{hintInvalid, hintInvalid, hintValid}, 0, ResultRepaired, false, 3},
+		{"exhausted", 2, []types.HintResponse{hintInvalid}, 0, ResultFailed, true, 2},
+		{"single attempt", 1, []types.HintResponse{hintInvalid}, 0, ResultFailed, true, 1},
+		{"zero means default", 0, []types.HintResponse{hintInvalid}, 0, ResultFailed, true, DefaultAttempts},
+		{"retry error", 3, []types.HintResponse{hintInvalid}, 2, ResultFailed, true, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := hintScript(tt.outs...)
+			s.errAt = tt.errAt
+			_, stats, err := Hint(context.Background(), tt.attempts, hintIn, s.call)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Hint() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if stats.Validation != tt.want {
+				t.Errorf("Validation = %q, want %q", stats.Validation, tt.want)
+			}
+			if len(s.corrections) != tt.wantCalls {
+				t.Fatalf("calls = %d, want %d", len(s.corrections), tt.wantCalls)
+			}
+			if want := 10 * (tt.wantCalls - min(tt.errAt, 1)); stats.InputTokens != want {
+				t.Errorf("InputTokens = %d, want %d", stats.InputTokens, want)
+			}
+			if s.corrections[0] != "" {
+				t.Errorf("first call has correction %q", s.corrections[0])
+			}
+			for _, c := range s.corrections[1:] {
+				if !strings.Contains(c, "subject gate: expected empty hints") {
+					t.Errorf("correction %q lacks validator error", c)
+				}
+			}
+		})
+	}
+}
+
+func TestHintKeepsOuterCorrection(t *testing.T) {
+	s := hintScript(hintInvalid, hintValid)
+	in := hintIn
+	in.Correction = "без ответа"
+	if _, _, err := Hint(context.Background(), 2, in, s.call); err != nil {
+		t.Fatalf("Hint() error = %v", err)
+	}
+	if s.corrections[0] != "без ответа" || !strings.HasPrefix(s.corrections[1], "без ответа\n") {
+		t.Errorf("corrections = %q", s.corrections)
+	}
+}
+
+func TestHintCallError(t *testing.T) {
+	s := hintScript(hintValid)
+	s.errAt = 1
+	if _, _, err := Hint(context.Background(), 2, hintIn, s.call); err == nil || len(s.corrections) != 1 {
+		t.Fatalf("Hint() error = %v, calls = %d; want provider error without retry", err, len(s.corrections))
+	}
+}
+
+func TestMalformedJSONRetried(t *testing.T) {
+	malformed := fmt.Errorf("openai hint: bad JSON: %w", jsonrepair.ErrMalformed)
+	tests := []struct {
+		name       string
+		attempts   int
+		want       string
+		wantRepair string // итог разбора последней попытки
+		wantErr    bool
+	}{
+		{"repaired by retry", 2, ResultRepaired, jsonrepair.ResultClean, false},
+		{"single attempt", 1, ResultFailed, jsonrepair.ResultFailed, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := hintScript(hintValid)
+			s.errAt, s.err = 1, malformed
+			_, stats, err := Hint(context.Background(), tt.attempts, hintIn, s.call)
+			if (err != nil) != tt.wantErr || (err != nil && !errors.Is(err, jsonrepair.ErrMalformed)) {
+				t.Fatalf("Hint() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if stats.Validation != tt.want {
+				t.Errorf("Validation = %q, want %q", stats.Validation, tt.want)
+			}
+			if stats.JSONRepair != tt.wantRepair {
+				t.Errorf("JSONRepair = %q, want %q", stats.JSONRepair, tt.wantRepair)
+			}
+			if len(s.corrections) != tt.attempts {
+				t.Fatalf("calls = %d, want %d", len(s.corrections), tt.attempts)
+			}
+			if tt.attempts > 1 && !strings.Contains(s.corrections[1], "не удалось разобрать как JSON") {
+				t.Errorf("correction %q lacks JSON error", s.corrections[1])
+			}
+		})
+	}
+}
+
+func TestCheckMalformedExhausted(t *testing.T) {
+	confidence := 0.9
+	invalid := types.CheckResponse{CanEvaluate: true, Status: types.CheckStatusEvaluated, Decision: types.CheckDecisionCorrect, Confidence: &confidence}
+	tests := []struct {
+		name    string
+		errAt   int
+		wantErr bool
+	}{
+		{"no parsed response", 1, true},
+		{"invalid then malformed", 2, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &script[types.CheckRequest, types.CheckResponse]{
+				outs:       []types.CheckResponse{invalid},
+				errAt:      tt.errAt,
+				err:        jsonrepair.ErrMalformed,
+				correction: func(in types.CheckRequest) string { return in.Correction },
+			}
+			// Попыток столько, что последний вызов отдаёт неразбираемый JSON.
+			out, stats, err := Check(context.Background(), tt.errAt, types.CheckRequest{}, s.call)
+			if (err != nil) != tt.wantErr || (err != nil && !errors.Is(err, jsonrepair.ErrMalformed)) {
+				t.Fatalf("Check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if stats.Validation != ResultFailed {
+				t.Errorf("Validation = %q, want %q", stats.Validation, ResultFailed)
+			}
+			if !tt.wantErr && out.Decision != types.CheckDecisionCannotEvaluate {
+				t.Errorf("decision = %q, want conservative response", out.Decision)
+			}
+		})
+	}
+}
+
+func TestCheckExhaustedIsConservative(t *testing.T) {
+	confidence := 0.9
+	invalid := types.CheckResponse{CanEvaluate: true, Status: types.CheckStatusEvaluated, Decision: types.CheckDecisionCorrect, Confidence: &confidence}
+	s := &script[types.CheckRequest, types.CheckResponse]{
+		outs:       []types.CheckResponse{invalid},
+		correction: func(in types.CheckRequest) string { return in.Correction },
+	}
+	out, stats, err := Check(context.Background(), 2, types.CheckRequest{}, s.call)
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if stats.Validation != ResultFailed || out.CanEvaluate || out.Decision != types.CheckDecisionCannotEvaluate {
+		t.Errorf("got %q can_evaluate=%v decision=%q, want conservative response", stats.Validation, out.CanEvaluate, out.Decision)
+	}
+	if !strings.Contains(s.corrections[1], "expected_answer") {
+		t.Errorf("correction %q lacks validator error", s.corrections[1])
+	}
+}
+
+func TestParse(t *testing.T) {
+	item := func(final string) types.ParseResponse {
+		return types.ParseResponse{Items: []types.ParseItem{{
+			ItemId: "1",
+			SolutionInternal: types.SolutionInternal{
+				SolutionSteps: []string{"27444 + 32646 = 60090"},
+				FinalAnswer:   final,
+			},
+		}}}
+	}
+	tests := []struct {
+		name       string
+		outs       []types.ParseResponse
+		want       string
+		wantUnsafe bool
+	}{
+		{"valid", []types.ParseResponse{item("60090")}, ResultValid, false},
+		{"repaired", []types.ParseResponse{item("59844"), item("60090")}, ResultRepaired, false},
+		{"exhausted marks unsafe", []types.ParseResponse{item("59844")}, ResultFailed, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &script[types.ParseRequest, types.ParseResponse]{
+				outs:       tt.outs,
+				correction: func(in types.ParseRequest) string { return in.Correction },
+			}
+			out, stats, err := Parse(context.Background(), 2, types.ParseRequest{}, s.call)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if stats.Validation != tt.want {
+				t.Errorf("Validation = %q, want %q", stats.Validation, tt.want)
+			}
+			if got := out.Items[0].ItemQuality.UnsafeToFinalizeAnswer; got != tt.wantUnsafe {
+				t.Errorf("unsafe_to_finalize_answer = %v, want %v", got, tt.wantUnsafe)
+			}
+		})
+	}
+}
+
+func TestCheckRU(t *testing.T) {
+	in := types.CheckRUCompactInput{ActionsPayload: []types.RUCheckPayload{{ActionID: "a1"}}}
+	valid := types.CheckRUResponse{Status: "correct", CheckedActions: []types.RUCheckedAction{{ActionID: "a1", Result: "correct"}}}
+	invalid := types.CheckRUResponse{Status: "correct", CheckedActions: []types.RUCheckedAction{{ActionID: "a1", Result: "has_issue"}}}
+	tests := []struct {
+		name       string
+		outs       []types.CheckRUResponse
+		want       string
+		wantStatus string
+	}{
+		{"repaired", []types.CheckRUResponse{invalid, valid}, ResultRepaired, "correct"},
+		{"exhausted", []types.CheckRUResponse{invalid}, ResultFailed, "cannot_check"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &script[types.CheckRUCompactInput, types.CheckRUResponse]{
+				outs:       tt.outs,
+				correction: func(in types.CheckRUCompactInput) string { return in.Correction },
+			}
+			out, stats, err := CheckRU(context.Background(), 2, in, s.call)
+			if err != nil {
+				t.Fatalf("CheckRU() error = %v", err)
+			}
+			if stats.Validation != tt.want || out.Status != tt.wantStatus {
+				t.Errorf("got %q status=%q, want %q status=%q", stats.Validation, out.Status, tt.want, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestParseRUAndHintRUExhaustedFail(t *testing.T) {
+	pr := &script[types.ParseRURequest, types.ParseRUResponse]{
+		outs:       []types.ParseRUResponse{{ActionPlan: types.RUActionPlan{Actions: []types.RUAction{{ActionID: ""}}}}},
+		correction: func(in types.ParseRURequest) string { return in.Correction },
+	}
+	if _, stats, err := ParseRU(context.Background(), 2, types.ParseRURequest{}, pr.call); err == nil || stats.Validation != ResultFailed {
+		t.Errorf("ParseRU() error = %v, validation = %q; want failure", err, stats.Validation)
+	}
+	hr := &script[types.HintRUCompactInput, types.HintRUResponse]{
+		outs:       []types.HintRUResponse{{Status: "ready"}},
+		correction: func(in types.HintRUCompactInput) string { return in.Correction },
+	}
+	if _, stats, err := HintRU(context.Background(), 2, types.HintRUCompactInput{}, hr.call); err == nil || stats.Validation != ResultFailed {
+		t.Errorf("HintRU() error = %v, validation = %q; want failure", err, stats.Validation)
+	}
+}
+
+func TestDetectAndAnalogueRetryMalformedJSON(t *testing.T) {
+	malformed := fmt.Errorf("bad JSON: %w", jsonrepair.ErrMalformed)
+	ds := &script[types.DetectRequest, types.DetectResponse]{
+		outs:       []types.DetectResponse{{SchemaVersion: "2.2.2"}},
+		errAt:      1,
+		err:        malformed,
+		correction: func(in types.DetectRequest) string { return in.Correction },
+	}
+	out, stats, err := Detect(context.Background(), 2, types.DetectRequest{}, ds.call)
+	if err != nil || out.SchemaVersion != "2.2.2" || stats.JSONRepair != jsonrepair.ResultClean {
+		t.Errorf("Detect() = %+v, %+v, %v; want retried response", out, stats, err)
+	}
+	if len(ds.corrections) != 2 || !strings.Contains(ds.corrections[1], "не удалось разобрать как JSON") {
+		t.Errorf("Detect corrections = %q, want JSON correction on retry", ds.corrections)
+	}
+
+	for _, attempts := range []int{1, 2} {
+		as := &script[types.AnalogueRequest, types.AnalogueResponse]{
+			outs:       []types.AnalogueResponse{{}},
+			errAt:      1,
+			err:        malformed,
+			correction: func(in types.AnalogueRequest) string { return in.Correction },
+		}
+		_, _, err := Analogue(context.Background(), attempts, types.AnalogueRequest{}, as.call)
+		if wantErr := attempts == 1; (err != nil) != wantErr || len(as.corrections) != attempts {
+			t.Errorf("Analogue(attempts=%d) error = %v, calls = %d", attempts, err, len(as.corrections))
+		}
+	}
+}
@@ -0,0 +1,207 @@
+// Package verify добавляет к CheckSolution этап второго мнения: если
+// уверенность вердикта ниже порога или задача повышенного риска (логика,
+// закономерности), другая модель получает первый вердикт, эталон и визуальные
+// наблюдения и подтверждает или оспаривает их. Итоговое решение при споре
+// определяется правилом из конфига.
+package verify
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"llm-proxy/api/internal/v2/ocr"
+	"llm-proxy/api/internal/v2/ocr/types"
+)
+
+// PromptBlock — имя этапа в PromptBlocks статистики.
+const PromptBlock = "check.verify"
+
+// FailureReasonDispute — failure_reason, когда спор разрешён в cannot_evaluate.
+const FailureReasonDispute = "verifier_dispute"
+
+// Причины запуска верификатора.
+const (
+	TriggerLowConfidence = "low_confidence"
+	TriggerHighRisk      = "high_risk"
+)
+
+// Resolution — кто определяет итог, если верификатор оспорил вердикт.
+type Resolution string
+
+const (
+	ResolvePrimary        Resolution = "primary"         // оставить первый вердикт
+	ResolveVerifier       Resolution = "verifier"        // взять решение верификатора
+	ResolveCannotEvaluate Resolution = "cannot_evaluate" // не показывать спорный вердикт
+)
+
+// ParseResolution разбирает правило; пустая строка — cannot_evaluate.
+func ParseResolution(s string) (Resolution, error) {
+	switch r := Resolution(strings.ToLower(strings.TrimSpace(s))); r {
+	case "":
+		return ResolveCannotEvaluate, nil
+	case ResolvePrimary, ResolveVerifier, ResolveCannotEvaluate:
+		return r, nil
+	default:
+		return "", fmt.Errorf("unknown dispute resolution %q; use primary, verifier or cannot_evaluate", s)
+	}
+}
+
+// Verifier — движок, умеющий дать второе мнение по вердикту CHECK.
+type Verifier interface {
+	Name() string
+	VerifyCheck(ctx context.Context, in types.CheckVerifyRequest) (types.CheckVerifyResponse, *types.LLMStats, error)
+}
+
+// Options — правила запуска и разрешения спора.
+type Options struct {
+	ConfidenceThreshold float64    // верифицировать при confidence ниже порога
+	HighRisk            bool       // всегда верифицировать задачи повышенного риска
+	OnDispute           Resolution // итог при споре
+}
+
+// Engine — декоратор основного движка; остальные шаги делегируются как есть.
+type Engine struct {
+	ocr.Engine
+	verifier Verifier
+	opts     Options
+}
+
+func New(primary ocr.Engine, verifier Verifier, opts Options) *Engine {
+	if opts.OnDispute == "" {
+		opts.OnDispute = ResolveCannotEvaluate
+	}
+	return &Engine{Engine: primary, verifier: verifier, opts: opts}
+}
+
+// trigger возвращает причину верификации или "", если она не нужна.
+func (e *Engine) trigger(in types.CheckRequest, out types.CheckResponse) string {
+	if !out.CanEvaluate || (out.Decision != types.CheckDecisionCorrect && out.Decision != types.CheckDecisionIncorrect) {
+		return ""
+	}
+	if e.opts.HighRisk && len(in.TaskStruct.Items) > 0 && types.IsHighRiskTask(in.TaskStruct.Items[0]) {
+		return TriggerHighRisk
+	}
+	if out.Confidence == nil || *out.Confidence < e.opts.ConfidenceThreshold {
+		return TriggerLowConfidence
+	}
+	return ""
+}
+
+func (e *Engine) CheckSolution(ctx context.Context, in types.CheckRequest) (types.CheckResponse, *types.LLMStats, error) {
+	out, stats, err := e.Engine.CheckSolution(ctx, in)
+	if err != nil {
+		return out, stats, err
+	}
+	trigger := e.trigger(in, out)
+	if trigger == "" {
+		return out, stats, nil
+	}
+
+	vr, vstats, verr := e.verifier.VerifyCheck(ctx, types.NewCheckVerifyRequest(in, out))
+	if stats == nil {
+		stats = &types.LLMStats{}
+	}
+	stats.Add(vstats)
+	stats.PromptBlocks = appendBlock(stats.PromptBlocks, PromptBlock)
+
+	trace := &types.CheckVerification{Model: e.verifier.Name(), Trigger: trigger}
+	if vstats != nil && vstats.Model != "" {
+		trace.Model = vstats.Model
+	}
+	if verr != nil {
+		// Сбой второго мнения не должен ломать проверку: оставляем первый вердикт.
+		log.Printf("[verify] check verifier failed: %v", verr)
+		trace.Error = verr.Error()
+		trace.Resolution = string(ResolvePrimary)
+		return withTrace(out, trace), stats, nil
+	}
+	trace.Verdict = vr.Verdict
+	trace.Decision = vr.Decision
+	trace.Reason = vr.Reason
+
+	resolved, resolution := resolve(in, out, vr, e.opts.OnDispute)
+	trace.Resolution = string(resolution)
+	if resolution != ResolvePrimary {
+		log.Printf("[verify] verdict disputed (%s → %s), resolved by %s", out.Decision, vr.Decision, resolution)
+	}
+	return withTrace(resolved, trace), stats, nil
+}
+
+// resolve применяет правило разрешения спора и возвращает итог и фактическое правило.
+func resolve(in types.CheckRequest, first types.CheckResponse, vr types.CheckVerifyResponse, rule Resolution) (types.CheckResponse, Resolution) {
+	disputed := vr.Verdict == types.CheckVerifyDispute || vr.Decision != first.Decision
+	if !disputed {
+		if first.Confidence != nil && vr.Confidence > *first.Confidence {
+			c := vr.Confidence
+			first.Confidence = &c
+		}
+		return first, ResolvePrimary
+	}
+	switch rule {
+	case ResolvePrimary:
+		return first, ResolvePrimary
+	case ResolveVerifier:
+		if out, ok := verifierResponse(in, first, vr); ok {
+			return out, ResolveVerifier
+		}
+	}
+	out := types.ConservativeCheckResponse()
+	reason := FailureReasonDispute
+	out.FailureReason = &reason
+	out.Feedback = "Не удалось уверенно проверить решение. Попробуй сфотографировать его ещё раз."
+	out.SetIsCorrectFromDecision()
+	return out, ResolveCannotEvaluate
+}
+
+// verifierResponse строит ответ на решении верификатора. Если он сам не
+// может проверить или итог не проходит семантическую валидацию — false.
+func verifierResponse(in types.CheckRequest, first types.CheckResponse, vr types.CheckVerifyResponse) (types.CheckResponse, bool) {
+	if vr.Decision != types.CheckDecisionCorrect && vr.Decision != types.CheckDecisionIncorrect {
+		return types.CheckResponse{}, false
+	}
+	out := first
+	out.Decision = vr.Decision
+	out.SetIsCorrectFromDecision()
+	c := vr.Confidence
+	out.Confidence = &c
+	if strings.TrimSpace(vr.Feedback) != "" {
+		out.Feedback = vr.Feedback
+	}
+	if vr.Decision == types.CheckDecisionCorrect {
+		out.ErrorSpans = []types.ErrorSpan{}
+		out.ErrorDetails = nil
+	}
+	debug := types.CheckDebug{}
+	if first.Debug != nil {
+		debug = *first.Debug
+	}
+	expected := vr.ExpectedAnswer
+	debug.ExpectedAnswer = &expected
+	reason := "independent_verification: second opinion — " + vr.Reason
+	debug.DecisionReason = &reason
+	out.Debug = &debug
+	if err := out.ValidateSemantics(in); err != nil {
+		log.Printf("[verify] verifier decision rejected: %v", err)
+		return types.CheckResponse{}, false
+	}
+	return out, true
+}
+
+func withTrace(out types.CheckResponse, trace *types.CheckVerification) types.CheckResponse {
+	debug := types.CheckDebug{}
+	if out.Debug != nil {
+		debug = *out.Debug
+	}
+	debug.Verification = trace
+	out.Debug = &debug
+	return out
+}
+
+func appendBlock(blocks, block string) string {
+	if blocks == "" {
+		return block
+	}
+	return blocks + "," + block
+}
@@ -0,0 +1,147 @@
+package verify
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"llm-proxy/api/internal/v2/ocr/fake"
+	"llm-proxy/api/internal/v2/ocr/types"
+)
+
+// stubVerifier возвращает заранее заданный ответ и считает вызовы.
+type stubVerifier struct {
+	resp  types.CheckVerifyResponse
+	err   error
+	calls int
+	got   types.CheckVerifyRequest
+}
+
+func (v *stubVerifier) Name() string { return "verifier" }
+
+func (v *stubVerifier) VerifyCheck(_ context.Context, in types.CheckVerifyRequest) (types.CheckVerifyResponse, *types.LLMStats, error) {
+	v.calls++
+	v.got = in
+	return v.resp, &types.LLMStats{Model: "verifier/model", CostUSD: 0.02, InputTokens: 10}, v.err
+}
+
+// primary — фейковый движок с фиксированным сценарием проверки.
+type primary struct {
+	*fake.Engine
+	sc fake.Scenario
+}
+
+func (p primary) CheckSolution(ctx context.Context, in types.CheckRequest) (types.CheckResponse, *types.LLMStats, error) {
+	return p.Engine.CheckSolution(fake.WithScenario(ctx, p.sc), in)
+}
+
+func request(taskType string) types.CheckRequest {
+	answer := any("12")
+	return types.CheckRequest{TaskStruct: types.TaskStructCheck{Items: []types.ParseItem{{
+		PedKeys:          types.PedKeys{TaskType: taskType},
+		SolutionInternal: types.SolutionInternal{FinalAnswer: answer},
+	}}}}
+}
+
+func TestVerify_Triggers(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      Options
+		taskType  string
+		wantCalls int
+		trigger   string
+	}{
+		{"confident arithmetic skipped", Options{ConfidenceThreshold: 0.7, HighRisk: true}, "arithmetic", 0, ""},
+		{"low confidence", Options{ConfidenceThreshold: 0.99}, "arithmetic", 1, TriggerLowConfidence},
+		{"high risk logic", Options{ConfidenceThreshold: 0.7, HighRisk: true}, types.TaskTypeLogic, 1, TriggerHighRisk},
+		{"high risk disabled", Options{ConfidenceThreshold: 0.7}, types.TaskTypeLogic, 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := &stubVerifier{resp: types.CheckVerifyResponse{Verdict: types.CheckVerifyConfirm, Decision: types.CheckDecisionCorrect, Confidence: 0.99}}
+			e := New(primary{Engine: fake.New(fake.Options{}), sc: fake.ScenarioOK}, v, tt.opts)
+			out, stats, err := e.CheckSolution(context.Background(), request(tt.taskType))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v.calls != tt.wantCalls {
+				t.Fatalf("verifier calls = %d, want %d", v.calls, tt.wantCalls)
+			}
+			if tt.wantCalls == 0 {
+				if out.Debug.Verification != nil || strings.Contains(stats.PromptBlocks, PromptBlock) {
+					t.Errorf("unexpected verification trace: %+v / %q", out.Debug.Verification, stats.PromptBlocks)
+				}
+				return
+			}
+			tr := out.Debug.Verification
+			if tr == nil || tr.Trigger != tt.trigger || tr.Resolution != string(ResolvePrimary) || tr.Model != "verifier/model" {
+				t.Fatalf("trace = %+v", tr)
+			}
+			if out.Decision != types.CheckDecisionCorrect || *out.Confidence != 0.99 {
+				t.Errorf("confirmed verdict: %s / %v", out.Decision, *out.Confidence)
+			}
+			if !strings.Contains(stats.PromptBlocks, PromptBlock) || stats.CostUSD != 0.02 {
+				t.Errorf("stats = %+v", stats)
+			}
+			if v.got.ExpectedAnswer == nil || *v.got.ExpectedAnswer != "12" || len(v.got.VisualEvidence) == 0 {
+				t.Errorf("verifier input = %+v", v.got)
+			}
+		})
+	}
+}
+
+func TestVerify_DisputeResolution(t *testing.T) {
+	// Первый вердикт: ответ 13 неверен (эталон 12). Верификатор считает эталоном 13.
+	dispute := types.CheckVerifyResponse{
+		Verdict: types.CheckVerifyDispute, Decision: types.CheckDecisionCorrect,
+		ExpectedAnswer: "13", Confidence: 0.9, Reason: "эталон пересчитан", Feedback: "Всё верно!",
+	}
+	tests := []struct {
+		rule     Resolution
+		decision types.CheckDecision
+	}{
+		{ResolvePrimary, types.CheckDecisionIncorrect},
+		{ResolveVerifier, types.CheckDecisionCorrect},
+		{ResolveCannotEvaluate, types.CheckDecisionCannotEvaluate},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.rule), func(t *testing.T) {
+			v := &stubVerifier{resp: dispute}
+			e := New(primary{Engine: fake.New(fake.Options{}), sc: fake.ScenarioIncorrect}, v,
+				Options{ConfidenceThreshold: 1, OnDispute: tt.rule})
+			in := request("arithmetic")
+			out, _, err := e.CheckSolution(context.Background(), in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out.Decision != tt.decision || out.Debug.Verification.Resolution != string(tt.rule) {
+				t.Fatalf("decision = %s, trace = %+v", out.Decision, out.Debug.Verification)
+			}
+			if err := out.ValidateSemantics(in); err != nil {
+				t.Errorf("resolved response invalid: %v", err)
+			}
+		})
+	}
+}
+
+func TestVerify_VerifierErrorKeepsPrimary(t *testing.T) {
+	v := &stubVerifier{err: errors.New("boom")}
+	e := New(primary{Engine: fake.New(fake.Options{}), sc: fake.ScenarioOK}, v, Options{ConfidenceThreshold: 1})
+	out, _, err := e.CheckSolution(context.Background(), request("arithmetic"))
+	if err != nil || out.Decision != types.CheckDecisionCorrect {
+		t.Fatalf("decision = %s, err = %v", out.Decision, err)
+	}
+	if out.Debug.Verification.Error == "" {
+		t.Errorf("trace must carry verifier error: %+v", out.Debug.Verification)
+	}
+}
+
+func TestParseResolution(t *testing.T) {
+	if r, err := ParseResolution(""); err != nil || r != ResolveCannotEvaluate {
+		t.Fatalf("default = %s, %v", r, err)
+	}
+	if _, err := ParseResolution("coin_flip"); err == nil {
+		t.Error("unknown rule must be rejected")
+	}
+}
@@ -0,0 +1,75 @@
+// Package pricing считает стоимость LLM-вызова по прайс-листу провайдеров.
+//
+// Нужен движкам, которые не получают стоимость в ответе API (OpenAI, Gemini):
+// OpenRouter возвращает usage.cost сам. Цены указаны в USD за 1M токенов;
+// закэшированные входные токены тарифицируются по сниженной ставке CachedInput.
+// Плата за хранение кэша Gemini (за час) здесь не учитывается.
+package pricing
+
+import (
+	"sort"
+	"strings"
+)
+
+// Price — тариф модели в USD за 1M токенов.
+type Price struct {
+	Input       float64
+	CachedInput float64
+	Output      float64
+}
+
+// table — публичные цены провайдеров. Ключ — префикс имени модели:
+// датированные снапшоты (gpt-4.1-mini-2025-04-14) находят базовую модель.
+var table = map[string]Price{
+	"gpt-4.1":               {Input: 2.00, CachedInput: 0.50, Output: 8.00},
+	"gpt-4.1-mini":          {Input: 0.40, CachedInput: 0.10, Output: 1.60},
+	"gpt-4.1-nano":          {Input: 0.10, CachedInput: 0.025, Output: 0.40},
+	"gpt-4o":                {Input: 2.50, CachedInput: 1.25, Output: 10.00},
+	"gpt-4o-mini":           {Input: 0.15, CachedInput: 0.075, Output: 0.60},
+	"gpt-5":                 {Input: 1.25, CachedInput: 0.125, Output: 10.00},
+	"gpt-5-mini":            {Input: 0.25, CachedInput: 0.025, Output: 2.00},
+	"gpt-5-nano":            {Input: 0.05, CachedInput: 0.005, Output: 0.40},
+	"gemini-2.0-flash":      {Input: 0.10, CachedInput: 0.025, Output: 0.40},
+	"gemini-2.0-flash-lite": {Input: 0.075, CachedInput: 0.075, Output: 0.30},
+	"gemini-2.5-flash":      {Input: 0.30, CachedInput: 0.075, Output: 2.50},
+	"gemini-2.5-flash-lite": {Input: 0.10, CachedInput: 0.025, Output: 0.40},
+	"gemini-2.5-pro":        {Input: 1.25, CachedInput: 0.31, Output: 10.00},
+}
+
+// prefixes — ключи table от длинных к коротким, чтобы gpt-4.1-mini
+// не совпал с gpt-4.1.
+var prefixes = func() []string {
+	keys := make([]string, 0, len(table))
+	for k := range table {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return len(keys[i]) > len(keys[j]) })
+	return keys
+}()
+
+// Lookup возвращает тариф модели. Префикс провайдера (openai/, google/) отбрасывается.
+func Lookup(model string) (Price, bool) {
+	m := strings.ToLower(strings.TrimSpace(model))
+	if i := strings.LastIndex(m, "/"); i >= 0 {
+		m = m[i+1:]
+	}
+	for _, p := range prefixes {
+		if strings.HasPrefix(m, p) {
+			return table[p], true
+		}
+	}
+	return Price{}, false
+}
+
+// Cost возвращает стоимость вызова в USD. cachedTokens входят в inputTokens
+// (так их отдают OpenAI и Gemini) и оплачиваются по CachedInput.
+// Для неизвестной модели возвращает 0 — заголовок X-LLM-Cost-USD не пишется.
+func Cost(model string, inputTokens, cachedTokens, outputTokens int) float64 {
+	p, ok := Lookup(model)
+	if !ok {
+		return 0
+	}
+	cached := min(max(cachedTokens, 0), inputTokens)
+	uncached := inputTokens - cached
+	return (float64(uncached)*p.Input + float64(cached)*p.CachedInput + float64(outputTokens)*p.Output) / 1e6
+}
@@ -0,0 +1,32 @@
+package pricing
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCost(t *testing.T) {
+	tests := []struct {
+		name                 string
+		model                string
+		input, cached, outTk int
+		want                 float64
+	}{
+		{"no cache", "gpt-4.1-mini", 1_000_000, 0, 0, 0.40},
+		{"fully cached", "gpt-4.1-mini", 1_000_000, 1_000_000, 0, 0.10},
+		{"mixed with output", "gpt-4.1-mini", 10_000, 6_000, 1_000, (4_000*0.40 + 6_000*0.10 + 1_000*1.60) / 1e6},
+		{"dated snapshot uses longest prefix", "gpt-4.1-mini-2025-04-14", 1_000_000, 0, 0, 0.40},
+		{"base model not shadowed", "gpt-4.1", 1_000_000, 0, 0, 2.00},
+		{"provider prefix stripped", "google/gemini-2.5-flash", 0, 0, 1_000_000, 2.50},
+		{"cached clamped to input", "gemini-2.5-flash", 100, 500, 0, 100 * 0.075 / 1e6},
+		{"unknown model", "some/unknown", 1_000_000, 0, 1_000_000, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Cost(tt.model, tt.input, tt.cached, tt.outTk)
+			if math.Abs(got-tt.want) > 1e-12 {
+				t.Errorf("Cost(%q, %d, %d, %d) = %v, want %v", tt.model, tt.input, tt.cached, tt.outTk, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,9 @@
+package prompt
+
+import _ "embed"
+
+// Readability — пороги читаемости подсказок и feedback по классам (ключ —
+// подкаталог класса "1_class"…"4_class"), встраивается в бинарник.
+//
+//go:embed readability.json
+var Readability string
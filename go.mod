@@ -4,6 +4,8 @@ go 1.26
 
 require (
 	github.com/google/generative-ai-go v0.20.1
+	github.com/klauspost/compress v1.18.0
+	golang.org/x/image v0.25.0
 	google.golang.org/api v0.252.0
 )
 